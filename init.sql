@@ -12,28 +12,330 @@
 
 CREATE TABLE IF NOT EXISTS CODES (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    code TEXT NOT NULL
+    code TEXT,
+    -- code when stored zstd-compressed (COMPRESS_ABOVE_BYTES), code is then NULL
+    code_zstd BYTEA,
+    -- Large code lives in object storage, see CODE_STORE
+    object_uri TEXT,
+    sha256 TEXT,
+    json_schema JSONB,
+    -- Format of the result the code writes to stdout (json, msgpack, protobuf)
+    -- and its schema reference (the protobuf message); NULL for free-form text
+    result_format TEXT,
+    result_schema TEXT,
+    -- Version run by tasks asking for the latest; the row itself is version 1
+    current_version INT NOT NULL DEFAULT 1 CHECK (current_version >= 1),
+    -- Python run once per sandbox container and virtualenv before the code's
+    -- tasks, see PUT /codes/{id}/warmup; it applies to every version
+    warmup TEXT,
+    CHECK (code IS NOT NULL OR code_zstd IS NOT NULL OR object_uri IS NOT NULL)
+);
+
+-- Versions 2 and up of a code, published through POST /codes/{id}/versions.
+-- Like CODES rows, they are immutable once written.
+CREATE TABLE IF NOT EXISTS CODE_VERSIONS (
+    code_id UUID NOT NULL REFERENCES CODES(id),
+    version INT NOT NULL CHECK (version >= 2),
+    code TEXT,
+    code_zstd BYTEA,
+    object_uri TEXT,
+    sha256 TEXT,
+    json_schema JSONB,
+    result_format TEXT,
+    result_schema TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (code_id, version),
+    CHECK (code IS NOT NULL OR code_zstd IS NOT NULL OR object_uri IS NOT NULL)
+);
+
+-- Every version of every code, version 1 being the CODES row
+CREATE OR REPLACE VIEW CODE_CONTENTS AS
+    SELECT id AS code_id, 1 AS version, code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema FROM CODES
+    UNION ALL
+    SELECT code_id, version, code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema FROM CODE_VERSIONS;
+
+-- Workload classes: defaults inherited by their tasks unless a task sets its own.
+-- isolation and network can only tighten the worker's sandbox.
+CREATE TABLE IF NOT EXISTS QUEUES (
+    name TEXT PRIMARY KEY,
+    description TEXT,
+    timeout_seconds DOUBLE PRECISION CHECK (timeout_seconds > 0),
+    memory_mb BIGINT CHECK (memory_mb > 0),
+    cpu_limit DOUBLE PRECISION CHECK (cpu_limit > 0),
+    retry_policy JSONB,
+    isolation TEXT CHECK (isolation IN ('default', 'strict')),
+    network TEXT CHECK (network IN ('sandbox', 'none', 'allowlist')),
+    -- Hosts reachable through the egress proxy with the allowlist network
+    egress_allowlist TEXT[],
+    -- Heartbeat gap of a worker after which its tasks of the queue are
+    -- recovered, WORKER_STALE_AFTER when NULL
+    stale_after_seconds DOUBLE PRECISION CHECK (stale_after_seconds > 0),
+    -- Network limit of the sandbox each way in kbit/s, CONTAINER_BANDWIDTH_KBPS when NULL
+    bandwidth_kbps BIGINT CHECK (bandwidth_kbps > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Tasks submitted together through POST /batches, followed as one
+CREATE TABLE IF NOT EXISTS BATCHES (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT,
+    tenant_id TEXT,
+    -- Receives a batch.finished event once every task of the batch is final
+    webhook_url TEXT,
+    total INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- When the last task of the batch reached a final status
+    finished_at TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS TASKS (
     id SERIAL PRIMARY KEY,
     name TEXT NOT NULL,
     description TEXT,
+    -- Submission time, the arrival of the task in capacity reports
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     started TIMESTAMP,
     finished TIMESTAMP,
     locked_at TIMESTAMP,
     last_error TEXT,
     priority INT DEFAULT 0,
-    status VARCHAR(50) DEFAULT 'pending',
+    -- The status taxonomy of model.Statuses; migrations/001_task_status_taxonomy.sql
+    -- brings older databases to it
+    status VARCHAR(50) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled', 'malicious', 'abandoned', 'held')),
     payload JSONB,
     code UUID REFERENCES CODES(id),
     worker_id TEXT,
-    output TEXT
+    output TEXT,
+    depends_on INT[] DEFAULT '{}',
+    tenant_id TEXT,
+    python_version TEXT,
+    interpreter_version TEXT,
+    cpu_seconds DOUBLE PRECISION,
+    peak_memory_bytes BIGINT,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 3,
+    first_started_at TIMESTAMP,
+    policy_version TEXT,
+    retry_policy JSONB,
+    deadline TIMESTAMP,
+    webhook_url TEXT,
+    -- Key/value annotations the script attached to its own task
+    annotations JSONB,
+    exit_code INT,
+    -- Machine-readable failure class of model.ErrorCodes; NULL on success.
+    -- migrations/002_task_error_codes.sql adds it to older databases
+    error_code VARCHAR(32) CHECK (error_code ~ '^E_[A-Z_]+$'),
+    -- payload and output when stored zstd-compressed (COMPRESS_ABOVE_BYTES),
+    -- the plain column is then NULL
+    payload_zstd BYTEA,
+    output_zstd BYTEA,
+    -- Not claimed before this time: scheduled by the submitter or requeued by a rate limit
+    run_at TIMESTAMP,
+    -- Queue whose defaults apply, and the task's own overrides of them
+    queue TEXT REFERENCES QUEUES(name),
+    timeout_seconds DOUBLE PRECISION CHECK (timeout_seconds > 0),
+    memory_mb BIGINT CHECK (memory_mb > 0),
+    cpu_limit DOUBLE PRECISION CHECK (cpu_limit > 0),
+    isolation TEXT CHECK (isolation IN ('default', 'strict')),
+    network TEXT CHECK (network IN ('sandbox', 'none', 'allowlist')),
+    egress_allowlist TEXT[],
+    bandwidth_kbps BIGINT CHECK (bandwidth_kbps > 0),
+    -- Only claimed by workers with CONTAINER_GPU=all
+    gpu_required BOOLEAN NOT NULL DEFAULT FALSE,
+    -- Script environment over the worker standard (SANDBOX_TZ, SANDBOX_LOCALE, SANDBOX_EXEC_ULIMITS)
+    timezone TEXT,
+    locale TEXT,
+    ulimits TEXT[],
+    stale_after_seconds DOUBLE PRECISION CHECK (stale_after_seconds > 0),
+    -- 'analyze' tasks are only analyzed, the verdict becomes their output
+    task_type TEXT NOT NULL DEFAULT 'execute' CHECK (task_type IN ('execute', 'analyze')),
+    -- Version of the code pinned on submission, or the latest one recorded when claimed
+    code_version INT,
+    -- Result of a code declaring a result_format, as normalized JSON, and the
+    -- raw bytes of binary formats (the output then holds the JSON)
+    result JSONB,
+    result_raw BYTEA,
+    -- Batch the task was submitted with, if any
+    batch_id UUID REFERENCES BATCHES(id),
+    -- Region whose workers claim the task first; others only after CROSS_REGION_WAIT
+    preferred_region TEXT,
+    -- Execution receipt signed by the worker that completed the task, when
+    -- RECEIPT_SIGNING_KEY is set
+    receipt JSONB
+);
+
+-- Worker liveness: each worker upserts its heartbeat every few seconds
+CREATE TABLE IF NOT EXISTS WORKERS (
+    id TEXT PRIMARY KEY,
+    instance_id TEXT,
+    hostname TEXT,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_heartbeat TIMESTAMP NOT NULL DEFAULT NOW(),
+    status VARCHAR(50) NOT NULL DEFAULT 'active',
+    -- WORKER_REGION of the worker, NULL when unset
+    region TEXT,
+    -- Fleet configuration the worker reconciled to, and its compliance
+    config_version TEXT,
+    config_status VARCHAR(50) CHECK (config_status IN ('compliant', 'drifted', 'error')),
+    config_detail TEXT,
+    config_checked_at TIMESTAMP
+);
+
+-- Sandbox image pulls per Docker daemon, so one worker of the fleet pulls each
+-- image while the others wait for it or import it from a peer
+CREATE TABLE IF NOT EXISTS IMAGE_PULLS (
+    image TEXT NOT NULL,
+    daemon_id TEXT NOT NULL,
+    worker_id TEXT NOT NULL,
+    status VARCHAR(50) NOT NULL CHECK (status IN ('pulling', 'ready', 'failed')),
+    image_id TEXT,
+    peer_url TEXT,
+    error TEXT,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (image, daemon_id)
+);
+
+-- Versions of the fleet configuration; workers with FLEET_CONFIG_SOURCE=db
+-- reconcile to the latest one
+CREATE TABLE IF NOT EXISTS FLEET_CONFIG (
+    version TEXT PRIMARY KEY,
+    document JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Execution attempt history, used to tell poison tasks from broken nodes
+CREATE TABLE IF NOT EXISTS TASK_ATTEMPTS (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    worker_id TEXT,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    outcome VARCHAR(50) NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX idx_task_attempts_task ON TASK_ATTEMPTS(task_id);
+CREATE INDEX idx_task_attempts_finished ON TASK_ATTEMPTS(finished_at);
+
+-- Outbound requests of allowlist tasks through the egress proxy, for audit.
+-- A CONNECT tunnel or redirected TLS connection is one row.
+CREATE TABLE IF NOT EXISTS TASK_NETWORK_LOG (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    worker_id TEXT,
+    method TEXT NOT NULL,
+    host TEXT NOT NULL,
+    port INT NOT NULL,
+    url TEXT,
+    decision VARCHAR(50) NOT NULL CHECK (decision IN ('allowed', 'denied', 'blocked', 'failed')),
+    status INT,
+    bytes_sent BIGINT NOT NULL DEFAULT 0,
+    bytes_received BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    requested_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    duration_seconds DOUBLE PRECISION
+);
+
+CREATE INDEX idx_task_network_log_task ON TASK_NETWORK_LOG(task_id);
+
+-- Pairs of attempts that broke at-most-once execution, found by the duplicate detector
+CREATE TABLE IF NOT EXISTS DUPLICATE_EXECUTIONS (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    first_attempt BIGINT NOT NULL,
+    second_attempt BIGINT NOT NULL,
+    first_worker TEXT,
+    second_worker TEXT,
+    detected_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (first_attempt, second_attempt)
+);
+
+-- Token buckets of the code and tenant rate limits, shared by all workers.
+-- Insert a row with per_minute to override the limit of one code or tenant.
+CREATE TABLE IF NOT EXISTS RATE_LIMITS (
+    scope VARCHAR(50) NOT NULL CHECK (scope IN ('code', 'tenant')),
+    key TEXT NOT NULL,
+    per_minute INT,
+    tokens DOUBLE PRECISION,
+    refilled_at TIMESTAMP,
+    PRIMARY KEY (scope, key)
+);
+
+-- Signed artifact download URLs issued by the API, for auditing
+CREATE TABLE IF NOT EXISTS SIGNED_URLS (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    requester TEXT,
+    issued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_signed_urls_task ON SIGNED_URLS(task_id);
+
+-- Rich outputs (images, HTML, tables...) emitted by scripts via the display protocol
+CREATE TABLE IF NOT EXISTS TASK_OUTPUTS (
+    id SERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    seq INT NOT NULL,
+    mime_type TEXT NOT NULL,
+    name TEXT,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (task_id, seq)
+);
+
+-- Files scripts wrote to /outputs, stored in the configured artifact store
+CREATE TABLE IF NOT EXISTS TASK_ARTIFACTS (
+    id SERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    content_type TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    uri TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (task_id, path)
 );
 
 -- INDEX for Task table for fast retrieval of pending tasks
 CREATE INDEX idx_tasks_status_priority ON TASKS(status, priority);
 
+-- INDEX for the deadline-first claim strategy
+CREATE INDEX idx_tasks_pending_deadline ON TASKS(deadline) WHERE status = 'pending';
+
+-- INDEX for finding the next scheduled task, see NextScheduled
+CREATE INDEX idx_tasks_pending_run_at ON TASKS(run_at) WHERE status = 'pending';
+
+-- INDEX for the queue filter of the task listing and /queues
+CREATE INDEX idx_tasks_queue ON TASKS(queue);
+
+-- INDEX for finding tasks whose retention TTL expired
+CREATE INDEX idx_tasks_finished ON TASKS(finished);
+
+-- INDEX for the submission window of capacity reports
+CREATE INDEX idx_tasks_created ON TASKS(created_at);
+
+-- INDEX for the progress of a batch
+CREATE INDEX idx_tasks_batch ON TASKS(batch_id) WHERE batch_id IS NOT NULL;
+
+-- Expired tasks moved out of TASKS by the retention job, with their attempts,
+-- rich outputs and artifact records
+CREATE TABLE IF NOT EXISTS TASKS_ARCHIVE (
+    id INT PRIMARY KEY,
+    status VARCHAR(50) NOT NULL CHECK (status IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned')),
+    finished TIMESTAMP,
+    archived_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    task JSONB NOT NULL
+);
+
+CREATE INDEX idx_tasks_archive_finished ON TASKS_ARCHIVE(finished);
+
+-- INDEX for dependency lookups when cascading failures to dependents
+CREATE INDEX idx_tasks_depends_on ON TASKS USING GIN (depends_on);
+
 -- Notification function
 CREATE OR REPLACE FUNCTION notify_task_change()
 RETURNS TRIGGER AS $$
@@ -47,4 +349,183 @@ $$ LANGUAGE plpgsql;
 CREATE TRIGGER task_change_trigger
 AFTER INSERT OR UPDATE ON TASKS
 FOR EACH ROW
-EXECUTE FUNCTION notify_task_change();
\ No newline at end of file
+EXECUTE FUNCTION notify_task_change();
+
+-- Code contents are immutable: publishing a version is the only way to change
+-- what future tasks run, and the only changes to CODES are current_version
+-- and warmup
+CREATE OR REPLACE FUNCTION reject_code_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% contents are immutable, publish a new code version instead', TG_TABLE_NAME
+        USING ERRCODE = 'integrity_constraint_violation';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER code_immutable_trigger
+BEFORE UPDATE OF code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema ON CODES
+FOR EACH ROW
+EXECUTE FUNCTION reject_code_change();
+
+CREATE TRIGGER code_version_immutable_trigger
+BEFORE UPDATE ON CODE_VERSIONS
+FOR EACH ROW
+EXECUTE FUNCTION reject_code_change();
+
+-- Task events waiting to be POSTed to the task's webhook_url. Rows are added in
+-- the same transaction as the status change, so no event is lost.
+CREATE TABLE IF NOT EXISTS WEBHOOK_OUTBOX (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    event JSONB NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX idx_webhook_outbox_due ON WEBHOOK_OUTBOX(next_attempt_at) WHERE status = 'pending';
+-- Deliveries of a task, listed by GET /tasks/{id}/webhooks
+CREATE INDEX idx_webhook_outbox_task ON WEBHOOK_OUTBOX(task_id);
+
+CREATE OR REPLACE FUNCTION enqueue_task_webhook()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO WEBHOOK_OUTBOX (task_id, url, event)
+    VALUES (NEW.id, NEW.webhook_url, json_build_object(
+        'event', 'task.' || NEW.status,
+        'task_id', NEW.id,
+        'name', NEW.name,
+        'status', NEW.status,
+        'tenant_id', NEW.tenant_id,
+        'started', NEW.started,
+        'finished', NEW.finished,
+        'last_error', NEW.last_error,
+        'error_code', NEW.error_code,
+        'occurred_at', NOW()
+    ));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_webhook_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.webhook_url IS NOT NULL AND NEW.status IS DISTINCT FROM OLD.status
+      AND NEW.status IN ('completed', 'failed', 'malicious'))
+EXECUTE FUNCTION enqueue_task_webhook();
+
+-- Finishes a batch once its last task reaches a final status and queues its
+-- batch.finished event, attributed to that last task. Locking the batch row
+-- serializes tasks of the batch finishing concurrently, so exactly one of
+-- them sees all the others final.
+CREATE OR REPLACE FUNCTION finish_batch()
+RETURNS TRIGGER AS $$
+DECLARE
+    b BATCHES%ROWTYPE;
+BEGIN
+    SELECT * INTO b FROM BATCHES WHERE id = NEW.batch_id FOR UPDATE;
+    IF b.finished_at IS NOT NULL OR EXISTS (
+        SELECT 1 FROM TASKS WHERE batch_id = NEW.batch_id
+        AND status NOT IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned')
+    ) THEN
+        RETURN NEW;
+    END IF;
+
+    UPDATE BATCHES SET finished_at = NOW() WHERE id = b.id;
+    IF b.webhook_url IS NOT NULL THEN
+        INSERT INTO WEBHOOK_OUTBOX (task_id, url, event)
+        SELECT NEW.id, b.webhook_url, json_build_object(
+            'event', 'batch.finished',
+            'batch_id', b.id,
+            'name', b.name,
+            'tenant_id', b.tenant_id,
+            'status', CASE WHEN BOOL_AND(status = 'completed') THEN 'completed' ELSE 'failed' END,
+            'total', COUNT(*),
+            'completed', COUNT(*) FILTER (WHERE status = 'completed'),
+            'failed', COUNT(*) FILTER (WHERE status IN ('failed', 'malicious', 'abandoned')),
+            'cancelled', COUNT(*) FILTER (WHERE status = 'cancelled'),
+            'occurred_at', NOW()
+        )
+        FROM TASKS WHERE batch_id = b.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER batch_finish_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.batch_id IS NOT NULL AND NEW.status IS DISTINCT FROM OLD.status
+      AND NEW.status IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned'))
+EXECUTE FUNCTION finish_batch();
+
+-- Wakes the API requests waiting on a task (GET /tasks/{id}/wait) when it
+-- reaches a final status
+CREATE OR REPLACE FUNCTION notify_task_finished()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('task_finished', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_finished_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.status IS DISTINCT FROM OLD.status
+      AND NEW.status IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned'))
+EXECUTE FUNCTION notify_task_finished();
+
+-- Task state transitions, for auditing and debugging. A row is written by a
+-- trigger in the same transaction as the change, whichever process makes it.
+CREATE TABLE IF NOT EXISTS TASK_EVENTS (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    -- NULL for the submission
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    -- Worker the task was assigned to by or before the transition
+    worker_id TEXT,
+    -- last_error and error_code set by the transition, if any
+    reason TEXT,
+    error_code VARCHAR(32),
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_task_events_task ON TASK_EVENTS(task_id, id);
+
+-- Records a submission or status change in TASK_EVENTS. A claim or release
+-- keeps the last_error of an earlier attempt, which doesn't explain it.
+CREATE OR REPLACE FUNCTION record_task_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO TASK_EVENTS (task_id, from_status, to_status, worker_id)
+        VALUES (NEW.id, NULL, NEW.status, NEW.worker_id);
+    ELSIF NEW.status NOT IN ('pending', 'running')
+          OR NEW.last_error IS DISTINCT FROM OLD.last_error
+          OR NEW.error_code IS DISTINCT FROM OLD.error_code THEN
+        INSERT INTO TASK_EVENTS (task_id, from_status, to_status, worker_id, reason, error_code)
+        VALUES (NEW.id, OLD.status, NEW.status, COALESCE(NEW.worker_id, OLD.worker_id), NEW.last_error, NEW.error_code);
+    ELSE
+        INSERT INTO TASK_EVENTS (task_id, from_status, to_status, worker_id)
+        VALUES (NEW.id, OLD.status, NEW.status, COALESCE(NEW.worker_id, OLD.worker_id));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_submitted_event_trigger
+AFTER INSERT ON TASKS
+FOR EACH ROW
+EXECUTE FUNCTION record_task_event();
+
+CREATE TRIGGER task_event_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.status IS DISTINCT FROM OLD.status)
+EXECUTE FUNCTION record_task_event();
@@ -0,0 +1,68 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Brings a database created by an older init.sql to the task status taxonomy
+-- (model.Statuses): legacy spellings are rewritten, rows with an unknown
+-- status are held for an operator, and the CHECK constraints are added.
+-- Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/001_task_status_taxonomy.sql
+
+BEGIN;
+
+-- Rewriting statuses must not wake workers or emit webhook events for
+-- tasks that finished long ago
+ALTER TABLE TASKS DISABLE TRIGGER USER;
+
+-- Legacy spellings, see legacyStatuses in src/model/status.go
+UPDATE TASKS SET status = LOWER(TRIM(status)) WHERE status <> LOWER(TRIM(status));
+UPDATE TASKS SET status = 'completed' WHERE status = 'done';
+UPDATE TASKS SET status = 'pending' WHERE status = 'not_started' OR status IS NULL;
+UPDATE TASKS SET status = 'cancelled' WHERE status = 'canceled';
+
+-- Anything else is held rather than guessed, keeping the original status in
+-- last_error; release a task by setting its status back to 'pending'
+UPDATE TASKS
+SET last_error = CONCAT_WS(E'\n', 'status normalized from ''' || status || '''', last_error),
+    status = 'held'
+WHERE status NOT IN ('pending', 'running', 'completed', 'failed', 'cancelled', 'malicious', 'abandoned', 'held');
+
+ALTER TABLE TASKS ENABLE TRIGGER USER;
+
+ALTER TABLE TASKS ALTER COLUMN status SET NOT NULL;
+ALTER TABLE TASKS DROP CONSTRAINT IF EXISTS tasks_status_check;
+ALTER TABLE TASKS ADD CONSTRAINT tasks_status_check
+    CHECK (status IN ('pending', 'running', 'completed', 'failed', 'cancelled', 'malicious', 'abandoned', 'held'));
+
+-- Archived tasks are final: legacy spellings are rewritten and anything
+-- else, which was never meant to expire, is recorded as abandoned. The
+-- archived document follows the column. Databases older than task retention
+-- have no archive.
+DO $$
+BEGIN
+    IF to_regclass('tasks_archive') IS NULL THEN
+        RETURN;
+    END IF;
+
+    UPDATE TASKS_ARCHIVE SET status = LOWER(TRIM(status)) WHERE status <> LOWER(TRIM(status));
+    UPDATE TASKS_ARCHIVE SET status = 'completed' WHERE status = 'done';
+    UPDATE TASKS_ARCHIVE SET status = 'cancelled' WHERE status = 'canceled';
+    UPDATE TASKS_ARCHIVE SET status = 'abandoned'
+    WHERE status NOT IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned');
+    UPDATE TASKS_ARCHIVE SET task = jsonb_set(task, '{status}', to_jsonb(status))
+    WHERE task->>'status' IS DISTINCT FROM status;
+
+    ALTER TABLE TASKS_ARCHIVE DROP CONSTRAINT IF EXISTS tasks_archive_status_check;
+    ALTER TABLE TASKS_ARCHIVE ADD CONSTRAINT tasks_archive_status_check
+        CHECK (status IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned'));
+END $$;
+
+COMMIT;
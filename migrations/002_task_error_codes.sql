@@ -0,0 +1,60 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds TASKS.error_code (model.ErrorCodes) to a database created by an older
+-- init.sql, includes it in webhook events, and backfills it for finished
+-- tasks whose class can be told from their status or last_error. Codes that
+-- can't be recovered are left NULL. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/002_task_error_codes.sql
+
+BEGIN;
+
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS error_code VARCHAR(32) CHECK (error_code ~ '^E_[A-Z_]+$');
+
+CREATE OR REPLACE FUNCTION enqueue_task_webhook()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO WEBHOOK_OUTBOX (task_id, url, event)
+    VALUES (NEW.id, NEW.webhook_url, json_build_object(
+        'event', 'task.' || NEW.status,
+        'task_id', NEW.id,
+        'name', NEW.name,
+        'status', NEW.status,
+        'tenant_id', NEW.tenant_id,
+        'started', NEW.started,
+        'finished', NEW.finished,
+        'last_error', NEW.last_error,
+        'error_code', NEW.error_code,
+        'occurred_at', NOW()
+    ));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- The backfill must not wake workers or emit webhook events for tasks that
+-- finished long ago
+ALTER TABLE TASKS DISABLE TRIGGER USER;
+
+UPDATE TASKS SET error_code = CASE
+        WHEN status = 'abandoned' THEN 'E_WORKER_LOST'
+        WHEN status = 'held' THEN 'E_POISON'
+        WHEN status = 'malicious' THEN 'E_MALICIOUS'
+        WHEN last_error LIKE 'Dependency task % did not complete' THEN 'E_DEPENDENCY'
+        WHEN last_error LIKE '%timed out after%' THEN 'E_TIMEOUT'
+        WHEN last_error LIKE '%SyntaxError:%' OR last_error LIKE '%IndentationError:%' THEN 'E_CODE_SYNTAX'
+    END
+WHERE error_code IS NULL
+AND status IN ('failed', 'malicious', 'abandoned', 'held');
+
+ALTER TABLE TASKS ENABLE TRIGGER USER;
+
+COMMIT;
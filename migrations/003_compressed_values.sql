@@ -0,0 +1,27 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds the columns holding zstd-compressed code, payloads and outputs
+-- (COMPRESS_ABOVE_BYTES) to a database created by an older init.sql.
+-- Existing values stay as they are. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/003_compressed_values.sql
+
+BEGIN;
+
+ALTER TABLE CODES ADD COLUMN IF NOT EXISTS code_zstd BYTEA;
+ALTER TABLE CODES DROP CONSTRAINT IF EXISTS codes_check;
+ALTER TABLE CODES ADD CONSTRAINT codes_check CHECK (code IS NOT NULL OR code_zstd IS NOT NULL OR object_uri IS NOT NULL);
+
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS payload_zstd BYTEA;
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS output_zstd BYTEA;
+
+COMMIT;
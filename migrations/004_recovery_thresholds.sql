@@ -0,0 +1,23 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds the per-queue and per-task recovery thresholds (stale_after_seconds)
+-- to a database created by an older init.sql. Existing queues and tasks keep
+-- WORKER_STALE_AFTER. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/004_recovery_thresholds.sql
+
+BEGIN;
+
+ALTER TABLE QUEUES ADD COLUMN IF NOT EXISTS stale_after_seconds DOUBLE PRECISION CHECK (stale_after_seconds > 0);
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS stale_after_seconds DOUBLE PRECISION CHECK (stale_after_seconds > 0);
+
+COMMIT;
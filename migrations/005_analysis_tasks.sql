@@ -0,0 +1,21 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds the task type (execute or analyze) to a database created by an older
+-- init.sql. Existing tasks keep being executed. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/005_analysis_tasks.sql
+
+BEGIN;
+
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS task_type TEXT NOT NULL DEFAULT 'execute' CHECK (task_type IN ('execute', 'analyze'));
+
+COMMIT;
@@ -0,0 +1,63 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds code versioning to a database created by an older init.sql: the
+-- CODE_VERSIONS table and CODE_CONTENTS view, CODES.current_version and
+-- TASKS.code_version. Existing codes become version 1 of themselves and
+-- existing tasks keep running it. From now on code contents can't be
+-- updated in place. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/006_code_versions.sql
+
+BEGIN;
+
+ALTER TABLE CODES ADD COLUMN IF NOT EXISTS current_version INT NOT NULL DEFAULT 1 CHECK (current_version >= 1);
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS code_version INT;
+
+CREATE TABLE IF NOT EXISTS CODE_VERSIONS (
+    code_id UUID NOT NULL REFERENCES CODES(id),
+    version INT NOT NULL CHECK (version >= 2),
+    code TEXT,
+    code_zstd BYTEA,
+    object_uri TEXT,
+    sha256 TEXT,
+    json_schema JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (code_id, version),
+    CHECK (code IS NOT NULL OR code_zstd IS NOT NULL OR object_uri IS NOT NULL)
+);
+
+CREATE OR REPLACE VIEW CODE_CONTENTS AS
+    SELECT id AS code_id, 1 AS version, code, code_zstd, object_uri, sha256, json_schema FROM CODES
+    UNION ALL
+    SELECT code_id, version, code, code_zstd, object_uri, sha256, json_schema FROM CODE_VERSIONS;
+
+CREATE OR REPLACE FUNCTION reject_code_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% contents are immutable, publish a new code version instead', TG_TABLE_NAME
+        USING ERRCODE = 'integrity_constraint_violation';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS code_immutable_trigger ON CODES;
+CREATE TRIGGER code_immutable_trigger
+BEFORE UPDATE OF code, code_zstd, object_uri, sha256, json_schema ON CODES
+FOR EACH ROW
+EXECUTE FUNCTION reject_code_change();
+
+DROP TRIGGER IF EXISTS code_version_immutable_trigger ON CODE_VERSIONS;
+CREATE TRIGGER code_version_immutable_trigger
+BEFORE UPDATE ON CODE_VERSIONS
+FOR EACH ROW
+EXECUTE FUNCTION reject_code_change();
+
+COMMIT;
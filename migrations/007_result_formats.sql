@@ -0,0 +1,40 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds the result contract of codes (result_format, result_schema) and the
+-- decoded results of tasks (result, result_raw) to a database created by an
+-- older init.sql. Existing codes keep free-form text output. Run after
+-- 006_code_versions.sql. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/007_result_formats.sql
+
+BEGIN;
+
+ALTER TABLE CODES ADD COLUMN IF NOT EXISTS result_format TEXT;
+ALTER TABLE CODES ADD COLUMN IF NOT EXISTS result_schema TEXT;
+ALTER TABLE CODE_VERSIONS ADD COLUMN IF NOT EXISTS result_format TEXT;
+ALTER TABLE CODE_VERSIONS ADD COLUMN IF NOT EXISTS result_schema TEXT;
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS result JSONB;
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS result_raw BYTEA;
+
+-- New columns can only be appended to a view
+CREATE OR REPLACE VIEW CODE_CONTENTS AS
+    SELECT id AS code_id, 1 AS version, code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema FROM CODES
+    UNION ALL
+    SELECT code_id, version, code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema FROM CODE_VERSIONS;
+
+DROP TRIGGER IF EXISTS code_immutable_trigger ON CODES;
+CREATE TRIGGER code_immutable_trigger
+BEFORE UPDATE OF code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema ON CODES
+FOR EACH ROW
+EXECUTE FUNCTION reject_code_change();
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds the bandwidth_kbps setting to QUEUES and TASKS for databases created
+-- by an older init.sql. Existing queues and tasks keep
+-- CONTAINER_BANDWIDTH_KBPS. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/008_bandwidth_limits.sql
+
+BEGIN;
+
+ALTER TABLE QUEUES ADD COLUMN IF NOT EXISTS bandwidth_kbps BIGINT CHECK (bandwidth_kbps > 0);
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS bandwidth_kbps BIGINT CHECK (bandwidth_kbps > 0);
+
+COMMIT;
@@ -0,0 +1,79 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds batches (BATCHES, TASKS.batch_id) and the trigger finishing them to a
+-- database created by an older init.sql. Existing tasks belong to no batch.
+-- Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/009_batches.sql
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS BATCHES (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT,
+    tenant_id TEXT,
+    webhook_url TEXT,
+    total INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS batch_id UUID REFERENCES BATCHES(id);
+CREATE INDEX IF NOT EXISTS idx_tasks_batch ON TASKS(batch_id) WHERE batch_id IS NOT NULL;
+
+-- Finishes a batch once its last task reaches a final status and queues its
+-- batch.finished event, attributed to that last task. Locking the batch row
+-- serializes tasks of the batch finishing concurrently, so exactly one of
+-- them sees all the others final.
+CREATE OR REPLACE FUNCTION finish_batch()
+RETURNS TRIGGER AS $$
+DECLARE
+    b BATCHES%ROWTYPE;
+BEGIN
+    SELECT * INTO b FROM BATCHES WHERE id = NEW.batch_id FOR UPDATE;
+    IF b.finished_at IS NOT NULL OR EXISTS (
+        SELECT 1 FROM TASKS WHERE batch_id = NEW.batch_id
+        AND status NOT IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned')
+    ) THEN
+        RETURN NEW;
+    END IF;
+
+    UPDATE BATCHES SET finished_at = NOW() WHERE id = b.id;
+    IF b.webhook_url IS NOT NULL THEN
+        INSERT INTO WEBHOOK_OUTBOX (task_id, url, event)
+        SELECT NEW.id, b.webhook_url, json_build_object(
+            'event', 'batch.finished',
+            'batch_id', b.id,
+            'name', b.name,
+            'tenant_id', b.tenant_id,
+            'status', CASE WHEN BOOL_AND(status = 'completed') THEN 'completed' ELSE 'failed' END,
+            'total', COUNT(*),
+            'completed', COUNT(*) FILTER (WHERE status = 'completed'),
+            'failed', COUNT(*) FILTER (WHERE status IN ('failed', 'malicious', 'abandoned')),
+            'cancelled', COUNT(*) FILTER (WHERE status = 'cancelled'),
+            'occurred_at', NOW()
+        )
+        FROM TASKS WHERE batch_id = b.id;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS batch_finish_trigger ON TASKS;
+CREATE TRIGGER batch_finish_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.batch_id IS NOT NULL AND NEW.status IS DISTINCT FROM OLD.status
+      AND NEW.status IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned'))
+EXECUTE FUNCTION finish_batch();
+
+COMMIT;
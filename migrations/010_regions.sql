@@ -0,0 +1,23 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds regions (WORKERS.region, TASKS.preferred_region) to a database
+-- created by an older init.sql. Existing tasks have no preferred region and
+-- run anywhere. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/010_regions.sql
+
+BEGIN;
+
+ALTER TABLE WORKERS ADD COLUMN IF NOT EXISTS region TEXT;
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS preferred_region TEXT;
+
+COMMIT;
@@ -0,0 +1,36 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds the task_finished notification behind GET /tasks/{id}/wait to a
+-- database created by an older init.sql. Until it runs, waiting requests
+-- return on their timeout. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/011_task_wait.sql
+
+BEGIN;
+
+CREATE OR REPLACE FUNCTION notify_task_finished()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('task_finished', NEW.id::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_finished_trigger ON TASKS;
+CREATE TRIGGER task_finished_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.status IS DISTINCT FROM OLD.status
+      AND NEW.status IN ('completed', 'failed', 'cancelled', 'malicious', 'abandoned'))
+EXECUTE FUNCTION notify_task_finished();
+
+COMMIT;
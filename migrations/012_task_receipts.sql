@@ -0,0 +1,22 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds TASKS.receipt, the signed execution receipt of a completed task, to a
+-- database created by an older init.sql. Tasks completed before it have no
+-- receipt. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/012_task_receipts.sql
+
+BEGIN;
+
+ALTER TABLE TASKS ADD COLUMN IF NOT EXISTS receipt JSONB;
+
+COMMIT;
@@ -0,0 +1,72 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds TASK_EVENTS and the triggers recording task state transitions into it
+-- to a database created by an older init.sql. Earlier transitions are not
+-- backfilled. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/013_task_events.sql
+
+BEGIN;
+
+-- Task state transitions, for auditing and debugging. A row is written by a
+-- trigger in the same transaction as the change, whichever process makes it.
+CREATE TABLE IF NOT EXISTS TASK_EVENTS (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES TASKS(id) ON DELETE CASCADE,
+    -- NULL for the submission
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    -- Worker the task was assigned to by or before the transition
+    worker_id TEXT,
+    -- last_error and error_code set by the transition, if any
+    reason TEXT,
+    error_code VARCHAR(32),
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_events_task ON TASK_EVENTS(task_id, id);
+
+-- Records a submission or status change in TASK_EVENTS. A claim or release
+-- keeps the last_error of an earlier attempt, which doesn't explain it.
+CREATE OR REPLACE FUNCTION record_task_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO TASK_EVENTS (task_id, from_status, to_status, worker_id)
+        VALUES (NEW.id, NULL, NEW.status, NEW.worker_id);
+    ELSIF NEW.status NOT IN ('pending', 'running')
+          OR NEW.last_error IS DISTINCT FROM OLD.last_error
+          OR NEW.error_code IS DISTINCT FROM OLD.error_code THEN
+        INSERT INTO TASK_EVENTS (task_id, from_status, to_status, worker_id, reason, error_code)
+        VALUES (NEW.id, OLD.status, NEW.status, COALESCE(NEW.worker_id, OLD.worker_id), NEW.last_error, NEW.error_code);
+    ELSE
+        INSERT INTO TASK_EVENTS (task_id, from_status, to_status, worker_id)
+        VALUES (NEW.id, OLD.status, NEW.status, COALESCE(NEW.worker_id, OLD.worker_id));
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_submitted_event_trigger ON TASKS;
+CREATE TRIGGER task_submitted_event_trigger
+AFTER INSERT ON TASKS
+FOR EACH ROW
+EXECUTE FUNCTION record_task_event();
+
+DROP TRIGGER IF EXISTS task_event_trigger ON TASKS;
+CREATE TRIGGER task_event_trigger
+AFTER UPDATE OF status ON TASKS
+FOR EACH ROW
+WHEN (NEW.status IS DISTINCT FROM OLD.status)
+EXECUTE FUNCTION record_task_event();
+
+COMMIT;
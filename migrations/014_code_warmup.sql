@@ -0,0 +1,22 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Adds CODES.warmup, the warm-up snippet run once per sandbox container and
+-- virtualenv before a code's tasks, to a database created by an older
+-- init.sql. Existing codes have no warm-up. Safe to run more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/014_code_warmup.sql
+
+BEGIN;
+
+ALTER TABLE CODES ADD COLUMN IF NOT EXISTS warmup TEXT;
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Copyright (c) 2026 Khaled Abbas
+--
+-- This source code is licensed under the Business Source License 1.1.
+-- 
+-- Change Date: 4 years after the first public release of this version.
+-- Change License: MIT
+--
+-- On the Change Date, this version of the code automatically converts 
+-- to the MIT License. Prior to that date, use is subject to the 
+-- Additional Use Grant. See the LICENSE file for details.
+
+-- Indexes WEBHOOK_OUTBOX by task, which GET /tasks/{id}/webhooks lists the
+-- deliveries of, in a database created by an older init.sql. Safe to run
+-- more than once:
+--
+--   psql "$DATABASE_URL" -f migrations/015_webhook_outbox_task_index.sql
+
+BEGIN;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_task ON WEBHOOK_OUTBOX(task_id);
+
+COMMIT;
@@ -15,7 +15,7 @@ if %errorlevel% neq 0 (
 REM Build the Benchmark Runner
 echo [INFO] Building Benchmark Runner...
 cd tests\benchmark
-go build -o benchmark.exe runner.go
+go build -o benchmark.exe .
 if %errorlevel% neq 0 (
     echo [ERROR] Failed to build runner.
     cd ..\..
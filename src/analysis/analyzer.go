@@ -0,0 +1,197 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package analysis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+)
+
+// Verdict is the outcome of analyzing a piece of code. Warnings come from
+// warn-level rules: the code still runs, but the execution may be traced.
+type Verdict struct {
+	Malicious bool
+	Reasons   []string
+	Warnings  []string
+}
+
+// String formats the verdict reasons for storage in LAST_ERROR
+func (v Verdict) String() string {
+	if !v.Malicious {
+		return "clean"
+	}
+	return "Rejected by code analysis: " + strings.Join(v.Reasons, "; ")
+}
+
+// CodeAnalyzer inspects code before it is executed
+type CodeAnalyzer interface {
+	Name() string
+	Analyze(ctx context.Context, code string) (Verdict, error)
+}
+
+// Engine runs a chain of analyzers; code is malicious if any analyzer says so
+type Engine struct {
+	analyzers []CodeAnalyzer
+}
+
+// NewEngine creates an engine running the given analyzers in order
+func NewEngine(analyzers ...CodeAnalyzer) *Engine {
+	return &Engine{analyzers: analyzers}
+}
+
+// Analyze runs every analyzer and merges their verdicts. Reasons are
+// prefixed with the analyzer name so operators know which rule fired.
+func (e *Engine) Analyze(ctx context.Context, code string) (Verdict, error) {
+	var merged Verdict
+	for _, a := range e.analyzers {
+		v, err := a.Analyze(ctx, code)
+		if err != nil {
+			return Verdict{}, fmt.Errorf("%s analyzer: %w", a.Name(), err)
+		}
+		if v.Malicious {
+			merged.Malicious = true
+			for _, r := range v.Reasons {
+				merged.Reasons = append(merged.Reasons, fmt.Sprintf("[%s] %s", a.Name(), r))
+			}
+		}
+		for _, w := range v.Warnings {
+			merged.Warnings = append(merged.Warnings, fmt.Sprintf("[%s] %s", a.Name(), w))
+		}
+	}
+	return merged, nil
+}
+
+// Names lists the analyzers in the engine
+func (e *Engine) Names() []string {
+	names := make([]string, len(e.analyzers))
+	for i, a := range e.analyzers {
+		names[i] = a.Name()
+	}
+	return names
+}
+
+// Versioned is implemented by analyzers whose rule set can be fingerprinted
+type Versioned interface {
+	Version() string
+}
+
+// AnalyzerInfo describes an enabled analyzer for audit purposes
+type AnalyzerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Describe lists the enabled analyzers with their rule set versions
+func (e *Engine) Describe() []AnalyzerInfo {
+	infos := make([]AnalyzerInfo, len(e.analyzers))
+	for i, a := range e.analyzers {
+		infos[i].Name = a.Name()
+		if v, ok := a.(Versioned); ok {
+			infos[i].Version = v.Version()
+		}
+	}
+	return infos
+}
+
+// RuleSetVersion fingerprints the whole analyzer configuration, so two nodes
+// with the same value enforce the same rules
+func (e *Engine) RuleSetVersion() string {
+	var sb strings.Builder
+	for _, info := range e.Describe() {
+		sb.WriteString(info.Name + "=" + info.Version + "\n")
+	}
+	return fingerprint(sb.String())
+}
+
+// fingerprint returns a short, stable hash used as a rule set version
+func fingerprint(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:6])
+}
+
+// NewEngineFromConfig builds the engine from the configured list of analyzers
+// (regex, ast, http). An empty list disables analysis.
+func NewEngineFromConfig(c config.Analysis) (*Engine, error) {
+	var analyzers []CodeAnalyzer
+	for _, name := range c.Analyzers {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "":
+			continue
+		case "regex":
+			a, err := NewRegexAnalyzer(c)
+			if err != nil {
+				return nil, err
+			}
+			analyzers = append(analyzers, a)
+		case "ast":
+			analyzers = append(analyzers, NewASTAnalyzer(c))
+		case "http":
+			a, err := NewHTTPAnalyzer(c)
+			if err != nil {
+				return nil, err
+			}
+			analyzers = append(analyzers, a)
+		default:
+			return nil, fmt.Errorf("unknown code analyzer %q", name)
+		}
+	}
+	return NewEngine(analyzers...), nil
+}
+
+// settings is the analysis configuration, see Configure
+var settings = config.Default().Analysis
+
+// Configure installs the analysis configuration. It must be called before
+// Default.
+func Configure(c config.Analysis) {
+	settings = c
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultEngine *Engine
+	defaultErr    error
+)
+
+// Default returns the process-wide engine built from the configuration
+func Default() (*Engine, error) {
+	defaultOnce.Do(func() {
+		defaultEngine, defaultErr = NewEngineFromConfig(settings)
+		if defaultErr == nil {
+			logging.Log(context.Background(), fmt.Sprintf("Code analyzers enabled: %v", defaultEngine.Names()), slog.LevelInfo)
+		}
+	})
+	return defaultEngine, defaultErr
+}
+
+// Tracer returns the tool tracing the execution of suspicious tasks, "" when
+// they run untraced
+func Tracer() string {
+	return settings.Trace
+}
+
+// AnalyzeCode checks code for malicious patterns using the default engine
+func AnalyzeCode(ctx context.Context, code string) (Verdict, error) {
+	engine, err := Default()
+	if err != nil {
+		return Verdict{}, err
+	}
+	return engine.Analyze(ctx, code)
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"continuumworker/src/config"
+)
+
+// astScript parses the code read from stdin with Python's ast module (the
+// code is never executed) and prints a JSON list of findings.
+const astScript = `
+import ast, json, sys
+
+BANNED_MODULES = {"subprocess", "pty", "ctypes", "multiprocessing"}
+BANNED_CALLS = {
+    "os.system", "os.popen", "os.fork", "os.forkpty", "os.kill", "os.setuid",
+    "os.execv", "os.execve", "os.execl", "os.execlp", "os.execvp",
+    "os.spawnl", "os.spawnv", "pty.spawn", "ctypes.CDLL",
+}
+DYNAMIC_CALLS = {"eval", "exec", "compile", "__import__"}
+
+def dotted(node):
+    if isinstance(node, ast.Name):
+        return node.id
+    if isinstance(node, ast.Attribute):
+        base = dotted(node.value)
+        return base + "." + node.attr if base else None
+    return None
+
+findings = []
+try:
+    tree = ast.parse(sys.stdin.read())
+except SyntaxError:
+    print("[]")
+    sys.exit(0)
+
+for node in ast.walk(tree):
+    if isinstance(node, ast.Import):
+        for alias in node.names:
+            if alias.name.split(".")[0] in BANNED_MODULES:
+                findings.append("line %d: import of %s" % (node.lineno, alias.name))
+    elif isinstance(node, ast.ImportFrom) and node.module:
+        if node.module.split(".")[0] in BANNED_MODULES:
+            findings.append("line %d: import from %s" % (node.lineno, node.module))
+    elif isinstance(node, ast.Call):
+        name = dotted(node.func)
+        if name in BANNED_CALLS:
+            findings.append("line %d: call to %s" % (node.lineno, name))
+        elif name in DYNAMIC_CALLS and node.args and not isinstance(node.args[0], ast.Constant):
+            findings.append("line %d: %s of non-literal code" % (node.lineno, name))
+
+print(json.dumps(findings))
+`
+
+// ASTAnalyzer runs a static analysis pass using the Python ast module
+type ASTAnalyzer struct {
+	Python  string
+	Timeout time.Duration
+}
+
+// NewASTAnalyzer uses the configured interpreter (default python3)
+func NewASTAnalyzer(c config.Analysis) *ASTAnalyzer {
+	return &ASTAnalyzer{Python: c.Python, Timeout: 10 * time.Second}
+}
+
+func (a *ASTAnalyzer) Name() string { return "ast" }
+
+// Version fingerprints the embedded rule script
+func (a *ASTAnalyzer) Version() string { return fingerprint(astScript) }
+
+func (a *ASTAnalyzer) Analyze(ctx context.Context, code string) (Verdict, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, a.Python, "-I", "-c", astScript)
+	cmd.Stdin = bytes.NewBufferString(code)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return Verdict{}, fmt.Errorf("python ast pass failed: %w: %s", err, stderr.String())
+	}
+
+	var findings []string
+	if err := json.Unmarshal(stdout.Bytes(), &findings); err != nil {
+		return Verdict{}, fmt.Errorf("invalid ast findings: %w", err)
+	}
+	return Verdict{Malicious: len(findings) > 0, Reasons: findings}, nil
+}
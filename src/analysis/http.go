@@ -0,0 +1,86 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"continuumworker/src/config"
+)
+
+// HTTPAnalyzer delegates the verdict to an external scanning service.
+// The service receives {"code": "..."} and must answer with
+// {"malicious": bool, "reasons": ["..."]}, optionally with "warnings" for
+// code that may run but is suspicious.
+type HTTPAnalyzer struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// NewHTTPAnalyzer uses the configured scanning service URL, token and
+// timeout (default 10s)
+func NewHTTPAnalyzer(c config.Analysis) (*HTTPAnalyzer, error) {
+	if c.HTTPURL == "" {
+		return nil, fmt.Errorf("ANALYZER_HTTP_URL must be set to use the http analyzer")
+	}
+	return &HTTPAnalyzer{
+		URL:    c.HTTPURL,
+		Token:  c.HTTPToken,
+		Client: &http.Client{Timeout: c.HTTPTimeout},
+	}, nil
+}
+
+func (a *HTTPAnalyzer) Name() string { return "http" }
+
+// Version identifies the scanning service; its rules are managed remotely
+func (a *HTTPAnalyzer) Version() string { return fingerprint(a.URL) }
+
+func (a *HTTPAnalyzer) Analyze(ctx context.Context, code string) (Verdict, error) {
+	body, err := json.Marshal(map[string]string{"code": code})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	}
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("scanner request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Verdict{}, fmt.Errorf("scanner returned %s", resp.Status)
+	}
+
+	var result struct {
+		Malicious bool     `json:"malicious"`
+		Reasons   []string `json:"reasons"`
+		Warnings  []string `json:"warnings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Verdict{}, fmt.Errorf("invalid scanner response: %w", err)
+	}
+	return Verdict{Malicious: result.Malicious, Reasons: result.Reasons, Warnings: result.Warnings}, nil
+}
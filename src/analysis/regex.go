@@ -0,0 +1,131 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package analysis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"continuumworker/src/config"
+)
+
+// Rule is a named denylist pattern. A Warn rule does not reject the code,
+// it only flags the task as suspicious.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Warn    bool
+}
+
+// DefaultRules is the built-in denylist used when no rule file is configured
+var DefaultRules = []Rule{
+	{"shell execution via os.system/os.popen", regexp.MustCompile(`\bos\.(system|popen)\s*\(`), false},
+	{"process replacement via os.exec*/os.spawn*", regexp.MustCompile(`\bos\.(exec[lv]p?e?|spawn[lv]p?e?)\s*\(`), false},
+	{"subprocess usage", regexp.MustCompile(`\bsubprocess\b`), false},
+	{"pseudo-terminal spawn", regexp.MustCompile(`\bpty\.spawn\s*\(`), false},
+	{"native code loading via ctypes", regexp.MustCompile(`\bctypes\b`), false},
+	{"fork bomb", regexp.MustCompile(`while\s+True\s*:\s*\n?\s*os\.fork\s*\(`), false},
+	{"encoded payload execution", regexp.MustCompile(`\b(exec|eval)\s*\(\s*(base64|codecs|zlib|marshal)\.`), false},
+	{"credential file access", regexp.MustCompile(`/etc/(shadow|passwd|sudoers)`), false},
+	{"docker socket access", regexp.MustCompile(`docker\.sock`), false},
+	{"raw socket usage", regexp.MustCompile(`\bsocket\.socket\s*\(`), true},
+	{"dynamic code execution", regexp.MustCompile(`(^|[^.\w])(exec|eval)\s*\(`), true},
+}
+
+// RegexAnalyzer flags code matching any denylist rule
+type RegexAnalyzer struct {
+	Rules []Rule
+}
+
+// bundleRules are the rules of a loaded policy bundle, see UseRules
+var bundleRules []Rule
+
+// UseRules makes the regex analyzer use the rules of a policy bundle instead
+// of the denylist file or DefaultRules. It must be called before Default.
+func UseRules(rules []Rule) {
+	bundleRules = rules
+}
+
+// NewRegexAnalyzer loads rules from the denylist file (one "name=regex" per
+// line, # for comments, a "warn:" prefix for warn-level rules) or falls back
+// to DefaultRules. Rules from a policy
+// bundle take precedence over both.
+func NewRegexAnalyzer(c config.Analysis) (*RegexAnalyzer, error) {
+	if bundleRules != nil {
+		return &RegexAnalyzer{Rules: bundleRules}, nil
+	}
+
+	path := c.DenylistFile
+	if path == "" {
+		return &RegexAnalyzer{Rules: DefaultRules}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open denylist: %w", err)
+	}
+	defer f.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line, warn := strings.CutPrefix(line, "warn:")
+		name, pattern, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("denylist line %d: expected name=regex", lineNo)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("denylist line %d: %w", lineNo, err)
+		}
+		rules = append(rules, Rule{Name: strings.TrimSpace(name), Pattern: re, Warn: warn})
+	}
+	return &RegexAnalyzer{Rules: rules}, scanner.Err()
+}
+
+func (a *RegexAnalyzer) Name() string { return "regex" }
+
+// Version fingerprints the active rules
+func (a *RegexAnalyzer) Version() string {
+	var sb strings.Builder
+	for _, rule := range a.Rules {
+		if rule.Warn {
+			sb.WriteString("warn:")
+		}
+		sb.WriteString(rule.Name + "=" + rule.Pattern.String() + "\n")
+	}
+	return fingerprint(sb.String())
+}
+
+func (a *RegexAnalyzer) Analyze(ctx context.Context, code string) (Verdict, error) {
+	var v Verdict
+	for _, rule := range a.Rules {
+		if !rule.Pattern.MatchString(code) {
+			continue
+		}
+		if rule.Warn {
+			v.Warnings = append(v.Warnings, rule.Name)
+			continue
+		}
+		v.Malicious = true
+		v.Reasons = append(v.Reasons, rule.Name)
+	}
+	return v, nil
+}
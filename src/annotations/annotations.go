@@ -0,0 +1,116 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package annotations implements the task annotation protocol. A script
+// attaches key/value annotations to its own task by printing a single line:
+//
+//	__CONTINUUM_ANNOTATE__ {"records_processed": 1042, "model_version": "v3"}
+//
+// Marker lines are removed from the task's plain OUTPUT. Later lines override
+// earlier values of the same key.
+package annotations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Marker prefixes every annotation line
+const Marker = "__CONTINUUM_ANNOTATE__ "
+
+const (
+	// MaxKeys bounds the number of annotations a task may carry
+	MaxKeys = 64
+	// MaxValueBytes bounds the size of a single value
+	MaxValueBytes = 1024
+)
+
+// validKey matches the keys accepted, which are also used in list filters
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Parse splits script stdout into the plain text output and the task's
+// annotations, nil if there are none. Malformed annotations are kept in the
+// plain output with a note so nothing the script printed is silently lost.
+func Parse(stdout string) (string, map[string]any) {
+	if !strings.Contains(stdout, Marker) {
+		return stdout, nil
+	}
+
+	var plain strings.Builder
+	var annotations map[string]any
+	for _, line := range strings.SplitAfter(stdout, "\n") {
+		raw, ok := strings.CutPrefix(line, Marker)
+		if !ok {
+			plain.WriteString(line)
+			continue
+		}
+
+		values, err := decode(strings.TrimSpace(raw))
+		if err == nil && annotations == nil {
+			annotations = map[string]any{}
+		}
+		for key, value := range values {
+			if _, exists := annotations[key]; !exists && len(annotations) >= MaxKeys {
+				err = fmt.Errorf("more than %d annotations", MaxKeys)
+				continue
+			}
+			annotations[key] = value
+		}
+		if err != nil {
+			plain.WriteString(fmt.Sprintf("[continuum] annotation dropped: %v\n", err))
+		}
+	}
+	return plain.String(), annotations
+}
+
+// decode reads an annotation line. Values must be strings, numbers or
+// booleans, so annotations stay small and filterable.
+func decode(raw string) (map[string]any, error) {
+	d := json.NewDecoder(strings.NewReader(raw))
+	d.UseNumber()
+	var values map[string]any
+	if err := d.Decode(&values); err != nil {
+		return nil, fmt.Errorf("invalid annotation: %w", err)
+	}
+
+	for key, value := range values {
+		if !validKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+		switch v := value.(type) {
+		case string:
+			if len(v) > MaxValueBytes {
+				return nil, fmt.Errorf("value of %q exceeds %d bytes", key, MaxValueBytes)
+			}
+		case json.Number, bool:
+		default:
+			return nil, fmt.Errorf("value of %q must be a string, number or boolean", key)
+		}
+	}
+	return values, nil
+}
+
+// Encode returns the annotations as a JSONB value, "" if there are none
+func Encode(annotations map[string]any) string {
+	if len(annotations) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(annotations); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(buf.String())
+}
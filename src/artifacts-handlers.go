@@ -0,0 +1,195 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"continuumworker/src/artifacts"
+	"continuumworker/src/logging"
+	"continuumworker/src/storage"
+)
+
+// TaskArtifact describes a stored artifact file
+type TaskArtifact struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	SHA256      string    `json:"sha256"`
+	URL         string    `json:"url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// taskArtifactsHandler lists the artifacts a task wrote to /outputs
+func (s *APIServer) taskArtifactsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT path, size, content_type, sha256, created_at
+		FROM TASK_ARTIFACTS
+		WHERE task_id = $1
+		ORDER BY path`, taskID)
+	if err != nil {
+		http.Error(w, "Failed to query task artifacts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	result := []TaskArtifact{}
+	for rows.Next() {
+		var a TaskArtifact
+		if err := rows.Scan(&a.Path, &a.Size, &a.ContentType, &a.SHA256, &a.CreatedAt); err != nil {
+			http.Error(w, "Failed to read task artifacts", http.StatusInternalServerError)
+			return
+		}
+		a.URL = fmt.Sprintf("/tasks/%d/artifacts/%s", taskID, (&url.URL{Path: a.Path}).EscapedPath())
+		result = append(result, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// taskArtifactHandler downloads a single artifact from the artifact store
+func (s *APIServer) taskArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	var contentType, uri string
+	var size int64
+	err = s.db.QueryRowContext(r.Context(),
+		"SELECT content_type, uri, size FROM TASK_ARTIFACTS WHERE task_id = $1 AND path = $2",
+		taskID, r.PathValue("path")).Scan(&contentType, &uri, &size)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query task artifact", http.StatusInternalServerError)
+		return
+	}
+
+	store, err := artifacts.Default()
+	if err != nil || store == nil {
+		http.Error(w, "No artifact store configured on this worker", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := store.Open(r.Context(), uri)
+	if err != nil {
+		http.Error(w, "Failed to open artifact", http.StatusBadGateway)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Script-produced files are untrusted: never render them in our origin
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	_, _ = io.Copy(w, body)
+}
+
+// SignedURLRequest asks for a signed download URL of one artifact. The full
+// output of a task whose output overflowed is the artifact
+// .continuum/stdout.txt.
+type SignedURLRequest struct {
+	Path      string `json:"path"`
+	ExpiresIn string `json:"expires_in,omitempty"` // Duration like "10m", the configured TTL when empty
+}
+
+// SignedURL is a short-lived URL downloading an artifact straight from the
+// artifact store
+type SignedURL struct {
+	Path      string    `json:"path"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// signedURLHandler issues a signed URL for one artifact so large downloads
+// bypass the API server. Every URL issued is recorded in SIGNED_URLS.
+func (s *APIServer) signedURLHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+	var req SignedURLRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil || req.Path == "" {
+		http.Error(w, "Request body must be a JSON object with a path", http.StatusBadRequest)
+		return
+	}
+	ttl := s.signedURLTTL
+	if req.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > s.signedURLMaxTTL {
+			http.Error(w, fmt.Sprintf("expires_in must be a positive duration of at most %s", s.signedURLMaxTTL), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var contentType, uri string
+	err = s.db.QueryRowContext(r.Context(),
+		"SELECT content_type, uri FROM TASK_ARTIFACTS WHERE task_id = $1 AND path = $2",
+		taskID, req.Path).Scan(&contentType, &uri)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query task artifact", http.StatusInternalServerError)
+		return
+	}
+
+	store, err := artifacts.Default()
+	if err != nil || store == nil {
+		http.Error(w, "No artifact store configured on this worker", http.StatusServiceUnavailable)
+		return
+	}
+	// Script-produced files are untrusted: always download them as attachments
+	signed, err := artifacts.SignedURL(store, uri, ttl, contentType, path.Base(req.Path))
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		http.Error(w, "The artifact store cannot sign URLs, download through /tasks/{id}/artifacts/{path}", http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to sign artifact URL", http.StatusInternalServerError)
+		return
+	}
+
+	// No URL leaves without its audit record
+	expiresAt := time.Now().Add(ttl).UTC()
+	_, err = s.db.ExecContext(r.Context(), "INSERT INTO SIGNED_URLS (task_id, path, requester, expires_at) VALUES ($1, $2, $3, $4)",
+		taskID, req.Path, r.RemoteAddr, expiresAt)
+	if err != nil {
+		http.Error(w, "Failed to record signed URL", http.StatusInternalServerError)
+		return
+	}
+	logging.Log(r.Context(), fmt.Sprintf("Signed URL for artifact %s of task %d issued to %s, expires at %s", req.Path, taskID, r.RemoteAddr, expiresAt.Format(time.RFC3339)), slog.LevelInfo)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(SignedURL{Path: req.Path, URL: signed, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Artifact is the metadata of a stored file, as recorded in TASK_ARTIFACTS
+type Artifact struct {
+	Path        string
+	Size        int64
+	ContentType string
+	SHA256      string
+	URI         string
+}
+
+// Collector stores the artifacts of one task execution
+type Collector struct {
+	store    Store
+	taskID   int
+	maxBytes int64
+	total    int64
+
+	Artifacts []Artifact
+}
+
+// NewCollector returns a collector for the task. The configured max bytes
+// bound the total size stored per execution.
+func NewCollector(store Store, taskID int) *Collector {
+	return &Collector{store: store, taskID: taskID, maxBytes: settings.MaxBytes}
+}
+
+// Store saves one file found in /outputs. name is relative to /outputs. A
+// file stored again, e.g. by a retried execution, replaces the earlier one.
+func (c *Collector) Store(ctx context.Context, name string, size int64, body io.Reader) error {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid artifact path %q", name)
+	}
+	if i := slices.IndexFunc(c.Artifacts, func(a Artifact) bool { return a.Path == name }); i >= 0 {
+		c.total -= c.Artifacts[i].Size
+		c.Artifacts = slices.Delete(c.Artifacts, i, i+1)
+	}
+	if c.total+size > c.maxBytes {
+		return fmt.Errorf("artifact %s exceeds the %d bytes limit per task", name, c.maxBytes)
+	}
+	c.total += size
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	hash := sha256.New()
+	key := fmt.Sprintf("tasks/%d/%s", c.taskID, name)
+	uri, err := c.store.Put(ctx, key, io.TeeReader(body, hash), size, contentType)
+	if err != nil {
+		return err
+	}
+
+	c.Artifacts = append(c.Artifacts, Artifact{
+		Path:        name,
+		Size:        size,
+		ContentType: contentType,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		URI:         uri,
+	})
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package artifacts stores the files a task script writes to /outputs
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+	"continuumworker/src/storage"
+)
+
+// Store persists artifact files and returns a URI to read them back
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error)
+	Open(ctx context.Context, uri string) (io.ReadCloser, error)
+}
+
+// LocalStore keeps artifacts under a directory of the worker host
+type LocalStore struct {
+	Root string
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	path := filepath.Join(s.Root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact %s: %w", key, err)
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write artifact %s: %w", key, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write artifact %s: %w", key, err)
+	}
+	return "file://" + filepath.ToSlash(path), nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	path, ok := strings.CutPrefix(uri, "file://")
+	if !ok {
+		return nil, fmt.Errorf("not a local artifact: %s", uri)
+	}
+	// Only serve files that live under the store root
+	rel, err := filepath.Rel(s.Root, filepath.FromSlash(path))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("artifact %s is outside of the store", uri)
+	}
+	return os.Open(filepath.FromSlash(path))
+}
+
+// ObjectStore keeps artifacts under a prefix of an object storage bucket:
+// S3 (or compatible), Google Cloud Storage or an Azure Blob container
+type ObjectStore struct {
+	Client storage.ObjectClient
+	Scheme string
+	Bucket string
+	Prefix string
+}
+
+func (s *ObjectStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (string, error) {
+	key = strings.TrimSuffix(s.Prefix, "/") + "/" + key
+	key = strings.TrimPrefix(key, "/")
+	if err := s.Client.PutObject(ctx, s.Bucket, key, body, size, contentType); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s://%s/%s", s.Scheme, s.Bucket, key), nil
+}
+
+func (s *ObjectStore) Open(ctx context.Context, uri string) (io.ReadCloser, error) {
+	scheme, bucket, key, ok := storage.ParseURL(uri)
+	if !ok || scheme != s.Scheme || bucket != s.Bucket || key == "" {
+		return nil, fmt.Errorf("not an artifact of this store: %s", uri)
+	}
+	return s.Client.GetObject(ctx, bucket, key)
+}
+
+// SignedURL returns a URL downloading the artifact at uri straight from
+// object storage until expires, served as an attachment named filename with
+// contentType. Local stores and credentials that can't sign return
+// storage.ErrPresignUnsupported.
+func SignedURL(store Store, uri string, expires time.Duration, contentType, filename string) (string, error) {
+	s, ok := store.(*ObjectStore)
+	if !ok {
+		return "", storage.ErrPresignUnsupported
+	}
+	presigner, ok := s.Client.(storage.Presigner)
+	if !ok {
+		return "", storage.ErrPresignUnsupported
+	}
+	scheme, bucket, key, ok := storage.ParseURL(uri)
+	if !ok || scheme != s.Scheme || bucket != s.Bucket || key == "" {
+		return "", fmt.Errorf("not an artifact of this store: %s", uri)
+	}
+	return presigner.PresignGetObject(bucket, key, expires, storage.DownloadOptions{ContentType: contentType, Filename: filename})
+}
+
+// NewStoreFromConfig builds the configured store: a local directory or an
+// s3://, gs:// or az://bucket/prefix URL. It returns nil when unset, which
+// disables artifact collection.
+func NewStoreFromConfig(c config.Artifacts) (Store, error) {
+	target := c.Store
+	if target == "" {
+		return nil, nil
+	}
+
+	if scheme, bucket, prefix, ok := storage.ParseURL(target); ok {
+		client, err := storage.NewClientFromEnv(scheme)
+		if err != nil {
+			return nil, err
+		}
+		return &ObjectStore{Client: client, Scheme: scheme, Bucket: bucket, Prefix: prefix}, nil
+	}
+	if strings.Contains(target, "://") && !strings.HasPrefix(target, "file://") {
+		return nil, fmt.Errorf("invalid ARTIFACT_STORE %q", target)
+	}
+
+	root, err := filepath.Abs(strings.TrimPrefix(target, "file://"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ARTIFACT_STORE %q: %w", target, err)
+	}
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create artifact store %s: %w", root, err)
+	}
+	return &LocalStore{Root: root}, nil
+}
+
+// settings is the artifact configuration, see Configure
+var settings = config.Default().Artifacts
+
+// Configure installs the artifact configuration. It must be called before
+// Default.
+func Configure(c config.Artifacts) {
+	settings = c
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore Store
+	defaultErr   error
+)
+
+// Default returns the process-wide store built from the configuration
+func Default() (Store, error) {
+	defaultOnce.Do(func() {
+		defaultStore, defaultErr = NewStoreFromConfig(settings)
+		if defaultErr == nil && defaultStore != nil {
+			logging.Log(context.Background(), fmt.Sprintf("Artifact store enabled: %s", settings.Store), slog.LevelInfo)
+		}
+	})
+	return defaultStore, defaultErr
+}
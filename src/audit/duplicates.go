@@ -0,0 +1,138 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package audit checks the execution history for violations of the
+// at-most-once guarantee: a task run by two workers at the same time, or
+// completed more than once.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"continuumworker/src/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Kinds of duplicate execution
+const (
+	// KindOverlap is two attempts of the task whose execution windows overlap
+	KindOverlap = "overlap"
+	// KindMultipleCompletions is two attempts that both completed the task
+	KindMultipleCompletions = "multiple_completions"
+)
+
+const metricDuplicates = "worker_duplicate_executions"
+
+// scanWindow bounds each scan to attempts that finished recently. Pairs
+// already recorded are skipped, so consecutive scans may overlap freely.
+const scanWindow = time.Hour
+
+// Duplicate is a pair of attempts of the same task that violates at-most-once
+// execution
+type Duplicate struct {
+	TaskID        int       `json:"task_id"`
+	Kind          string    `json:"kind"`
+	FirstAttempt  int64     `json:"first_attempt"`
+	SecondAttempt int64     `json:"second_attempt"`
+	FirstWorker   string    `json:"first_worker"`
+	SecondWorker  string    `json:"second_worker"`
+	DetectedAt    time.Time `json:"detected_at"`
+}
+
+// RegisterMetrics registers the duplicate detector metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricDuplicates, "Number of duplicate task executions detected, by kind", "Execution")
+}
+
+// Scan records every pair of attempts that finished within window and
+// overlaps or double-completes a task in DUPLICATE_EXECUTIONS, and returns
+// the pairs that weren't recorded before. Workers run it concurrently; the
+// unique constraint makes each pair reported once across the fleet.
+func Scan(ctx context.Context, db *sql.DB, window time.Duration) ([]Duplicate, error) {
+	rows, err := db.QueryContext(ctx, `
+		INSERT INTO DUPLICATE_EXECUTIONS (task_id, kind, first_attempt, second_attempt, first_worker, second_worker)
+		SELECT a.task_id,
+			CASE WHEN a.started_at < b.finished_at AND b.started_at < a.finished_at THEN $2 ELSE $3 END,
+			a.id, b.id, a.worker_id, b.worker_id
+		FROM TASK_ATTEMPTS b
+		JOIN TASK_ATTEMPTS a ON a.task_id = b.task_id AND a.id < b.id
+		WHERE b.finished_at > NOW() - $1 * INTERVAL '1 second'
+		AND (
+			(a.started_at < b.finished_at AND b.started_at < a.finished_at)
+			OR (a.outcome = 'completed' AND b.outcome = 'completed')
+		)
+		ON CONFLICT (first_attempt, second_attempt) DO NOTHING
+		RETURNING task_id, kind, first_attempt, second_attempt, COALESCE(first_worker, ''), COALESCE(second_worker, ''), detected_at`,
+		window.Seconds(), KindOverlap, KindMultipleCompletions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for duplicate executions: %w", err)
+	}
+	return scanDuplicates(rows)
+}
+
+// List returns the duplicates detected since the given time, oldest first
+func List(ctx context.Context, db *sql.DB, since time.Time) ([]Duplicate, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT task_id, kind, first_attempt, second_attempt, COALESCE(first_worker, ''), COALESCE(second_worker, ''), detected_at
+		FROM DUPLICATE_EXECUTIONS
+		WHERE detected_at >= $1
+		ORDER BY detected_at, id`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicate executions: %w", err)
+	}
+	return scanDuplicates(rows)
+}
+
+func scanDuplicates(rows *sql.Rows) ([]Duplicate, error) {
+	defer rows.Close()
+
+	var found []Duplicate
+	for rows.Next() {
+		var d Duplicate
+		if err := rows.Scan(&d.TaskID, &d.Kind, &d.FirstAttempt, &d.SecondAttempt, &d.FirstWorker, &d.SecondWorker, &d.DetectedAt); err != nil {
+			return nil, err
+		}
+		found = append(found, d)
+	}
+	return found, rows.Err()
+}
+
+// RunDetector scans for duplicate executions every interval until ctx is
+// cancelled, counting and alerting on each new one
+func RunDetector(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			found, err := Scan(ctx, db, max(scanWindow, 2*interval))
+			if err != nil {
+				if ctx.Err() == nil {
+					logging.Log(ctx, fmt.Sprintf("Error detecting duplicate executions: %v", err), slog.LevelWarn)
+				}
+				continue
+			}
+			for _, d := range found {
+				logging.Inc(ctx, metricDuplicates, attribute.String("kind", d.Kind))
+				logging.Log(ctx, fmt.Sprintf("ALERT: task %d executed more than once (%s): attempt %d on worker %s and attempt %d on worker %s",
+					d.TaskID, d.Kind, d.FirstAttempt, d.FirstWorker, d.SecondAttempt, d.SecondWorker), slog.LevelError)
+			}
+		}
+	}
+}
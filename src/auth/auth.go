@@ -0,0 +1,196 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package auth authenticates API requests carrying a bearer token, either a
+// static API key or an HS256 JWT, and checks the role it grants.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"continuumworker/src/config"
+)
+
+// Role is what a token may do. Each role includes the ones below it.
+type Role int
+
+const (
+	RoleNone Role = iota
+	// RoleRead reads status, tasks, outputs and reports
+	RoleRead
+	// RoleOperator also submits tasks and drains the worker
+	RoleOperator
+)
+
+// parseRole returns the role named name, read or operator
+func parseRole(name string) (Role, error) {
+	switch name {
+	case "read":
+		return RoleRead, nil
+	case "operator":
+		return RoleOperator, nil
+	}
+	return RoleNone, fmt.Errorf("unknown role %q, must be read or operator", name)
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleRead:
+		return "read"
+	case RoleOperator:
+		return "operator"
+	}
+	return "none"
+}
+
+var (
+	// ErrNoToken is returned for a request without a bearer token
+	ErrNoToken = errors.New("missing bearer token")
+	// ErrInvalidToken is returned for an unknown API key or a JWT that doesn't
+	// verify, has expired or grants no role
+	ErrInvalidToken = errors.New("invalid bearer token")
+	// ErrNotConfigured is returned for every request while no credential is
+	// configured and authentication isn't disabled
+	ErrNotConfigured = errors.New("API authentication is not configured")
+)
+
+// Authenticator checks bearer tokens against the configured API keys and JWT
+// secret
+type Authenticator struct {
+	keys      map[[sha256.Size]byte]Role // API keys by SHA-256, so lookups take no secret-dependent time
+	jwtSecret []byte
+	// open lets every request through with the operator role (API_AUTH_DISABLED)
+	open bool
+}
+
+// New returns the authenticator of the API configuration
+func New(cfg config.API) *Authenticator {
+	a := &Authenticator{keys: make(map[[sha256.Size]byte]Role), open: cfg.AuthDisabled}
+	for _, key := range cfg.ReadTokens {
+		a.keys[sha256.Sum256([]byte(key))] = RoleRead
+	}
+	// An operator key listed as both gets the higher role
+	for _, key := range cfg.OperatorTokens {
+		a.keys[sha256.Sum256([]byte(key))] = RoleOperator
+	}
+	if cfg.JWTSecret != "" {
+		a.jwtSecret = []byte(cfg.JWTSecret)
+	}
+	return a
+}
+
+// Enabled reports whether requests are authenticated, that is unless
+// API_AUTH_DISABLED lets every request through with the operator role
+func (a *Authenticator) Enabled() bool {
+	return !a.open
+}
+
+// Configured reports whether any credential is configured. Without one an
+// enabled authenticator refuses every request.
+func (a *Authenticator) Configured() bool {
+	return len(a.keys) > 0 || a.jwtSecret != nil
+}
+
+// Authenticate returns the role granted by the request's bearer token
+func (a *Authenticator) Authenticate(r *http.Request) (Role, error) {
+	if a.open {
+		return RoleOperator, nil
+	}
+	if !a.Configured() {
+		return RoleNone, ErrNotConfigured
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return RoleNone, ErrNoToken
+	}
+	if role, ok := a.keys[sha256.Sum256([]byte(token))]; ok {
+		return role, nil
+	}
+	if a.jwtSecret != nil && strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token, time.Now())
+	}
+	return RoleNone, ErrInvalidToken
+}
+
+// Require wraps next so it only serves requests granted at least role:
+// 401 without a valid token, 403 with one granting less
+func (a *Authenticator) Require(role Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="continuum"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if granted < role {
+			http.Error(w, "This endpoint requires the "+role.String()+" role", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// claims are the JWT claims checked; role is read or operator
+type claims struct {
+	Role      string `json:"role"`
+	ExpiresAt *int64 `json:"exp"`
+	NotBefore *int64 `json:"nbf"`
+}
+
+// verifyJWT checks an HS256 JWT signed with the secret and returns its role
+func (a *Authenticator) verifyJWT(token string, now time.Time) (Role, error) {
+	parts := strings.Split(token, ".")
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return RoleNone, ErrInvalidToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if json.Unmarshal(header, &h) != nil || h.Alg != "HS256" {
+		return RoleNone, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return RoleNone, ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return RoleNone, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return RoleNone, ErrInvalidToken
+	}
+	var c claims
+	if json.Unmarshal(payload, &c) != nil {
+		return RoleNone, ErrInvalidToken
+	}
+	if c.ExpiresAt != nil && now.Unix() >= *c.ExpiresAt || c.NotBefore != nil && now.Unix() < *c.NotBefore {
+		return RoleNone, ErrInvalidToken
+	}
+	role, err := parseRole(c.Role)
+	if err != nil {
+		return RoleNone, ErrInvalidToken
+	}
+	return role, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"continuumworker/src/config"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keys := config.API{ReadTokens: []string{"reader"}, OperatorTokens: []string{"operator"}}
+	tests := []struct {
+		name    string
+		cfg     config.API
+		token   string
+		want    Role
+		wantErr error
+	}{
+		{name: "no credentials", cfg: config.API{}, wantErr: ErrNotConfigured},
+		{name: "no credentials with a token", cfg: config.API{}, token: "anything", wantErr: ErrNotConfigured},
+		{name: "disabled", cfg: config.API{AuthDisabled: true}, want: RoleOperator},
+		{name: "missing token", cfg: keys, wantErr: ErrNoToken},
+		{name: "unknown token", cfg: keys, token: "other", wantErr: ErrInvalidToken},
+		{name: "read key", cfg: keys, token: "reader", want: RoleRead},
+		{name: "operator key", cfg: keys, token: "operator", want: RoleOperator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/status", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			got, err := New(tt.cfg).Authenticate(r)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Fatalf("Authenticate() = %s, %v; want %s, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
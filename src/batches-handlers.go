@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"continuumworker/src/submit"
+)
+
+// createBatchHandler creates a batch of tasks from the request body, see
+// submit.CreateBatch
+func (s *APIServer) createBatchHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmitBodyBytes)
+
+	var req submit.BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := submit.CreateBatch(r.Context(), s.db, req)
+	switch {
+	case errors.Is(err, submit.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, submit.ErrUnknownCode), errors.Is(err, submit.ErrUnknownVersion):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to create batch", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/batches/"+resp.ID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// batchHandler returns the aggregate progress of a batch
+func (s *APIServer) batchHandler(w http.ResponseWriter, r *http.Request) {
+	batch, err := submit.GetBatch(r.Context(), s.db, r.PathValue("id"))
+	if errors.Is(err, submit.ErrUnknownBatch) {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query batch", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(batch)
+}
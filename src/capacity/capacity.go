@@ -0,0 +1,212 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package capacity turns the task history into fleet sizing advice: how many
+// concurrent executions each queue needs to meet a queue-wait SLO at its peak
+// arrival rate, how many workers that is, and which resource limits match
+// the tasks' measured usage.
+package capacity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// headroom is added to measured usage when recommending resource limits
+const headroom = 1.25
+
+// Options select the history analyzed and the target to size for
+type Options struct {
+	Since, Until time.Time     // Tasks submitted in [Since, Until)
+	SLO          time.Duration // Target queue wait, from submission (or run_at) to first start
+	Percentile   float64       // Share of tasks that must start within the SLO, e.g. 0.95
+	Concurrency  int           // Executions per worker (MAX_CONCURRENT_EXECS)
+	// Limits of tasks whose queue sets none (CONTAINER_MEMORY_MB, CONTAINER_CPU_LIMIT)
+	DefaultMemoryMB int64
+	DefaultCPULimit float64
+}
+
+// QueueReport is the measured load of one queue and the capacity it needs.
+// Durations are in seconds.
+type QueueReport struct {
+	Queue               string  `json:"queue"` // "" for tasks submitted without a queue
+	Tasks               int     `json:"tasks"`
+	ArrivalsPerHour     float64 `json:"arrivals_per_hour"`
+	PeakArrivalsPerHour int     `json:"peak_arrivals_per_hour"`
+	WaitP50             float64 `json:"wait_p50_seconds"`
+	WaitP95             float64 `json:"wait_p95_seconds"`
+	RuntimeMean         float64 `json:"runtime_mean_seconds"`
+	RuntimeP95          float64 `json:"runtime_p95_seconds"`
+	MemoryP99MB         float64 `json:"memory_p99_mb"`
+	MemoryMaxMB         float64 `json:"memory_max_mb"`
+	CPUCoresP95         float64 `json:"cpu_cores_p95"` // CPU seconds per second of runtime
+	CurrentMemoryMB     int64   `json:"current_memory_mb"`
+	CurrentCPULimit     float64 `json:"current_cpu_limit"`
+
+	Slots    int      `json:"recommended_slots"` // Concurrent executions meeting the SLO at peak
+	MemoryMB int64    `json:"recommended_memory_mb"`
+	CPULimit float64  `json:"recommended_cpu_limit"`
+	Notes    []string `json:"notes,omitempty"`
+}
+
+// Report is the capacity recommendation for the whole fleet
+type Report struct {
+	Since       time.Time     `json:"since"`
+	Until       time.Time     `json:"until"`
+	SLO         string        `json:"slo"`
+	Percentile  float64       `json:"percentile"`
+	Concurrency int           `json:"concurrency"`
+	Queues      []QueueReport `json:"queues"`
+	Slots       int           `json:"recommended_slots"`
+	Workers     int           `json:"recommended_workers"`
+}
+
+// Analyze reads the tasks submitted in the window and sizes every queue for
+// the SLO. Queues are sized independently, so the fleet total is what a
+// fleet serving all of them at their peaks needs.
+func Analyze(ctx context.Context, db *sql.DB, opts Options) (Report, error) {
+	if opts.Percentile <= 0 || opts.Percentile >= 1 {
+		return Report{}, fmt.Errorf("percentile must be between 0 and 1, got %g", opts.Percentile)
+	}
+	if !opts.Until.After(opts.Since) {
+		return Report{}, fmt.Errorf("empty window: %s to %s", opts.Since.Format(time.RFC3339), opts.Until.Format(time.RFC3339))
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	report := Report{Since: opts.Since, Until: opts.Until, SLO: opts.SLO.String(), Percentile: opts.Percentile, Concurrency: opts.Concurrency}
+
+	// Waits count from run_at for scheduled tasks; a task's CPU share is its
+	// CPU time over the wall time of its last execution
+	rows, err := db.QueryContext(ctx, `
+		WITH window_tasks AS (
+			SELECT COALESCE(t.queue, '') AS queue, t.created_at,
+				EXTRACT(EPOCH FROM t.first_started_at - GREATEST(t.created_at, COALESCE(t.run_at, t.created_at))) AS wait,
+				EXTRACT(EPOCH FROM t.finished - t.started) AS runtime,
+				t.cpu_seconds, t.peak_memory_bytes / 1048576.0 AS memory_mb
+			FROM TASKS t
+			WHERE t.created_at >= $1 AND t.created_at < $2
+		),
+		hourly AS (
+			SELECT queue, MAX(n) AS peak
+			FROM (SELECT queue, date_trunc('hour', created_at), COUNT(*) AS n FROM window_tasks GROUP BY 1, 2) h
+			GROUP BY queue
+		)
+		SELECT w.queue, COUNT(*), h.peak,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY w.wait), percentile_cont(0.95) WITHIN GROUP (ORDER BY w.wait),
+			AVG(w.runtime), percentile_cont(0.95) WITHIN GROUP (ORDER BY w.runtime),
+			percentile_cont(0.99) WITHIN GROUP (ORDER BY w.memory_mb), MAX(w.memory_mb),
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY w.cpu_seconds / NULLIF(w.runtime, 0)),
+			COALESCE(MAX(q.memory_mb), 0), COALESCE(MAX(q.cpu_limit), 0)
+		FROM window_tasks w
+		JOIN hourly h ON h.queue = w.queue
+		LEFT JOIN QUEUES q ON q.name = w.queue
+		GROUP BY w.queue, h.peak
+		ORDER BY w.queue`, opts.Since, opts.Until)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to read task history: %w", err)
+	}
+	defer rows.Close()
+
+	hours := opts.Until.Sub(opts.Since).Hours()
+	for rows.Next() {
+		var q QueueReport
+		var waitP50, waitP95, runtimeMean, runtimeP95, memoryP99, memoryMax, cpuP95 sql.NullFloat64
+		if err := rows.Scan(&q.Queue, &q.Tasks, &q.PeakArrivalsPerHour, &waitP50, &waitP95, &runtimeMean, &runtimeP95,
+			&memoryP99, &memoryMax, &cpuP95, &q.CurrentMemoryMB, &q.CurrentCPULimit); err != nil {
+			return Report{}, err
+		}
+		q.WaitP50, q.WaitP95 = waitP50.Float64, waitP95.Float64
+		q.RuntimeMean, q.RuntimeP95 = runtimeMean.Float64, runtimeP95.Float64
+		q.MemoryP99MB, q.MemoryMaxMB, q.CPUCoresP95 = memoryP99.Float64, memoryMax.Float64, cpuP95.Float64
+		if hours > 0 {
+			q.ArrivalsPerHour = float64(q.Tasks) / hours
+		}
+		if q.CurrentMemoryMB == 0 {
+			q.CurrentMemoryMB = opts.DefaultMemoryMB
+		}
+		if q.CurrentCPULimit == 0 {
+			q.CurrentCPULimit = opts.DefaultCPULimit
+		}
+		recommend(&q, opts)
+		report.Queues = append(report.Queues, q)
+		report.Slots += q.Slots
+	}
+	if err := rows.Err(); err != nil {
+		return Report{}, err
+	}
+	report.Workers = (report.Slots + opts.Concurrency - 1) / opts.Concurrency
+	return report, nil
+}
+
+// recommend fills the queue's slots and resource limits, and notes where the
+// current settings fall short of the measured load
+func recommend(q *QueueReport, opts Options) {
+	q.Slots = slotsFor(float64(q.PeakArrivalsPerHour)/3600, q.RuntimeMean, opts.SLO, opts.Percentile)
+
+	if q.MemoryP99MB > 0 {
+		// Rounded up to 64 MB steps
+		q.MemoryMB = int64(math.Ceil(q.MemoryP99MB*headroom/64)) * 64
+	}
+	if q.CPUCoresP95 > 0 {
+		// Rounded up to quarter cores
+		q.CPULimit = math.Ceil(q.CPUCoresP95*headroom*4) / 4
+	}
+
+	if slo := opts.SLO.Seconds(); q.WaitP95 > slo {
+		q.Notes = append(q.Notes, fmt.Sprintf("p95 wait %s is over the %s SLO", seconds(q.WaitP95), opts.SLO))
+	}
+	if q.CurrentMemoryMB > 0 && q.MemoryMaxMB >= 0.9*float64(q.CurrentMemoryMB) {
+		q.Notes = append(q.Notes, fmt.Sprintf("peak memory %.0f MB is near the %d MB limit, tasks risk OOM kills", q.MemoryMaxMB, q.CurrentMemoryMB))
+	} else if q.MemoryMB > 0 && q.CurrentMemoryMB > 4*q.MemoryMB {
+		q.Notes = append(q.Notes, fmt.Sprintf("memory limit %d MB is over 4x the recommended %d MB", q.CurrentMemoryMB, q.MemoryMB))
+	}
+	if q.CurrentCPULimit > 0 && q.CPUCoresP95 >= 0.9*q.CurrentCPULimit {
+		q.Notes = append(q.Notes, fmt.Sprintf("p95 CPU use %.2f cores is at the %.2f limit, tasks are throttled", q.CPUCoresP95, q.CurrentCPULimit))
+	}
+}
+
+// slotsFor returns the fewest concurrent executions (an M/M/c queue) for
+// which the share of tasks waiting longer than slo stays under 1-percentile,
+// given the arrival rate (per second) and the mean runtime (seconds)
+func slotsFor(arrivalRate, meanRuntime float64, slo time.Duration, percentile float64) int {
+	if arrivalRate <= 0 || meanRuntime <= 0 {
+		return 0
+	}
+	load := arrivalRate * meanRuntime
+	for c := int(math.Floor(load)) + 1; ; c++ {
+		// The wait of a queued task is exponential with rate c/runtime - arrivals
+		late := erlangC(c, load) * math.Exp(-(float64(c)/meanRuntime-arrivalRate)*slo.Seconds())
+		if late <= 1-percentile {
+			return c
+		}
+	}
+}
+
+// erlangC is the probability that a task has to queue with c slots and an
+// offered load (arrival rate times mean runtime) below c
+func erlangC(c int, load float64) float64 {
+	// Erlang B by recurrence, then C from B
+	b := 1.0
+	for k := 1; k <= c; k++ {
+		b = load * b / (float64(k) + load*b)
+	}
+	rho := load / float64(c)
+	return b / (1 - rho + rho*b)
+}
+
+// seconds formats a duration in seconds for notes
+func seconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Second).String()
+}
@@ -0,0 +1,431 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// continuumctl is the operator command line for a Continuum deployment.
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"continuumworker/src/audit"
+	"continuumworker/src/capacity"
+	"continuumworker/src/codestore"
+	"continuumworker/src/compression"
+	"continuumworker/src/config"
+	"continuumworker/src/dbwrite"
+	"continuumworker/src/export"
+	"continuumworker/src/pgdb"
+	"continuumworker/src/receipts"
+	"continuumworker/src/retention"
+
+	"github.com/joho/godotenv"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: continuumctl <command> [flags]
+
+Commands:
+  archive           Move expired tasks out of TASKS now, as the workers' retention job does
+  capacity          Recommend fleet size, concurrency and resource limits for a queue-wait SLO
+  check-duplicates  Fail if any task was executed more than once (for CI correctness gates)
+  export            Export task history to CSV or Parquet (local file, or s3://, gs:// or az://bucket/key)
+  replay-journal    Re-apply task writes a worker journaled while the database was failing
+  verify-receipt    Check a completed task's signed receipt against its code, payload and output`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	// .env is optional for the CLI; the environment may already be set
+	_ = godotenv.Load()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "archive":
+		err = runArchive(ctx, os.Args[2:])
+	case "capacity":
+		err = runCapacity(ctx, os.Args[2:])
+	case "check-duplicates":
+		err = runCheckDuplicates(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "replay-journal":
+		err = runReplayJournal(ctx, os.Args[2:])
+	case "verify-receipt":
+		err = runVerifyReceipt(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		usage()
+		return
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// openDB connects with the same configuration (config.yaml and DB_*) as the worker
+func openDB() (*sql.DB, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return pgdb.Open(cfg.Database)
+}
+
+func runReplayJournal(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay-journal", flag.ExitOnError)
+	file := fs.String("file", "", "Journal to replay (default: DB_WRITE_JOURNAL)")
+	fs.Parse(args)
+
+	path := *file
+	if path == "" {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		path = cfg.Database.JournalPath
+	}
+	if path == "" {
+		return fmt.Errorf("no journal configured, pass -file")
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, remaining, err := dbwrite.Replay(ctx, db, path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Replayed %d writes from %s, %d still failing\n", applied, path, remaining)
+	return nil
+}
+
+func runArchive(ctx context.Context, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	olderThan := fs.Duration("older-than", cfg.Retention.TTL, "Archive tasks finished longer ago than this (default: TASK_RETENTION_TTL)")
+	fs.StringVar(&cfg.Retention.Destination, "to", cfg.Retention.Destination, "s3://, gs:// or az://bucket/prefix for JSONL exports (default: the TASKS_ARCHIVE table)")
+	fs.Parse(args)
+
+	if *olderThan <= 0 {
+		return fmt.Errorf("no retention TTL configured, pass -older-than")
+	}
+	cfg.Retention.TTL = *olderThan
+
+	db, err := pgdb.Open(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	count, err := retention.Archive(ctx, db, cfg.Retention)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Archived %d tasks finished more than %s ago\n", count, cfg.Retention.TTL)
+	return nil
+}
+
+func runCapacity(ctx context.Context, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("capacity", flag.ExitOnError)
+	since := fs.String("since", "168h", "Analyze tasks submitted at or after this time (RFC3339 or duration like 168h)")
+	until := fs.String("until", "", "Analyze tasks submitted before this time (RFC3339, default: now)")
+	slo := fs.Duration("slo", time.Minute, "Target queue wait, from submission to start")
+	percentile := fs.Float64("percentile", 0.95, "Share of tasks that must start within the SLO")
+	concurrency := fs.Int("concurrency", cfg.Container.MaxConcurrentExecs, "Executions per worker (default: MAX_CONCURRENT_EXECS)")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	fs.Parse(args)
+
+	opts := capacity.Options{
+		SLO:             *slo,
+		Percentile:      *percentile,
+		Concurrency:     *concurrency,
+		DefaultMemoryMB: cfg.Container.MemoryMB,
+		DefaultCPULimit: cfg.Container.CPULimit,
+	}
+	if opts.Since, err = parseTimeBound(*since); err != nil || opts.Since.IsZero() {
+		return fmt.Errorf("invalid -since: %q", *since)
+	}
+	if opts.Until, err = parseTimeBound(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+	if opts.Until.IsZero() {
+		opts.Until = time.Now()
+	}
+
+	db, err := pgdb.Open(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := capacity.Analyze(ctx, db, opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	printCapacity(report)
+	return nil
+}
+
+// printCapacity writes the capacity report as a table followed by the notes
+func printCapacity(r capacity.Report) {
+	fmt.Printf("Tasks submitted %s to %s, sized for %.0f%% of tasks starting within %s\n\n",
+		r.Since.Format(time.RFC3339), r.Until.Format(time.RFC3339), r.Percentile*100, r.SLO)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUEUE\tTASKS\tPEAK/H\tWAIT P95\tRUNTIME AVG\tSLOTS\tMEMORY MB (NOW)\tCPU (NOW)")
+	for _, q := range r.Queues {
+		name := q.Queue
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1fs\t%.1fs\t%d\t%d (%d)\t%.2f (%.2f)\n", name, q.Tasks, q.PeakArrivalsPerHour,
+			q.WaitP95, q.RuntimeMean, q.Slots, q.MemoryMB, q.CurrentMemoryMB, q.CPULimit, q.CurrentCPULimit)
+	}
+	tw.Flush()
+
+	fmt.Printf("\nRecommended: %d concurrent executions, %d workers at %d executions each\n", r.Slots, r.Workers, r.Concurrency)
+	for _, q := range r.Queues {
+		name := q.Queue
+		if name == "" {
+			name = "(none)"
+		}
+		for _, note := range q.Notes {
+			fmt.Printf("  %s: %s\n", name, note)
+		}
+	}
+}
+
+// errDuplicates makes check-duplicates exit non-zero
+var errDuplicates = errors.New("at-most-once execution violated")
+
+func runCheckDuplicates(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("check-duplicates", flag.ExitOnError)
+	since := fs.String("since", "1h", "Check attempts finished at or after this time (RFC3339 or duration like 30m)")
+	fs.Parse(args)
+
+	from, err := parseTimeBound(*since)
+	if err != nil || from.IsZero() {
+		return fmt.Errorf("invalid -since: %q", *since)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Scan now rather than wait for the workers' detector, then report
+	// everything detected in the window, including earlier scans
+	if _, err := audit.Scan(ctx, db, time.Since(from)); err != nil {
+		return err
+	}
+	found, err := audit.List(ctx, db, from)
+	if err != nil {
+		return err
+	}
+	for _, d := range found {
+		fmt.Printf("task %d: %s, attempt %d (worker %s) and attempt %d (worker %s)\n",
+			d.TaskID, d.Kind, d.FirstAttempt, d.FirstWorker, d.SecondAttempt, d.SecondWorker)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%d duplicate executions since %s: %w", len(found), from.Format(time.RFC3339), errDuplicates)
+	}
+	fmt.Printf("No duplicate executions since %s\n", from.Format(time.RFC3339))
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "Output format (csv, parquet)")
+	columns := fs.String("columns", strings.Join(export.DefaultColumns, ","), "Comma-separated TASKS columns to export")
+	since := fs.String("since", "", "Only tasks finished at or after this time (RFC3339 or duration like 168h)")
+	until := fs.String("until", "", "Only tasks finished before this time (RFC3339)")
+	out := fs.String("out", "", "Destination file path, or s3://, gs:// or az://bucket/key")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	opts := export.Options{
+		Format:      *format,
+		Destination: *out,
+	}
+	for _, c := range strings.Split(*columns, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			opts.Columns = append(opts.Columns, c)
+		}
+	}
+
+	var err error
+	if opts.Since, err = parseTimeBound(*since); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if opts.Until, err = parseTimeBound(*until); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	count, err := export.Run(ctx, db, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d tasks to %s\n", count, *out)
+	return nil
+}
+
+func runVerifyReceipt(ctx context.Context, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("verify-receipt", flag.ExitOnError)
+	taskID := fs.Int("task", 0, "ID of the task whose receipt to verify")
+	keys := fs.String("keys", strings.Join(cfg.Receipts.PublicKeys, ","), "Comma-separated base64 public keys to trust (default: RECEIPT_PUBLIC_KEYS)")
+	fs.Parse(args)
+
+	if *taskID <= 0 {
+		return fmt.Errorf("-task is required")
+	}
+
+	// The configured signing key is trusted as well, so a worker's own
+	// environment verifies its receipts
+	var trusted []ed25519.PublicKey
+	for _, k := range strings.Split(*keys, ",") {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		pub, err := receipts.ParsePublicKey(k)
+		if err != nil {
+			return err
+		}
+		trusted = append(trusted, pub)
+	}
+	if cfg.Receipts.SigningKey != "" {
+		key, err := receipts.ParsePrivateKey(cfg.Receipts.SigningKey)
+		if err != nil {
+			return err
+		}
+		trusted = append(trusted, key.Public().(ed25519.PublicKey))
+	}
+	if len(trusted) == 0 {
+		return fmt.Errorf("no trusted keys, pass -keys or set RECEIPT_PUBLIC_KEYS")
+	}
+
+	db, err := pgdb.Open(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// The code is read at the version the receipt was issued for
+	var encoded, payload, output, code string
+	var packedPayload, packedOutput, packedCode []byte
+	var ref codestore.Ref
+	err = db.QueryRowContext(ctx, `
+		SELECT COALESCE(t.receipt::TEXT, ''), COALESCE(t.payload::TEXT, ''), t.payload_zstd, COALESCE(t.output, ''), t.output_zstd,
+			COALESCE(cv.code, ''), cv.code_zstd, COALESCE(cv.object_uri, ''), COALESCE(cv.sha256, '')
+		FROM TASKS t
+		LEFT JOIN CODE_CONTENTS cv ON cv.code_id = t.code AND cv.version = (t.receipt->>'code_version')::INT
+		WHERE t.id = $1`, *taskID).Scan(&encoded, &payload, &packedPayload, &output, &packedOutput, &code, &packedCode, &ref.ObjectURI, &ref.SHA256)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("task %d not found", *taskID)
+	}
+	if err != nil {
+		return err
+	}
+	if encoded == "" {
+		return fmt.Errorf("task %d has no receipt", *taskID)
+	}
+
+	var receipt receipts.Receipt
+	if err := json.Unmarshal([]byte(encoded), &receipt); err != nil {
+		return fmt.Errorf("malformed receipt: %w", err)
+	}
+	if payload, err = compression.Unpack(payload, packedPayload); err != nil {
+		return err
+	}
+	if output, err = compression.Unpack(output, packedOutput); err != nil {
+		return err
+	}
+	if ref.Code, err = compression.Unpack(code, packedCode); err != nil {
+		return err
+	}
+	store, err := codestore.NewStoreFromConfig(cfg.Code)
+	if err != nil {
+		return err
+	}
+	if code, err = store.Get(ctx, ref); err != nil {
+		return fmt.Errorf("failed to read code version %d: %w", receipt.CodeVersion, err)
+	}
+
+	if err := receipts.Verify(receipt, trusted, *taskID, code, payload, output); err != nil {
+		return err
+	}
+	fmt.Printf("Receipt of task %d is valid: signed by worker %s with key %s, finished at %s\n",
+		*taskID, receipt.WorkerID, receipt.KeyID, receipt.FinishedAt.Format(time.RFC3339))
+	return nil
+}
+
+// parseTimeBound accepts either an absolute RFC3339 time or a duration
+// relative to now (e.g. "24h" means 24 hours ago).
+func parseTimeBound(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"continuumworker/src/results"
+	"continuumworker/src/submit"
+)
+
+// codeVersionsHandler lists the versions of a stored code
+func (s *APIServer) codeVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	versions, err := submit.Versions(r.Context(), s.db, r.PathValue("id"))
+	if errors.Is(err, submit.ErrUnknownCode) {
+		http.Error(w, "Code not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query code versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(versions)
+}
+
+// publishCodeHandler stores a new version of a code and makes it current
+func (s *APIServer) publishCodeHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmitBodyBytes)
+
+	var req struct {
+		Code         string          `json:"code"`
+		JSONSchema   json.RawMessage `json:"json_schema,omitempty"`
+		ResultFormat string          `json:"result_format,omitempty"`
+		ResultSchema string          `json:"result_schema,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	codeID := r.PathValue("id")
+	version, err := submit.Publish(r.Context(), s.db, codeID, req.Code, req.JSONSchema,
+		results.Contract{Format: req.ResultFormat, Schema: req.ResultSchema})
+	if !writeCodeError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/codes/%s/versions", codeID))
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(version)
+}
+
+// rollbackCodeHandler makes another version of a code current, the previous
+// one unless the body names a version
+func (s *APIServer) rollbackCodeHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Version submit.CodeVersion `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, err := submit.Rollback(r.Context(), s.db, r.PathValue("id"), req.Version)
+	if !writeCodeError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(version)
+}
+
+// codeWarmup is the body of the warm-up endpoints
+type codeWarmup struct {
+	Warmup string `json:"warmup"`
+}
+
+// codeWarmupHandler returns the warm-up snippet of a stored code
+func (s *APIServer) codeWarmupHandler(w http.ResponseWriter, r *http.Request) {
+	warmup, err := submit.Warmup(r.Context(), s.db, r.PathValue("id"))
+	if errors.Is(err, submit.ErrUnknownCode) {
+		http.Error(w, "Code not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query code warm-up", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(codeWarmup{Warmup: warmup})
+}
+
+// setCodeWarmupHandler registers (or, when empty, removes) the warm-up
+// snippet of a stored code
+func (s *APIServer) setCodeWarmupHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmitBodyBytes)
+
+	var req codeWarmup
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !writeCodeError(w, submit.SetWarmup(r.Context(), s.db, r.PathValue("id"), req.Warmup)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(req)
+}
+
+// writeCodeError answers a failed code change, and reports whether there
+// was none
+func writeCodeError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, submit.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, submit.ErrUnknownCode):
+		http.Error(w, "Code not found", http.StatusNotFound)
+	case errors.Is(err, submit.ErrUnknownVersion):
+		http.Error(w, "Unknown code version", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to update code", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package codestore keeps task source code. Small scripts stay inline in the
+// CODES table; large scripts and bundles go to object storage and CODES only
+// references them by URI and SHA-256.
+package codestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+	"continuumworker/src/storage"
+)
+
+// ErrChecksumMismatch is returned when fetched code doesn't hash to the
+// SHA-256 recorded in CODES
+var ErrChecksumMismatch = errors.New("code checksum mismatch")
+
+// Ref locates the source of a CODES row: inline Code, or the ObjectURI of an
+// object. SHA256 is the hex digest of the source.
+type Ref struct {
+	Code      string
+	ObjectURI string
+	SHA256    string
+}
+
+// CodeStore stores task source code and reads it back
+type CodeStore interface {
+	Put(ctx context.Context, code string) (Ref, error)
+	Get(ctx context.Context, ref Ref) (string, error)
+}
+
+// Checksum returns the hex SHA-256 of code
+func Checksum(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Postgres keeps all code inline in the CODES.code column
+type Postgres struct{}
+
+func (Postgres) Put(ctx context.Context, code string) (Ref, error) {
+	return Ref{Code: code, SHA256: Checksum(code)}, nil
+}
+
+func (Postgres) Get(ctx context.Context, ref Ref) (string, error) {
+	if ref.ObjectURI != "" {
+		return "", fmt.Errorf("code %s is in object storage but CODE_STORE is not set", ref.ObjectURI)
+	}
+	return ref.Code, nil
+}
+
+// ObjectStore keeps code larger than InlineMaxBytes as objects named by their
+// SHA-256 under a prefix of a bucket, so identical code is uploaded once.
+// Fetched code is cached under CacheDir and verified before use.
+type ObjectStore struct {
+	Client         storage.ObjectClient
+	Scheme         string
+	Bucket         string
+	Prefix         string
+	InlineMaxBytes int
+	CacheDir       string
+}
+
+func (s *ObjectStore) Put(ctx context.Context, code string) (Ref, error) {
+	sum := Checksum(code)
+	if len(code) <= s.InlineMaxBytes {
+		return Ref{Code: code, SHA256: sum}, nil
+	}
+
+	key := strings.TrimPrefix(strings.TrimSuffix(s.Prefix, "/")+"/codes/"+sum+".py", "/")
+	if err := s.Client.PutObject(ctx, s.Bucket, key, strings.NewReader(code), int64(len(code)), "text/x-python"); err != nil {
+		return Ref{}, fmt.Errorf("failed to upload code: %w", err)
+	}
+	// Cache what we just uploaded, a local worker is likely to run it next
+	s.cache(ctx, sum, code)
+	return Ref{ObjectURI: fmt.Sprintf("%s://%s/%s", s.Scheme, s.Bucket, key), SHA256: sum}, nil
+}
+
+func (s *ObjectStore) Get(ctx context.Context, ref Ref) (string, error) {
+	if ref.ObjectURI == "" {
+		return ref.Code, nil
+	}
+	if ref.SHA256 == "" {
+		return "", fmt.Errorf("code %s has no checksum", ref.ObjectURI)
+	}
+	if code, ok := s.cached(ref.SHA256); ok {
+		return code, nil
+	}
+
+	scheme, bucket, key, ok := storage.ParseURL(ref.ObjectURI)
+	if !ok || scheme != s.Scheme || key == "" {
+		return "", fmt.Errorf("code %s is not in the %s code store", ref.ObjectURI, s.Scheme)
+	}
+	body, err := s.Client.GetObject(ctx, bucket, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch code %s: %w", ref.ObjectURI, err)
+	}
+	defer body.Close()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, body); err != nil {
+		return "", fmt.Errorf("failed to fetch code %s: %w", ref.ObjectURI, err)
+	}
+
+	code := buf.String()
+	if sum := Checksum(code); sum != ref.SHA256 {
+		return "", fmt.Errorf("%w: %s has SHA-256 %s, expected %s", ErrChecksumMismatch, ref.ObjectURI, sum, ref.SHA256)
+	}
+	s.cache(ctx, ref.SHA256, code)
+	return code, nil
+}
+
+// cached reads code from the local cache, ignoring a corrupted entry
+func (s *ObjectStore) cached(sum string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(s.CacheDir, sum))
+	if err != nil {
+		return "", false
+	}
+	code := string(data)
+	return code, Checksum(code) == sum
+}
+
+// cache writes code to the local cache; failures only cost a refetch
+func (s *ObjectStore) cache(ctx context.Context, sum string, code string) {
+	if err := writeCache(s.CacheDir, sum, code); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to cache code %s: %v", sum, err), slog.LevelWarn)
+	}
+}
+
+// writeCache renames the file into place so a concurrent reader never sees
+// it half written
+func writeCache(dir, sum, code string) error {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, sum+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // No-op once renamed
+	if _, err := f.WriteString(code); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, sum))
+}
+
+// NewStoreFromConfig builds the configured store: Postgres when Store is
+// unset, otherwise an object store at the s3://, gs:// or az://bucket/prefix URL
+func NewStoreFromConfig(c config.Code) (CodeStore, error) {
+	if c.Store == "" {
+		return Postgres{}, nil
+	}
+
+	scheme, bucket, prefix, ok := storage.ParseURL(c.Store)
+	if !ok {
+		return nil, fmt.Errorf("invalid CODE_STORE %q", c.Store)
+	}
+	client, err := storage.NewClientFromEnv(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectStore{
+		Client:         client,
+		Scheme:         scheme,
+		Bucket:         bucket,
+		Prefix:         prefix,
+		InlineMaxBytes: c.InlineMaxBytes,
+		CacheDir:       c.CacheDir,
+	}, nil
+}
+
+// settings is the code store configuration, see Configure
+var settings = config.Default().Code
+
+// Configure installs the code store configuration. It must be called before
+// Default.
+func Configure(c config.Code) {
+	settings = c
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore CodeStore
+	defaultErr   error
+)
+
+// Default returns the process-wide store built from the configuration
+func Default() (CodeStore, error) {
+	defaultOnce.Do(func() {
+		defaultStore, defaultErr = NewStoreFromConfig(settings)
+		if defaultErr == nil && settings.Store != "" {
+			logging.Log(context.Background(), fmt.Sprintf("Code store enabled: %s", settings.Store), slog.LevelInfo)
+		}
+	})
+	return defaultStore, defaultErr
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package compression stores large text values (payloads, outputs, code)
+// zstd-compressed. A compressed value goes to a BYTEA column next to the
+// plain one (e.g. output_zstd beside output), which is left NULL; a non-NULL
+// *_zstd column is what flags the value as compressed.
+package compression
+
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDecodedBytes bounds the memory a single value may decompress to
+const maxDecodedBytes = 1 << 30
+
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	decoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedBytes), zstd.WithDecoderConcurrency(0))
+)
+
+// Pack returns the arguments to store s as: s itself and nil, or nil and its
+// zstd encoding when s is at least threshold bytes long and shrinks. A
+// threshold of 0 disables compression.
+func Pack(s string, threshold int) (plain any, packed []byte) {
+	if threshold <= 0 || len(s) < threshold {
+		return s, nil
+	}
+	packed = encoder.EncodeAll([]byte(s), make([]byte, 0, len(s)/4))
+	if len(packed) >= len(s) {
+		return s, nil
+	}
+	return nil, packed
+}
+
+// Unpack returns the text of a value stored by Pack: plain when packed is
+// nil, the decompressed packed bytes otherwise
+func Unpack(plain string, packed []byte) (string, error) {
+	if packed == nil {
+		return plain, nil
+	}
+	data, err := decoder.DecodeAll(packed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress stored value: %w", err)
+	}
+	return string(data), nil
+}
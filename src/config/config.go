@@ -0,0 +1,684 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package config loads the worker configuration into a typed, validated
+// Config. Values come from built-in defaults, then an optional YAML file,
+// then environment variables, each layer overriding the previous one.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"continuumworker/src/retry"
+
+	"github.com/docker/go-units"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the complete worker configuration
+type Config struct {
+	Database  Database  `yaml:"database"`
+	Worker    Worker    `yaml:"worker"`
+	API       API       `yaml:"api"`
+	Container Container `yaml:"container"`
+	Analysis  Analysis  `yaml:"analysis"`
+	Artifacts Artifacts `yaml:"artifacts"`
+	Code      Code      `yaml:"code"`
+	Secrets   Secrets   `yaml:"secrets"`
+	Webhooks  Webhooks  `yaml:"webhooks"`
+	Policy    Policy    `yaml:"policy"`
+	Fleet     Fleet     `yaml:"fleet"`
+	Retention Retention `yaml:"retention"`
+	Queue     Queue     `yaml:"queue"`
+	Receipts  Receipts  `yaml:"receipts"`
+}
+
+// Database is the PostgreSQL connection
+type Database struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Name     string `yaml:"name"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// JournalPath is where status and result writes that fail despite
+	// retries are kept for replay; "" only logs them
+	JournalPath string `yaml:"journal_path"`
+	// BreakerThreshold consecutive failed writes open the circuit breaker:
+	// writes go straight to the journal and no task is claimed until the
+	// database answers again, probed every BreakerCooldown. 0 disables it.
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+	// ReplayInterval is how often the journal is replayed automatically
+	// while the database is reachable; 0 leaves it to continuumctl
+	ReplayInterval time.Duration `yaml:"replay_interval"`
+	// Pool sizing and recycling, see database/sql; 0 open conns is unlimited
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// StatementCache prepares each statement once per connection. Disable it
+	// behind a pooler in transaction mode such as PgBouncer.
+	StatementCache bool `yaml:"statement_cache"`
+}
+
+// DSN returns the keyword/value connection string. SSL is always required.
+func (d Database) DSN() string {
+	return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d sslmode=require",
+		d.User, d.Password, d.Name, d.Host, d.Port)
+}
+
+// Worker controls claiming, liveness and recovery
+type Worker struct {
+	Identity              string        `yaml:"identity"`
+	PollingInterval       time.Duration `yaml:"polling_interval"`
+	NotifyMinInterval     time.Duration `yaml:"notify_min_interval"` // Minimum spacing of claims triggered by NOTIFY
+	MinPriority           int           `yaml:"min_priority"`
+	MaxPriority           int           `yaml:"max_priority"`
+	Queues                []string      `yaml:"queues"` // Only claim tasks of these queues; empty claims every task
+	ClaimBatchSize        int           `yaml:"claim_batch_size"`
+	ClaimStrategy         string        `yaml:"claim_strategy"`
+	QueueSampleInterval   time.Duration `yaml:"queue_sample_interval"`
+	Retry                 retry.Policy  `yaml:"retry"` // Default execution retry policy, tasks may override it
+	DrainTimeout          time.Duration `yaml:"drain_timeout"`
+	DrainThreshold        int           `yaml:"drain_threshold"`
+	HeartbeatInterval     time.Duration `yaml:"heartbeat_interval"`
+	StaleAfter            time.Duration `yaml:"stale_after"`
+	ReconcileInterval     time.Duration `yaml:"reconcile_interval"` // 0 disables the reconciler of tasks owned by gone workers
+	LeaderElection        bool          `yaml:"leader_election"`    // Run maintenance jobs on one elected worker rather than all
+	LeaderInterval        time.Duration `yaml:"leader_interval"`    // Campaign and leadership check period
+	RecoveryMaxAge        time.Duration `yaml:"recovery_max_age"`
+	PoisonThreshold       int           `yaml:"poison_threshold"`
+	DuplicateScanInterval time.Duration `yaml:"duplicate_scan_interval"` // 0 disables the duplicate-execution detector
+	StallTimeout          time.Duration `yaml:"stall_timeout"`           // Main loop progress gap reported as a stall, 0 disables the check
+	StallRestart          bool          `yaml:"stall_restart"`           // Abandon a stalled main loop for a new one
+	Region                string        `yaml:"region"`                  // Region of the worker, claiming the tasks preferring it first
+	CrossRegionWait       time.Duration `yaml:"cross_region_wait"`       // Wait before a task preferring another region may be claimed
+	RichOutputMaxBytes    int           `yaml:"rich_output_max_bytes"`
+	PrewarmLookahead      time.Duration `yaml:"prewarm_lookahead"` // Sandboxes of tasks due within it are prepared ahead, 0 disables
+	Limits                Limits        `yaml:"limits"`
+	RateLimit             RateLimit     `yaml:"rate_limit"`
+}
+
+// Limits bound the size of a task's code, payload and stored output and error
+type Limits struct {
+	CodeBytes    int `yaml:"code_bytes"`
+	PayloadBytes int `yaml:"payload_bytes"`
+	OutputBytes  int `yaml:"output_bytes"`
+	ErrorBytes   int `yaml:"error_bytes"` // Largest last_error stored, keeping its start and end
+	// OutputOverflow is what happens to output over OutputBytes (and an error
+	// over ErrorBytes): "truncate" cuts it, "artifact" also stores it whole in
+	// the artifact store
+	OutputOverflow string `yaml:"output_overflow"`
+	// CompressAboveBytes is the size from which code, payloads and outputs
+	// are stored zstd-compressed; 0 stores them as they are
+	CompressAboveBytes int `yaml:"compress_above_bytes"`
+}
+
+// RateLimit caps the executions per minute of each code and each tenant
+// across all workers; 0 is unlimited. Rows of RATE_LIMITS with a per_minute
+// override the limit of a single code or tenant.
+type RateLimit struct {
+	PerCode   int `yaml:"per_code"`
+	PerTenant int `yaml:"per_tenant"`
+}
+
+// API is the HTTP status server
+type API struct {
+	Port            int           `yaml:"port"`
+	ReportsCacheTTL time.Duration `yaml:"reports_cache_ttl"`
+	// Lifetime of signed artifact download URLs, and the longest a client
+	// may ask for
+	SignedURLTTL    time.Duration `yaml:"signed_url_ttl"`
+	SignedURLMaxTTL time.Duration `yaml:"signed_url_max_ttl"`
+	// HealthCheckTimeout bounds each dependency check of /healthz and /readyz
+	HealthCheckTimeout time.Duration `yaml:"health_check_timeout"`
+	// How long GET /tasks/{id}/wait blocks by default, and the longest a
+	// client may ask for
+	WaitTimeout    time.Duration `yaml:"wait_timeout"`
+	WaitMaxTimeout time.Duration `yaml:"wait_max_timeout"`
+	// Bearer tokens: API keys granting the read or operator role, and the
+	// secret of HS256 JWTs carrying a "role" claim. With none set every
+	// request but the probes is refused, unless AuthDisabled opens the API.
+	ReadTokens     []string `yaml:"read_tokens"`
+	OperatorTokens []string `yaml:"operator_tokens"`
+	JWTSecret      string   `yaml:"jwt_secret"`
+	AuthDisabled   bool     `yaml:"auth_disabled"`
+}
+
+// Container is the sandbox container setup
+type Container struct {
+	Image               string         `yaml:"image"`
+	PythonVersions      []string       `yaml:"python_versions"`
+	PythonImageTemplate string         `yaml:"python_image_template"`
+	MemoryMB            int64          `yaml:"memory_mb"`
+	CPULimit            float64        `yaml:"cpu_limit"`
+	MaxMemoryMB         int64          `yaml:"max_memory_mb"`      // Largest memory_mb a task or queue may request, 0 for no bound
+	MaxCPULimit         float64        `yaml:"max_cpu_limit"`      // Largest cpu_limit a task or queue may request, 0 for no bound
+	BandwidthKbps       int64          `yaml:"bandwidth_kbps"`     // Network limit of sandbox containers each way in kbit/s, 0 for none
+	MaxBandwidthKbps    int64          `yaml:"max_bandwidth_kbps"` // Largest bandwidth_kbps a task or queue may request, 0 for no bound
+	IdleTimeout         time.Duration  `yaml:"idle_timeout"`
+	RotateInterval      time.Duration  `yaml:"rotate_interval"` // Age at which a warm container is replaced, 0 keeps it until idle
+	Runtime             string         `yaml:"runtime"`
+	RuntimeRequired     bool           `yaml:"runtime_required"`
+	Profile             string         `yaml:"profile"`
+	SeccompProfile      string         `yaml:"seccomp_profile"`
+	Reset               string         `yaml:"reset"` // "clean" deletes the files of a reused container, "recreate" replaces it after each execution
+	TenantPoolSize      int            `yaml:"tenant_pool_size"`
+	TenantPoolSizes     map[string]int `yaml:"tenant_pool_sizes"`
+	VenvVolume          string         `yaml:"venv_volume"`
+	VenvBuildTimeout    time.Duration  `yaml:"venv_build_timeout"`
+	DockerDesktop       *bool          `yaml:"docker_desktop"` // nil detects it from the daemon
+	EnvDenylist         []string       `yaml:"env_denylist"`   // Task env variables denied on top of the built-in list, "PREFIX_*" for prefixes
+	MaxConcurrentExecs  int            `yaml:"max_concurrent_execs"`
+	// ImagePeerURL is this worker's API address, advertised so other daemons
+	// import images from it rather than pull them; "" disables peer transfer
+	ImagePeerURL  string        `yaml:"image_peer_url"`
+	ImagePullWait time.Duration `yaml:"image_pull_wait"` // How long to wait for another worker's pull
+	// ImagePeerToken is the bearer token sent to peers whose API requires one
+	ImagePeerToken string `yaml:"image_peer_token"`
+	GPU            string `yaml:"gpu"` // "all" exposes the node's NVIDIA GPUs to tasks requiring one, "none" claims no such task
+	// Host protections of every sandbox container: a process limit against
+	// fork bombs, "name=soft[:hard]" ulimits, and a size limit on the
+	// writable layer ("" for none) against scripts filling the disk
+	PidsLimit int64    `yaml:"pids_limit"`
+	Ulimits   []string `yaml:"ulimits"`
+	DiskQuota string   `yaml:"disk_quota"`
+	// Standard environment of every script run, which tasks may override:
+	// TZ, LANG/LC_ALL and "name=value" soft ulimits (nofile, stack...)
+	TZ          string   `yaml:"tz"`
+	Locale      string   `yaml:"locale"`
+	ExecUlimits []string `yaml:"exec_ulimits"`
+	// EgressProxyListen is the host:port of the egress proxy serving tasks
+	// with the allowlist network policy; "" runs no proxy and claims no such task
+	EgressProxyListen string `yaml:"egress_proxy_listen"`
+	// CPU placement of sandbox containers: Cpuset ("0-7,16-23") is the CPUs
+	// they may run on, "" for all; NUMASpread pins each execution to the CPUs
+	// and memory of the least busy NUMA node
+	Cpuset     string `yaml:"cpuset"`
+	NUMASpread bool   `yaml:"numa_spread"`
+	// Platform ("linux/arm64") of the sandbox images pulled and run, "" for
+	// the daemon's own; another architecture runs under emulation
+	Platform string `yaml:"platform"`
+	// NetworkGuard is where the egress rules and bandwidth limits are
+	// enforced: "host" (nftables rules on the sandbox bridges, managed from a
+	// privileged helper container running GuardImage) or "container"
+	// (iptables installed in each container, which then needs NET_ADMIN)
+	NetworkGuard string `yaml:"network_guard"`
+	GuardImage   string `yaml:"network_guard_image"`
+	// ImageRefreshInterval is how often the registry is asked whether the
+	// runtime images changed, 0 never
+	ImageRefreshInterval time.Duration `yaml:"image_refresh_interval"`
+	// WarmupTimeout bounds the warm-up snippet of a code, see
+	// PUT /codes/{id}/warmup
+	WarmupTimeout time.Duration `yaml:"warmup_timeout"`
+}
+
+// Analysis is the pre-execution code analysis
+type Analysis struct {
+	Analyzers    []string      `yaml:"analyzers"`
+	DenylistFile string        `yaml:"denylist_file"`
+	Python       string        `yaml:"python"`
+	HTTPURL      string        `yaml:"http_url"`
+	HTTPToken    string        `yaml:"http_token"`
+	HTTPTimeout  time.Duration `yaml:"http_timeout"`
+	Trace        string        `yaml:"trace"` // strace or ltrace wraps runs flagged as suspicious, "" disables tracing
+}
+
+// Artifacts is where /outputs files are kept
+type Artifacts struct {
+	Store    string `yaml:"store"`
+	MaxBytes int64  `yaml:"max_bytes"`
+}
+
+// Code is where task source code is kept. Code larger than InlineMaxBytes
+// goes to the object storage Store when one is set; the rest stays in CODES.
+type Code struct {
+	Store          string `yaml:"store"` // s3://, gs:// or az://bucket/prefix; "" keeps all code in Postgres
+	InlineMaxBytes int    `yaml:"inline_max_bytes"`
+	CacheDir       string `yaml:"cache_dir"` // Local copies of fetched code, keyed by SHA-256
+	// ResultDescriptors is a protobuf FileDescriptorSet holding the messages
+	// codes with protobuf results name
+	ResultDescriptors string `yaml:"result_descriptors"`
+}
+
+// Secrets is the provider resolving the secrets tasks reference in their env
+// map. Provider credentials are read from the environment.
+type Secrets struct {
+	Provider string        `yaml:"provider"` // env-file, vault or aws; "" disables secrets
+	File     string        `yaml:"file"`     // KEY=value file of the env-file provider
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+}
+
+// Webhooks is the delivery of task events to the tasks' webhook_url
+type Webhooks struct {
+	Secret       string        `yaml:"secret"` // Signs deliveries with HMAC-SHA256; "" sends them unsigned
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Timeout      time.Duration `yaml:"timeout"`
+	BatchSize    int           `yaml:"batch_size"`
+	AllowPrivate bool          `yaml:"allow_private"` // Allow loopback and private network targets
+	Retry        retry.Policy  `yaml:"retry"`
+	// Endpoints override the settings above for the webhook URLs they match;
+	// they are only read from the configuration file
+	Endpoints []WebhookEndpoint `yaml:"endpoints"`
+}
+
+// WebhookEndpoint is the delivery setup of the webhook URLs starting with
+// URLPrefix; the longest matching prefix applies. Zero values inherit the
+// Webhooks settings.
+type WebhookEndpoint struct {
+	URLPrefix string            `yaml:"url_prefix"`
+	Secret    string            `yaml:"secret"`
+	Timeout   time.Duration     `yaml:"timeout"`
+	Retry     retry.Policy      `yaml:"retry"`   // Retry budget; zero fields inherit
+	Headers   map[string]string `yaml:"headers"` // Sent with each delivery; can't replace the X-Continuum-* ones
+	// PEM files of the mTLS client certificate and key, and of the CAs
+	// trusted for the receiver instead of the system ones
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+	CACert     string `yaml:"ca_cert"`
+	// Consecutive failures after which deliveries to the endpoint are paused
+	// for BreakerCooldown, 0 to never pause them
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+// Policy is the signed policy bundle
+type Policy struct {
+	Bundle        string `yaml:"bundle"`
+	Signature     string `yaml:"signature"`
+	PublicKey     string `yaml:"public_key"`
+	RequireSigned bool   `yaml:"require_signed"`
+}
+
+// Receipts are the signed execution receipts of completed tasks
+type Receipts struct {
+	// SigningKey is the worker's base64 ed25519 private key (or seed); ""
+	// signs no receipts
+	SigningKey string `yaml:"signing_key"`
+	// PublicKeys are the base64 keys continuumctl verify-receipt trusts, on
+	// top of the signing key's own
+	PublicKeys []string `yaml:"public_keys"`
+}
+
+// Fleet is the central document this worker reconciles its settings to
+type Fleet struct {
+	Source   string        `yaml:"source"` // "db" for FLEET_CONFIG, a file path or an http(s) URL; "" disables it
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Retention moves finished tasks out of TASKS once they are older than TTL,
+// keeping the claim query fast
+type Retention struct {
+	TTL         time.Duration `yaml:"ttl"` // 0 keeps tasks forever
+	Interval    time.Duration `yaml:"interval"`
+	BatchSize   int           `yaml:"batch_size"`
+	Destination string        `yaml:"destination"` // s3://, gs:// or az://bucket/prefix for JSONL exports; "" archives to TASKS_ARCHIVE
+}
+
+// Queue is the backend announcing claimable tasks to the workers. Tasks and
+// claims stay in Postgres whichever backend carries the announcements.
+type Queue struct {
+	URL            string        `yaml:"url"`             // redis:// or nats:// URL; "" uses Postgres LISTEN/NOTIFY
+	Stream         string        `yaml:"stream"`          // Redis stream or JetStream stream name
+	RedeliverAfter time.Duration `yaml:"redeliver_after"` // Unacknowledged announcements go to another worker after this
+	// Mode is "queue" (Redis Streams, JetStream) or "pubsub", plain wake-ups
+	// broadcast to every worker like LISTEN/NOTIFY
+	Mode string `yaml:"mode"`
+}
+
+// Default returns the built-in defaults
+func Default() Config {
+	return Config{
+		Database: Database{Host: "localhost", Port: 5432, Name: "continuum", User: "user", Password: "password",
+			JournalPath: "write-journal.jsonl", BreakerThreshold: 3, BreakerCooldown: 10 * time.Second, ReplayInterval: 30 * time.Second,
+			MaxIdleConns: 10, ConnMaxLifetime: 30 * time.Minute, ConnMaxIdleTime: 5 * time.Minute, StatementCache: true},
+		Worker: Worker{
+			PollingInterval:       5 * time.Second,
+			NotifyMinInterval:     100 * time.Millisecond,
+			ClaimBatchSize:        1,
+			ClaimStrategy:         "priority",
+			QueueSampleInterval:   15 * time.Second,
+			DuplicateScanInterval: time.Minute,
+			CrossRegionWait:       time.Minute,
+			Retry: retry.Policy{
+				MaxAttempts: 3,
+				BaseDelay:   2 * time.Second,
+				MaxDelay:    30 * time.Second,
+				Jitter:      0.2,
+				RetryOn:     []string{"infra"},
+			},
+			DrainTimeout:       time.Minute,
+			DrainThreshold:     5,
+			HeartbeatInterval:  10 * time.Second,
+			StaleAfter:         2 * time.Minute,
+			ReconcileInterval:  5 * time.Second,
+			LeaderElection:     true,
+			LeaderInterval:     5 * time.Second,
+			RecoveryMaxAge:     24 * time.Hour,
+			PoisonThreshold:    2,
+			RichOutputMaxBytes: 5 * 1024 * 1024,
+			Limits: Limits{
+				CodeBytes:      1024 * 1024,
+				PayloadBytes:   1024 * 1024,
+				OutputBytes:    1024 * 1024,
+				ErrorBytes:     64 * 1024,
+				OutputOverflow: "truncate",
+			},
+		},
+		API: API{Port: 8080, ReportsCacheTTL: time.Minute, SignedURLTTL: 5 * time.Minute, SignedURLMaxTTL: time.Hour,
+			HealthCheckTimeout: 2 * time.Second, WaitTimeout: 30 * time.Second, WaitMaxTimeout: 5 * time.Minute},
+		Container: Container{
+			Image:               "python:3.9-slim",
+			PythonVersions:      []string{"3.9", "3.10", "3.11", "3.12"},
+			PythonImageTemplate: "python:{version}-slim",
+			MemoryMB:            512,
+			CPULimit:            0.5,
+			IdleTimeout:         5 * time.Minute,
+			Runtime:             "runc",
+			Profile:             "default",
+			TenantPoolSize:      2,
+			VenvVolume:          "continuum_venvs",
+			VenvBuildTimeout:    5 * time.Minute,
+			WarmupTimeout:       2 * time.Minute,
+			MaxConcurrentExecs:  1,
+			ImagePullWait:       10 * time.Minute,
+			GPU:                 "none",
+			Reset:               "clean",
+			NetworkGuard:        "host",
+			GuardImage:          "alpine:3.20",
+			PidsLimit:           256,
+			Ulimits:             []string{"nofile=1024:4096", "core=0"},
+			TZ:                  "UTC",
+			Locale:              "C.UTF-8",
+		},
+		Analysis:  Analysis{Python: "python3", HTTPTimeout: 10 * time.Second},
+		Artifacts: Artifacts{MaxBytes: 100 * 1024 * 1024},
+		Code: Code{
+			InlineMaxBytes: 64 * 1024,
+			CacheDir:       filepath.Join(os.TempDir(), "continuum-code"),
+		},
+		Secrets: Secrets{CacheTTL: time.Minute},
+		Webhooks: Webhooks{
+			PollInterval: 5 * time.Second,
+			Timeout:      10 * time.Second,
+			BatchSize:    20,
+			Retry: retry.Policy{
+				MaxAttempts: 10,
+				BaseDelay:   10 * time.Second,
+				MaxDelay:    time.Hour,
+				Jitter:      0.2,
+			},
+		},
+		Fleet:     Fleet{Interval: time.Minute},
+		Retention: Retention{Interval: time.Hour, BatchSize: 500},
+		Queue:     Queue{Stream: "continuum-tasks", RedeliverAfter: 30 * time.Second, Mode: "queue"},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file named by
+// CONFIG_FILE (default config.yaml, skipped when absent) and the environment.
+// Malformed or out-of-range values are errors rather than silent defaults.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	path, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		path = "config.yaml"
+	}
+	if path != "" {
+		content, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(content, &cfg); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		case errors.Is(err, os.ErrNotExist) && !explicit:
+		default:
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	if err := applyEnv(&cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Validate checks value ranges and cross-field constraints
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validPort(c.Database.Port), "database port %d is out of range", c.Database.Port)
+	check(c.Database.BreakerThreshold >= 0, "DB_BREAKER_THRESHOLD must not be negative")
+	check(c.Database.BreakerThreshold == 0 || c.Database.BreakerCooldown > 0, "DB_BREAKER_COOLDOWN must be positive")
+	check(c.Database.ReplayInterval >= 0, "DB_JOURNAL_REPLAY_INTERVAL must not be negative")
+	check(c.Database.MaxOpenConns >= 0 && c.Database.MaxIdleConns >= 0, "database pool sizes must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	check(c.Database.ConnMaxLifetime >= 0 && c.Database.ConnMaxIdleTime >= 0, "database connection lifetimes must not be negative")
+	check(validPort(c.API.Port), "API port %d is out of range", c.API.Port)
+
+	w := c.Worker
+	check(w.MinPriority >= 0 && w.MaxPriority >= 0, "priorities must not be negative")
+	check(w.MaxPriority == 0 || w.MinPriority <= w.MaxPriority, "MIN_PRIORITY %d is above MAX_PRIORITY %d", w.MinPriority, w.MaxPriority)
+	check(w.PollingInterval > 0, "polling interval must be positive")
+	check(w.NotifyMinInterval >= 0, "notify min interval must not be negative")
+	check(w.DrainTimeout > 0, "drain timeout must be positive")
+	check(w.HeartbeatInterval > 0, "heartbeat interval must be positive")
+	check(w.StaleAfter > w.HeartbeatInterval, "worker stale-after (%s) must exceed the heartbeat interval (%s)", w.StaleAfter, w.HeartbeatInterval)
+	check(w.ReconcileInterval >= 0, "reconcile interval must not be negative")
+	check(w.LeaderInterval > 0, "leader interval must be positive")
+	check(w.RecoveryMaxAge >= 0, "recovery max age must not be negative")
+	check(w.ClaimBatchSize > 0, "claim batch size must be positive")
+	check(w.QueueSampleInterval > 0, "queue sample interval must be positive")
+	if err := w.Retry.Validate(); err != nil {
+		check(false, "retry policy: %v", err)
+	}
+	check(w.DrainThreshold >= 0, "drain threshold must not be negative")
+	check(w.PoisonThreshold >= 0, "poison threshold must not be negative")
+	check(w.DuplicateScanInterval >= 0, "duplicate scan interval must not be negative")
+	check(w.StallTimeout == 0 || w.StallTimeout >= time.Second, "WORKER_STALL_TIMEOUT must be 0 or at least 1s")
+	check(!w.StallRestart || w.StallTimeout > 0, "WORKER_STALL_RESTART requires WORKER_STALL_TIMEOUT")
+	check(w.CrossRegionWait >= 0, "CROSS_REGION_WAIT must not be negative")
+	check(w.RichOutputMaxBytes > 0, "rich output max bytes must be positive")
+	check(w.PrewarmLookahead >= 0, "PREWARM_LOOKAHEAD must not be negative")
+	check(w.Limits.CodeBytes > 0 && w.Limits.PayloadBytes > 0 && w.Limits.OutputBytes > 0 && w.Limits.ErrorBytes > 0,
+		"code, payload, output and error size limits must be positive")
+	check(w.Limits.CompressAboveBytes >= 0, "COMPRESS_ABOVE_BYTES must not be negative")
+	check(w.RateLimit.PerCode >= 0 && w.RateLimit.PerTenant >= 0, "rate limits must not be negative")
+	check(w.Limits.OutputOverflow == "truncate" || w.Limits.OutputOverflow == "artifact",
+		"output overflow must be truncate or artifact, got %q", w.Limits.OutputOverflow)
+	check(c.API.ReportsCacheTTL >= 0, "reports cache TTL must not be negative")
+	check(!c.API.AuthDisabled || len(c.API.ReadTokens)+len(c.API.OperatorTokens) == 0 && c.API.JWTSecret == "",
+		"API_AUTH_DISABLED can't be set with API_READ_TOKENS, API_OPERATOR_TOKENS or API_JWT_SECRET")
+	check(c.API.HealthCheckTimeout > 0, "health check timeout must be positive")
+	// SigV4 presigned URLs are valid for at most 7 days
+	check(c.API.SignedURLTTL > 0 && c.API.SignedURLTTL <= c.API.SignedURLMaxTTL && c.API.SignedURLMaxTTL <= 7*24*time.Hour,
+		"signed URL TTL must be positive and at most the max TTL (%s), itself at most 7 days", c.API.SignedURLMaxTTL)
+	check(c.API.WaitTimeout > 0 && c.API.WaitTimeout <= c.API.WaitMaxTimeout,
+		"task wait timeout must be positive and at most the max timeout (%s)", c.API.WaitMaxTimeout)
+
+	ct := c.Container
+	check(ct.Image != "", "container image must be set")
+	check(ct.MemoryMB > 0, "container memory must be positive")
+	check(ct.CPULimit > 0, "container CPU limit must be positive")
+	check(ct.MaxMemoryMB == 0 || ct.MaxMemoryMB >= ct.MemoryMB, "container max memory (%d MB) must be 0 or at least the default memory (%d MB)", ct.MaxMemoryMB, ct.MemoryMB)
+	check(ct.MaxCPULimit == 0 || ct.MaxCPULimit >= ct.CPULimit, "container max CPU limit (%g) must be 0 or at least the default CPU limit (%g)", ct.MaxCPULimit, ct.CPULimit)
+	check(ct.BandwidthKbps >= 0, "container bandwidth must not be negative")
+	check(ct.MaxBandwidthKbps == 0 || (ct.BandwidthKbps > 0 && ct.BandwidthKbps <= ct.MaxBandwidthKbps),
+		"container max bandwidth (%d kbit/s) must be 0 or at least a non-zero default bandwidth (%d kbit/s)", ct.MaxBandwidthKbps, ct.BandwidthKbps)
+	check(ct.IdleTimeout > 0, "container idle timeout must be positive")
+	check(ct.RotateInterval >= 0, "container rotate interval must not be negative")
+	check(ct.TenantPoolSize >= 0, "tenant pool size must not be negative")
+	for tenant, size := range ct.TenantPoolSizes {
+		check(size >= 0, "pool size of tenant %q must not be negative", tenant)
+	}
+	check(ct.VenvBuildTimeout > 0, "venv build timeout must be positive")
+	check(ct.MaxConcurrentExecs > 0, "max concurrent execs must be positive")
+	check(ct.ImagePullWait > 0, "image pull wait must be positive")
+	check(ct.ImageRefreshInterval >= 0, "image refresh interval must not be negative")
+	check(ct.WarmupTimeout > 0, "warm-up timeout must be positive")
+	check(ct.GPU == "all" || ct.GPU == "none", "container GPU must be all or none, got %q", ct.GPU)
+	check(ct.Reset == "clean" || ct.Reset == "recreate", "SANDBOX_RESET must be clean or recreate, got %q", ct.Reset)
+	check(ct.NetworkGuard == "host" || ct.NetworkGuard == "container", "NETWORK_GUARD must be host or container, got %q", ct.NetworkGuard)
+	check(ct.NetworkGuard != "host" || ct.GuardImage != "", "NETWORK_GUARD_IMAGE must be set with NETWORK_GUARD=host")
+	if ct.Platform != "" {
+		parts := strings.Split(ct.Platform, "/")
+		check(len(parts) >= 2 && len(parts) <= 3 && parts[0] == "linux" && !slices.Contains(parts, ""),
+			"SANDBOX_PLATFORM must be linux/<arch>[/<variant>], got %q", ct.Platform)
+	}
+	check(ct.PidsLimit >= 0, "container pids limit must not be negative")
+	for _, u := range ct.Ulimits {
+		if _, err := units.ParseUlimit(u); err != nil {
+			check(false, "container ulimit: %v", err)
+		}
+	}
+	if ct.DiskQuota != "" {
+		if _, err := units.RAMInBytes(ct.DiskQuota); err != nil {
+			check(false, "container disk quota: %v", err)
+		}
+	}
+	if ct.EgressProxyListen != "" {
+		if _, _, err := net.SplitHostPort(ct.EgressProxyListen); err != nil {
+			check(false, "egress proxy listen address: %v", err)
+		}
+	}
+	if ct.Cpuset != "" {
+		if _, err := ParseCPUList(ct.Cpuset); err != nil {
+			check(false, "container cpuset: %v", err)
+		}
+	}
+
+	check(c.Analysis.HTTPTimeout > 0, "analyzer HTTP timeout must be positive")
+	check(c.Analysis.Trace == "" || c.Analysis.Trace == "strace" || c.Analysis.Trace == "ltrace",
+		"execution trace must be strace, ltrace or empty, got %q", c.Analysis.Trace)
+	check(c.Artifacts.MaxBytes > 0, "artifact max bytes must be positive")
+	check(c.Code.InlineMaxBytes >= 0, "code inline max bytes must not be negative")
+	check(c.Code.Store == "" || c.Code.CacheDir != "", "code cache dir is required with a code store")
+	check(c.Secrets.CacheTTL >= 0, "secrets cache TTL must not be negative")
+
+	wh := c.Webhooks
+	check(wh.PollInterval >= 0, "webhook poll interval must not be negative")
+	check(wh.Timeout > 0, "webhook timeout must be positive")
+	check(wh.BatchSize > 0, "webhook batch size must be positive")
+	if err := wh.Retry.Validate(); err != nil {
+		check(false, "webhook retry policy: %v", err)
+	}
+	prefixes := make(map[string]bool)
+	for _, e := range wh.Endpoints {
+		u, err := url.Parse(e.URLPrefix)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"webhook endpoint url_prefix %q must be an http or https URL", e.URLPrefix)
+		check(!prefixes[e.URLPrefix], "webhook endpoint %s is configured twice", e.URLPrefix)
+		prefixes[e.URLPrefix] = true
+		check(e.Timeout >= 0, "webhook endpoint %s: timeout must not be negative", e.URLPrefix)
+		check(e.Retry.MaxAttempts >= 0 && e.Retry.BaseDelay >= 0 && e.Retry.MaxDelay >= 0 && e.Retry.Jitter >= 0 && e.Retry.Jitter <= 1,
+			"webhook endpoint %s: retry settings must not be negative, jitter at most 1", e.URLPrefix)
+		check((e.ClientCert == "") == (e.ClientKey == ""), "webhook endpoint %s: client_cert and client_key go together", e.URLPrefix)
+		for name := range e.Headers {
+			check(!strings.HasPrefix(strings.ToLower(name), "x-continuum-"), "webhook endpoint %s: header %s is reserved", e.URLPrefix, name)
+		}
+		check(e.BreakerThreshold >= 0, "webhook endpoint %s: breaker threshold must not be negative", e.URLPrefix)
+		check(e.BreakerThreshold == 0 || e.BreakerCooldown > 0, "webhook endpoint %s: breaker cooldown must be positive", e.URLPrefix)
+	}
+
+	check(c.Fleet.Interval > 0, "fleet reconcile interval must be positive")
+	check(c.Retention.TTL >= 0, "task retention TTL must not be negative")
+	check(c.Retention.Interval > 0, "retention interval must be positive")
+	check(c.Retention.BatchSize > 0, "retention batch size must be positive")
+	if c.Queue.URL != "" {
+		if u, err := url.Parse(c.Queue.URL); err != nil {
+			check(false, "task queue URL: %v", err)
+		} else {
+			check(u.Scheme == "redis" || u.Scheme == "rediss" || u.Scheme == "nats",
+				"task queue URL must be redis://, rediss:// or nats://, got %q", u.Scheme)
+		}
+		check(validStreamName(c.Queue.Stream), "task queue stream must be letters, digits, '-' or '_', got %q", c.Queue.Stream)
+		check(c.Queue.RedeliverAfter > 0, "task queue redeliver delay must be positive")
+		check(c.Queue.Mode == "queue" || c.Queue.Mode == "pubsub", "task queue mode must be queue or pubsub, got %q", c.Queue.Mode)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// validStreamName reports whether name is usable as both a Redis key and a
+// JetStream stream name, which can't contain '.', '*', '>' or spaces
+func validStreamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseCPUList parses a Linux CPU list such as "0-3,8,10-11" into sorted,
+// distinct CPU numbers
+func ParseCPUList(raw string) ([]int, error) {
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid CPU list %q", raw)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("invalid CPU list %q", raw)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+// splitList parses a comma-separated list, dropping empty entries
+func splitList(raw string) []string {
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envReader applies set environment variables and collects parse errors
+type envReader struct {
+	errs []error
+}
+
+func (r *envReader) lookup(key string) (string, bool) {
+	v, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(v) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(v), true
+}
+
+func (r *envReader) fail(key, value string, err error) {
+	r.errs = append(r.errs, fmt.Errorf("%s=%q: %w", key, value, err))
+}
+
+func (r *envReader) string(key string, dst *string) {
+	if v, ok := r.lookup(key); ok {
+		*dst = v
+	}
+}
+
+func (r *envReader) int(key string, dst *int) {
+	if v, ok := r.lookup(key); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (r *envReader) int64(key string, dst *int64) {
+	if v, ok := r.lookup(key); ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = n
+	}
+}
+
+func (r *envReader) float(key string, dst *float64) {
+	if v, ok := r.lookup(key); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = f
+	}
+}
+
+func (r *envReader) bool(key string, dst *bool) {
+	if v, ok := r.lookup(key); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = b
+	}
+}
+
+func (r *envReader) duration(key string, dst *time.Duration) {
+	if v, ok := r.lookup(key); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			r.fail(key, v, err)
+			return
+		}
+		*dst = d
+	}
+}
+
+// seconds accepts a plain number of seconds as well as a duration
+func (r *envReader) seconds(key string, dst *time.Duration) {
+	if v, ok := r.lookup(key); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			*dst = time.Duration(n) * time.Second
+			return
+		}
+		r.duration(key, dst)
+	}
+}
+
+func (r *envReader) list(key string, dst *[]string) {
+	if v, ok := r.lookup(key); ok {
+		*dst = splitList(v)
+	}
+}
+
+// sizes parses "name=size,..." entries into a map
+func (r *envReader) sizes(key string, dst *map[string]int) {
+	v, ok := r.lookup(key)
+	if !ok {
+		return
+	}
+	sizes := make(map[string]int)
+	for _, entry := range splitList(v) {
+		name, size, ok := strings.Cut(entry, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if !ok || err != nil {
+			r.fail(key, entry, errors.New("expected name=size"))
+			continue
+		}
+		sizes[strings.TrimSpace(name)] = n
+	}
+	*dst = sizes
+}
+
+// applyEnv overrides cfg with every configuration variable that is set
+func applyEnv(cfg *Config) error {
+	var r envReader
+
+	r.string("DB_HOST", &cfg.Database.Host)
+	r.int("DB_PORT", &cfg.Database.Port)
+	r.string("DB_NAME", &cfg.Database.Name)
+	r.string("DB_USER", &cfg.Database.User)
+	r.string("DB_PASSWORD", &cfg.Database.Password)
+	r.string("DB_WRITE_JOURNAL", &cfg.Database.JournalPath)
+	r.int("DB_BREAKER_THRESHOLD", &cfg.Database.BreakerThreshold)
+	r.duration("DB_BREAKER_COOLDOWN", &cfg.Database.BreakerCooldown)
+	r.duration("DB_JOURNAL_REPLAY_INTERVAL", &cfg.Database.ReplayInterval)
+	r.int("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	r.int("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	r.duration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+	r.duration("DB_CONN_MAX_IDLE_TIME", &cfg.Database.ConnMaxIdleTime)
+	r.bool("DB_STATEMENT_CACHE", &cfg.Database.StatementCache)
+
+	w := &cfg.Worker
+	r.string("WORKER_IDENTITY", &w.Identity)
+	r.seconds("POLLING_INTERVAL", &w.PollingInterval)
+	r.duration("NOTIFY_MIN_INTERVAL", &w.NotifyMinInterval)
+	r.int("MIN_PRIORITY", &w.MinPriority)
+	r.int("MAX_PRIORITY", &w.MaxPriority)
+	r.list("WORKER_QUEUES", &w.Queues)
+	r.int("CLAIM_BATCH_SIZE", &w.ClaimBatchSize)
+	r.string("CLAIM_STRATEGY", &w.ClaimStrategy)
+	r.duration("QUEUE_SAMPLE_INTERVAL", &w.QueueSampleInterval)
+	r.int("TASK_RETRY_MAX_ATTEMPTS", &w.Retry.MaxAttempts)
+	r.duration("TASK_RETRY_BASE_DELAY", &w.Retry.BaseDelay)
+	r.duration("TASK_RETRY_MAX_DELAY", &w.Retry.MaxDelay)
+	r.float("TASK_RETRY_JITTER", &w.Retry.Jitter)
+	r.list("TASK_RETRY_ON", &w.Retry.RetryOn)
+	r.duration("DRAIN_TIMEOUT", &w.DrainTimeout)
+	r.int("WORKER_DRAIN_THRESHOLD", &w.DrainThreshold)
+	r.duration("HEARTBEAT_INTERVAL", &w.HeartbeatInterval)
+	r.duration("WORKER_STALE_AFTER", &w.StaleAfter)
+	r.duration("WORKER_RECONCILE_INTERVAL", &w.ReconcileInterval)
+	r.bool("LEADER_ELECTION", &w.LeaderElection)
+	r.duration("LEADER_INTERVAL", &w.LeaderInterval)
+	r.duration("RECOVERY_MAX_AGE", &w.RecoveryMaxAge)
+	r.int("POISON_TASK_THRESHOLD", &w.PoisonThreshold)
+	r.duration("DUPLICATE_SCAN_INTERVAL", &w.DuplicateScanInterval)
+	r.duration("WORKER_STALL_TIMEOUT", &w.StallTimeout)
+	r.bool("WORKER_STALL_RESTART", &w.StallRestart)
+	r.string("WORKER_REGION", &w.Region)
+	r.duration("CROSS_REGION_WAIT", &w.CrossRegionWait)
+	r.int("RICH_OUTPUT_MAX_BYTES", &w.RichOutputMaxBytes)
+	r.duration("PREWARM_LOOKAHEAD", &w.PrewarmLookahead)
+	r.int("MAX_CODE_BYTES", &w.Limits.CodeBytes)
+	r.int("MAX_PAYLOAD_BYTES", &w.Limits.PayloadBytes)
+	r.int("MAX_OUTPUT_BYTES", &w.Limits.OutputBytes)
+	r.int("MAX_ERROR_BYTES", &w.Limits.ErrorBytes)
+	r.string("OUTPUT_OVERFLOW", &w.Limits.OutputOverflow)
+	r.int("COMPRESS_ABOVE_BYTES", &w.Limits.CompressAboveBytes)
+	r.int("RATE_LIMIT_PER_CODE", &w.RateLimit.PerCode)
+	r.int("RATE_LIMIT_PER_TENANT", &w.RateLimit.PerTenant)
+
+	r.int("API_PORT", &cfg.API.Port)
+	r.duration("REPORTS_CACHE_TTL", &cfg.API.ReportsCacheTTL)
+	r.duration("SIGNED_URL_TTL", &cfg.API.SignedURLTTL)
+	r.duration("SIGNED_URL_MAX_TTL", &cfg.API.SignedURLMaxTTL)
+	r.duration("HEALTH_CHECK_TIMEOUT", &cfg.API.HealthCheckTimeout)
+	r.duration("TASK_WAIT_TIMEOUT", &cfg.API.WaitTimeout)
+	r.duration("TASK_WAIT_MAX_TIMEOUT", &cfg.API.WaitMaxTimeout)
+	r.list("API_READ_TOKENS", &cfg.API.ReadTokens)
+	r.list("API_OPERATOR_TOKENS", &cfg.API.OperatorTokens)
+	r.string("API_JWT_SECRET", &cfg.API.JWTSecret)
+	r.bool("API_AUTH_DISABLED", &cfg.API.AuthDisabled)
+
+	c := &cfg.Container
+	r.string("CONTAINER_IMAGE", &c.Image)
+	r.list("PYTHON_VERSIONS", &c.PythonVersions)
+	r.string("PYTHON_IMAGE_TEMPLATE", &c.PythonImageTemplate)
+	r.int64("CONTAINER_MEMORY_MB", &c.MemoryMB)
+	r.float("CONTAINER_CPU_LIMIT", &c.CPULimit)
+	r.int64("CONTAINER_MAX_MEMORY_MB", &c.MaxMemoryMB)
+	r.float("CONTAINER_MAX_CPU_LIMIT", &c.MaxCPULimit)
+	r.int64("CONTAINER_BANDWIDTH_KBPS", &c.BandwidthKbps)
+	r.int64("CONTAINER_MAX_BANDWIDTH_KBPS", &c.MaxBandwidthKbps)
+	r.duration("CONTAINER_IDLE_TIMEOUT", &c.IdleTimeout)
+	r.duration("CONTAINER_ROTATE_INTERVAL", &c.RotateInterval)
+	r.string("CONTAINER_RUNTIME", &c.Runtime)
+	r.bool("CONTAINER_RUNTIME_REQUIRED", &c.RuntimeRequired)
+	r.string("SANDBOX_PROFILE", &c.Profile)
+	r.string("SANDBOX_SECCOMP_PROFILE", &c.SeccompProfile)
+	r.string("SANDBOX_RESET", &c.Reset)
+	r.int("TENANT_POOL_SIZE", &c.TenantPoolSize)
+	r.sizes("TENANT_POOL_SIZES", &c.TenantPoolSizes)
+	r.string("VENV_VOLUME", &c.VenvVolume)
+	r.list("TASK_ENV_DENYLIST", &c.EnvDenylist)
+	r.int("MAX_CONCURRENT_EXECS", &c.MaxConcurrentExecs)
+	r.duration("VENV_BUILD_TIMEOUT", &c.VenvBuildTimeout)
+	r.string("IMAGE_PEER_URL", &c.ImagePeerURL)
+	r.duration("IMAGE_PULL_WAIT", &c.ImagePullWait)
+	r.string("IMAGE_PEER_TOKEN", &c.ImagePeerToken)
+	r.duration("IMAGE_REFRESH_INTERVAL", &c.ImageRefreshInterval)
+	r.duration("WARMUP_TIMEOUT", &c.WarmupTimeout)
+	r.string("CONTAINER_GPU", &c.GPU)
+	r.int64("CONTAINER_PIDS_LIMIT", &c.PidsLimit)
+	r.list("CONTAINER_ULIMITS", &c.Ulimits)
+	r.string("CONTAINER_DISK_QUOTA", &c.DiskQuota)
+	r.string("SANDBOX_TZ", &c.TZ)
+	r.string("SANDBOX_LOCALE", &c.Locale)
+	r.list("SANDBOX_EXEC_ULIMITS", &c.ExecUlimits)
+	r.string("EGRESS_PROXY_LISTEN", &c.EgressProxyListen)
+	r.string("CONTAINER_CPUSET", &c.Cpuset)
+	r.bool("CONTAINER_NUMA_SPREAD", &c.NUMASpread)
+	r.string("SANDBOX_PLATFORM", &c.Platform)
+	r.string("NETWORK_GUARD", &c.NetworkGuard)
+	r.string("NETWORK_GUARD_IMAGE", &c.GuardImage)
+	if _, ok := r.lookup("DOCKER_DESKTOP"); ok {
+		var desktop bool
+		r.bool("DOCKER_DESKTOP", &desktop)
+		c.DockerDesktop = &desktop
+	}
+
+	a := &cfg.Analysis
+	r.list("CODE_ANALYZERS", &a.Analyzers)
+	r.string("ANALYZER_DENYLIST_FILE", &a.DenylistFile)
+	r.string("ANALYZER_PYTHON", &a.Python)
+	r.string("ANALYZER_HTTP_URL", &a.HTTPURL)
+	r.string("ANALYZER_HTTP_TOKEN", &a.HTTPToken)
+	r.duration("ANALYZER_HTTP_TIMEOUT", &a.HTTPTimeout)
+	r.string("EXECUTION_TRACE", &a.Trace)
+
+	r.string("ARTIFACT_STORE", &cfg.Artifacts.Store)
+	r.int64("ARTIFACT_MAX_BYTES", &cfg.Artifacts.MaxBytes)
+
+	r.string("CODE_STORE", &cfg.Code.Store)
+	r.int("CODE_INLINE_MAX_BYTES", &cfg.Code.InlineMaxBytes)
+	r.string("CODE_CACHE_DIR", &cfg.Code.CacheDir)
+	r.string("RESULT_PROTO_DESCRIPTORS", &cfg.Code.ResultDescriptors)
+
+	r.string("SECRETS_PROVIDER", &cfg.Secrets.Provider)
+	r.string("SECRETS_FILE", &cfg.Secrets.File)
+	r.duration("SECRETS_CACHE_TTL", &cfg.Secrets.CacheTTL)
+
+	wh := &cfg.Webhooks
+	r.string("WEBHOOK_SECRET", &wh.Secret)
+	r.duration("WEBHOOK_POLL_INTERVAL", &wh.PollInterval)
+	r.duration("WEBHOOK_TIMEOUT", &wh.Timeout)
+	r.int("WEBHOOK_BATCH_SIZE", &wh.BatchSize)
+	r.bool("WEBHOOK_ALLOW_PRIVATE", &wh.AllowPrivate)
+	r.int("WEBHOOK_MAX_ATTEMPTS", &wh.Retry.MaxAttempts)
+	r.duration("WEBHOOK_RETRY_BASE_DELAY", &wh.Retry.BaseDelay)
+	r.duration("WEBHOOK_RETRY_MAX_DELAY", &wh.Retry.MaxDelay)
+
+	p := &cfg.Policy
+	r.string("POLICY_BUNDLE", &p.Bundle)
+	r.string("POLICY_BUNDLE_SIGNATURE", &p.Signature)
+	r.string("POLICY_PUBLIC_KEY", &p.PublicKey)
+	r.bool("POLICY_REQUIRE_SIGNED", &p.RequireSigned)
+
+	r.string("RECEIPT_SIGNING_KEY", &cfg.Receipts.SigningKey)
+	r.list("RECEIPT_PUBLIC_KEYS", &cfg.Receipts.PublicKeys)
+
+	r.string("FLEET_CONFIG_SOURCE", &cfg.Fleet.Source)
+	r.duration("FLEET_RECONCILE_INTERVAL", &cfg.Fleet.Interval)
+
+	rt := &cfg.Retention
+	r.duration("TASK_RETENTION_TTL", &rt.TTL)
+	r.duration("RETENTION_INTERVAL", &rt.Interval)
+	r.int("RETENTION_BATCH_SIZE", &rt.BatchSize)
+	r.string("ARCHIVE_DESTINATION", &rt.Destination)
+
+	q := &cfg.Queue
+	r.string("TASK_QUEUE_URL", &q.URL)
+	r.string("TASK_QUEUE_STREAM", &q.Stream)
+	r.duration("TASK_QUEUE_REDELIVER_AFTER", &q.RedeliverAfter)
+	r.string("TASK_QUEUE_MODE", &q.Mode)
+
+	if len(r.errs) > 0 {
+		return fmt.Errorf("invalid environment: %w", errors.Join(r.errs...))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// sandboxInterface is the container end of the veth pair Docker gives a
+// container on a bridge network
+const sandboxInterface = "eth0"
+
+// containerBandwidthKbps is the network limit of sandbox containers, each
+// way in kbit/s: the requested one (a task's or its queue's) bounded by
+// CONTAINER_MAX_BANDWIDTH_KBPS, else CONTAINER_BANDWIDTH_KBPS. 0 is unlimited.
+func containerBandwidthKbps(requested int64) int64 {
+	if settings.MaxBandwidthKbps > 0 && requested > settings.MaxBandwidthKbps {
+		requested = settings.MaxBandwidthKbps
+	}
+	if requested > 0 {
+		return requested
+	}
+	return settings.BandwidthKbps
+}
+
+// ValidateBandwidth checks a requested bandwidth limit against this worker's
+// maximum. 0 means the limit is not requested.
+func ValidateBandwidth(kbps int64) error {
+	if settings.MaxBandwidthKbps > 0 && kbps > settings.MaxBandwidthKbps {
+		return fmt.Errorf("bandwidth_kbps %d is above the %d kbit/s maximum", kbps, settings.MaxBandwidthKbps)
+	}
+	return nil
+}
+
+// shapingSupported reports whether the containers of key can be shaped: tc
+// runs from the host through the network guard, or else needs NET_ADMIN and
+// iproute2 in the container, which only the default profile's setup
+// provides. A container without a network has no traffic to shape.
+func shapingSupported(key poolKey, profile SandboxProfile) bool {
+	return (networkGuard != nil || profile.InstallIptables) && key.Network != NetworkNone
+}
+
+// shapeCmd returns the shell command limiting the container's interface to
+// kbps, or lifting the limit when 0. Outgoing traffic is shaped by an HTB
+// class; incoming traffic can only be policed, dropping what exceeds the rate
+// so TCP senders back off.
+func shapeCmd(kbps int64) string {
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "tc qdisc del dev %s root 2>/dev/null; tc qdisc del dev %[1]s ingress 2>/dev/null\n", sandboxInterface)
+	if kbps == 0 {
+		cmd.WriteString("exit 0\n")
+		return cmd.String()
+	}
+	// A burst of 100ms of traffic, at least a few full-size packets
+	burst := max(kbps*125/10, 16*1024)
+	fmt.Fprintf(&cmd, "tc qdisc add dev %s root handle 1: htb default 10 &&\n", sandboxInterface)
+	fmt.Fprintf(&cmd, "tc class add dev %s parent 1: classid 1:10 htb rate %dkbit ceil %[2]dkbit &&\n", sandboxInterface, kbps)
+	fmt.Fprintf(&cmd, "tc qdisc add dev %s handle ffff: ingress &&\n", sandboxInterface)
+	fmt.Fprintf(&cmd, "tc filter add dev %s parent ffff: protocol all prio 1 u32 match u32 0 0 police rate %dkbit burst %d drop flowid :1\n",
+		sandboxInterface, kbps, burst)
+	return cmd.String()
+}
+
+// shapeContainer sets the bandwidth limit of a warm container to kbps unless
+// it already has it. A limit that can't be applied is alerted on and the
+// container runs unshaped, like egress rules that can't be installed.
+func shapeContainer(ctx context.Context, cli *client.Client, pc *PooledContainer, key poolKey, profile SandboxProfile, kbps int64) {
+	if pc.BandwidthKbps == kbps {
+		return
+	}
+	if !shapingSupported(key, profile) {
+		if kbps > 0 && key.Network != NetworkNone {
+			logging.Log(ctx, fmt.Sprintf("Bandwidth limit of %d kbit/s not applied to %s: the %s profile can't shape traffic", kbps, pc.ID[:12], profile.Name), slog.LevelWarn)
+		}
+		return
+	}
+	if err := runShape(ctx, cli, pc.ID, kbps); err != nil {
+		logging.Log(ctx, fmt.Sprintf("ALERT: bandwidth limit of %d kbit/s could not be applied to sandbox container %s: %v",
+			kbps, pc.ID[:12], err), slog.LevelError)
+		// Whatever was set before is gone, so the next task tries again
+		pc.BandwidthKbps = -1
+		return
+	}
+	pc.BandwidthKbps = kbps
+}
+
+// runShape runs shapeCmd in the container's network namespace, from the host
+// through the network guard or else in the container itself
+func runShape(ctx context.Context, cli *client.Client, containerID string, kbps int64) error {
+	if networkGuard != nil {
+		_, err := networkGuard.ExecInNetns(ctx, containerID, shapeCmd(kbps))
+		return err
+	}
+	_, stderr, exitCode, err := runExec(ctx, cli, containerID, "", []string{"sh", "-c", shapeCmd(kbps)})
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exit %d: %s", exitCode, strings.TrimSpace(stderr))
+	}
+	return err
+}
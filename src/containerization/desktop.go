@@ -0,0 +1,138 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// Docker Desktop (macOS/Windows) runs the daemon inside a small Linux VM. The
+// VM adds its own host aliases and subnet, caps memory and CPUs below the
+// physical machine's, and its kernel may only support the legacy iptables
+// backend. The quirks below let developers run the real Docker executor
+// locally without touching production behaviour.
+
+// desktopHostAliases are the extra names Docker Desktop resolves to the host
+var desktopHostAliases = []string{
+	"kubernetes.docker.internal:127.0.0.1",
+}
+
+// desktopVMSubnet is the VM network Docker Desktop routes host traffic through
+const desktopVMSubnet = "192.168.65.0/24"
+
+// HostPlatform describes the Docker daemon sandbox containers run on
+type HostPlatform struct {
+	Desktop         bool   `json:"docker_desktop"`
+	OperatingSystem string `json:"operating_system"`
+	CgroupVersion   string `json:"cgroup_version"`
+	NCPU            int    `json:"ncpu"`
+	MemTotal        int64  `json:"mem_total_bytes"`
+	// Architecture is the daemon's in OCI terms ("amd64", "arm64")
+	Architecture string `json:"architecture"`
+}
+
+var (
+	platformOnce sync.Once
+	platform     HostPlatform
+	platformErr  error
+)
+
+// DetectPlatform inspects the Docker daemon once and enables the Docker
+// Desktop quirks when it runs inside the Desktop VM. DOCKER_DESKTOP=true or
+// false overrides the detection. A daemon running Windows containers is
+// refused, sandboxes are Linux images. It must be called before the first
+// container is created.
+func DetectPlatform(ctx context.Context, cli *client.Client) (HostPlatform, error) {
+	platformOnce.Do(func() {
+		info, err := cli.Info(ctx)
+		if err != nil {
+			platformErr = fmt.Errorf("failed to query docker daemon: %w", err)
+			return
+		}
+		if info.OSType != "" && info.OSType != "linux" {
+			platformErr = fmt.Errorf("docker daemon runs %s containers, switch it to Linux containers", info.OSType)
+			return
+		}
+
+		platform = HostPlatform{
+			Desktop:         strings.Contains(info.OperatingSystem, "Docker Desktop"),
+			OperatingSystem: info.OperatingSystem,
+			CgroupVersion:   info.CgroupVersion,
+			NCPU:            info.NCPU,
+			MemTotal:        info.MemTotal,
+			Architecture:    ociArchitecture(info.Architecture),
+		}
+		if settings.Platform != "" {
+			logging.Log(ctx, fmt.Sprintf("Sandbox images run as %s on a %s daemon", settings.Platform, platform.Architecture), slog.LevelInfo)
+		}
+		if settings.DockerDesktop != nil {
+			platform.Desktop = *settings.DockerDesktop
+		}
+		if !platform.Desktop {
+			return
+		}
+
+		sandboxExtraHosts = append(sandboxExtraHosts, desktopHostAliases...)
+		blockedEgressRanges = append(blockedEgressRanges, desktopVMSubnet)
+		logging.Log(ctx, fmt.Sprintf("Docker Desktop detected (%s, %d CPUs, %d MB, cgroup v%s)",
+			info.OperatingSystem, info.NCPU, info.MemTotal/1024/1024, info.CgroupVersion), slog.LevelWarn)
+	})
+	return platform, platformErr
+}
+
+// ActivePlatform returns the platform found by DetectPlatform
+func ActivePlatform() HostPlatform {
+	return platform
+}
+
+// sandboxResources returns the memory (MB) and CPU limits of a sandbox
+// container running with sb. Docker Desktop rejects NanoCPUs above the VM's
+// CPU count and a memory limit near the VM's total starves the daemon, so
+// both are clamped.
+func sandboxResources(sb Sandbox) (int64, float64) {
+	memoryMB, cpuLimit := containerMemoryMB(sb.MemoryMB), containerCPULimit(sb.CPULimit)
+	if !platform.Desktop {
+		return memoryMB, cpuLimit
+	}
+
+	if platform.NCPU > 0 && cpuLimit > float64(platform.NCPU) {
+		logging.Log(context.Background(), fmt.Sprintf("Clamping CPU limit %.2f to the %d CPUs of the Docker Desktop VM", cpuLimit, platform.NCPU), slog.LevelWarn)
+		cpuLimit = float64(platform.NCPU)
+	}
+	if vmHalfMB := platform.MemTotal / 2 / 1024 / 1024; vmHalfMB > 0 && memoryMB > vmHalfMB {
+		logging.Log(context.Background(), fmt.Sprintf("Clamping memory limit %d MB to half of the Docker Desktop VM (%d MB)", memoryMB, vmHalfMB), slog.LevelWarn)
+		memoryMB = vmHalfMB
+	}
+	return memoryMB, cpuLimit
+}
+
+// iptablesCmd returns a shell command that appends an OUTPUT rule, falling
+// back to the legacy backend for kernels without nf_tables (Docker Desktop on
+// WSL2 and some older LinuxKit VMs)
+func iptablesCmd(cidr, target string) string {
+	rule := fmt.Sprintf("-A OUTPUT -d %s -j %s", cidr, target)
+	return fmt.Sprintf("iptables %[1]s 2>/dev/null || iptables-legacy %[1]s 2>/dev/null || true\n", rule)
+}
+
+// egressUnenforced is printed by the setup script when no DROP rule stuck
+const egressUnenforced = "CONTINUUM_EGRESS_UNENFORCED"
+
+// iptablesCheck verifies that at least one DROP rule was installed
+const iptablesCheck = "{ iptables -S OUTPUT 2>/dev/null; iptables-legacy -S OUTPUT 2>/dev/null; } | grep -q DROP || echo " + egressUnenforced + "\n"
@@ -0,0 +1,82 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Sandbox images come in three flavours: Debian-based ones (apt-get),
+// Alpine-based ones (apk, busybox) and shell-less ones such as distroless,
+// which ship the interpreter alone. The setup adapts to the first two. The
+// last can only run under the strict profile, whose scripts are executed
+// directly, and without requirements or task ulimits.
+
+// keepAlive is the command keeping a sandbox container running
+var keepAlive = []string{"sleep", "infinity"}
+
+// pythonKeepAlive keeps a container running in an image without sleep
+var pythonKeepAlive = []string{"python", "-c", "import signal; signal.pause()"}
+
+// shellless records the images found to have no shell
+var shellless sync.Map
+
+// isShellless reports whether the image was found to have no shell
+func isShellless(imageName string) bool {
+	_, ok := shellless.Load(imageName)
+	return ok
+}
+
+// missingExecutable reports whether a container or exec failed to start
+// because the image lacks the command
+func missingExecutable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "executable file not found")
+}
+
+// installPackages returns a shell command installing packages with the
+// image's package manager, apt-get or apk, fetching through proxyURL unless
+// it is "". Its output is discarded, callers check for the commands they need.
+func installPackages(proxyURL string, packages ...string) string {
+	proxy := ""
+	if proxyURL != "" {
+		proxy = "export http_proxy=" + proxyURL + "; "
+	}
+	return fmt.Sprintf("(%sif command -v apt-get; then apt-get update -qq && apt-get install -qq -y --no-install-recommends %[2]s; elif command -v apk; then apk add --no-cache -q %[2]s; fi) >/dev/null 2>&1",
+		proxy, strings.Join(packages, " "))
+}
+
+// addSandboxUser creates sandboxuser with useradd, or busybox's adduser
+const addSandboxUser = "id sandboxuser >/dev/null 2>&1 || useradd -m -s /bin/bash sandboxuser 2>/dev/null || adduser -D sandboxuser 2>/dev/null || true\n"
+
+// pythonCleanup empties the scratch directories of a container without a
+// shell
+var pythonCleanup = fmt.Sprintf(`
+import os, shutil
+for d in ("/tmp", "/var/tmp", %q):
+    for name in (os.listdir(d) if os.path.isdir(d) else []):
+        path = os.path.join(d, name)
+        try:
+            if os.path.isdir(path) and not os.path.islink(path):
+                shutil.rmtree(path)
+            else:
+                os.remove(path)
+        except OSError:
+            pass
+`, OutputsDir)
+
+// needsShell reports whether containers of the profile are set up and run
+// through sh
+func (p SandboxProfile) needsShell() bool {
+	return p.ExecUser == "" || p.InstallIptables
+}
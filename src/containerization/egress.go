@@ -0,0 +1,199 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// egressNetworkName is the internal network of allowlist containers: it has
+// no route out, so the egress proxy is the only way to reach the internet
+const egressNetworkName = "continuum_egress"
+
+// EgressProxy forwards the HTTP(S) traffic of allowlist containers to the
+// hosts of their task's allowlist, see the egress package
+type EgressProxy interface {
+	// Allow lets the container at ip reach hosts on behalf of the task (0
+	// while the container is set up) until it is revoked
+	Allow(ip string, taskID int, hosts []string)
+	Revoke(ip string)
+	// Addr is the host:port of the proxy on the egress network
+	Addr() string
+}
+
+var egressProxy EgressProxy
+
+// ErrNoEgressProxy is returned for an allowlist task on a worker without an
+// egress proxy (EGRESS_PROXY_LISTEN unset)
+var ErrNoEgressProxy = errors.New("worker has no egress proxy (EGRESS_PROXY_LISTEN unset)")
+
+// UseEgressProxy enables the allowlist network policy. It must be called
+// before the first task runs.
+func UseEgressProxy(p EgressProxy) {
+	egressProxy = p
+}
+
+// EgressProxyEnabled reports whether tasks with an egress allowlist may run
+// on this worker
+func EgressProxyEnabled() bool {
+	return egressProxy != nil
+}
+
+// EnsureEgressNetwork creates or retrieves the internal network of allowlist
+// containers and returns its ID and gateway
+func EnsureEgressNetwork(ctx context.Context, cli *client.Client) (string, string, error) {
+	networks, err := cli.NetworkList(ctx, network.ListOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list networks: %w", err)
+	}
+
+	id := ""
+	for _, n := range networks {
+		if n.Name == egressNetworkName {
+			id = n.ID
+			break
+		}
+	}
+	if id == "" {
+		resp, err := cli.NetworkCreate(ctx, egressNetworkName, network.CreateOptions{
+			Driver:   "bridge",
+			Internal: true,
+		})
+		if err != nil {
+			logging.Log(ctx, fmt.Sprintf("failed to create egress network: %v", err), slog.LevelError)
+			return "", "", err
+		}
+		id = resp.ID
+	}
+
+	inspect, err := cli.NetworkInspect(ctx, id, network.InspectOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to inspect egress network: %w", err)
+	}
+	gateway := ""
+	if len(inspect.IPAM.Config) > 0 {
+		gateway = inspect.IPAM.Config[0].Gateway
+	}
+	return id, gateway, nil
+}
+
+// EgressNetworkName is the network the egress proxy must be reachable on
+func EgressNetworkName() string {
+	return egressNetworkName
+}
+
+// allowlistEntry is a host name, optionally preceded by "*." to match every
+// subdomain of it
+var allowlistEntry = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// ValidateAllowlist checks the host names of an egress allowlist
+func ValidateAllowlist(hosts []string) error {
+	for _, h := range hosts {
+		if !allowlistEntry.MatchString(h) {
+			return fmt.Errorf("egress_allowlist entry %q must be a lowercase host name or *.domain", h)
+		}
+	}
+	return nil
+}
+
+// AllowedHost reports whether host matches an entry of the allowlist. An
+// entry "*.example.com" matches the subdomains of example.com, not
+// example.com itself.
+func AllowedHost(allowlist []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, entry := range allowlist {
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// EgressBlocked reports whether an allowlisted host resolved to an address
+// the sandbox must never reach: loopback, link-local and the blocked egress
+// ranges, unless the policy bundle allows the range
+func EgressBlocked(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	if inRanges(ip, overrides.AllowedEgress) {
+		return false
+	}
+	return ip.IsPrivate() || inRanges(ip, blockedEgressRanges)
+}
+
+func inRanges(ip net.IP, cidrs []string) bool {
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// EgressProxyURL is the address given to the HTTP clients of allowlist
+// containers, "" without an egress proxy
+func EgressProxyURL() string {
+	if egressProxy == nil {
+		return ""
+	}
+	return "http://" + egressProxy.Addr()
+}
+
+// proxyEnv points the HTTP clients of a script (and pip) to the egress proxy
+func proxyEnv() []string {
+	url := EgressProxyURL()
+	return []string{"HTTP_PROXY=" + url, "HTTPS_PROXY=" + url, "http_proxy=" + url, "https_proxy=" + url}
+}
+
+// setupHosts are reachable while an allowlist container is set up, for
+// apt-get or apk to install iptables
+var setupHosts = []string{"deb.debian.org", "security.debian.org", "dl-cdn.alpinelinux.org"}
+
+// egressUnredirected is printed by the setup when the redirect to the proxy
+// could not be installed
+const egressUnredirected = "CONTINUUM_EGRESS_UNREDIRECTED"
+
+// redirectSetup installs iptables (and tc) in an allowlist container through the
+// proxy and redirects its outgoing HTTP and HTTPS connections to the proxy,
+// so clients ignoring HTTP_PROXY are filtered and logged too rather than
+// left without a route
+func redirectSetup() string {
+	host, port, _ := net.SplitHostPort(egressProxy.Addr())
+	var setup strings.Builder
+	setup.WriteString("{ command -v iptables && command -v tc; } >/dev/null 2>&1 || " + installPackages(EgressProxyURL(), "iptables", "iproute2") + "\n")
+	setup.WriteString(natCmd(fmt.Sprintf("-p tcp -d %s -j RETURN", host)))
+	setup.WriteString(natCmd(fmt.Sprintf("-p tcp -m multiport --dports 80,443 -j DNAT --to-destination %s", net.JoinHostPort(host, port))))
+	setup.WriteString("{ iptables -t nat -S OUTPUT 2>/dev/null; iptables-legacy -t nat -S OUTPUT 2>/dev/null; } | grep -q DNAT || echo " + egressUnredirected + "\n")
+	return setup.String()
+}
+
+// natCmd appends a nat OUTPUT rule, falling back to iptables-legacy like
+// iptablesCmd
+func natCmd(rule string) string {
+	return fmt.Sprintf("iptables -t nat -A OUTPUT %[1]s 2>/dev/null || iptables-legacy -t nat -A OUTPUT %[1]s 2>/dev/null || true\n", rule)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxTaskEnvVars bounds the number of variables a task may set
+	maxTaskEnvVars = 64
+	// maxTaskEnvBytes bounds the total size of the names and values
+	maxTaskEnvBytes = 32 * 1024
+)
+
+// ErrTaskEnv marks an env map that can never be injected
+var ErrTaskEnv = errors.New("invalid task env")
+
+// deniedEnv are variables a task may never set: they change how the
+// interpreter, the dynamic linker or the shell that starts the script behave.
+// Entries ending with "*" are prefixes.
+var deniedEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "PWD", "TMPDIR", "HOSTNAME",
+	"LD_*", "DYLD_*", "PYTHON*", "PIP_*", "VIRTUAL_ENV",
+	"BASH_ENV", "ENV", "BASH_FUNC_*", "SHELLOPTS", "BASHOPTS", "IFS", "PS4",
+	"GCONV_PATH", "LOCPATH", "NLSPATH", "MALLOC_*", "GLIBC_TUNABLES",
+	// Set through the task's timezone and locale instead
+	"TZ", "LANG", "LANGUAGE", "LC_*",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "REQUESTS_CA_BUNDLE", "CURL_CA_BUNDLE",
+	"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY",
+}
+
+var (
+	validEnvName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	validSecretName = regexp.MustCompile(`^[A-Za-z0-9_+=.@/#:-]{1,512}$`)
+)
+
+// EnvVar is a variable of a task's env map: a literal Value, or the name of
+// a Secret the worker resolves when the task is claimed
+type EnvVar struct {
+	Name   string
+	Value  string
+	Secret string
+}
+
+// String returns the NAME=value pair of a literal variable
+func (v EnvVar) String() string {
+	return v.Name + "=" + v.Value
+}
+
+// envDenied reports whether name matches the built-in denylist or
+// TASK_ENV_DENYLIST. Names are compared case-insensitively.
+func envDenied(name string) bool {
+	name = strings.ToUpper(name)
+	for _, denied := range slices.Concat(deniedEnv, settings.EnvDenylist) {
+		denied = strings.ToUpper(denied)
+		if prefix, ok := strings.CutSuffix(denied, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvFromPayload reads the optional "env" map of a task payload, e.g.
+// {"env": {"MODE": "fast", "API_TOKEN": {"secret": "prod/api#token"}}},
+// sorted by name. Payloads that are not JSON objects simply declare nothing.
+func EnvFromPayload(payload string) ([]EnvVar, error) {
+	var p struct {
+		Env map[string]json.RawMessage `json:"env"`
+	}
+	if payload == "" || json.Unmarshal([]byte(payload), &p) != nil {
+		return nil, nil
+	}
+	if len(p.Env) > maxTaskEnvVars {
+		return nil, fmt.Errorf("%w: more than %d variables", ErrTaskEnv, maxTaskEnvVars)
+	}
+
+	env := make([]EnvVar, 0, len(p.Env))
+	size := 0
+	for name, raw := range p.Env {
+		if !validEnvName.MatchString(name) {
+			return nil, fmt.Errorf("%w: invalid variable name %q", ErrTaskEnv, name)
+		}
+		if envDenied(name) {
+			return nil, fmt.Errorf("%w: variable %s may not be set by a task", ErrTaskEnv, name)
+		}
+
+		v := EnvVar{Name: name}
+		var ref struct {
+			Secret string `json:"secret"`
+		}
+		if err := json.Unmarshal(raw, &v.Value); err == nil {
+			if strings.ContainsRune(v.Value, 0) {
+				return nil, fmt.Errorf("%w: value of %s contains a NUL byte", ErrTaskEnv, name)
+			}
+		} else if err := json.Unmarshal(raw, &ref); err == nil && ref.Secret != "" {
+			if !validSecretName.MatchString(ref.Secret) || strings.Contains(ref.Secret, "..") {
+				return nil, fmt.Errorf("%w: invalid secret name %q for %s", ErrTaskEnv, ref.Secret, name)
+			}
+			v.Secret = ref.Secret
+		} else {
+			return nil, fmt.Errorf(`%w: value of %s must be a string or {"secret": "<name>"}`, ErrTaskEnv, name)
+		}
+		size += len(name) + len(v.Value) + 1
+		env = append(env, v)
+	}
+	if size > maxTaskEnvBytes {
+		return nil, fmt.Errorf("%w: variables exceed %d bytes", ErrTaskEnv, maxTaskEnvBytes)
+	}
+	slices.SortFunc(env, func(a, b EnvVar) int { return strings.Compare(a.Name, b.Name) })
+	return env, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExecEnvironment is the timezone, locale and soft ulimits a script runs
+// with. Every field left empty by a task keeps the worker standard
+// (SANDBOX_TZ, SANDBOX_LOCALE, SANDBOX_EXEC_ULIMITS), so a script behaves the
+// same on every node whatever the image or host defaults.
+type ExecEnvironment struct {
+	TZ      string
+	Locale  string
+	Ulimits []string // "name=value" soft limits, replacing the worker's of the same name
+}
+
+// ulimitFlags maps the ulimit names a task may set to their sh flag
+var ulimitFlags = map[string]string{
+	"as": "-v", "core": "-c", "cpu": "-t", "data": "-d",
+	"fsize": "-f", "nofile": "-n", "nproc": "-u", "stack": "-s",
+}
+
+var validLocale = regexp.MustCompile(`^(C|POSIX|[a-z]{2,3}(_[A-Z]{2})?)(\.[A-Za-z0-9-]+)?(@[a-z]+)?$`)
+
+// ValidateExecEnvironment checks a timezone, a locale and soft ulimits
+func ValidateExecEnvironment(e ExecEnvironment) error {
+	if e.TZ != "" {
+		if _, err := time.LoadLocation(e.TZ); err != nil {
+			return fmt.Errorf("unknown timezone %q", e.TZ)
+		}
+	}
+	if e.Locale != "" && !validLocale.MatchString(e.Locale) {
+		return fmt.Errorf("invalid locale %q", e.Locale)
+	}
+	_, err := parseUlimits(e.Ulimits)
+	return err
+}
+
+// parseUlimits reads "name=value" soft limits, value being a number in the
+// unit of sh's ulimit or "unlimited", into a value per name
+func parseUlimits(raw []string) (map[string]string, error) {
+	limits := make(map[string]string, len(raw))
+	for _, r := range raw {
+		name, value, ok := strings.Cut(r, "=")
+		name, value = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid ulimit %q, expected name=value", r)
+		}
+		if _, known := ulimitFlags[name]; !known {
+			return nil, fmt.Errorf("unknown ulimit %q, expected one of %s", name, strings.Join(slices.Sorted(maps.Keys(ulimitFlags)), ", "))
+		}
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil && value != "unlimited" {
+			return nil, fmt.Errorf("invalid value %q of ulimit %s", value, name)
+		}
+		limits[name] = value
+	}
+	return limits, nil
+}
+
+// resolve layers the task's environment over the worker standard
+func (e ExecEnvironment) resolve() ExecEnvironment {
+	resolved := ExecEnvironment{TZ: cmp.Or(e.TZ, settings.TZ), Locale: cmp.Or(e.Locale, settings.Locale)}
+	// Both lists were validated with the configuration and the task
+	limits, _ := parseUlimits(settings.ExecUlimits)
+	task, _ := parseUlimits(e.Ulimits)
+	maps.Copy(limits, task)
+	for _, name := range slices.Sorted(maps.Keys(limits)) {
+		resolved.Ulimits = append(resolved.Ulimits, name+"="+limits[name])
+	}
+	return resolved
+}
+
+// env returns the variables setting the timezone and locale
+func (e ExecEnvironment) env() []string {
+	var vars []string
+	if e.TZ != "" {
+		vars = append(vars, "TZ="+e.TZ)
+	}
+	if e.Locale != "" {
+		vars = append(vars, "LANG="+e.Locale, "LC_ALL="+e.Locale)
+	}
+	return vars
+}
+
+// ulimitCommands returns the sh commands setting the soft ulimits, each
+// followed by "&& ", or "" when there are none. A soft limit above the
+// container's hard limit fails the run before the script starts.
+func (e ExecEnvironment) ulimitCommands() string {
+	var sb strings.Builder
+	limits, _ := parseUlimits(e.Ulimits)
+	for _, name := range slices.Sorted(maps.Keys(limits)) {
+		fmt.Fprintf(&sb, "ulimit -S %s %s && ", ulimitFlags[name], limits[name])
+	}
+	return sb.String()
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"sync"
+)
+
+// ExecQueue admits at most limit script executions at a time. Waiting
+// executions are grouped by tenant and admitted round-robin across tenants,
+// in arrival order within a tenant, so a tenant with a large batch can't
+// starve the others.
+type ExecQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	waiting map[string][]*ExecTicket
+	tenants []string // Tenants with waiting tickets, in round-robin order
+}
+
+// ExecTicket is a place in an ExecQueue
+type ExecTicket struct {
+	queue    *ExecQueue
+	tenantID string
+	ready    chan struct{}
+	admitted bool // Guarded by queue.mu
+}
+
+// NewExecQueue creates a queue running up to limit executions at a time
+func NewExecQueue(limit int) *ExecQueue {
+	return &ExecQueue{limit: max(limit, 1), waiting: make(map[string][]*ExecTicket)}
+}
+
+// Enqueue takes a place in line for the tenant. Enqueue in priority order
+// and Wait concurrently to keep that order within a tenant.
+func (q *ExecQueue) Enqueue(tenantID string) *ExecTicket {
+	t := &ExecTicket{queue: q, tenantID: tenantID, ready: make(chan struct{})}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiting[tenantID]) == 0 {
+		q.tenants = append(q.tenants, tenantID)
+	}
+	q.waiting[tenantID] = append(q.waiting[tenantID], t)
+	q.admitLocked()
+	return t
+}
+
+// SetLimit changes how many executions may run at a time. Executions over a
+// lowered limit finish undisturbed; no new one is admitted until they do.
+func (q *ExecQueue) SetLimit(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limit = max(limit, 1)
+	q.admitLocked()
+}
+
+// Limit returns how many executions may run at a time
+func (q *ExecQueue) Limit() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit
+}
+
+// Waiting returns the number of executions waiting for a slot
+func (q *ExecQueue) Waiting() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, tickets := range q.waiting {
+		n += len(tickets)
+	}
+	return n
+}
+
+// admitLocked hands free slots to the next tenants in turn; the caller holds mu
+func (q *ExecQueue) admitLocked() {
+	for q.running < q.limit && len(q.tenants) > 0 {
+		tenantID := q.tenants[0]
+		q.tenants = q.tenants[1:]
+		tickets := q.waiting[tenantID]
+		t := tickets[0]
+		if len(tickets) > 1 {
+			q.waiting[tenantID] = tickets[1:]
+			q.tenants = append(q.tenants, tenantID)
+		} else {
+			delete(q.waiting, tenantID)
+		}
+		t.admitted = true
+		q.running++
+		close(t.ready)
+	}
+}
+
+// Wait blocks until the ticket is admitted. If ctx is cancelled first the
+// ticket leaves the queue and Release must not be called.
+func (t *ExecTicket) Wait(ctx context.Context) error {
+	select {
+	case <-t.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q := t.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t.admitted {
+		// Admitted meanwhile: hand the slot to the next in line
+		q.running--
+		q.admitLocked()
+		return ctx.Err()
+	}
+	tickets := q.waiting[t.tenantID]
+	for i, other := range tickets {
+		if other == t {
+			tickets = append(tickets[:i:i], tickets[i+1:]...)
+			break
+		}
+	}
+	if len(tickets) > 0 {
+		q.waiting[t.tenantID] = tickets
+	} else {
+		delete(q.waiting, t.tenantID)
+		for i, tenantID := range q.tenants {
+			if tenantID == t.tenantID {
+				q.tenants = append(q.tenants[:i:i], q.tenants[i+1:]...)
+				break
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// Release frees the slot of an admitted ticket
+func (t *ExecTicket) Release() {
+	q := t.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	q.admitLocked()
+}
+
+var defaultExecQueue = sync.OnceValue(func() *ExecQueue {
+	return NewExecQueue(settings.MaxConcurrentExecs)
+})
+
+// DefaultExecQueue returns the worker's queue, sized by MAX_CONCURRENT_EXECS
+func DefaultExecQueue() *ExecQueue {
+	return defaultExecQueue()
+}
+
+var (
+	containerSlotsMu sync.Mutex
+	containerSlots   = make(map[poolKey]chan struct{})
+)
+
+// containerBusy reports whether an execution holds the container of key
+func containerBusy(key poolKey) bool {
+	containerSlotsMu.Lock()
+	defer containerSlotsMu.Unlock()
+	slot, ok := containerSlots[key]
+	return ok && len(slot) > 0
+}
+
+// lockContainer waits until no other execution uses the warm container of
+// key. A container runs one script at a time: scripts share its work dir and
+// OutputsDir, and it is sanitized before every execution.
+func lockContainer(ctx context.Context, key poolKey) (func(), error) {
+	containerSlotsMu.Lock()
+	slot, ok := containerSlots[key]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		containerSlots[key] = slot
+	}
+	containerSlotsMu.Unlock()
+
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+
+	"github.com/docker/docker/client"
+)
+
+// Where the egress rules and bandwidth limits of sandbox containers are
+// enforced, see NETWORK_GUARD
+const (
+	GuardHost      = "host"
+	GuardContainer = "container"
+)
+
+// NetworkGuard enforces the egress rules of the sandbox networks from the
+// host, so containers need neither iptables nor NET_ADMIN, see the
+// networkguard package
+type NetworkGuard interface {
+	// ExecInNetns runs a shell script in the network namespace of the
+	// container, with the host's network privileges, and returns its output
+	ExecInNetns(ctx context.Context, containerID, script string) (string, error)
+}
+
+var networkGuard NetworkGuard
+
+// UseNetworkGuard hands traffic shaping to the guard enforcing the egress
+// rules from the host. It must be called before the first task runs.
+func UseNetworkGuard(g NetworkGuard) {
+	networkGuard = g
+}
+
+// EgressRanges returns the ranges sandbox containers may reach despite the
+// blocked ones (a policy bundle's), and the blocked ranges
+func EgressRanges() (allowed, blocked []string) {
+	return overrides.AllowedEgress, blockedEgressRanges
+}
+
+// Exec runs a command in a container and waits for it, returning its
+// stdout, stderr and exit code
+func Exec(ctx context.Context, cli *client.Client, containerID, user string, cmd []string) (string, string, int, error) {
+	return runExec(ctx, cli, containerID, user, cmd)
+}
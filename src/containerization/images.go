@@ -0,0 +1,148 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// DefaultImage is the sandbox image used when a task doesn't request a version
+func DefaultImage() string {
+	return settings.Image
+}
+
+// SupportedPythonVersions lists the versions tasks may request
+func SupportedPythonVersions() []string {
+	return settings.PythonVersions
+}
+
+// ImageForPythonVersion maps a requested python_version to a sandbox image
+// using the python image template (default python:{version}-slim). An empty
+// version selects the default image.
+func ImageForPythonVersion(version string) (string, error) {
+	if version == "" {
+		return DefaultImage(), nil
+	}
+	if !slices.Contains(SupportedPythonVersions(), version) {
+		return "", fmt.Errorf("unsupported python_version %q (supported: %s)", version, strings.Join(SupportedPythonVersions(), ", "))
+	}
+	return strings.ReplaceAll(settings.PythonImageTemplate, "{version}", version), nil
+}
+
+// RuntimeImages lists every image a task may run in: the default image and
+// the image of each supported python version, without duplicates
+func RuntimeImages() []string {
+	images := []string{DefaultImage()}
+	for _, version := range SupportedPythonVersions() {
+		if imageName, err := ImageForPythonVersion(version); err == nil && !slices.Contains(images, imageName) {
+			images = append(images, imageName)
+		}
+	}
+	return images
+}
+
+// PullProgress receives the bytes downloaded so far out of the total known
+// so far, which grows as the registry reports more layers
+type PullProgress func(current, total int64)
+
+type progressKey struct{}
+
+// WithPullProgress reports the progress of registry pulls made with ctx,
+// whichever Puller makes them
+func WithPullProgress(ctx context.Context, progress PullProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// Puller fetches an image that is not present locally
+type Puller func(ctx context.Context, cli *client.Client, imageName string) error
+
+var puller Puller = PullImage
+
+// UsePuller replaces the registry pull of missing images, e.g. to coordinate
+// pulls across the fleet. It must be called before the first task runs.
+func UsePuller(p Puller) {
+	puller = p
+}
+
+// EnsureImage fetches the image through the installed Puller if it is not
+// present locally, and again from the registry if the local one was built
+// for another platform
+func EnsureImage(ctx context.Context, cli *client.Client, imageName string) error {
+	inspect, err := cli.ImageInspect(ctx, imageName)
+	if client.IsErrNotFound(err) {
+		if err := puller(ctx, cli, imageName); err != nil {
+			return err
+		}
+		inspect, err = cli.ImageInspect(ctx, imageName)
+	}
+	if err != nil {
+		return err
+	}
+	return ensurePlatform(ctx, cli, imageName, inspect)
+}
+
+// PullImage pulls the image from its registry, for SANDBOX_PLATFORM when set
+func PullImage(ctx context.Context, cli *client.Client, imageName string) error {
+	logging.Log(ctx, fmt.Sprintf("Pulling sandbox image %s...", imageName), slog.LevelInfo)
+	reader, err := cli.ImagePull(ctx, imageName, image.PullOptions{Platform: settings.Platform})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", imageName, err)
+	}
+	defer reader.Close()
+
+	// The stream reports each layer's download, and failures such as an
+	// unknown manifest that the request itself doesn't
+	progress, _ := ctx.Value(progressKey{}).(PullProgress)
+	layers := map[string][2]int64{}
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to pull image %s: %w", imageName, err)
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("failed to pull image %s: %s", imageName, msg.Error.Message)
+		}
+		if progress == nil || msg.ID == "" {
+			continue
+		}
+		switch layer := layers[msg.ID]; {
+		case msg.Status == "Downloading" && msg.Progress != nil && msg.Progress.Total > 0:
+			layers[msg.ID] = [2]int64{msg.Progress.Current, msg.Progress.Total}
+		case msg.Status == "Download complete":
+			layers[msg.ID] = [2]int64{layer[1], layer[1]}
+		default:
+			continue
+		}
+		var current, total int64
+		for _, layer := range layers {
+			current += layer[0]
+			total += layer[1]
+		}
+		progress(current, total)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Metrics recorded by the container manager
+const (
+	metricContainersCreated = "worker_containers_created"
+	metricContainersReused  = "worker_containers_reused"
+	metricContainersRemoved = "worker_containers_removed"
+	metricVenvPreparations  = "worker_venv_preparations"
+	metricWarmups           = "worker_code_warmups"
+	metricPoolSize          = "worker_container_pool_size"
+	metricExecQueueWaiting  = "worker_exec_queue_waiting"
+)
+
+// Reasons a container is removed, recorded on worker_containers_removed
+const (
+	removeIdle        = "idle"
+	removeEvicted     = "evicted"
+	removeSingleUse   = "single_use"
+	removeSetupFailed = "setup_failed"
+	removeShutdown    = "shutdown"
+	removeRotated     = "rotated" // Replaced by a fresh container after CONTAINER_ROTATE_INTERVAL
+	removeAborted     = "aborted" // The execution was cancelled or timed out with the script still running
+	removeReset       = "reset"   // Discarded after its execution under SANDBOX_RESET=recreate
+	// Discarded after its execution, as its code's warm-up timed out and may
+	// still be running
+	removeWarmupTimeout = "warmup_timeout"
+)
+
+// RegisterMetrics registers the container manager metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricContainersCreated, "Number of sandbox containers created, by image", "Container")
+	logging.InitializeFloatCounter(metricContainersReused, "Number of executions served by a warm container, by image", "Container")
+	logging.InitializeFloatCounter(metricContainersRemoved, "Number of sandbox containers removed, by reason", "Container")
+	logging.InitializeFloatCounter(metricVenvPreparations, "Number of virtualenvs prepared for task requirements, by result", "Virtualenv")
+	logging.InitializeFloatCounter(metricWarmups, "Number of code warm-ups run in sandbox containers, by result", "Warmup")
+	logging.InitializeFloatGauge(metricPoolSize, "Number of warm containers in the pool", "Container",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			record(float64(poolSize.Load()))
+		})
+	logging.InitializeFloatGauge(metricExecQueueWaiting, "Number of claimed tasks waiting for an execution slot", "Task",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			record(float64(DefaultExecQueue().Waiting()))
+		})
+}
+
+// removeContainer force-removes a sandbox container and counts the removal
+func removeContainer(ctx context.Context, cli *client.Client, containerID, imageName, reason string) {
+	cli.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+	forgetPlacement(containerID)
+	forgetWarmups(containerID)
+	logging.Inc(ctx, metricContainersRemoved, attribute.String("image", imageName), attribute.String("reason", reason))
+}
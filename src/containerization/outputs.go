@@ -0,0 +1,71 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// OutputsDir is where scripts write files that should be kept as artifacts
+const OutputsDir = "/outputs"
+
+// ArtifactSink receives the files a script left in OutputsDir
+type ArtifactSink interface {
+	Store(ctx context.Context, name string, size int64, body io.Reader) error
+}
+
+// collectArtifacts streams every regular file under OutputsDir to the sink
+func collectArtifacts(ctx context.Context, cli *client.Client, containerID string, sink ArtifactSink) error {
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, OutputsDir)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Symlinks could point anywhere in the container; only keep files
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Entries are named "outputs/<path>"
+		_, name, ok := strings.Cut(hdr.Name, "/")
+		if !ok || name == "" {
+			continue
+		}
+		// .continuum/ is reserved for the worker's own artifacts, such as the
+		// execution trace, which a script must not be able to replace
+		if strings.HasPrefix(path.Clean(name), ".continuum/") {
+			continue
+		}
+		if err := sink.Store(ctx, name, hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+}
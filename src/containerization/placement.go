@@ -0,0 +1,153 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+const sysNodeDir = "/sys/devices/system/node"
+
+// numaNode is a NUMA node of the host and the CPUs of CONTAINER_CPUSET on it
+type numaNode struct {
+	ID   int
+	CPUs string
+}
+
+// numaNodes reads the host topology from sysfs once. Nodes without any
+// allowed CPU are left out; a host without NUMA information has none.
+var numaNodes = sync.OnceValue(func() []numaNode {
+	var allowed []int
+	if settings.Cpuset != "" {
+		// Validated with the configuration
+		allowed, _ = config.ParseCPUList(settings.Cpuset)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(sysNodeDir, "node[0-9]*"))
+	var nodes []numaNode
+	for _, path := range paths {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "node"))
+		if err != nil {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(path, "cpulist"))
+		if err != nil {
+			continue
+		}
+		// Memory-only nodes have an empty list
+		cpus, err := config.ParseCPUList(strings.TrimSpace(string(raw)))
+		if err != nil {
+			continue
+		}
+		if allowed != nil {
+			cpus = slices.DeleteFunc(cpus, func(cpu int) bool { return !slices.Contains(allowed, cpu) })
+		}
+		if len(cpus) > 0 {
+			nodes = append(nodes, numaNode{ID: id, CPUs: formatCPUList(cpus)})
+		}
+	}
+	slices.SortFunc(nodes, func(a, b numaNode) int { return a.ID - b.ID })
+	return nodes
+})
+
+// formatCPUList writes sorted CPU numbers as a Linux CPU list, e.g. "0-3,8"
+func formatCPUList(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// placement counts the executions running on each NUMA node and remembers
+// the node each warm container is pinned to
+var placement = struct {
+	sync.Mutex
+	running map[int]int    // Executions per node ID
+	pinned  map[string]int // Node ID per container ID
+}{running: make(map[int]int), pinned: make(map[string]int)}
+
+// placeExecution pins the container to the NUMA node running the fewest
+// executions, preferring the node it is already pinned to so a warm
+// container's memory stays local, and returns the function giving the place
+// back. It does nothing without CONTAINER_NUMA_SPREAD or on a single node.
+// A container that can't be pinned runs where it is.
+func placeExecution(ctx context.Context, cli *client.Client, containerID string) func() {
+	nodes := numaNodes()
+	if !settings.NUMASpread || len(nodes) < 2 {
+		return func() {}
+	}
+
+	placement.Lock()
+	current, pinned := placement.pinned[containerID]
+	best := nodes[0]
+	for _, n := range nodes[1:] {
+		load, bestLoad := placement.running[n.ID], placement.running[best.ID]
+		if load < bestLoad || load == bestLoad && pinned && n.ID == current {
+			best = n
+		}
+	}
+	placement.running[best.ID]++
+	placement.Unlock()
+
+	release := func() {
+		placement.Lock()
+		placement.running[best.ID]--
+		placement.Unlock()
+	}
+	if pinned && current == best.ID {
+		return release
+	}
+
+	_, err := cli.ContainerUpdate(ctx, containerID, container.UpdateConfig{Resources: container.Resources{
+		CpusetCpus: best.CPUs,
+		CpusetMems: strconv.Itoa(best.ID),
+	}})
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to pin container %s to NUMA node %d: %v", containerID[:12], best.ID, err), slog.LevelWarn)
+		return release
+	}
+	placement.Lock()
+	placement.pinned[containerID] = best.ID
+	placement.Unlock()
+	return release
+}
+
+// forgetPlacement drops the pinning of a removed container
+func forgetPlacement(containerID string) {
+	placement.Lock()
+	delete(placement.pinned, containerID)
+	placement.Unlock()
+}
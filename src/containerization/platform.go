@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Sandbox images run on the daemon's own architecture unless SANDBOX_PLATFORM
+// asks for another one (under emulation). A multi-arch image pulled from the
+// registry already resolves to the right variant, but an image imported from
+// a peer, or pulled for another platform before, may not match.
+
+// ociArchitecture maps the architecture reported by the daemon (uname -m)
+// to its OCI name
+func ociArchitecture(arch string) string {
+	switch arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "armv7l":
+		return "arm"
+	}
+	return arch
+}
+
+// imagePlatform returns the "os/arch[/variant]" sandbox images are expected
+// to have, "" while the daemon's architecture is unknown
+func imagePlatform() string {
+	if settings.Platform != "" {
+		return settings.Platform
+	}
+	if platform.Architecture != "" {
+		return "linux/" + platform.Architecture
+	}
+	return ""
+}
+
+// ociPlatform returns the platform containers are created for, nil to let
+// the daemon pick its own
+func ociPlatform() *ocispec.Platform {
+	if settings.Platform == "" {
+		return nil
+	}
+	parts := strings.Split(settings.Platform, "/")
+	p := &ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) > 2 {
+		p.Variant = parts[2]
+	}
+	return p
+}
+
+// platformMatches reports whether a local image was built for imagePlatform
+func platformMatches(inspect image.InspectResponse) bool {
+	want := imagePlatform()
+	if want == "" || inspect.Architecture == "" {
+		return true
+	}
+	parts := strings.Split(want, "/")
+	if inspect.Os != "" && inspect.Os != parts[0] {
+		return false
+	}
+	if inspect.Architecture != parts[1] {
+		return false
+	}
+	return len(parts) < 3 || inspect.Variant == "" || inspect.Variant == parts[2]
+}
+
+// repulled records the images pulled again for the platform, so a
+// single-arch image of another architecture is only pulled once
+var repulled sync.Map
+
+// ensurePlatform pulls the image again from the registry when the local copy
+// was built for another platform. If the registry has no better match, the
+// local image is used as is (under emulation when the daemon has it).
+func ensurePlatform(ctx context.Context, cli *client.Client, imageName string, inspect image.InspectResponse) error {
+	if platformMatches(inspect) {
+		return nil
+	}
+	if _, done := repulled.LoadOrStore(imageName, true); done {
+		return nil
+	}
+	logging.Log(ctx, fmt.Sprintf("Sandbox image %s is %s/%s, pulling it for %s", imageName, inspect.Os, inspect.Architecture, imagePlatform()), slog.LevelWarn)
+	return PullImage(ctx, cli, imageName)
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// blockedEgressRanges are dropped by the network guard's host rules, or the
+// in-container iptables rules of the default profile: private networks and
+// the cloud metadata range
+var blockedEgressRanges = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"}
+
+// PolicyOverrides are sandbox settings imposed by a policy bundle. Zero
+// values keep the environment configuration.
+type PolicyOverrides struct {
+	Profile       string
+	BlockedEgress []string
+	AllowedEgress []string // Accepted before the blocked ranges, e.g. an internal package mirror
+	MemoryMB      int64
+	CPULimit      float64
+}
+
+var overrides PolicyOverrides
+
+// ApplyPolicyOverrides installs the sandbox settings of a policy bundle. It
+// must be called before LoadSandboxProfile and before any container is created.
+func ApplyPolicyOverrides(o PolicyOverrides) {
+	overrides = o
+	if o.BlockedEgress != nil {
+		blockedEgressRanges = o.BlockedEgress
+	}
+}
+
+// sandboxExtraHosts makes Docker's host aliases resolve to the container itself
+var sandboxExtraHosts = []string{
+	"host.docker.internal:127.0.0.1",
+	"gateway.docker.internal:127.0.0.1",
+}
+
+// containerMemoryMB is the memory limit of sandbox containers: the policy
+// bundle's, else the requested one (a task's or its queue's) bounded by
+// CONTAINER_MAX_MEMORY_MB, else CONTAINER_MEMORY_MB
+func containerMemoryMB(requested int64) int64 {
+	if overrides.MemoryMB > 0 {
+		return overrides.MemoryMB
+	}
+	if maxMB, _ := MaxResources(); maxMB > 0 && requested > maxMB {
+		requested = maxMB
+	}
+	if requested > 0 {
+		return requested
+	}
+	return settings.MemoryMB
+}
+
+// containerCPULimit is the fractional CPU limit of sandbox containers,
+// resolved like containerMemoryMB (CONTAINER_CPU_LIMIT)
+func containerCPULimit(requested float64) float64 {
+	if overrides.CPULimit > 0 {
+		return overrides.CPULimit
+	}
+	if _, maxCPU := MaxResources(); maxCPU > 0 && requested > maxCPU {
+		requested = maxCPU
+	}
+	if requested > 0 {
+		return requested
+	}
+	return settings.CPULimit
+}
+
+// MaxResources returns the largest memory (MB) and CPU limits a task may
+// request on this worker, 0 when unbounded. Limits imposed by a policy
+// bundle replace any request, so they leave requests unbounded.
+func MaxResources() (int64, float64) {
+	memoryMB, cpuLimit := settings.MaxMemoryMB, settings.MaxCPULimit
+	if overrides.MemoryMB > 0 {
+		memoryMB = 0
+	}
+	if overrides.CPULimit > 0 {
+		cpuLimit = 0
+	}
+	return memoryMB, cpuLimit
+}
+
+// ValidateResources checks requested limits against this worker's maximums.
+// 0 means the limit is not requested.
+func ValidateResources(memoryMB int64, cpuLimit float64) error {
+	maxMB, maxCPU := MaxResources()
+	if maxMB > 0 && memoryMB > maxMB {
+		return fmt.Errorf("memory_mb %d is above the %d MB maximum", memoryMB, maxMB)
+	}
+	if maxCPU > 0 && cpuLimit > maxCPU {
+		return fmt.Errorf("cpu_limit %g is above the %g maximum", cpuLimit, maxCPU)
+	}
+	return nil
+}
+
+// NetworkPolicy describes what sandboxed code can reach
+type NetworkPolicy struct {
+	Network        string   `json:"network"`
+	AllowedEgress  []string `json:"allowed_egress"`
+	BlockedEgress  []string `json:"blocked_egress"`
+	EgressEnforced string   `json:"egress_enforced_by"`
+	HostAliases    []string `json:"host_aliases_to_loopback"`
+	// EgressProxy serves the allowlist network policy, "" when disabled
+	EgressProxy string `json:"egress_proxy,omitempty"`
+}
+
+// ResourceDefaults are the limits applied to every sandbox container
+type ResourceDefaults struct {
+	MemoryMB       int64    `json:"memory_mb"`
+	CPULimit       float64  `json:"cpu_limit"`
+	MaxMemoryMB    int64    `json:"max_memory_mb"`
+	MaxCPULimit    float64  `json:"max_cpu_limit"`
+	PidsLimit      int64    `json:"pids_limit"`
+	Ulimits        []string `json:"ulimits"`
+	DiskQuota      string   `json:"disk_quota,omitempty"`
+	TenantPoolSize int      `json:"tenant_pool_size"`
+	Bandwidth      int64    `json:"bandwidth_kbps"` // 0 when unlimited
+	MaxBandwidth   int64    `json:"max_bandwidth_kbps"`
+}
+
+// Policy is the effective sandbox configuration of this node
+type Policy struct {
+	Runtime         string            `json:"runtime"`
+	Profile         string            `json:"profile"`
+	ReadonlyRootfs  bool              `json:"readonly_rootfs"`
+	CapAdd          []string          `json:"cap_add"`
+	CapDrop         []string          `json:"cap_drop"`
+	NoNewPrivileges bool              `json:"no_new_privileges"`
+	Seccomp         string            `json:"seccomp"`
+	ExecUser        string            `json:"exec_user"`
+	Tmpfs           map[string]string `json:"tmpfs"`
+	Network         NetworkPolicy     `json:"network"`
+	Resources       ResourceDefaults  `json:"resources"`
+	Platform        HostPlatform      `json:"platform"`
+}
+
+// EffectivePolicy reports the sandbox configuration actually applied to new
+// containers. A custom seccomp profile is reported by hash, not content.
+func EffectivePolicy() (Policy, error) {
+	profile, err := LoadSandboxProfile()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	runtime := ActiveRuntime()
+	if runtime == "" {
+		runtime = "default"
+	}
+
+	p := Policy{
+		Runtime:        runtime,
+		Profile:        profile.Name,
+		ReadonlyRootfs: profile.ReadonlyRootfs,
+		CapAdd:         nonNil(profile.CapAdd),
+		CapDrop:        nonNil(profile.CapDrop),
+		Seccomp:        "docker-default",
+		ExecUser:       profile.ExecUser,
+		Tmpfs:          profile.Tmpfs,
+		Network: NetworkPolicy{
+			Network:        sandboxNetworkName,
+			AllowedEgress:  []string{},
+			BlockedEgress:  []string{},
+			EgressEnforced: "external",
+			HostAliases:    sandboxExtraHosts,
+		},
+		Resources: ResourceDefaults{
+			PidsLimit:      settings.PidsLimit,
+			Ulimits:        nonNil(settings.Ulimits),
+			DiskQuota:      settings.DiskQuota,
+			TenantPoolSize: TenantPoolSize(""),
+		},
+		Platform: ActivePlatform(),
+	}
+	p.Resources.MemoryMB, p.Resources.CPULimit = sandboxResources(Sandbox{})
+	p.Resources.MaxMemoryMB, p.Resources.MaxCPULimit = MaxResources()
+	p.Resources.Bandwidth, p.Resources.MaxBandwidth = containerBandwidthKbps(0), settings.MaxBandwidthKbps
+	if p.ExecUser == "" {
+		p.ExecUser = "sandboxuser"
+	}
+	if EgressProxyEnabled() {
+		p.Network.EgressProxy = EgressProxyURL()
+	}
+	if networkGuard != nil || profile.InstallIptables {
+		p.Network.AllowedEgress = nonNil(overrides.AllowedEgress)
+		p.Network.BlockedEgress = blockedEgressRanges
+		p.Network.EgressEnforced = "in-container iptables"
+	}
+	if networkGuard != nil {
+		p.Network.EgressEnforced = "host nftables"
+	}
+
+	for _, opt := range profile.SecurityOpt {
+		switch {
+		case strings.HasPrefix(opt, "no-new-privileges"):
+			p.NoNewPrivileges = !strings.HasSuffix(opt, ":false")
+		case strings.HasPrefix(opt, "seccomp="):
+			sum := sha256.Sum256([]byte(strings.TrimPrefix(opt, "seccomp=")))
+			p.Seccomp = "custom sha256:" + hex.EncodeToString(sum[:])
+		}
+	}
+	return p, nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
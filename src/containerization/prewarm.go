@@ -0,0 +1,77 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// Prewarm prepares the warm container an execution of req will use before
+// it is due: it creates the container (pulling its image when missing),
+// builds the virtualenv of req.Requirements and runs req.Warmup, so the
+// execution starts on a ready sandbox. Code and payload are not copied. A
+// container busy with an execution is left alone, and false is returned;
+// it gets prepared when the task runs.
+func Prewarm(ctx context.Context, cli *client.Client, networkID string, req ExecRequest) (bool, error) {
+	key, profile, err := keyFor(req)
+	if err != nil {
+		return false, err
+	}
+	if containerBusy(key) {
+		return false, nil
+	}
+	unlock, err := lockContainer(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	pc, err := GetOrCreateContainer(ctx, cli, networkID, req.Image, req.TenantID, req.Sandbox)
+	if err != nil {
+		return false, err
+	}
+	// A shell-less image has nothing more to prepare
+	if pc.NoShell {
+		return true, nil
+	}
+
+	// pip and the warm-up reach the task's hosts as the script would
+	var proxy []string
+	if key.Network == NetworkAllowlist {
+		egressProxy.Allow(pc.EgressIP, req.TaskID, req.Sandbox.Allowlist)
+		defer egressProxy.Revoke(pc.EgressIP)
+		proxy = proxyEnv()
+	}
+
+	python := "python"
+	if len(req.Requirements) > 0 {
+		python, err = ensureVenv(ctx, cli, pc.ID, req.Image, req.Requirements, proxy)
+		if err != nil {
+			return false, fmt.Errorf("failed to prepare virtualenv: %w", err)
+		}
+	}
+	singleUse := resetRecreates() || (req.TenantID != "" && TenantPoolSize(req.TenantID) == 0)
+	if req.Warmup != "" && !singleUse {
+		if warmUp(ctx, cli, pc.ID, profile, python, req.Warmup, slices.Concat([]string{"HOME=/tmp"}, req.Environment.resolve().env(), proxy)) {
+			discardContainer(cli, key, pc.ID, req.Image, removeWarmupTimeout)
+			return false, fmt.Errorf("warm-up timed out after %s", settings.WarmupTimeout)
+		}
+	}
+	logging.Log(ctx, fmt.Sprintf("Pre-warmed container %s for task %d", pc.ID[:12], req.TaskID), slog.LevelDebug)
+	return true, nil
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+// nobodyUser is the unprivileged uid:gid present in Debian-based images
+const nobodyUser = "65534:65534"
+
+// SandboxProfile describes how sandbox containers are hardened
+type SandboxProfile struct {
+	Name           string
+	ReadonlyRootfs bool
+	CapDrop        []string
+	CapAdd         []string
+	SecurityOpt    []string
+	Tmpfs          map[string]string
+	Mounts         []mount.Mount
+	// WorkDir is where script.py and payload.json are copied
+	WorkDir string
+	// ExecUser runs the script directly; empty means chown + su to sandboxuser
+	ExecUser string
+	// InstallIptables installs the egress rules (and tc) in the container,
+	// with NET_ADMIN, when they aren't enforced from the host
+	InstallIptables bool
+}
+
+var (
+	profileMu sync.Mutex
+	profiles  = map[string]SandboxProfile{}
+)
+
+// LoadSandboxProfile resolves SANDBOX_PROFILE (default|strict), unless a policy
+// bundle imposes one, and the optional SANDBOX_SECCOMP_PROFILE json file. The
+// result is computed once and cached.
+//
+// The default profile runs scripts as sandboxuser via su with
+// no-new-privileges. The strict profile drops every capability, mounts the
+// root filesystem read-only with tmpfs scratch space and runs scripts as
+// nobody. Egress filtering is enforced from the host by the network guard;
+// with NETWORK_GUARD=container the default profile installs iptables rules in
+// the container instead, and strict mode has none.
+func LoadSandboxProfile() (SandboxProfile, error) {
+	return profileFor("")
+}
+
+// profileFor resolves the profile of a task asking for the given isolation
+// mode. Asking for strict isolation tightens the node's profile; nothing
+// loosens it, and a profile imposed by a policy bundle always wins.
+func profileFor(isolation string) (SandboxProfile, error) {
+	name := strings.ToLower(settings.Profile)
+	if strings.ToLower(isolation) == IsolationStrict {
+		name = IsolationStrict
+	}
+	if overrides.Profile != "" {
+		name = strings.ToLower(overrides.Profile)
+	}
+	if name == "" {
+		name = IsolationDefault
+	}
+
+	profileMu.Lock()
+	defer profileMu.Unlock()
+	if p, ok := profiles[name]; ok {
+		return p, nil
+	}
+	p, err := buildProfile(name)
+	if err != nil {
+		return SandboxProfile{}, err
+	}
+	profiles[name] = p
+	return p, nil
+}
+
+// buildProfile builds a named profile with the optional seccomp profile
+func buildProfile(name string) (SandboxProfile, error) {
+	var profile SandboxProfile
+	switch name {
+	case IsolationDefault:
+		profile = SandboxProfile{
+			Name:        IsolationDefault,
+			SecurityOpt: []string{"no-new-privileges:true"},
+			WorkDir:     "/",
+		}
+		if settings.NetworkGuard == GuardContainer {
+			profile.CapAdd = []string{"NET_ADMIN"}
+			profile.InstallIptables = true
+		}
+	case IsolationStrict:
+		profile = SandboxProfile{
+			Name:           IsolationStrict,
+			ReadonlyRootfs: true,
+			CapDrop:        []string{"ALL"},
+			SecurityOpt:    []string{"no-new-privileges:true"},
+			Tmpfs: map[string]string{
+				"/tmp":     "rw,noexec,nosuid,nodev,size=64m",
+				"/var/tmp": "rw,noexec,nosuid,nodev,size=16m",
+				OutputsDir: "rw,noexec,nosuid,nodev,size=256m,mode=1777",
+			},
+			// Anonymous volume so the worker can still CopyToContainer
+			// into an otherwise read-only filesystem
+			Mounts: []mount.Mount{
+				{Type: mount.TypeVolume, Target: "/sandbox"},
+			},
+			WorkDir:  "/sandbox",
+			ExecUser: nobodyUser,
+		}
+	default:
+		return SandboxProfile{}, fmt.Errorf("unknown SANDBOX_PROFILE %q (expected default or strict)", name)
+	}
+
+	if path := settings.SeccompProfile; path != "" {
+		// The Docker API expects the profile content, not a path
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return SandboxProfile{}, fmt.Errorf("failed to read seccomp profile: %w", err)
+		}
+		profile.SecurityOpt = append(profile.SecurityOpt, "seccomp="+string(content))
+	}
+	return profile, nil
+}
+
+// scriptPath returns the absolute path of a file copied into the work dir
+func (p SandboxProfile) scriptPath(name string) string {
+	return strings.TrimSuffix(p.WorkDir, "/") + "/" + name
+}
+
+// cleanupExec returns the user and command that sanitize a reused container,
+// in python when it has no shell
+func (p SandboxProfile) cleanupExec(noShell bool) (string, []string) {
+	if noShell {
+		return p.ExecUser, []string{"python", "-c", pythonCleanup}
+	}
+	if p.ExecUser != "" {
+		// Files left behind were written by the exec user; root without
+		// capabilities cannot remove them from sticky directories.
+		return p.ExecUser, []string{"sh", "-c", `
+			find /tmp -mindepth 1 -delete 2>/dev/null || true
+			find /var/tmp -mindepth 1 -delete 2>/dev/null || true
+			find /outputs -mindepth 1 -delete 2>/dev/null || true
+		`}
+	}
+	// We just remove everything in the container home directory to be safe in case a python code leaves some files behind. /root is already inaccessible.
+	return "root", []string{"sh", "-c", `
+		rm -f /script.py /payload.json
+		find /tmp -mindepth 1 -delete 2>/dev/null || true
+		find /var/tmp -mindepth 1 -delete 2>/dev/null || true
+		find /home/sandboxuser -mindepth 1 -delete 2>/dev/null || true
+		find /outputs -mindepth 1 -delete 2>/dev/null || true
+	`}
+}
+
+// runExec returns the user and command that execute the task script with the
+// given interpreter (plain "python" or a cached virtualenv's), wrapped in the
+// tracer unless it is "", under the soft ulimits of env
+func (p SandboxProfile) runExec(python, tracer string, env ExecEnvironment) (string, []string) {
+	script, payload := p.scriptPath("script.py"), p.scriptPath("payload.json")
+	ulimits := env.ulimitCommands()
+	if p.ExecUser != "" {
+		cmd := []string{python, script, payload}
+		if tracer != "" {
+			cmd = append(traceArgs(tracer, p.traceFile()), cmd...)
+		}
+		if ulimits != "" {
+			cmd = append([]string{"sh", "-c", ulimits + `exec "$@"`, "sh"}, cmd...)
+		}
+		return p.ExecUser, cmd
+	}
+	run := fmt.Sprintf(`su sandboxuser -c "%[1]s %[2]s %[3]s"`, python, script, payload)
+	if tracer != "" {
+		run = fmt.Sprintf("%[1]s -u sandboxuser %[2]s %[3]s %[4]s", strings.Join(traceArgs(tracer, p.traceFile()), " "), python, script, payload)
+	}
+	// Limits set by root are inherited through su and the tracer
+	return "root", []string{"sh", "-c", fmt.Sprintf(`
+		mkdir -p %[3]s
+		chown sandboxuser:sandboxuser %[1]s %[2]s %[3]s
+		%[4]s%[5]s
+	`, script, payload, OutputsDir, ulimits, run)}
+}
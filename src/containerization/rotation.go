@@ -0,0 +1,96 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// RunContainerRotation replaces every warm container older than interval
+// with a fresh one until ctx is cancelled, so state left behind by scripts
+// (processes, caches, kernel objects) can't build up in a container living
+// for days. The replacement is created in the background and swapped in
+// between two tasks.
+func RunContainerRotation(ctx context.Context, cli *client.Client, networkID string, interval time.Duration) {
+	ticker := time.NewTicker(min(interval, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stale := make(map[poolKey]PooledContainer)
+			poolMu.Lock()
+			for key, pc := range pool {
+				if time.Since(pc.CreatedAt) > interval {
+					stale[key] = *pc
+				}
+			}
+			poolMu.Unlock()
+
+			for key, pc := range stale {
+				if ctx.Err() != nil {
+					return
+				}
+				rotateContainer(ctx, cli, networkID, key, pc)
+			}
+		}
+	}
+}
+
+// rotateContainer swaps the warm container old of key for a fresh one. A
+// container whose settings the pool no longer produces, e.g. after a policy
+// change, is left to the idle reaper.
+func rotateContainer(ctx context.Context, cli *client.Client, networkID string, key poolKey, old PooledContainer) {
+	sb := Sandbox{Network: key.Network, GPU: key.GPU}
+	if key.Profile == IsolationStrict {
+		sb.Isolation = IsolationStrict
+	}
+	current, profile, err := keyFor(ExecRequest{Image: key.Image, TenantID: key.TenantID, Sandbox: sb})
+	if err != nil || current != key {
+		return
+	}
+
+	fresh, err := createContainer(ctx, cli, networkID, key, profile, old.MemoryMB, old.CPULimit)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to rotate container %s (%s), keeping it: %v", old.ID[:12], key, err), slog.LevelWarn)
+		return
+	}
+
+	// Wait for the task running in the old container, if any
+	removed := fresh
+	if unlock, err := lockContainer(ctx, key); err == nil {
+		poolMu.Lock()
+		if pc, ok := pool[key]; ok && pc.ID == old.ID {
+			fresh.LastUsedAt = pc.LastUsedAt
+			poolPut(key, fresh)
+			removed = pc
+		}
+		poolMu.Unlock()
+		unlock()
+	}
+
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	removeContainer(cleanupCtx, cli, removed.ID, removed.Image, removeRotated)
+	if removed != fresh {
+		logging.Log(ctx, fmt.Sprintf("Rotated container %s (%s), replaced by %s", old.ID[:12], key, fresh.ID[:12]), slog.LevelInfo)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// runtimeCandidates maps CONTAINER_RUNTIME values to the names Docker
+// daemons commonly register those runtimes under.
+var runtimeCandidates = map[string][]string{
+	"runc":   {"runc"},
+	"runsc":  {"runsc"},
+	"gvisor": {"runsc"},
+	"kata":   {"kata", "kata-runtime", "io.containerd.kata.v2"},
+}
+
+var (
+	runtimeOnce     sync.Once
+	resolvedRuntime string
+	runtimeErr      error
+)
+
+// ResolveRuntime detects which OCI runtime sandbox containers should use.
+// CONTAINER_RUNTIME selects runc (default), runsc/gvisor or kata. If the
+// requested runtime is not registered with the Docker daemon, the worker
+// falls back to the daemon default unless CONTAINER_RUNTIME_REQUIRED=true.
+// The result is computed once and cached.
+func ResolveRuntime(ctx context.Context, cli *client.Client) (string, error) {
+	runtimeOnce.Do(func() {
+		requested := strings.ToLower(settings.Runtime)
+		if requested == "" || requested == "runc" || requested == "default" {
+			return
+		}
+
+		candidates, ok := runtimeCandidates[requested]
+		if !ok {
+			// Allow arbitrary runtime names registered in daemon.json
+			candidates = []string{requested}
+		}
+
+		info, err := cli.Info(ctx)
+		if err != nil {
+			runtimeErr = fmt.Errorf("failed to query docker runtimes: %w", err)
+			return
+		}
+
+		for _, name := range candidates {
+			if _, ok := info.Runtimes[name]; ok {
+				resolvedRuntime = name
+				logging.Log(ctx, fmt.Sprintf("Using container runtime %s", name), slog.LevelInfo)
+				return
+			}
+		}
+
+		if settings.RuntimeRequired {
+			runtimeErr = fmt.Errorf("container runtime %q is not available on this docker daemon", requested)
+			return
+		}
+		logging.Log(ctx, fmt.Sprintf("Container runtime %q is not available, falling back to %s", requested, info.DefaultRuntime), slog.LevelWarn)
+	})
+	return resolvedRuntime, runtimeErr
+}
+
+// ActiveRuntime returns the runtime chosen by ResolveRuntime, or "" when
+// sandbox containers use the daemon default
+func ActiveRuntime() string {
+	return resolvedRuntime
+}
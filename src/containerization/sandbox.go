@@ -0,0 +1,134 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+)
+
+// Isolation modes, the hardening profiles a task or queue may ask for
+const (
+	IsolationDefault = "default"
+	IsolationStrict  = "strict"
+)
+
+// Network policies of a task or queue
+const (
+	NetworkSandbox = "sandbox" // The sandbox network with the egress rules
+	NetworkNone    = "none"    // No network at all; requirements can't be installed
+	// NetworkAllowlist reaches only the hosts of the egress allowlist, through
+	// the worker's egress proxy
+	NetworkAllowlist = "allowlist"
+)
+
+// Sandbox are the container settings of one task, inherited from its queue
+// unless the task overrides them. Zero values keep the worker configuration.
+type Sandbox struct {
+	Isolation string
+	Network   string
+	Allowlist []string // Hosts reachable with NetworkAllowlist
+	MemoryMB  int64
+	CPULimit  float64
+	GPU       bool  // The task requires the node's GPUs
+	Bandwidth int64 // Traffic limit each way in kbit/s
+}
+
+// ErrNoGPU is returned for a task requiring a GPU on a worker without any
+var ErrNoGPU = errors.New("worker has no GPU (CONTAINER_GPU=none)")
+
+// GPUEnabled reports whether tasks requiring a GPU may run on this worker
+func GPUEnabled() bool {
+	return settings.GPU == "all"
+}
+
+// gpuDeviceRequests exposes every NVIDIA GPU of the node to a container
+func gpuDeviceRequests() []container.DeviceRequest {
+	return []container.DeviceRequest{{Driver: "nvidia", Count: -1, Capabilities: [][]string{{"gpu"}}}}
+}
+
+// ValidateSandbox checks the isolation mode and network policy names
+func ValidateSandbox(isolation, network string) error {
+	switch isolation {
+	case "", IsolationDefault, IsolationStrict:
+	default:
+		return fmt.Errorf("isolation must be %s or %s, got %q", IsolationDefault, IsolationStrict, isolation)
+	}
+	switch network {
+	case "", NetworkSandbox, NetworkNone, NetworkAllowlist:
+	default:
+		return fmt.Errorf("network must be %s, %s or %s, got %q", NetworkSandbox, NetworkNone, NetworkAllowlist, network)
+	}
+	return nil
+}
+
+// keyFor returns the pool partition of a request with its resolved profile.
+// Containers differ by profile, network and GPU access, so each combination is pooled
+// separately; memory, CPU and bandwidth are updated on a warm container instead.
+func keyFor(req ExecRequest) (poolKey, SandboxProfile, error) {
+	profile, err := profileFor(req.Sandbox.Isolation)
+	if err != nil {
+		return poolKey{}, SandboxProfile{}, err
+	}
+	key := poolKey{Image: req.Image, TenantID: req.TenantID, Profile: profile.Name}
+	switch req.Sandbox.Network {
+	case NetworkNone:
+		key.Network = NetworkNone
+	case NetworkAllowlist:
+		if !EgressProxyEnabled() {
+			return poolKey{}, SandboxProfile{}, ErrNoEgressProxy
+		}
+		key.Network = NetworkAllowlist
+	}
+	if req.Sandbox.GPU {
+		if !GPUEnabled() {
+			return poolKey{}, SandboxProfile{}, ErrNoGPU
+		}
+		key.GPU = true
+	}
+	return key, profile, nil
+}
+
+// containerResources converts limits to Docker resources. Swap is kept at
+// Docker's default of twice the memory so raising the memory of a warm
+// container is accepted.
+func containerResources(memoryMB int64, cpuLimit float64) container.Resources {
+	return container.Resources{
+		Memory:     memoryMB * 1024 * 1024,
+		MemorySwap: 2 * memoryMB * 1024 * 1024,
+		NanoCPUs:   int64(cpuLimit * math.Pow10(9)),
+	}
+}
+
+// applyHostLimits sets the limits protecting the host on a new container:
+// CONTAINER_PIDS_LIMIT, CONTAINER_ULIMITS and CONTAINER_DISK_QUOTA. They
+// don't vary per task, so warm containers keep them.
+func applyHostLimits(hc *container.HostConfig) {
+	if settings.PidsLimit > 0 {
+		pids := settings.PidsLimit
+		hc.PidsLimit = &pids
+	}
+	for _, raw := range settings.Ulimits {
+		// Validated with the configuration
+		if u, err := units.ParseUlimit(raw); err == nil {
+			hc.Ulimits = append(hc.Ulimits, u)
+		}
+	}
+	// Only some storage drivers support it, e.g. overlay2 on xfs with pquota
+	if settings.DiskQuota != "" {
+		hc.StorageOpt = map[string]string{"size": settings.DiskQuota}
+	}
+}
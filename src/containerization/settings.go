@@ -11,7 +11,13 @@
 
 package containerization
 
-// TODO: AnalyzeCode checks for malicious patterns in Python code
-func AnalyzeCode(code string) (bool, error) {
-	return false, nil
-}
\ No newline at end of file
+import "continuumworker/src/config"
+
+// settings is the container configuration, see Configure
+var settings = config.Default().Container
+
+// Configure installs the container configuration. It must be called before
+// the sandbox profile, runtime or any container is resolved.
+func Configure(c config.Container) {
+	settings = c
+}
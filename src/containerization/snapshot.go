@@ -0,0 +1,102 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// Ways a sandbox container is reset between executions (SANDBOX_RESET)
+const (
+	// ResetClean deletes the files left in the scratch directories of a
+	// reused container. Changes elsewhere, e.g. packages installed with pip
+	// --user or into /usr by root, survive it.
+	ResetClean = "clean"
+	// ResetRecreate discards the container after each execution. The next
+	// one starts from the base snapshot, a layer committed right after the
+	// setup, so nothing of an earlier execution survives.
+	ResetRecreate = "recreate"
+)
+
+// snapshotRepository is the local repository of the base snapshots
+const snapshotRepository = "continuum-sandbox-base"
+
+var (
+	snapshotMu sync.Mutex
+	// snapshots maps a snapshot key to the reference of its committed image
+	snapshots = map[string]string{}
+)
+
+// resetRecreates reports whether containers are discarded after each execution
+func resetRecreates() bool {
+	return settings.Reset == ResetRecreate
+}
+
+// baseImage returns the image to create a container for key from: its base
+// snapshot when there is one, else the image itself. snapKey names the
+// snapshot to commit once the container is set up, "" for none: only
+// recreated containers with an in-container setup have one.
+func baseImage(ctx context.Context, cli *client.Client, key poolKey, profile SandboxProfile) (image, snapKey string) {
+	if !resetRecreates() || !profile.needsShell() {
+		return key.Image, ""
+	}
+	// A new version of the image under the same tag gets its own snapshot
+	inspect, err := cli.ImageInspect(ctx, key.Image)
+	if err != nil {
+		return key.Image, ""
+	}
+	sum := sha256.Sum256([]byte(inspect.ID + "\x00" + profile.Name + "\x00" + key.Network))
+	snapKey = hex.EncodeToString(sum[:8])
+
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	if ref, ok := snapshots[snapKey]; ok {
+		return ref, ""
+	}
+	return key.Image, snapKey
+}
+
+// takeSnapshot commits a container that was just set up, before it runs
+// anything, as the base snapshot of snapKey. Without one, containers keep
+// being created from the image and set up from scratch.
+func takeSnapshot(ctx context.Context, cli *client.Client, containerID, snapKey string) {
+	ref := snapshotRepository + ":" + snapKey
+	if _, err := cli.ContainerCommit(ctx, containerID, container.CommitOptions{Reference: ref, Comment: "Continuum sandbox after setup", Pause: true}); err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to commit the base snapshot of %s: %v", containerID[:12], err), slog.LevelWarn)
+		return
+	}
+	snapshotMu.Lock()
+	snapshots[snapKey] = ref
+	snapshotMu.Unlock()
+	logging.Log(ctx, fmt.Sprintf("Base snapshot %s committed from %s", ref, containerID[:12]), slog.LevelInfo)
+}
+
+// discardContainer removes a container after its execution, e.g. under
+// SANDBOX_RESET=recreate, unless it was already replaced
+func discardContainer(cli *client.Client, key poolKey, containerID, imageName, reason string) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
+	if current, ok := pool[key]; ok && current.ID == containerID {
+		poolDelete(key)
+		removeContainer(context.Background(), cli, containerID, imageName, reason)
+	}
+}
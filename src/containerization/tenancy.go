@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// TenantPoolSize is the number of warm containers a tenant may keep across
+// all images. TENANT_POOL_SIZE sets the default and TENANT_POOL_SIZES
+// ("tenant=size,...") overrides it per tenant. A size of 0 disables reuse
+// entirely: the tenant gets a fresh container for every task.
+func TenantPoolSize(tenantID string) int {
+	if n, ok := settings.TenantPoolSizes[tenantID]; ok {
+		return n
+	}
+	return settings.TenantPoolSize
+}
+
+// evictTenantContainers removes the tenant's least recently used containers
+// until there is room for one more. Busy containers are skipped, so the
+// partition may briefly exceed its size while they run. Tasks without a
+// tenant share an unbounded partition. The caller must hold poolMu.
+func evictTenantContainers(ctx context.Context, cli *client.Client, tenantID string) {
+	if tenantID == "" {
+		return
+	}
+	// A size-0 tenant still needs one container for the running task; it is
+	// removed as soon as the task finishes
+	limit := max(TenantPoolSize(tenantID), 1)
+
+	for {
+		var oldest *poolKey
+		count := 0
+		for key, pc := range pool {
+			if key.TenantID != tenantID {
+				continue
+			}
+			count++
+			// Never evict a container that is running another task
+			if containerBusy(key) {
+				continue
+			}
+			if oldest == nil || pc.LastUsedAt.Before(pool[*oldest].LastUsedAt) {
+				k := key
+				oldest = &k
+			}
+		}
+		if count < limit || oldest == nil {
+			return
+		}
+
+		pc := pool[*oldest]
+		logging.Log(ctx, fmt.Sprintf("Tenant pool full, evicting container %s (%s)\n", pc.ID[:12], *oldest), slog.LevelInfo)
+		removeContainer(ctx, cli, pc.ID, pc.Image, removeEvicted)
+		poolDelete(*oldest)
+	}
+}
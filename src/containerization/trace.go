@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// Tracers that can wrap the execution of a flagged task
+const (
+	TracerStrace = "strace" // system calls
+	TracerLtrace = "ltrace" // library calls
+)
+
+// TraceArtifactPath is where the execution trace is kept among the task's
+// artifacts
+const TraceArtifactPath = ".continuum/trace.txt"
+
+// traceFile is where the tracer writes inside the container. Under the
+// default profile the tracer runs as root and only the script drops to
+// sandboxuser, so the script can't read or rewrite its own trace.
+func (p SandboxProfile) traceFile() string {
+	if p.ExecUser != "" {
+		return "/tmp/.continuum-trace"
+	}
+	return "/root/.continuum-trace"
+}
+
+// traceArgs is the tracer command line, followed children included
+func traceArgs(tracer, file string) []string {
+	return []string{tracer, "-f", "-tt", "-o", file}
+}
+
+// ensureTracer installs the tracer in the container if the image lacks it,
+// then checks it may attach to the script's user: seccomp profiles and
+// missing capabilities commonly forbid ptrace, in which case the task must
+// run untraced rather than fail.
+func ensureTracer(ctx context.Context, cli *client.Client, containerID string, profile SandboxProfile, tracer string) error {
+	install := fmt.Sprintf("command -v %s >/dev/null 2>&1 || %s", tracer, installPackages("", tracer))
+	_, stderr, exitCode, err := runExec(ctx, cli, containerID, "root", []string{"sh", "-c", install})
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%s is not installed in the image and could not be installed (exit %d): %s", tracer, exitCode, strings.TrimSpace(stderr))
+	}
+
+	user, probe := "root", append(traceArgs(tracer, "/dev/null"), "-u", "sandboxuser", "true")
+	if profile.ExecUser != "" {
+		user, probe = profile.ExecUser, append(traceArgs(tracer, "/dev/null"), "true")
+	}
+	_, stderr, exitCode, err = runExec(ctx, cli, containerID, user, probe)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("%s cannot attach in the sandbox (exit %d): %s", tracer, exitCode, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// collectTrace stores the trace written by the tracer as an artifact and
+// removes it from the container
+func collectTrace(ctx context.Context, cli *client.Client, containerID string, file string, sink ArtifactSink) error {
+	defer runExec(context.WithoutCancel(ctx), cli, containerID, "root", []string{"rm", "-f", file})
+
+	rc, _, err := cli.CopyFromContainer(ctx, containerID, file)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("failed to read trace: %w", err)
+	}
+	return sink.Store(ctx, TraceArtifactPath, hdr.Size, tr)
+}
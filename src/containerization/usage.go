@@ -0,0 +1,119 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ResourceUsage is the resource consumption attributed to one execution
+type ResourceUsage struct {
+	CPUSeconds      float64
+	PeakMemoryBytes uint64
+}
+
+// usageSampler measures a single exec inside a pooled container. CPU time is
+// the cgroup usage delta between the start and end snapshots; peak memory is
+// the highest usage observed while streaming stats during the exec. This is
+// accurate as long as a container runs one exec at a time.
+type usageSampler struct {
+	cli         *client.Client
+	containerID string
+	startCPU    uint64
+	cancel      context.CancelFunc
+	done        chan struct{}
+
+	mu      sync.Mutex
+	peakMem uint64
+}
+
+func readStats(ctx context.Context, cli *client.Client, containerID string) (container.StatsResponse, error) {
+	reader, err := cli.ContainerStatsOneShot(ctx, containerID)
+	if err != nil {
+		return container.StatsResponse{}, err
+	}
+	defer reader.Body.Close()
+
+	var stats container.StatsResponse
+	err = json.NewDecoder(reader.Body).Decode(&stats)
+	return stats, err
+}
+
+// startUsageSampler snapshots the container and starts streaming stats
+func startUsageSampler(ctx context.Context, cli *client.Client, containerID string) (*usageSampler, error) {
+	initial, err := readStats(ctx, cli, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	s := &usageSampler{
+		cli:         cli,
+		containerID: containerID,
+		startCPU:    initial.CPUStats.CPUUsage.TotalUsage,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		peakMem:     initial.MemoryStats.Usage,
+	}
+
+	go func() {
+		defer close(s.done)
+		reader, err := cli.ContainerStats(streamCtx, containerID, true)
+		if err != nil {
+			return
+		}
+		defer reader.Body.Close()
+
+		dec := json.NewDecoder(reader.Body)
+		for {
+			var stats container.StatsResponse
+			if err := dec.Decode(&stats); err != nil {
+				return
+			}
+			s.observe(stats.MemoryStats)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *usageSampler) observe(mem container.MemoryStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// cgroup v1 reports a true high-water mark; v2 only reports current usage
+	s.peakMem = max(s.peakMem, mem.Usage, mem.MaxUsage)
+}
+
+// Stop ends sampling and returns the usage attributed to the exec
+func (s *usageSampler) Stop(ctx context.Context) ResourceUsage {
+	final, err := readStats(ctx, s.cli, s.containerID)
+	s.cancel()
+	<-s.done
+
+	if err == nil {
+		s.observe(final.MemoryStats)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := ResourceUsage{PeakMemoryBytes: s.peakMem}
+	if err == nil && final.CPUStats.CPUUsage.TotalUsage >= s.startCPU {
+		usage.CPUSeconds = float64(final.CPUStats.CPUUsage.TotalUsage-s.startCPU) / 1e9
+	}
+	return usage
+}
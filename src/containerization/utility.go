@@ -13,12 +13,13 @@ package containerization
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math"
-	"os"
-	"strconv"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"archive/tar"
@@ -26,20 +27,127 @@ import (
 	"io"
 
 	"continuumworker/src/logging"
+	"continuumworker/src/workers"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// PooledContainer is a warm sandbox container kept alive between tasks
+type PooledContainer struct {
+	ID            string
+	Image         string
+	TenantID      string // Tenant the container is reserved for, "" for the shared pool
+	PythonVersion string // Interpreter version reported by the container
+	CreatedAt     time.Time
+	LastUsedAt    time.Time
+	// Resource limits currently set, updated to each task's before it runs
+	MemoryMB      int64
+	CPULimit      float64
+	BandwidthKbps int64 // 0 unshaped, -1 unknown after a failed change
+	// EgressIP is the address of an allowlist container on the egress network
+	EgressIP string
+	// NoShell is set for images without a shell, see distro.go
+	NoShell bool
+}
+
+// ExecRequest describes a single script execution
+type ExecRequest struct {
+	TaskID   int // Attributes the task's network requests in TASK_NETWORK_LOG
+	Code     string
+	Payload  string
+	Image    string // Sandbox image, selects the warm pool
+	TenantID string // Owning tenant, selects the tenant's pool partition
+	// Requirements are pip specifiers installed into a cached virtualenv
+	Requirements []string
+	// Warmup is the code's warm-up snippet, run once per container and
+	// interpreter before the script, see warmUp
+	Warmup string
+	// Env are NAME=value pairs set for the script, see EnvFromPayload
+	Env []string
+	// Sandbox holds the task's isolation, network and resource settings
+	Sandbox Sandbox
+	// Artifacts receives the files left in OutputsDir, nil to skip collection
+	Artifacts ArtifactSink
+	// Environment is the task's timezone, locale and ulimits over the
+	// worker standard
+	Environment ExecEnvironment
+	// Trace is the tracer (strace or ltrace) wrapping a flagged run, "" for
+	// none. The trace is stored through Artifacts whatever the exit status.
+	Trace string
+
+	// Optional live copies of the output, written while the script runs
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// ErrScript marks a script that ran but exited with a non-zero status. It is
+// the task's own fault, not the worker's.
+var ErrScript = errors.New("script exited with an error")
+
+// ExecResult is the outcome of a script execution
+type ExecResult struct {
+	Output        string
+	ExitCode      *int // Exit status of the script, nil if it never finished
+	PythonVersion string
+	Usage         ResourceUsage
+	ArtifactsErr  error // Artifact collection failure; the script itself succeeded
+	Traced        bool  // The execution trace was stored as TraceArtifactPath
+}
 
 var (
-	activeContainerMu sync.Mutex
-	activeContainerID string
-	lastUsedAt        time.Time
+	poolMu sync.Mutex
+	pool   = make(map[poolKey]*PooledContainer) // Warm containers keyed by image and tenant
+	// poolSize mirrors len(pool) so the gauge never waits on poolMu, which is
+	// held while a container is created
+	poolSize atomic.Int64
 )
 
+// poolPut adds a container to the pool. The caller must hold poolMu.
+func poolPut(key poolKey, pc *PooledContainer) {
+	pool[key] = pc
+	poolSize.Store(int64(len(pool)))
+}
+
+// poolDelete removes a container from the pool. The caller must hold poolMu.
+func poolDelete(key poolKey) {
+	delete(pool, key)
+	poolSize.Store(int64(len(pool)))
+}
+
+// poolKey partitions the warm pool so a container is never reused across
+// tenants, hardening profiles, network policies or GPU access
+type poolKey struct {
+	Image    string
+	TenantID string
+	Profile  string // Name of the SandboxProfile the container was created with
+	Network  string // NetworkNone or NetworkAllowlist, "" for the sandbox network
+	GPU      bool   // The container has the node's GPUs
+}
+
+func (k poolKey) String() string {
+	s := k.Image
+	if k.TenantID != "" {
+		s += ", tenant " + k.TenantID
+	}
+	if k.Profile != "" && k.Profile != IsolationDefault {
+		s += ", " + k.Profile
+	}
+	switch k.Network {
+	case NetworkNone:
+		s += ", no network"
+	case NetworkAllowlist:
+		s += ", egress allowlist"
+	}
+	if k.GPU {
+		s += ", gpu"
+	}
+	return s
+}
+
 const sandboxNetworkName = "continuum_sandbox"
 
 // ensureSandboxNetwork creates or retrieves the sandbox network for container isolation
@@ -48,7 +156,7 @@ func EnsureSandboxNetwork(ctx context.Context, cli *client.Client) (string, erro
 	// Check if network already exists
 	networks, err := cli.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
-		logging.Log(fmt.Sprintf("failed to list networks: %w", err), slog.LevelError)
+		logging.Log(ctx, fmt.Sprintf("failed to list networks: %v", err), slog.LevelError)
 		return "", err
 	}
 
@@ -64,254 +172,546 @@ func EnsureSandboxNetwork(ctx context.Context, cli *client.Client) (string, erro
 		// Note: Internal: true would block ALL external access
 		// We want external access, just not internal host access
 		// So we use ExtraHosts in container config instead
+		Options: map[string]string{
+			// Sandboxes never talk to each other
+			"com.docker.network.bridge.enable_icc": "false",
+		},
 	})
 	if err != nil {
-		logging.Log(fmt.Sprintf("failed to create sandbox network: %w", err), slog.LevelError)
+		logging.Log(ctx, fmt.Sprintf("failed to create sandbox network: %v", err), slog.LevelError)
 		return "", err
 	}
 
 	return resp.ID, nil
 }
 
-func GetOrCreateContainer(ctx context.Context, cli *client.Client, networkID string) (string, error) {
-	activeContainerMu.Lock()
-	defer activeContainerMu.Unlock()
+// runExec runs a command in the container, with env added to its
+// environment, and waits for it to finish
+func runExec(ctx context.Context, cli *client.Client, containerID, user string, cmd []string, env ...string) (string, string, int, error) {
+	exec, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		User:         user,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          env,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return "", "", -1, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, container.ExecStartOptions{})
+	if err != nil {
+		return "", "", -1, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer resp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader); err != nil {
+		return "", "", -1, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return stdout.String(), stderr.String(), -1, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	return stdout.String(), stderr.String(), inspect.ExitCode, nil
+}
+
+// GetOrCreateContainer returns a sanitized warm container for the image from
+// the tenant's partition of the pool, creating one if the partition has none
+// (or the pooled one died). The container's limits are set to sb's.
+func GetOrCreateContainer(ctx context.Context, cli *client.Client, networkID string, imageName string, tenantID string, sb Sandbox) (PooledContainer, error) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
 
-	if activeContainerID != "" {
+	key, profile, err := keyFor(ExecRequest{Image: imageName, TenantID: tenantID, Sandbox: sb})
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to load sandbox profile: %v", err), slog.LevelError)
+		return PooledContainer{}, err
+	}
+
+	// Resource Limits
+	memoryMB, cpuLimit := sandboxResources(sb)
+	bandwidthKbps := containerBandwidthKbps(sb.Bandwidth)
+
+	if pc, ok := pool[key]; ok {
 		// Check if container is still alive
-		inspect, err := cli.ContainerInspect(ctx, activeContainerID)
+		inspect, err := cli.ContainerInspect(ctx, pc.ID)
 		if err == nil && inspect.State.Running {
-			lastUsedAt = time.Now()
+			pc.LastUsedAt = time.Now()
 			//sanitize active container (erase tmp and existing files)
-			execConfig := container.ExecOptions{
-				User:         "root",
-				AttachStdout: true,
-				AttachStderr: true,
-				// We just remove everything in the container home directory to be safe in case a python code leaves some files behind. /root is already inaccessible.
-				Cmd: []string{"sh", "-c", `
-					rm -f /script.py /payload.json
-					find /tmp -mindepth 1 -delete 2>/dev/null || true
-					find /var/tmp -mindepth 1 -delete 2>/dev/null || true
-					find /home/sandboxuser -mindepth 1 -delete 2>/dev/null || true
-				`},
-			}
-			exeCreate, err := cli.ContainerExecCreate(ctx, activeContainerID, execConfig)
-			if err != nil {
-				logging.Log(fmt.Sprintf("failed to create exec: %w", err), slog.LevelError)
-				return "", err
+			cleanupUser, cleanupCmd := profile.cleanupExec(pc.NoShell)
+			if _, _, _, err := runExec(ctx, cli, pc.ID, cleanupUser, cleanupCmd); err != nil {
+				logging.Log(ctx, fmt.Sprintf("failed to sanitize container: %v", err), slog.LevelError)
+				return PooledContainer{}, err
 			}
-			execResp, err := cli.ContainerExecAttach(ctx, exeCreate.ID, container.ExecStartOptions{})
-			if err != nil {
-				logging.Log(fmt.Sprintf("failed to attach to exec: %w", err), slog.LevelError)
-				return "", err
+			if pc.MemoryMB != memoryMB || pc.CPULimit != cpuLimit {
+				if _, err := cli.ContainerUpdate(ctx, pc.ID, container.UpdateConfig{Resources: containerResources(memoryMB, cpuLimit)}); err != nil {
+					logging.Log(ctx, fmt.Sprintf("failed to update container limits: %v", err), slog.LevelError)
+					return PooledContainer{}, err
+				}
+				pc.MemoryMB, pc.CPULimit = memoryMB, cpuLimit
 			}
-			defer execResp.Close()
-			return activeContainerID, nil
+			shapeContainer(ctx, cli, pc, key, profile, bandwidthKbps)
+			logging.Inc(ctx, metricContainersReused, attribute.String("image", imageName))
+			return *pc, nil
 		}
 		// If not running or error, reset and create new one
-		activeContainerID = ""
+		poolDelete(key)
 	}
 
-	imageName := os.Getenv("CONTAINER_IMAGE")
-	if imageName == "" {
-		imageName = "python:3.9-slim"
+	// Make room in the tenant's partition before warming another container
+	evictTenantContainers(ctx, cli, tenantID)
+
+	pc, err := createContainer(ctx, cli, networkID, key, profile, memoryMB, cpuLimit)
+	if err != nil {
+		return PooledContainer{}, err
 	}
+	shapeContainer(ctx, cli, pc, key, profile, bandwidthKbps)
+	poolPut(key, pc)
+	return *pc, nil
+}
 
-	// Resource Limits
-	memoryMBStr := os.Getenv("CONTAINER_MEMORY_MB")
-	if memoryMBStr == "" {
-		memoryMBStr = "512"
+// createContainer creates, starts and sets up a sandbox container for key,
+// outside the pool
+func createContainer(ctx context.Context, cli *client.Client, networkID string, key poolKey, profile SandboxProfile, memoryMB int64, cpuLimit float64) (*PooledContainer, error) {
+	imageName, tenantID := key.Image, key.TenantID
+	if err := EnsureImage(ctx, cli, imageName); err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to ensure image: %v", err), slog.LevelError)
+		return nil, err
 	}
-	memoryMB, _ := strconv.ParseInt(memoryMBStr, 10, 64)
 
-	cpuLimitStr := os.Getenv("CONTAINER_CPU_LIMIT")
-	if cpuLimitStr == "" {
-		cpuLimitStr = "0.5"
+	// Recreated containers start from the base snapshot of the image
+	baseImageName, snapKey := baseImage(ctx, cli, key, profile)
+
+	runtimeName, err := ResolveRuntime(ctx, cli)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to resolve container runtime: %v", err), slog.LevelError)
+		return nil, err
 	}
-	cpuLimit, _ := strconv.ParseFloat(cpuLimitStr, 64)
 
-	resp, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: imageName,
-		Cmd:   []string{"sleep", "infinity"}, // Keep it alive
-		Tty:   false,
-	}, &container.HostConfig{
-		Resources: container.Resources{
-			Memory:   memoryMB * 1024 * 1024,
-			NanoCPUs: int64(cpuLimit * math.Pow10(9)),
-		},
-		CapAdd: []string{"NET_ADMIN"},
-		ExtraHosts: []string{
-			"host.docker.internal:127.0.0.1",
-			"gateway.docker.internal:127.0.0.1",
-		},
-	}, &network.NetworkingConfig{
+	hostConfig := &container.HostConfig{
+		Runtime:        runtimeName,
+		Resources:      containerResources(memoryMB, cpuLimit),
+		ReadonlyRootfs: profile.ReadonlyRootfs,
+		CapDrop:        profile.CapDrop,
+		CapAdd:         profile.CapAdd,
+		SecurityOpt:    profile.SecurityOpt,
+		Tmpfs:          profile.Tmpfs,
+		Mounts:         append(slices.Clone(profile.Mounts), venvMount()),
+		ExtraHosts:     sandboxExtraHosts,
+	}
+	networking := &network.NetworkingConfig{
 		EndpointsConfig: map[string]*network.EndpointSettings{
 			sandboxNetworkName: {
 				NetworkID: networkID,
 			},
 		},
-	}, nil, "")
+	}
+	switch key.Network {
+	case NetworkNone:
+		hostConfig.NetworkMode = "none"
+		networking = nil
+	case NetworkAllowlist:
+		hostConfig.NetworkMode = egressNetworkName
+		networking = &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{egressNetworkName: {}},
+		}
+	}
+	if key.GPU {
+		hostConfig.DeviceRequests = gpuDeviceRequests()
+	}
+	// CONTAINER_NUMA_SPREAD narrows this down to one node per execution
+	hostConfig.CpusetCpus = settings.Cpuset
+	applyHostLimits(hostConfig)
+	cmd := keepAlive
+	if isShellless(imageName) {
+		if profile.needsShell() {
+			return nil, fmt.Errorf("image %s has no shell, which only the strict sandbox profile supports", imageName)
+		}
+		cmd = pythonKeepAlive
+	}
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  baseImageName,
+		Cmd:    cmd, // Keep it alive
+		Tty:    false,
+		Labels: map[string]string{"continuum.tenant": tenantID},
+	}, hostConfig, networking, ociPlatform(), "")
 	if err != nil {
-		logging.Log(fmt.Sprintf("failed to create container: %w", err), slog.LevelError)
-		return "", err
+		logging.Log(ctx, fmt.Sprintf("failed to create container: %v", err), slog.LevelError)
+		return nil, err
 	}
 
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
-		logging.Log(fmt.Sprintf("failed to start container: %w", err), slog.LevelError)
-		return "", err
+		removeContainer(ctx, cli, resp.ID, imageName, removeSetupFailed)
+		if missingExecutable(err) && !isShellless(imageName) {
+			// A distroless image lacks sleep too; keep it alive with python
+			logging.Log(ctx, fmt.Sprintf("Sandbox image %s has no shell, keeping its containers alive with python", imageName), slog.LevelWarn)
+			shellless.Store(imageName, true)
+			return createContainer(ctx, cli, networkID, key, profile, memoryMB, cpuLimit)
+		}
+		logging.Log(ctx, fmt.Sprintf("failed to start container: %v", err), slog.LevelError)
+		return nil, err
 	}
 
-	// Move setup (iptables, user) to Exec
-	setupCmd := []string{"sh", "-c", `
-		apt-get update -qq && apt-get install -qq -y iptables > /dev/null 2>&1
-		iptables -A OUTPUT -d 10.0.0.0/8 -j DROP 2>/dev/null || true
-		iptables -A OUTPUT -d 172.16.0.0/12 -j DROP 2>/dev/null || true  
-		iptables -A OUTPUT -d 192.168.0.0/16 -j DROP 2>/dev/null || true
-		iptables -A OUTPUT -d 169.254.0.0/16 -j DROP 2>/dev/null || true
-		useradd -m -s /bin/bash sandboxuser 2>/dev/null || true
-	`}
-	
-	setupExec, err := cli.ContainerExecCreate(ctx, resp.ID, container.ExecOptions{
-		Cmd:          setupCmd,
-		AttachStdout: true,
-		AttachStderr: true,
-	})
-	if err != nil {
-		cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
-		return "", fmt.Errorf("failed to create setup exec: %w", err)
+	egressIP := ""
+	if key.Network == NetworkAllowlist {
+		inspect, err := cli.ContainerInspect(ctx, resp.ID)
+		if err == nil && inspect.NetworkSettings != nil && inspect.NetworkSettings.Networks[egressNetworkName] != nil {
+			egressIP = inspect.NetworkSettings.Networks[egressNetworkName].IPAddress
+		}
+		if egressIP == "" {
+			removeContainer(ctx, cli, resp.ID, imageName, removeSetupFailed)
+			return nil, fmt.Errorf("failed to read the egress network address of %s: %v", resp.ID[:12], err)
+		}
 	}
 
-	setupResp, err := cli.ContainerExecAttach(ctx, setupExec.ID, container.ExecStartOptions{})
-	if err != nil {
-		cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
-		return "", fmt.Errorf("failed to attach to setup exec: %w", err)
+	if profile.needsShell() {
+		// Move setup (iptables, user) to Exec
+		// A container without a network has no egress to filter, and one on
+		// the egress network can only reach the proxy. With the network guard
+		// the rules are on the host and only the user is set up.
+		var setup strings.Builder
+		switch {
+		case profile.InstallIptables && key.Network == "":
+			setup.WriteString("{ command -v iptables && command -v tc; } >/dev/null 2>&1 || " + installPackages("", "iptables", "iproute2") + "\n")
+			for _, cidr := range overrides.AllowedEgress {
+				setup.WriteString(iptablesCmd(cidr, "ACCEPT"))
+			}
+			for _, cidr := range blockedEgressRanges {
+				setup.WriteString(iptablesCmd(cidr, "DROP"))
+			}
+			setup.WriteString(iptablesCheck)
+		case profile.InstallIptables && key.Network == NetworkAllowlist:
+			// The proxy serves the setup until the container is handed out
+			egressProxy.Allow(egressIP, 0, setupHosts)
+			defer egressProxy.Revoke(egressIP)
+			setup.WriteString(redirectSetup())
+		}
+		setup.WriteString(addSandboxUser)
+		setupCmd := []string{"sh", "-c", setup.String()}
+
+		setupExec, err := cli.ContainerExecCreate(ctx, resp.ID, container.ExecOptions{
+			Cmd:          setupCmd,
+			AttachStdout: true,
+			AttachStderr: true,
+		})
+		if err != nil {
+			removeContainer(ctx, cli, resp.ID, imageName, removeSetupFailed)
+			return nil, fmt.Errorf("failed to create setup exec: %w", err)
+		}
+
+		setupResp, err := cli.ContainerExecAttach(ctx, setupExec.ID, container.ExecStartOptions{})
+		if err != nil {
+			removeContainer(ctx, cli, resp.ID, imageName, removeSetupFailed)
+			return nil, fmt.Errorf("failed to attach to setup exec: %w", err)
+		}
+		defer setupResp.Close()
+
+		// Wait for setup to finish
+		setupOut, _ := io.ReadAll(setupResp.Reader)
+		if bytes.Contains(setupOut, []byte(egressUnenforced)) {
+			if platform.Desktop {
+				logging.Log(ctx, fmt.Sprintf("Egress rules could not be installed in %s, the Docker Desktop kernel lacks iptables support", resp.ID[:12]), slog.LevelWarn)
+			} else {
+				logging.Log(ctx, fmt.Sprintf("ALERT: egress rules could not be installed in sandbox container %s", resp.ID[:12]), slog.LevelError)
+			}
+		}
+		if bytes.Contains(setupOut, []byte(egressUnredirected)) {
+			// The egress network still has no route out, so this only
+			// leaves clients ignoring HTTP_PROXY unable to connect
+			logging.Log(ctx, fmt.Sprintf("Egress redirect could not be installed in %s, only proxy-aware clients reach the allowlist", resp.ID[:12]), slog.LevelWarn)
+		}
+
+		// Check setup exit status
+		setupInspect, err := cli.ContainerExecInspect(ctx, setupExec.ID)
+		if err != nil || setupInspect.ExitCode != 0 {
+			removeContainer(ctx, cli, resp.ID, imageName, removeSetupFailed)
+			logging.Log(ctx, fmt.Sprintf("setup exec failed (exit %d): %v", setupInspect.ExitCode, err), slog.LevelError)
+			return nil, err
+		}
 	}
-	defer setupResp.Close()
 
-	// Wait for setup to finish
-	_, _ = io.Copy(io.Discard, setupResp.Reader)
+	if snapKey != "" {
+		takeSnapshot(ctx, cli, resp.ID, snapKey)
+	}
 
-	// Check setup exit status
-	setupInspect, err := cli.ContainerExecInspect(ctx, setupExec.ID)
-	if err != nil || setupInspect.ExitCode != 0 {
-		cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
-		logging.Log(fmt.Sprintf("setup exec failed (exit %d): %v", setupInspect.ExitCode, err), slog.LevelError)
-		return "", err
+	// Record the interpreter actually shipped by the image
+	version, _, exitCode, err := runExec(ctx, cli, resp.ID, "", []string{"python", "-c", "import platform; print(platform.python_version())"})
+	if err != nil || exitCode != 0 {
+		removeContainer(ctx, cli, resp.ID, imageName, removeSetupFailed)
+		logging.Log(ctx, fmt.Sprintf("failed to detect python version (exit %d): %v", exitCode, err), slog.LevelError)
+		return nil, fmt.Errorf("failed to detect python version in %s", imageName)
 	}
 
-	activeContainerID = resp.ID
-	lastUsedAt = time.Now()
-	logging.Log(fmt.Sprintf("New persistent container created: %s", activeContainerID[:12]), slog.LevelInfo)
-	return activeContainerID, nil
+	pc := &PooledContainer{
+		ID:            resp.ID,
+		Image:         imageName,
+		TenantID:      tenantID,
+		PythonVersion: strings.TrimSpace(version),
+		CreatedAt:     time.Now(),
+		LastUsedAt:    time.Now(),
+		MemoryMB:      memoryMB,
+		CPULimit:      cpuLimit,
+		EgressIP:      egressIP,
+		NoShell:       isShellless(imageName),
+	}
+	logging.Inc(ctx, metricContainersCreated, attribute.String("image", imageName))
+	logging.Log(ctx, fmt.Sprintf("New persistent container created: %s (%s, Python %s)", pc.ID[:12], key, pc.PythonVersion), slog.LevelInfo)
+	return pc, nil
 }
 
-func ExecuteTaskInDocker(ctx context.Context, cli *client.Client, code string, payload string, networkID string) (string, error) {
-	containerID, err := GetOrCreateContainer(ctx, cli, networkID)
+func ExecuteTaskInDocker(ctx context.Context, cli *client.Client, networkID string, req ExecRequest) (ExecResult, error) {
+	acquireStart := time.Now()
+	key, profile, err := keyFor(req)
 	if err != nil {
-		return "", err
+		return ExecResult{}, err
 	}
+	unlock, err := lockContainer(ctx, key)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	defer unlock()
+	pc, err := GetOrCreateContainer(ctx, cli, networkID, req.Image, req.TenantID, req.Sandbox)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	defer placeExecution(ctx, cli, pc.ID)()
+	// Under SANDBOX_RESET=recreate nothing of this execution is left for the next
+	if resetRecreates() {
+		defer discardContainer(cli, key, pc.ID, req.Image, removeReset)
+	}
+	logging.ObservePhase(ctx, "container_acquire", acquireStart)
+	workers.Progress(ctx)
+	containerID := pc.ID
+	result := ExecResult{PythonVersion: pc.PythonVersion}
 
 	// Prepare TAR archive with script.py and payload.json
+	copyStart := time.Now()
 	var buf bytes.Buffer
 	tw := tar.NewWriter(&buf)
 
 	// script.py
-	scriptData := []byte(code)
+	scriptData := []byte(req.Code)
 	scriptHeader := &tar.Header{
 		Name: "script.py",
 		Mode: 0755,
 		Size: int64(len(scriptData)),
 	}
 	if err := tw.WriteHeader(scriptHeader); err != nil {
-		return "", err
+		return result, err
 	}
 	if _, err := tw.Write(scriptData); err != nil {
-		return "", err
+		return result, err
 	}
 
 	// payload.json
-	payloadData := []byte(payload)
+	payloadData := []byte(req.Payload)
 	payloadHeader := &tar.Header{
 		Name: "payload.json",
 		Mode: 0644,
 		Size: int64(len(payloadData)),
 	}
 	if err := tw.WriteHeader(payloadHeader); err != nil {
-		return "", err
+		return result, err
 	}
 	if _, err := tw.Write(payloadData); err != nil {
-		return "", err
+		return result, err
 	}
 
 	if err := tw.Close(); err != nil {
-		logging.Log(fmt.Sprintf("failed to close tar writer: %w", err), slog.LevelError)
-		return "", err
+		logging.Log(ctx, fmt.Sprintf("failed to close tar writer: %v", err), slog.LevelError)
+		return result, err
 	}
 
-	if err := cli.CopyToContainer(ctx, containerID, "/", &buf, container.CopyToContainerOptions{}); err != nil {
-		logging.Log(fmt.Sprintf("failed to copy to container: %w", err), slog.LevelError)
-		return "", err
+	if err := cli.CopyToContainer(ctx, containerID, profile.WorkDir, &buf, container.CopyToContainerOptions{}); err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to copy to container: %v", err), slog.LevelError)
+		return result, err
+	}
+	logging.ObservePhase(ctx, "copy", copyStart)
+	workers.Progress(ctx)
+
+	// An allowlist container reaches the task's hosts, and nothing else,
+	// through the egress proxy while the task runs
+	var proxy []string
+	if key.Network == NetworkAllowlist {
+		egressProxy.Allow(pc.EgressIP, req.TaskID, req.Sandbox.Allowlist)
+		defer egressProxy.Revoke(pc.EgressIP)
+		proxy = proxyEnv()
+	}
+
+	// Build or reuse the virtualenv holding the task's requirements
+	python := "python"
+	execEnv := req.Environment.resolve()
+	if pc.NoShell {
+		// Nothing but the script itself can run in a shell-less image
+		if len(req.Requirements) > 0 {
+			return result, fmt.Errorf("%w: image %s has no shell to build a virtualenv", ErrRequirements, req.Image)
+		}
+		if execEnv.ulimitCommands() != "" {
+			return result, fmt.Errorf("image %s has no shell to set ulimits", req.Image)
+		}
+	}
+	if len(req.Requirements) > 0 {
+		venvStart := time.Now()
+		python, err = ensureVenv(ctx, cli, containerID, req.Image, req.Requirements, proxy)
+		if err != nil {
+			logging.Log(ctx, fmt.Sprintf("failed to prepare virtualenv: %v", err), slog.LevelError)
+			return result, err
+		}
+		logging.ObservePhase(ctx, "requirements", venvStart)
+		workers.Progress(ctx)
 	}
 
-	// Fix permissions and Run as sandboxuser using Exec
+	// Run the code's warm-up once in this container and interpreter, unless
+	// the container is discarded after this execution anyway
+	singleUse := resetRecreates() || (req.TenantID != "" && TenantPoolSize(req.TenantID) == 0)
+	if req.Warmup != "" && !singleUse {
+		warmupStart := time.Now()
+		if warmUp(ctx, cli, containerID, profile, python, req.Warmup, slices.Concat([]string{"HOME=/tmp"}, execEnv.env(), proxy)) {
+			defer discardContainer(cli, key, containerID, req.Image, removeWarmupTimeout)
+		}
+		logging.ObservePhase(ctx, "warmup", warmupStart)
+		workers.Progress(ctx)
+	}
+
+	// A flagged run is traced when the trace can be kept and the tracer works
+	// in this sandbox; otherwise it still runs, untraced
+	tracer := req.Trace
+	if tracer != "" && req.Artifacts == nil {
+		logging.Log(ctx, "no artifact store configured, running flagged task untraced", slog.LevelWarn)
+		tracer = ""
+	}
+	if tracer != "" {
+		if err := ensureTracer(ctx, cli, containerID, profile, tracer); err != nil {
+			logging.Log(ctx, fmt.Sprintf("running flagged task untraced: %v", err), slog.LevelWarn)
+			tracer = ""
+		}
+	}
+
+	// Fix permissions and Run as sandboxuser (or the profile's exec user) using Exec
+	runUser, runCmd := profile.runExec(python, tracer, execEnv)
 	execConfig := container.ExecOptions{
-		User:         "root", // Use root to chown first
+		User:         runUser,
 		AttachStdout: true,
 		AttachStderr: true,
-		Cmd: []string{"sh", "-c", `
-			chown sandboxuser:sandboxuser /script.py /payload.json
-			su sandboxuser -c "python /script.py /payload.json"
-		`},
+		Env:          slices.Concat([]string{"HOME=/tmp"}, execEnv.env(), proxy, req.Env),
+		Cmd:          runCmd,
 	}
 
 	execResp, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
 	if err != nil {
-		logging.Log(fmt.Sprintf("failed to create exec: %w", err), slog.LevelError)
-		return "", err
+		logging.Log(ctx, fmt.Sprintf("failed to create exec: %v", err), slog.LevelError)
+		return result, err
+	}
+
+	// Start resource accounting right before the exec starts running
+	sampler, err := startUsageSampler(ctx, cli, containerID)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("failed to sample container stats, usage will not be recorded: %v", err), slog.LevelWarn)
 	}
 
+	execStart := time.Now()
 	resp, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{})
 	if err != nil {
-		logging.Log(fmt.Sprintf("failed to attach to exec: %w", err), slog.LevelError)
-		return "", err
+		if sampler != nil {
+			sampler.Stop(ctx)
+		}
+		logging.Log(ctx, fmt.Sprintf("failed to attach to exec: %v", err), slog.LevelError)
+		return result, err
 	}
 	defer resp.Close()
 
 	var stdout, stderr bytes.Buffer
+	var stdoutW, stderrW io.Writer = &stdout, &stderr
+	if req.Stdout != nil {
+		stdoutW = io.MultiWriter(&stdout, req.Stdout)
+	}
+	if req.Stderr != nil {
+		stderrW = io.MultiWriter(&stderr, req.Stderr)
+	}
 	done := make(chan error, 1)
 	go func() {
-		_, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader)
+		_, err := stdcopy.StdCopy(stdoutW, stderrW, resp.Reader)
 		done <- err
 	}()
 
+	// The script is bounded by its own timeout, not the deadman switch
+	scriptDone := workers.AwaitScript(ctx)
 	select {
 	case <-ctx.Done():
-		return "", ctx.Err()
+		scriptDone()
+		if sampler != nil {
+			sampler.Stop(context.Background())
+		}
+		// The script is still running: the container can't be reused
+		poolMu.Lock()
+		if current, ok := pool[key]; ok && current.ID == containerID {
+			poolDelete(key)
+		}
+		poolMu.Unlock()
+		removeContainer(context.Background(), cli, containerID, req.Image, removeAborted)
+		return result, ctx.Err()
 	case err := <-done:
+		scriptDone()
+		logging.ObservePhase(ctx, "exec", execStart)
+		if sampler != nil {
+			result.Usage = sampler.Stop(ctx)
+		}
 		if err != nil {
-			logging.Log(fmt.Sprintf("error reading exec output: %w", err), slog.LevelError)
-			return "", err
+			logging.Log(ctx, fmt.Sprintf("error reading exec output: %v", err), slog.LevelError)
+			return result, err
 		}
 	}
 
 	// Check exec exit status
 	inspect, err := cli.ContainerExecInspect(ctx, execResp.ID)
 	if err != nil {
-		logging.Log(fmt.Sprintf("failed to inspect exec: %w", err), slog.LevelError)
-		return stdout.String(), err
+		logging.Log(ctx, fmt.Sprintf("failed to inspect exec: %v", err), slog.LevelError)
+		result.Output = stdout.String()
+		return result, err
 	}
-	
+
+	// The trace matters most when the script failed, so it is kept either way
+	if tracer != "" {
+		if err := collectTrace(ctx, cli, containerID, profile.traceFile(), req.Artifacts); err != nil {
+			logging.Log(ctx, fmt.Sprintf("failed to store execution trace: %v", err), slog.LevelError)
+			result.ArtifactsErr = fmt.Errorf("execution trace: %w", err)
+		} else {
+			result.Traced = true
+		}
+	}
+
+	result.ExitCode = &inspect.ExitCode
 	if inspect.ExitCode != 0 {
-		logging.Log(fmt.Sprintf("script execution error (exit %d): %s", inspect.ExitCode, stderr.String()), slog.LevelError)
-		return stdout.String(), err
+		logging.Log(ctx, fmt.Sprintf("script execution error (exit %d): %s", inspect.ExitCode, stderr.String()), slog.LevelError)
+		result.Output = stdout.String()
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return result, fmt.Errorf("%w (exit %d): %s", ErrScript, inspect.ExitCode, strings.Join(lines[max(len(lines)-5, 0):], "\n"))
 	}
 
-	activeContainerMu.Lock()
-	lastUsedAt = time.Now()
-	activeContainerMu.Unlock()
+	if req.Artifacts != nil {
+		artifactsStart := time.Now()
+		if err := collectArtifacts(ctx, cli, containerID, req.Artifacts); err != nil {
+			logging.Log(ctx, fmt.Sprintf("failed to collect artifacts: %v", err), slog.LevelError)
+			result.ArtifactsErr = err
+		}
+		logging.ObservePhase(ctx, "artifacts", artifactsStart)
+	}
+
+	poolMu.Lock()
+	if current, ok := pool[key]; ok && current.ID == containerID {
+		current.LastUsedAt = time.Now()
+		// Tenants with no warm pool get a fresh container for every task
+		if req.TenantID != "" && TenantPoolSize(req.TenantID) == 0 {
+			poolDelete(key)
+			removeContainer(context.Background(), cli, containerID, req.Image, removeSingleUse)
+		}
+	}
+	poolMu.Unlock()
 
-	return stdout.String(), nil
+	result.Output = stdout.String()
+	return result, nil
 }
 
 func RunContainerReaper(ctx context.Context, cli *client.Client, timeout time.Duration) {
@@ -323,30 +723,35 @@ func RunContainerReaper(ctx context.Context, cli *client.Client, timeout time.Du
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			activeContainerMu.Lock()
-			if activeContainerID != "" && time.Since(lastUsedAt) > timeout {
-				logging.Log(fmt.Sprintf("Idle timeout reached for container %s. Removing...\n", activeContainerID[:12]), slog.LevelInfo)
-				id := activeContainerID
-				activeContainerID = ""
-				activeContainerMu.Unlock()
+			var idle []PooledContainer
+			poolMu.Lock()
+			for key, pc := range pool {
+				// A container running a long script isn't idle
+				if time.Since(pc.LastUsedAt) > timeout && !containerBusy(key) {
+					logging.Log(ctx, fmt.Sprintf("Idle timeout reached for container %s (%s). Removing...\n", pc.ID[:12], key), slog.LevelInfo)
+					idle = append(idle, *pc)
+					poolDelete(key)
+				}
+			}
+			poolMu.Unlock()
 
+			for _, pc := range idle {
 				cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-				cli.ContainerRemove(cleanupCtx, id, container.RemoveOptions{Force: true})
+				removeContainer(cleanupCtx, cli, pc.ID, pc.Image, removeIdle)
 				cancel()
-			} else {
-				activeContainerMu.Unlock()
 			}
 		}
 	}
 }
 
-func CleanupActiveContainer(ctx context.Context, cli *client.Client) {
-	activeContainerMu.Lock()
-	defer activeContainerMu.Unlock()
+// CleanupContainers removes every pooled container
+func CleanupContainers(ctx context.Context, cli *client.Client) {
+	poolMu.Lock()
+	defer poolMu.Unlock()
 
-	if activeContainerID != "" {
-		logging.Log(fmt.Sprintf("Cleaning up active container %s...\n", activeContainerID[:12]), slog.LevelInfo)
-		cli.ContainerRemove(ctx, activeContainerID, container.RemoveOptions{Force: true})
-		activeContainerID = ""
+	for key, pc := range pool {
+		logging.Log(ctx, fmt.Sprintf("Cleaning up container %s (%s)...\n", pc.ID[:12], key), slog.LevelInfo)
+		removeContainer(ctx, cli, pc.ID, pc.Image, removeShutdown)
+		poolDelete(key)
 	}
-}
\ No newline at end of file
+}
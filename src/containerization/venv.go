@@ -0,0 +1,133 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const venvMountPath = "/venvs"
+
+// ErrRequirements marks a failure to install a task's declared requirements.
+// It is the task's fault (typo, missing package...), not the node's.
+var ErrRequirements = errors.New("failed to install requirements")
+
+// venvVolume is the named Docker volume holding the cached virtualenvs
+func venvVolume() string {
+	return settings.VenvVolume
+}
+
+// venvMount shares the virtualenv cache with every sandbox container. The
+// venvs are built by root, so the sandbox user can use but never alter them.
+func venvMount() mount.Mount {
+	return mount.Mount{Type: mount.TypeVolume, Source: venvVolume(), Target: venvMountPath}
+}
+
+// RequirementsFromPayload reads the optional "requirements" list of a task
+// payload, e.g. {"requirements": ["requests==2.32.3", "numpy"]}
+func RequirementsFromPayload(payload string) ([]string, error) {
+	var p struct {
+		Requirements []string `json:"requirements"`
+	}
+	if payload == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		// Payloads that are not JSON objects simply declare nothing
+		return nil, nil
+	}
+
+	var reqs []string
+	for _, r := range p.Requirements {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		// Only plain requirement specifiers: no pip options (--index-url,
+		// -e, -r...) and nothing that could smuggle extra lines
+		if strings.HasPrefix(r, "-") || strings.ContainsAny(r, "\r\n") {
+			return nil, fmt.Errorf("%w: invalid requirement %q", ErrRequirements, r)
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, nil
+}
+
+// venvKey identifies a virtualenv by interpreter image and requirement set
+func venvKey(imageName string, requirements []string) string {
+	sorted := slices.Clone(requirements)
+	slices.Sort(sorted)
+	sum := sha256.Sum256([]byte(imageName + "\n" + strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ensureVenv builds (or reuses) the cached virtualenv for the requirements
+// and returns its python interpreter. env is exported to pip, e.g. the
+// egress proxy of an allowlist container.
+func ensureVenv(ctx context.Context, cli *client.Client, containerID, imageName string, requirements []string, env []string) (string, error) {
+	dir := venvMountPath + "/" + venvKey(imageName, requirements)
+	python := dir + "/bin/python"
+
+	buildCtx, cancel := context.WithTimeout(ctx, settings.VenvBuildTimeout)
+	defer cancel()
+
+	// Build into a temporary directory and move it into place, so concurrent
+	// builds of the same set never expose a half-installed venv
+	build := fmt.Sprintf(`
+		set -e
+		[ -x %[1]s ] && echo cached && exit 0
+		T=$(mktemp -d %[2]s/.build-XXXXXX)
+		trap 'rm -rf "$T"' EXIT
+		export TMPDIR="$T" %[5]s
+		echo %[3]s | base64 -d > "$T/requirements.txt"
+		python -m venv "$T/venv"
+		"$T/venv/bin/pip" install -q --no-cache-dir --disable-pip-version-check -r "$T/requirements.txt"
+		chmod -R a+rX,go-w "$T/venv"
+		mv -T "$T/venv" %[4]s 2>/dev/null || [ -x %[1]s ]
+	`, python, venvMountPath, base64.StdEncoding.EncodeToString([]byte(strings.Join(requirements, "\n")+"\n")), dir, strings.Join(env, " "))
+
+	start := time.Now()
+	stdout, stderr, exitCode, err := runExec(buildCtx, cli, containerID, "root", []string{"sh", "-c", build})
+	if err != nil {
+		logging.Inc(ctx, metricVenvPreparations, attribute.String("result", "error"))
+		return "", err
+	}
+	if exitCode != 0 {
+		logging.Inc(ctx, metricVenvPreparations, attribute.String("result", "failed"))
+		lines := strings.Split(strings.TrimSpace(stderr), "\n")
+		return "", fmt.Errorf("%w: %s", ErrRequirements, strings.Join(lines[max(len(lines)-5, 0):], "\n"))
+	}
+
+	result := "built"
+	if strings.TrimSpace(stdout) == "cached" {
+		result = "cached"
+	}
+	logging.Inc(ctx, metricVenvPreparations, attribute.String("result", result))
+	logging.Log(ctx, fmt.Sprintf("Virtualenv %s ready in %s", dir, time.Since(start).Truncate(time.Millisecond)), slog.LevelDebug)
+	return python, nil
+}
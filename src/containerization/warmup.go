@@ -0,0 +1,93 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package containerization
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"continuumworker/src/logging"
+	"continuumworker/src/workers"
+
+	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// warmups records the warm-ups already run in each container, by interpreter
+// and snippet, so each runs once per container and virtualenv
+var warmups = struct {
+	sync.Mutex
+	done map[string]map[string]bool
+}{done: map[string]map[string]bool{}}
+
+// warmUp runs a code's warm-up snippet with python, as the script would run,
+// unless it already ran in the container with that interpreter. It imports
+// modules and loads files once, so later executions find them in the page
+// cache and bytecode caches. A failed warm-up is logged and not retried in
+// the container; the script runs either way. It reports whether the warm-up
+// timed out and may still be running, in which case the container must not
+// be reused.
+func warmUp(ctx context.Context, cli *client.Client, containerID string, profile SandboxProfile, python, snippet string, env []string) (lingering bool) {
+	sum := sha256.Sum256([]byte(snippet))
+	key := python + "\x00" + hex.EncodeToString(sum[:])
+
+	warmups.Lock()
+	if warmups.done[containerID][key] {
+		warmups.Unlock()
+		return false
+	}
+	if warmups.done[containerID] == nil {
+		warmups.done[containerID] = map[string]bool{}
+	}
+	warmups.done[containerID][key] = true
+	warmups.Unlock()
+
+	user := profile.ExecUser
+	if user == "" {
+		user = "sandboxuser"
+	}
+	warmupCtx, cancel := context.WithTimeout(ctx, settings.WarmupTimeout)
+	defer cancel()
+	// Like the script, the warm-up is bounded by its own timeout
+	done := workers.AwaitScript(ctx)
+	_, stderr, exitCode, err := runExec(warmupCtx, cli, containerID, user, []string{python, "-c", snippet}, env...)
+	done()
+
+	switch {
+	case err != nil && ctx.Err() == nil && warmupCtx.Err() != nil:
+		logging.Inc(ctx, metricWarmups, attribute.String("result", "timeout"))
+		logging.Log(ctx, fmt.Sprintf("Warm-up in %s timed out after %s, the container is replaced after this execution", containerID[:12], settings.WarmupTimeout), slog.LevelWarn)
+		return true
+	case err != nil:
+		logging.Inc(ctx, metricWarmups, attribute.String("result", "error"))
+		logging.Log(ctx, fmt.Sprintf("Warm-up in %s did not run: %v", containerID[:12], err), slog.LevelWarn)
+	case exitCode != 0:
+		logging.Inc(ctx, metricWarmups, attribute.String("result", "failed"))
+		lines := strings.Split(strings.TrimSpace(stderr), "\n")
+		logging.Log(ctx, fmt.Sprintf("Warm-up in %s failed (exit %d): %s", containerID[:12], exitCode, strings.Join(lines[max(len(lines)-5, 0):], "\n")), slog.LevelWarn)
+	default:
+		logging.Inc(ctx, metricWarmups, attribute.String("result", "ok"))
+	}
+	return false
+}
+
+// forgetWarmups drops the warm-ups of a removed container
+func forgetWarmups(containerID string) {
+	warmups.Lock()
+	delete(warmups.done, containerID)
+	warmups.Unlock()
+}
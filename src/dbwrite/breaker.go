@@ -0,0 +1,169 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package dbwrite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"continuumworker/src/logging"
+)
+
+// ErrCircuitOpen is returned, after journaling the write, while the circuit
+// breaker is open. It counts as transient.
+var ErrCircuitOpen = errors.New("database circuit breaker is open")
+
+// breaker opens after BreakerThreshold consecutive writes failed with
+// transient errors. While open, writes skip the database (and its retries)
+// and go straight to the journal. After BreakerCooldown a probe, or a write
+// serving as a trial, is let through; its success closes the breaker.
+type breaker struct {
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+}
+
+var circuit breaker
+
+// Open reports whether the circuit breaker is open, i.e. the last writes
+// failed and the database has not answered since
+func Open() bool {
+	circuit.mu.Lock()
+	defer circuit.mu.Unlock()
+	return !circuit.openedAt.IsZero()
+}
+
+// allow reports whether a write may try the database: the breaker is
+// closed, or has been open for at least the cooldown
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt.IsZero() || time.Since(b.openedAt) >= settings.BreakerCooldown
+}
+
+// observe counts the outcome of a write. Only transient errors count: a
+// statement the database refuses says nothing about its health.
+func (b *breaker) observe(ctx context.Context, err error) {
+	if settings.BreakerThreshold <= 0 {
+		return
+	}
+	if err == nil {
+		b.close(ctx)
+		return
+	}
+	if !Transient(err) || errors.Is(err, context.Canceled) {
+		return
+	}
+
+	b.mu.Lock()
+	b.failures++
+	if b.failures < settings.BreakerThreshold {
+		b.mu.Unlock()
+		return
+	}
+	opened := b.openedAt.IsZero()
+	// A failed trial restarts the cooldown
+	b.openedAt = time.Now()
+	b.mu.Unlock()
+	if opened {
+		logging.Log(ctx, fmt.Sprintf("ALERT: database circuit breaker opened after %d failed writes, journaling writes and pausing claims: %v",
+			settings.BreakerThreshold, err), slog.LevelError)
+	}
+}
+
+func (b *breaker) close(ctx context.Context) {
+	b.mu.Lock()
+	wasOpen := !b.openedAt.IsZero()
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.mu.Unlock()
+	if wasOpen {
+		logging.Log(ctx, "Database circuit breaker closed, the database is reachable again", slog.LevelInfo)
+	}
+}
+
+// RegisterMetrics registers the circuit breaker gauge
+func RegisterMetrics() {
+	logging.InitializeFloatGauge("worker_db_circuit_open", "Whether the database circuit breaker is open (1) or closed (0)", "",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			if Open() {
+				record(1)
+			} else {
+				record(0)
+			}
+		})
+}
+
+// Run probes the database while the circuit breaker is open and replays the
+// journal every ReplayInterval, and as soon as the breaker closes, until ctx
+// is cancelled
+func Run(ctx context.Context, db *sql.DB) {
+	interval := settings.ReplayInterval
+	if settings.BreakerThreshold > 0 && (interval == 0 || settings.BreakerCooldown < interval) {
+		interval = settings.BreakerCooldown
+	}
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastReplay := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if Open() {
+			if !circuit.allow() {
+				continue
+			}
+			if err := db.PingContext(ctx); err != nil {
+				circuit.observe(ctx, err)
+				continue
+			}
+			circuit.close(ctx)
+		} else if time.Since(lastReplay) < settings.ReplayInterval {
+			continue
+		}
+		if settings.ReplayInterval == 0 || !pending(settings.JournalPath) {
+			continue
+		}
+
+		lastReplay = time.Now()
+		applied, remaining, err := Replay(ctx, db, settings.JournalPath)
+		if err != nil {
+			logging.Log(ctx, fmt.Sprintf("Error replaying the write journal: %v", err), slog.LevelWarn)
+			continue
+		}
+		if applied > 0 || remaining > 0 {
+			logging.Log(ctx, fmt.Sprintf("Replayed %d journaled writes, %d still pending", applied, remaining), slog.LevelInfo)
+		}
+	}
+}
+
+// pending reports whether the journal at path holds any entry
+func pending(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > 0
+}
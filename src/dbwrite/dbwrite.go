@@ -0,0 +1,193 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package dbwrite makes status and result writes survive transient Postgres
+// errors. Writes are retried with bounded backoff; a write that still fails
+// is appended to a local journal so the result is not lost, and is replayed
+// once the database is healthy again. A circuit breaker stops hammering a
+// database that is down.
+package dbwrite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+	"continuumworker/src/retry"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// classTransient is the retry class of errors worth another attempt
+const classTransient = "transient"
+
+// policy bounds the retries of a single write
+var policy = retry.Policy{
+	MaxAttempts: 5,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.2,
+	RetryOn:     []string{classTransient},
+}
+
+// settings is the database configuration, see Configure
+var settings = config.Default().Database
+
+// Configure installs the database configuration. It must be called before
+// the first write.
+func Configure(c config.Database) {
+	settings = c
+}
+
+// Statement is one SQL statement with its arguments
+type Statement struct {
+	Query string
+	Args  []any
+}
+
+// Transient reports whether err is a Postgres or connection error that may
+// succeed on retry: serialization failures, deadlocks, lost connections and
+// an overloaded or restarting server
+func Transient(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:2] {
+		case "08", "40", "53", "57":
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) || pgconn.Timeout(err) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) || strings.Contains(err.Error(), "connection reset")
+}
+
+func classify(err error) string {
+	if Transient(err) {
+		return classTransient
+	}
+	return "permanent"
+}
+
+// Exec runs a single write, retrying transient errors. If it still fails, or
+// the circuit breaker is open, the statement is journaled. label describes
+// the write (e.g. "task 42 result") in logs and in the journal.
+func Exec(ctx context.Context, db *sql.DB, label string, query string, args ...any) (sql.Result, error) {
+	if !circuit.allow() {
+		err := fmt.Errorf("write of %s skipped: %w", label, ErrCircuitOpen)
+		record(ctx, label, err, Statement{Query: query, Args: args})
+		return nil, err
+	}
+
+	var res sql.Result
+	err := retry.Do(ctx, policy, classify, func(attempt int) error {
+		var err error
+		res, err = db.ExecContext(ctx, query, args...)
+		return err
+	}, onRetry(ctx, label))
+	circuit.observe(ctx, err)
+	if err != nil {
+		record(ctx, label, err, Statement{Query: query, Args: args})
+	}
+	return res, err
+}
+
+// Batch runs the statements in one transaction, retrying the whole
+// transaction on transient errors. If it still fails, or the circuit breaker
+// is open, the batch is journaled.
+func Batch(ctx context.Context, db *sql.DB, label string, stmts ...Statement) error {
+	if !circuit.allow() {
+		err := fmt.Errorf("write of %s skipped: %w", label, ErrCircuitOpen)
+		record(ctx, label, err, stmts...)
+		return err
+	}
+
+	err := retry.Do(ctx, policy, classify, func(attempt int) error {
+		return runBatch(ctx, db, nil, stmts)
+	}, onRetry(ctx, label))
+	circuit.observe(ctx, err)
+	if err != nil {
+		record(ctx, label, err, stmts...)
+	}
+	return err
+}
+
+// runBatch runs the statements in one transaction. guard, if not nil, runs
+// first and may abort the transaction with an error. Without a guard the
+// statements are pipelined in a single round trip.
+func runBatch(ctx context.Context, db *sql.DB, guard func(*sql.Tx) error, stmts []Statement) error {
+	if guard == nil {
+		return sendBatch(ctx, db, stmts)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if guard != nil {
+		if err := guard(tx); err != nil {
+			return err
+		}
+	}
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s.Query, s.Args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sendBatch sends the statements as one pgx batch, which the server runs in
+// an implicit transaction
+func sendBatch(ctx context.Context, db *sql.DB, stmts []Statement) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		batch := &pgx.Batch{}
+		for _, s := range stmts {
+			batch.Queue(s.Query, s.Args...)
+		}
+		results := driverConn.(*stdlib.Conn).Conn().SendBatch(ctx, batch)
+		for range stmts {
+			if _, err := results.Exec(); err != nil {
+				results.Close()
+				return err
+			}
+		}
+		return results.Close()
+	})
+}
+
+func onRetry(ctx context.Context, label string) func(int, error, time.Duration) {
+	return func(attempt int, err error, delay time.Duration) {
+		logging.Log(ctx, fmt.Sprintf("Write of %s failed (attempt %d/%d), retrying in %s: %v", label, attempt, policy.MaxAttempts, delay.Truncate(time.Millisecond), err), slog.LevelWarn)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package dbwrite
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"continuumworker/src/logging"
+)
+
+// entry is one failed write in the journal, stored as a JSON line
+type entry struct {
+	Time       time.Time        `json:"time"`
+	Label      string           `json:"label"`
+	Error      string           `json:"error"`
+	Statements []entryStatement `json:"statements"`
+	// The execution the write belongs to, see WithTask
+	TaskID   int    `json:"task_id,omitempty"`
+	WorkerID string `json:"worker_id,omitempty"`
+}
+
+type entryStatement struct {
+	Query string       `json:"query"`
+	Args  []entryValue `json:"args"`
+}
+
+// entryValue keeps binary arguments apart so they survive the JSON round trip
+type entryValue struct {
+	Value any    `json:"value"`
+	Bytes []byte `json:"bytes,omitempty"`
+}
+
+var journalMu sync.Mutex
+
+// errSuperseded aborts the replay of a write whose task was reassigned
+var errSuperseded = errors.New("task is no longer assigned to the worker that wrote it")
+
+type ownerKey struct{}
+
+type owner struct {
+	taskID   int
+	workerID string
+}
+
+// WithTask attributes the writes made with ctx to the execution of taskID by
+// workerID. If they are journaled, replay drops them once the task has been
+// recovered or claimed by another worker, so a stale result never overwrites
+// a newer one.
+func WithTask(ctx context.Context, taskID int, workerID string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner{taskID: taskID, workerID: workerID})
+}
+
+// record appends a failed write to the journal. Without a journal the write
+// is only logged.
+func record(ctx context.Context, label string, cause error, stmts ...Statement) {
+	if settings.JournalPath == "" {
+		logging.Log(ctx, fmt.Sprintf("ALERT: write of %s lost, no write journal is configured: %v", label, cause), slog.LevelError)
+		return
+	}
+
+	e := entry{Time: time.Now().UTC(), Label: label, Error: cause.Error()}
+	if o, ok := ctx.Value(ownerKey{}).(owner); ok {
+		e.TaskID, e.WorkerID = o.taskID, o.workerID
+	}
+	for _, s := range stmts {
+		es := entryStatement{Query: s.Query}
+		for _, a := range s.Args {
+			es.Args = append(es.Args, journalValue(a))
+		}
+		e.Statements = append(e.Statements, es)
+	}
+
+	journalMu.Lock()
+	err := appendEntries(settings.JournalPath, e)
+	journalMu.Unlock()
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("ALERT: write of %s lost, journaling failed: %v (write error: %v)", label, err, cause), slog.LevelError)
+		return
+	}
+	logging.Log(ctx, fmt.Sprintf("ALERT: write of %s failed and was journaled to %s: %v", label, settings.JournalPath, cause), slog.LevelError)
+}
+
+func journalValue(a any) entryValue {
+	if v, ok := a.(driver.Valuer); ok {
+		a, _ = v.Value()
+	}
+	if b, ok := a.([]byte); ok {
+		return entryValue{Bytes: b}
+	}
+	return entryValue{Value: a}
+}
+
+// appendEntries writes entries to the journal at path. The caller must hold
+// journalMu.
+func appendEntries(path string, entries ...entry) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// Replay applies the journaled writes at path, oldest first, each once and
+// without retries. Entries that fail again are kept in the journal; the
+// others are removed. Once the database is unreachable the remaining entries
+// are kept without being tried. A write attributed to a task execution (see
+// WithTask) is dropped if the task has since been reassigned.
+func Replay(ctx context.Context, db *sql.DB, path string) (applied int, remaining int, err error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var failed []entry
+	unreachable := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			f.Close()
+			return applied, 0, fmt.Errorf("corrupt journal entry: %w", err)
+		}
+		if unreachable {
+			failed = append(failed, e)
+			continue
+		}
+		err := runBatch(ctx, db, e.guard(ctx), e.statements())
+		if errors.Is(err, errSuperseded) {
+			logging.Log(ctx, fmt.Sprintf("Dropped journaled write of %s: task %d %v", e.Label, e.TaskID, err), slog.LevelWarn)
+			continue
+		}
+		if err != nil {
+			logging.Log(ctx, fmt.Sprintf("Replay of %s failed: %v", e.Label, err), slog.LevelWarn)
+			e.Error = err.Error()
+			failed = append(failed, e)
+			unreachable = Transient(err)
+			continue
+		}
+		applied++
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return applied, 0, err
+	}
+
+	// Rewrite the journal with the entries that are still pending
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return applied, len(failed), err
+	}
+	if err := appendEntries(tmp, failed...); err != nil {
+		return applied, len(failed), err
+	}
+	return applied, len(failed), os.Rename(tmp, path)
+}
+
+// guard checks, and locks, the task the entry was written for, if any
+func (e entry) guard(ctx context.Context) func(*sql.Tx) error {
+	if e.TaskID == 0 {
+		return nil
+	}
+	return func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx, "SELECT ID FROM TASKS WHERE ID = $1 AND WORKER_ID = $2 FOR UPDATE", e.TaskID, e.WorkerID).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errSuperseded
+		}
+		return err
+	}
+}
+
+func (e entry) statements() []Statement {
+	stmts := make([]Statement, len(e.Statements))
+	for i, s := range e.Statements {
+		stmts[i].Query = s.Query
+		for _, a := range s.Args {
+			if a.Bytes != nil {
+				stmts[i].Args = append(stmts[i].Args, a.Bytes)
+			} else {
+				stmts[i].Args = append(stmts[i].Args, a.Value)
+			}
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"continuumworker/src/taskdiff"
+)
+
+// taskDiffHandler compares a task with another run, typically its replay, so
+// a fix or an environment change can be validated
+func (s *APIServer) taskDiffHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+	against, err := strconv.Atoi(r.URL.Query().Get("against"))
+	if err != nil {
+		http.Error(w, "Invalid or missing against task id", http.StatusBadRequest)
+		return
+	}
+
+	diff, err := taskdiff.Compare(r.Context(), s.db, taskID, against)
+	if errors.Is(err, taskdiff.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to compare tasks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(diff)
+}
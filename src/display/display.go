@@ -0,0 +1,114 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package display implements the rich output protocol. A script emits a rich
+// output by printing a single line:
+//
+//	__CONTINUUM_DISPLAY__ {"mime": "image/png", "encoding": "base64", "data": "...", "name": "chart"}
+//
+// Marker lines are removed from the task's plain OUTPUT and stored as typed
+// outputs instead.
+package display
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Marker prefixes every rich output line
+const Marker = "__CONTINUUM_DISPLAY__ "
+
+// AllowedMIMETypes are the output types the API knows how to render
+var AllowedMIMETypes = map[string]bool{
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/svg+xml":    true,
+	"text/html":        true,
+	"text/markdown":    true,
+	"text/csv":         true,
+	"text/plain":       true,
+	"application/json": true,
+}
+
+// Output is a single typed rich output produced by a script
+type Output struct {
+	Seq      int
+	MIMEType string
+	Name     string
+	Data     []byte
+}
+
+type block struct {
+	MIME     string `json:"mime"`
+	Encoding string `json:"encoding"`
+	Name     string `json:"name"`
+	Data     string `json:"data"`
+}
+
+// Parse splits script stdout into the plain text output and the rich outputs.
+// Malformed or oversized blocks are kept in the plain output with a note so
+// nothing the script printed is silently lost.
+func Parse(stdout string, maxBytes int) (string, []Output) {
+	if !strings.Contains(stdout, Marker) {
+		return stdout, nil
+	}
+
+	var plain strings.Builder
+	var outputs []Output
+	for _, line := range strings.SplitAfter(stdout, "\n") {
+		raw, ok := strings.CutPrefix(line, Marker)
+		if !ok {
+			plain.WriteString(line)
+			continue
+		}
+
+		out, err := decode(strings.TrimSpace(raw), maxBytes)
+		if err != nil {
+			plain.WriteString(fmt.Sprintf("[continuum] rich output dropped: %v\n", err))
+			continue
+		}
+		out.Seq = len(outputs)
+		outputs = append(outputs, out)
+	}
+	return plain.String(), outputs
+}
+
+func decode(raw string, maxBytes int) (Output, error) {
+	var b block
+	if err := json.Unmarshal([]byte(raw), &b); err != nil {
+		return Output{}, fmt.Errorf("invalid block: %w", err)
+	}
+	if !AllowedMIMETypes[b.MIME] {
+		return Output{}, fmt.Errorf("unsupported mime type %q", b.MIME)
+	}
+
+	var data []byte
+	switch b.Encoding {
+	case "", "text":
+		data = []byte(b.Data)
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(b.Data)
+		if err != nil {
+			return Output{}, fmt.Errorf("invalid base64 data: %w", err)
+		}
+		data = decoded
+	default:
+		return Output{}, fmt.Errorf("unsupported encoding %q", b.Encoding)
+	}
+
+	if maxBytes > 0 && len(data) > maxBytes {
+		return Output{}, fmt.Errorf("%s output of %d bytes exceeds limit of %d", b.MIME, len(data), maxBytes)
+	}
+	return Output{MIMEType: b.MIME, Name: b.Name, Data: data}, nil
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package egress
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"continuumworker/src/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Decisions recorded in TASK_NETWORK_LOG
+const (
+	decisionAllowed = "allowed"
+	decisionDenied  = "denied"  // The host is not on the task's allowlist
+	decisionBlocked = "blocked" // The host resolved to a blocked address
+	decisionFailed  = "failed"  // The host could not be reached
+)
+
+const (
+	// metricRequests counts the requests of tasks by decision
+	metricRequests = "worker_egress_requests"
+	// metricLogDropped counts requests left out of TASK_NETWORK_LOG
+	metricLogDropped = "worker_egress_log_dropped"
+)
+
+const (
+	logBuffer        = 1024
+	logBatchSize     = 100
+	logFlushInterval = time.Second
+)
+
+// RegisterMetrics registers the egress proxy metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricRequests, "Number of outbound requests of allowlist tasks, by decision", "Request")
+	logging.InitializeFloatCounter(metricLogDropped, "Number of outbound requests not recorded in TASK_NETWORK_LOG", "Request")
+}
+
+// entry is one outbound request of a task. A CONNECT tunnel or redirected
+// TLS connection is one request, whatever went through it.
+type entry struct {
+	taskID   int
+	method   string // CONNECT, TLS for a redirected TLS connection, or the HTTP method
+	host     string
+	port     int
+	url      string // Plain HTTP only; HTTPS paths are never seen
+	decision string
+	status   int
+	sent     int64
+	received int64
+	err      string
+	at       time.Time
+	duration time.Duration
+}
+
+// fail records why the host could not be reached
+func (e *entry) fail(err error) {
+	e.decision = decisionFailed
+	if errors.Is(err, errBlocked) {
+		e.decision = decisionBlocked
+	}
+	e.err = err.Error()
+}
+
+type entryKey struct{}
+
+func withEntry(ctx context.Context, e *entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+func entryFrom(ctx context.Context) *entry {
+	e, _ := ctx.Value(entryKey{}).(*entry)
+	return e
+}
+
+// requestLog writes entries to TASK_NETWORK_LOG in batches, off the path of
+// the requests. Entries of the setup of a container (task 0) are not kept.
+type requestLog struct {
+	db       *sql.DB
+	workerID string
+	entries  chan *entry
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newRequestLog(db *sql.DB, workerID string) *requestLog {
+	l := &requestLog{db: db, workerID: workerID, entries: make(chan *entry, logBuffer),
+		stop: make(chan struct{}), done: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+// finish completes the entry of a request that went out
+func (l *requestLog) finish(e *entry) {
+	e.duration = time.Since(e.at)
+	l.record(e)
+}
+
+// record queues the entry, dropping it when the database can't keep up
+// rather than slowing down the task
+func (l *requestLog) record(e *entry) {
+	logging.Inc(context.Background(), metricRequests, attribute.String("decision", e.decision))
+	if e.taskID == 0 {
+		return
+	}
+	select {
+	case l.entries <- e:
+	default:
+		logging.Inc(context.Background(), metricLogDropped)
+	}
+}
+
+func (l *requestLog) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*entry
+	for {
+		select {
+		case e := <-l.entries:
+			batch = append(batch, e)
+			if len(batch) >= logBatchSize {
+				l.write(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			l.write(batch)
+			batch = nil
+		case <-l.stop:
+			for {
+				select {
+				case e := <-l.entries:
+					batch = append(batch, e)
+				default:
+					l.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *requestLog) write(batch []*entry) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := l.insert(ctx, batch); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to record %d egress requests: %v", len(batch), err), slog.LevelError)
+		logging.Add(ctx, metricLogDropped, float64(len(batch)))
+	}
+}
+
+func (l *requestLog) insert(ctx context.Context, batch []*entry) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range batch {
+		_, err := tx.ExecContext(ctx, `INSERT INTO TASK_NETWORK_LOG (task_id, worker_id, method, host, port, url, decision, status,
+			bytes_sent, bytes_received, error, requested_at, duration_seconds)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, NULLIF($8, 0), $9, $10, NULLIF($11, ''), $12, $13)`,
+			e.taskID, l.workerID, e.method, e.host, e.port, e.url, e.decision, e.status,
+			e.sent, e.received, e.err, e.at, e.duration.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// close writes the queued entries and stops the writer. Entries recorded
+// later are dropped.
+func (l *requestLog) close() {
+	close(l.stop)
+	<-l.done
+}
+
+// countingReader counts the bytes of a request body
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
+
+// recordingWriter keeps the status and size of a response
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush lets streamed responses through as they arrive
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
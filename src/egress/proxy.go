@@ -0,0 +1,348 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package egress is the HTTP proxy of the sandbox containers with the
+// allowlist network policy. They sit on an internal Docker network without
+// a route out, so the proxy is their only way to the internet, and it only
+// forwards requests to the hosts on the allowlist of the task running in the
+// container a request comes from. Every request of a task is recorded in
+// TASK_NETWORK_LOG.
+package egress
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+const (
+	dialTimeout       = 10 * time.Second
+	readHeaderTimeout = 10 * time.Second
+)
+
+// errBlocked is returned when an allowlisted host resolves to an address the
+// sandbox must never reach
+var errBlocked = errors.New("destination address is blocked")
+
+// binding is the access of the container running a task
+type binding struct {
+	taskID int
+	hosts  []string
+}
+
+// Proxy forwards plain HTTP requests and tunnels CONNECT (HTTPS) ones. HTTP
+// and TLS connections redirected by a container's iptables rules are served
+// on the same port, see sniffListener.
+type Proxy struct {
+	addr   string
+	server *http.Server
+	dialer *net.Dialer
+	http   *httputil.ReverseProxy
+	log    *requestLog
+
+	mu sync.Mutex
+	// bindings of the containers running a task, by egress network address
+	bindings map[string]binding
+	// tunnels open for each container, closed when its task ends
+	tunnels map[string]map[net.Conn]struct{}
+}
+
+// Start serves the proxy on listen, reachable from the egress network, and
+// records the requests of tasks as workerID
+func Start(ctx context.Context, db *sql.DB, cli *client.Client, workerID, listen string) (*Proxy, error) {
+	_, gateway, err := containerization.EnsureEgressNetwork(ctx, cli)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup egress network: %w", err)
+	}
+	host, err := address(ctx, cli, gateway)
+	if err != nil {
+		return nil, err
+	}
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for egress proxy: %w", err)
+	}
+
+	p := &Proxy{
+		addr:     net.JoinHostPort(host, port),
+		log:      newRequestLog(db, workerID),
+		bindings: map[string]binding{},
+		tunnels:  map[string]map[net.Conn]struct{}{},
+	}
+	p.dialer = &net.Dialer{Timeout: dialTimeout, Control: control}
+	p.http = &httputil.ReverseProxy{
+		// The request URL is absolute, so it is forwarded as is
+		Rewrite: func(*httputil.ProxyRequest) {},
+		Transport: &http.Transport{
+			DialContext:         p.dialer.DialContext,
+			TLSHandshakeTimeout: dialTimeout,
+			IdleConnTimeout:     time.Minute,
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if e := entryFrom(r.Context()); e != nil {
+				e.fail(err)
+			}
+			http.Error(w, "failed to reach host", http.StatusBadGateway)
+		},
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: readHeaderTimeout}
+	go func() {
+		if err := p.server.Serve(newSniffListener(ln, p)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Log(context.Background(), fmt.Sprintf("Egress proxy stopped: %v", err), slog.LevelError)
+		}
+	}()
+	return p, nil
+}
+
+// address returns the address of the proxy on the egress network. A worker
+// running in a container of the daemon joins the network; a worker on the
+// host is reached at the network's gateway.
+func address(ctx context.Context, cli *client.Client, gateway string) (string, error) {
+	name := containerization.EgressNetworkName()
+	hostname, _ := os.Hostname()
+	self, err := cli.ContainerInspect(ctx, hostname)
+	if err != nil {
+		if gateway == "" {
+			return "", fmt.Errorf("egress network %s has no gateway", name)
+		}
+		return gateway, nil
+	}
+	if ep := self.NetworkSettings.Networks[name]; ep == nil || ep.IPAddress == "" {
+		if err := cli.NetworkConnect(ctx, name, self.ID, nil); err != nil {
+			return "", fmt.Errorf("failed to connect worker to egress network: %w", err)
+		}
+		if self, err = cli.ContainerInspect(ctx, self.ID); err != nil {
+			return "", fmt.Errorf("failed to inspect worker container: %w", err)
+		}
+	}
+	ep := self.NetworkSettings.Networks[name]
+	if ep == nil || ep.IPAddress == "" {
+		return "", fmt.Errorf("worker has no address on egress network %s", name)
+	}
+	return ep.IPAddress, nil
+}
+
+// control refuses connections to blocked addresses once the host is
+// resolved, so an allowlisted name can't be pointed at internal services
+func control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || containerization.EgressBlocked(ip) {
+		return fmt.Errorf("%w: %s", errBlocked, host)
+	}
+	return nil
+}
+
+// Addr is the proxy address given to the containers
+func (p *Proxy) Addr() string {
+	return p.addr
+}
+
+// Allow lets the container at ip reach the hosts of the task's allowlist
+func (p *Proxy) Allow(ip string, taskID int, hosts []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bindings[ip] = binding{taskID: taskID, hosts: hosts}
+}
+
+// Revoke ends the container's access, closing the tunnels it left open
+func (p *Proxy) Revoke(ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.bindings, ip)
+	for conn := range p.tunnels[ip] {
+		conn.Close()
+	}
+	delete(p.tunnels, ip)
+}
+
+// check starts the log entry of a request from source to host, deciding
+// whether it may go through. The entry is nil for sources running no task.
+func (p *Proxy) check(source, method, host string, port int) (*entry, bool) {
+	p.mu.Lock()
+	b, ok := p.bindings[source]
+	p.mu.Unlock()
+	if !ok {
+		logging.Log(context.Background(), fmt.Sprintf("Egress to %s denied for %s: no task is running there", host, source), slog.LevelWarn)
+		return nil, false
+	}
+
+	e := &entry{taskID: b.taskID, method: method, host: host, port: port, decision: decisionAllowed, at: time.Now()}
+	if !containerization.AllowedHost(b.hosts, host) {
+		e.decision = decisionDenied
+		logging.Log(context.Background(), fmt.Sprintf("Egress to %s denied for task %d: not on its allowlist", host, b.taskID), slog.LevelWarn)
+		p.log.record(e)
+		return e, false
+	}
+	return e, true
+}
+
+// track registers a tunnel of the container at source, or returns false if
+// its access was revoked in the meantime
+func (p *Proxy) track(source string, conns ...net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.bindings[source]; !ok {
+		return false
+	}
+	if p.tunnels[source] == nil {
+		p.tunnels[source] = map[net.Conn]struct{}{}
+	}
+	for _, conn := range conns {
+		p.tunnels[source][conn] = struct{}{}
+	}
+	return true
+}
+
+func (p *Proxy) untrack(source string, conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		delete(p.tunnels[source], conn)
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	source, _, _ := net.SplitHostPort(r.RemoteAddr)
+	if r.Method != http.MethodConnect && !r.URL.IsAbs() {
+		// Redirected by the container's iptables rules: the client doesn't
+		// know it talks to a proxy
+		if r.Host == "" {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		r.URL.Scheme, r.URL.Host = "http", r.Host
+	}
+
+	host, port := r.URL.Hostname(), portOf(r.URL.Port(), 80)
+	if r.Method == http.MethodConnect {
+		port = portOf(r.URL.Port(), 443)
+	}
+	e, ok := p.check(source, r.Method, host, port)
+	if !ok {
+		http.Error(w, "host is not on the task's egress allowlist", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, source, e)
+		return
+	}
+
+	e.url = r.URL.String()
+	body := &countingReader{r: r.Body}
+	r.Body = body
+	rw := &recordingWriter{ResponseWriter: w}
+	p.http.ServeHTTP(rw, r.WithContext(withEntry(r.Context(), e)))
+	e.status, e.sent, e.received = rw.status, body.n, rw.n
+	p.log.finish(e)
+}
+
+// tunnel connects the client to the CONNECT target and relays both ways
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request, source string, e *entry) {
+	dst, err := p.dialer.DialContext(r.Context(), "tcp", net.JoinHostPort(e.host, strconv.Itoa(e.port)))
+	if err != nil {
+		e.fail(err)
+		p.log.finish(e)
+		http.Error(w, "failed to reach host", http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		dst.Close()
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		dst.Close()
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		dst.Close()
+		return
+	}
+	e.status = http.StatusOK
+	p.relay(source, e, conn, buf.Reader, dst, nil)
+}
+
+// relay copies between the client and the destination until either side
+// closes, then records the entry. prefix is sent to the destination first.
+func (p *Proxy) relay(source string, e *entry, client net.Conn, from io.Reader, dst net.Conn, prefix []byte) {
+	defer dst.Close()
+	defer p.log.finish(e)
+	if !p.track(source, client, dst) {
+		return
+	}
+	defer p.untrack(source, client, dst)
+
+	if len(prefix) > 0 {
+		if _, err := dst.Write(prefix); err != nil {
+			e.fail(err)
+			return
+		}
+		e.sent += int64(len(prefix))
+	}
+	var sent, received int64
+	done := make(chan struct{}, 2)
+	go func() {
+		sent, _ = io.Copy(dst, from)
+		done <- struct{}{}
+	}()
+	go func() {
+		received, _ = io.Copy(client, dst)
+		done <- struct{}{}
+	}()
+	<-done
+	client.Close()
+	dst.Close()
+	<-done
+	e.sent += sent
+	e.received = received
+}
+
+// portOf parses the port of a URL, def when it has none
+func portOf(port string, def int) int {
+	if n, err := strconv.Atoi(port); err == nil {
+		return n
+	}
+	return def
+}
+
+// Close stops serving and writes the requests still buffered; open tunnels
+// end with their tasks
+func (p *Proxy) Close() error {
+	err := p.server.Close()
+	p.log.close()
+	return err
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tlsRecordHandshake is the first byte of a TLS connection
+const tlsRecordHandshake = 0x16
+
+// sniffListener hands HTTP connections to the proxy's HTTP server and serves
+// the TLS connections redirected by a container's iptables rules itself, so
+// one port serves both
+type sniffListener struct {
+	net.Listener
+	p     *Proxy
+	conns chan net.Conn
+	err   error // Set before conns is closed
+	stop  chan struct{}
+	once  sync.Once
+}
+
+func newSniffListener(ln net.Listener, p *Proxy) *sniffListener {
+	l := &sniffListener{Listener: ln, p: p, conns: make(chan net.Conn), stop: make(chan struct{})}
+	go l.run()
+	return l
+}
+
+func (l *sniffListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.err = err
+			close(l.conns)
+			return
+		}
+		go l.sniff(conn)
+	}
+}
+
+// sniff peeks at the first byte of the connection to tell TLS from HTTP
+func (l *sniffListener) sniff(conn net.Conn) {
+	br := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(readHeaderTimeout))
+	first, err := br.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+	buffered := &bufferedConn{Conn: conn, r: br}
+	if first[0] == tlsRecordHandshake {
+		l.p.serveTLS(buffered)
+		return
+	}
+	select {
+	case l.conns <- buffered:
+	case <-l.stop:
+		conn.Close()
+	}
+}
+
+func (l *sniffListener) Accept() (net.Conn, error) {
+	conn, ok := <-l.conns
+	if !ok {
+		return nil, l.err
+	}
+	return conn, nil
+}
+
+func (l *sniffListener) Close() error {
+	l.once.Do(func() { close(l.stop) })
+	return l.Listener.Close()
+}
+
+// bufferedConn is a connection whose first bytes were already read
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// serveTLS relays a redirected TLS connection to the host named by its
+// server name indication. The proxy can't see inside, so the connection is
+// recorded as a single TLS request.
+func (p *Proxy) serveTLS(conn net.Conn) {
+	defer conn.Close()
+	source, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+
+	conn.SetReadDeadline(time.Now().Add(readHeaderTimeout))
+	var hello bytes.Buffer
+	host, err := serverName(io.TeeReader(conn, &hello))
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || host == "" {
+		return
+	}
+
+	e, ok := p.check(source, "TLS", host, 443)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	dst, err := p.dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(443)))
+	cancel()
+	if err != nil {
+		e.fail(err)
+		p.log.finish(e)
+		return
+	}
+	p.relay(source, e, conn, conn, dst, hello.Bytes())
+}
+
+// errHelloRead stops the handshake once the client hello is parsed
+var errHelloRead = errors.New("client hello read")
+
+// serverName reads a TLS client hello and returns its server name
+func serverName(r io.Reader) (string, error) {
+	var name string
+	err := tls.Server(readOnlyConn{r: r}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			name = hello.ServerName
+			return nil, errHelloRead
+		},
+	}).Handshake()
+	if name == "" {
+		return "", err
+	}
+	return name, nil
+}
+
+// readOnlyConn feeds a reader to crypto/tls, which never gets to write
+type readOnlyConn struct {
+	r io.Reader
+}
+
+func (c readOnlyConn) Read(p []byte) (int, error)         { return c.r.Read(p) }
+func (c readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c readOnlyConn) Close() error                       { return nil }
+func (c readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,814 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package embed runs a Continuum worker inside another Go program. Tasks can
+// be submitted in-process, without the HTTP API, and are still persisted to
+// Postgres so any worker of the fleet may run them.
+//
+//	w, err := embed.New(ctx, cfg, db)
+//	...
+//	defer w.Close()
+//	go w.Run(ctx)
+//	resp, err := w.Submit(ctx, submit.Request{Name: "hello", Code: "print(1)"})
+package embed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"continuumworker/src/analysis"
+	"continuumworker/src/artifacts"
+	"continuumworker/src/audit"
+	"continuumworker/src/codestore"
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/dbwrite"
+	"continuumworker/src/egress"
+	"continuumworker/src/fleet"
+	"continuumworker/src/health"
+	"continuumworker/src/imagesync"
+	"continuumworker/src/leader"
+	"continuumworker/src/logging"
+	"continuumworker/src/networkguard"
+	"continuumworker/src/pgdb"
+	"continuumworker/src/policy"
+	"continuumworker/src/processor"
+	"continuumworker/src/receipts"
+	"continuumworker/src/results"
+	"continuumworker/src/retention"
+	"continuumworker/src/secrets"
+	"continuumworker/src/stats"
+	"continuumworker/src/submit"
+	"continuumworker/src/taskqueue"
+	"continuumworker/src/webhooks"
+	"continuumworker/src/workers"
+
+	"github.com/docker/docker/client"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// submissionQueueSize bounds the submissions waiting to be persisted
+const submissionQueueSize = 64
+
+// metricNotifications counts task queue announcements by result
+const metricNotifications = "worker_notifications"
+
+// queueWait bounds each wait for announcements, and so how long Close may
+// wait for the task queue
+const queueWait = 5 * time.Second
+
+// Worker is a Continuum worker embedded in the host program
+type Worker struct {
+	cfg        *config.Config
+	db         *sql.DB
+	ownsDB     bool
+	cli        *client.Client
+	id         string
+	instanceID string
+	networkID  string
+
+	stats     *stats.WorkerStats
+	drain     *workers.Drain
+	lifecycle *workers.Lifecycle
+	// deadman detects a main loop that stopped making progress
+	deadman *workers.Deadman
+	// fleet, when FLEET_CONFIG_SOURCE is set, overrides the worker settings
+	fleet *fleet.Reconciler
+	// images coordinates image pulls with the rest of the fleet
+	images *imagesync.Coordinator
+	// runtimeImages preheats the images tasks run in, started by Run
+	runtimeImages *imagesync.Manager
+	// egress serves allowlist tasks when EGRESS_PROXY_LISTEN is set
+	egress *egress.Proxy
+	// leader tells whether this worker runs the maintenance jobs, set by Run
+	leader leader.Leader
+	// health checks the database, the Docker daemon, the task queue and the
+	// runtime images
+	health *health.Checker
+
+	// queue announces claimable tasks, Postgres LISTEN/NOTIFY by default
+	queue taskqueue.Queue
+	// held are announcements waiting for a claim pass to settle them, and
+	// settled tells pumpDeliveries it may take more
+	heldMu  sync.Mutex
+	held    []taskqueue.Delivery
+	settled chan struct{}
+
+	// latch triggers a claim on an announcement or an in-process submission
+	latch       *workers.WorkLatch
+	submissions chan Submission
+}
+
+// Submission is a task handed to the worker through Submissions. Result, if
+// not nil, receives the outcome and should be buffered.
+type Submission struct {
+	Request submit.Request
+	Result  chan<- Result
+}
+
+// Result is the outcome of a Submission
+type Result struct {
+	submit.Response
+	Err error
+}
+
+// New validates the configuration and prepares the worker: Docker client,
+// sandbox network, policy bundle, runtime, analyzers and artifact store.
+// db is opened from cfg.Database when nil. The worker doesn't claim tasks
+// until Run is called, but Submit works right away.
+func New(ctx context.Context, cfg *config.Config, db *sql.DB) (w *Worker, err error) {
+	if err := processor.ValidateRetryPolicy(cfg.Worker.Retry); err != nil {
+		return nil, fmt.Errorf("invalid configuration: retry policy: %w", err)
+	}
+	if _, err := processor.StrategyByName(cfg.Worker.ClaimStrategy); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	containerization.Configure(cfg.Container)
+	analysis.Configure(cfg.Analysis)
+	artifacts.Configure(cfg.Artifacts)
+	codestore.Configure(cfg.Code)
+	dbwrite.Configure(cfg.Database)
+	secrets.Configure(cfg.Secrets)
+	submit.Configure(cfg.Worker.Limits)
+	if err := results.Configure(cfg.Code); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := receipts.Configure(cfg.Receipts); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := webhooks.Configure(cfg.Webhooks); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	w = &Worker{
+		cfg:         cfg,
+		db:          db,
+		latch:       workers.NewWorkLatch(cfg.Worker.NotifyMinInterval),
+		submissions: make(chan Submission, submissionQueueSize),
+		settled:     make(chan struct{}, 1),
+	}
+	defer func() {
+		if err != nil {
+			w.Close()
+		}
+	}()
+
+	// Enable SSL For Production
+	if w.db == nil {
+		if w.db, err = pgdb.Open(cfg.Database); err != nil {
+			return nil, err
+		}
+		w.ownsDB = true
+	}
+
+	// Generate Unique ID, unless a stable identity is configured.
+	// The instance ID always identifies this process.
+	w.instanceID = uuid.New().String()
+	w.id = workers.Identity(cfg.Worker.Identity)
+	if w.id == "" {
+		w.id = w.instanceID
+	}
+	fmt.Printf("Starting worker with ID: %s (instance %s)\n", w.id, w.instanceID)
+
+	// Connect the task queue before Submit may announce anything
+	if w.queue, err = taskqueue.Open(ctx, cfg.Queue, cfg.Database.DSN(), w.id); err != nil {
+		return nil, fmt.Errorf("failed to open task queue: %w", err)
+	}
+	submit.UseNotifier(w.queue.Notify)
+	fmt.Printf("Task queue ready: %s\n", taskqueue.Name(cfg.Queue))
+
+	// A drain (Run's context, or POST /drain) lets the running task finish
+	// for up to DRAIN_TIMEOUT
+	w.lifecycle = workers.NewLifecycle(context.Background(), cfg.Worker.DrainTimeout)
+
+	// Initialize Docker Client
+	w.cli, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker client: %w", err)
+	}
+
+	// Create or get sandbox network for isolated container execution
+	w.networkID, err = containerization.EnsureSandboxNetwork(ctx, w.cli)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup sandbox network: %w", err)
+	}
+	fmt.Printf("Sandbox network ready: %s\n", w.networkID[:12])
+
+	// Serve the allowlist network policy, if enabled
+	if cfg.Container.EgressProxyListen != "" {
+		if w.egress, err = egress.Start(ctx, w.db, w.cli, w.id, cfg.Container.EgressProxyListen); err != nil {
+			return nil, fmt.Errorf("failed to start egress proxy: %w", err)
+		}
+		containerization.UseEgressProxy(w.egress)
+		fmt.Printf("Egress proxy ready: %s\n", w.egress.Addr())
+	}
+
+	// Let one worker pull each image rather than the whole fleet at once
+	w.images, err = imagesync.New(ctx, w.db, w.cli, w.id, cfg.Container)
+	if err != nil {
+		return nil, err
+	}
+	containerization.UsePuller(w.images.Pull)
+
+	// Install the policy bundle (if any) before the sandbox and analyzers
+	// read their configuration
+	if _, err := policy.Load(ctx, cfg); err != nil {
+		return nil, fmt.Errorf("failed to load policy bundle: %w", err)
+	}
+
+	// Detect Docker Desktop so local development gets its quirks handled
+	if _, err := containerization.DetectPlatform(ctx, w.cli); err != nil {
+		return nil, fmt.Errorf("failed to inspect docker daemon: %w", err)
+	}
+
+	// Enforce the network policies from the host so sandboxes need no NET_ADMIN
+	if cfg.Container.NetworkGuard == containerization.GuardHost {
+		proxyAddr := ""
+		if w.egress != nil {
+			proxyAddr = w.egress.Addr()
+		}
+		guard, err := networkguard.Start(ctx, w.cli, cfg.Container, w.networkID, proxyAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start network guard: %w", err)
+		}
+		containerization.UseNetworkGuard(guard)
+		logging.Log(ctx, "Network guard ready", slog.LevelInfo)
+	}
+
+	// Detect the sandbox runtime (gVisor/Kata) before the first task arrives
+	if _, err := containerization.ResolveRuntime(ctx, w.cli); err != nil {
+		return nil, fmt.Errorf("failed to resolve container runtime: %w", err)
+	}
+	profile, err := containerization.LoadSandboxProfile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sandbox profile: %w", err)
+	}
+	fmt.Printf("Sandbox profile: %s\n", profile.Name)
+	if err := containerization.ValidateExecEnvironment(containerization.ExecEnvironment{
+		TZ: cfg.Container.TZ, Locale: cfg.Container.Locale, Ulimits: cfg.Container.ExecUlimits,
+	}); err != nil {
+		return nil, fmt.Errorf("invalid sandbox environment: %w", err)
+	}
+
+	// Build the code analysis engine so misconfiguration fails fast
+	if _, err := analysis.Default(); err != nil {
+		return nil, fmt.Errorf("failed to setup code analyzers: %w", err)
+	}
+
+	// Open the artifact store (if any) so a bad ARTIFACT_STORE fails fast
+	if _, err := artifacts.Default(); err != nil {
+		return nil, fmt.Errorf("failed to setup artifact store: %w", err)
+	}
+
+	// Same for the archive destination
+	if cfg.Retention.TTL > 0 {
+		if err := retention.Check(cfg.Retention); err != nil {
+			return nil, fmt.Errorf("failed to setup task archive: %w", err)
+		}
+	}
+
+	// Same for the secrets provider
+	if _, err := secrets.Default(); err != nil {
+		return nil, fmt.Errorf("failed to setup secrets provider: %w", err)
+	}
+
+	w.stats = stats.New(w.id)
+	w.drain = workers.NewDrain(cfg.Worker.DrainThreshold)
+	w.deadman = workers.NewDeadman(cfg.Worker.StallTimeout, cfg.Worker.StallRestart)
+
+	w.runtimeImages = imagesync.NewManager(w.cli, containerization.RuntimeImages(), cfg.Container.ImageRefreshInterval)
+
+	w.health = health.NewChecker(cfg.API.HealthCheckTimeout)
+	w.health.Add("database", w.db.PingContext)
+	w.health.Add("docker", func(ctx context.Context) error {
+		_, err := w.cli.Ping(ctx)
+		return err
+	})
+	w.health.Add("task_queue", func(ctx context.Context) error {
+		if !w.queue.Connected() {
+			return fmt.Errorf("%s connection is down", taskqueue.Name(cfg.Queue))
+		}
+		return nil
+	})
+	w.health.Add("images", w.runtimeImages.Check)
+	return w, nil
+}
+
+// ID is the worker's identity in the WORKERS table
+func (w *Worker) ID() string { return w.id }
+
+// DB is the database the worker claims and persists tasks with
+func (w *Worker) DB() *sql.DB { return w.db }
+
+// Stats are the worker's execution counters
+func (w *Worker) Stats() *stats.WorkerStats { return w.stats }
+
+// NodeDrain tracks consecutive infrastructure failures and quarantine
+func (w *Worker) NodeDrain() *workers.Drain { return w.drain }
+
+// ImageExport serves this daemon's images to peers at imagesync.ExportPath,
+// or is nil when IMAGE_PEER_URL is not set
+func (w *Worker) ImageExport() http.Handler {
+	if w.cfg.Container.ImagePeerURL == "" {
+		return nil
+	}
+	return w.images
+}
+
+// RuntimeImages reports the readiness and pull progress of the images tasks
+// run in
+func (w *Worker) RuntimeImages() *imagesync.Manager { return w.runtimeImages }
+
+// Leader tells whether this worker runs the cluster-wide maintenance jobs.
+// It is nil until Run starts.
+func (w *Worker) Leader() leader.Leader { return w.leader }
+
+// Health checks the worker's dependencies: the database, the Docker daemon,
+// the task queue and the runtime images
+func (w *Worker) Health() *health.Checker { return w.health }
+
+// Deadman reports whether the main loop is stalled, for liveness probes
+func (w *Worker) Deadman() *workers.Deadman { return w.deadman }
+
+// Lifecycle coordinates the graceful drain; call Drain on it to stop the
+// worker without cancelling Run's context
+func (w *Worker) Lifecycle() *workers.Lifecycle { return w.lifecycle }
+
+// workerConfig returns the worker settings in effect, those of the fleet
+// configuration when one is reconciled
+func (w *Worker) workerConfig() config.Worker {
+	if w.fleet != nil {
+		return w.fleet.Worker()
+	}
+	return w.cfg.Worker
+}
+
+// Submit persists a task, see submit.Create, and wakes this worker so it is
+// claimed without waiting for the task queue round trip
+func (w *Worker) Submit(ctx context.Context, req submit.Request) (submit.Response, error) {
+	resp, err := submit.Create(ctx, w.db, req)
+	if err == nil {
+		w.latch.Signal()
+	}
+	return resp, err
+}
+
+// Submissions is an in-process queue of tasks to submit. It is served while
+// Run executes; sends block once submissionQueueSize submissions are waiting.
+func (w *Worker) Submissions() chan<- Submission {
+	return w.submissions
+}
+
+func (w *Worker) serveSubmissions(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-w.submissions:
+			resp, err := w.Submit(ctx, s.Request)
+			if err != nil {
+				logging.Log(ctx, fmt.Sprintf("In-process submission of %q failed: %v", s.Request.Name, err), slog.LevelWarn)
+			}
+			if s.Result != nil {
+				s.Result <- Result{Response: resp, Err: err}
+			}
+		}
+	}
+}
+
+// Run registers the worker, starts its background loops and claims tasks
+// until ctx is cancelled or the lifecycle drains. The running task may finish
+// for up to DRAIN_TIMEOUT before Run returns.
+func (w *Worker) Run(ctx context.Context) error {
+	cfg, db, cli := w.cfg, w.db, w.cli
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.lifecycle.Drain("shutdown signal")
+		case <-w.lifecycle.Draining():
+		}
+	}()
+	// Background loops must outlive the signal so heartbeats keep the
+	// in-flight task from being recovered while it finishes
+	runCtx := w.lifecycle.ExecContext()
+
+	// Start Container Reaper
+	go containerization.RunContainerReaper(runCtx, cli, cfg.Container.IdleTimeout)
+	if cfg.Container.RotateInterval > 0 {
+		go containerization.RunContainerRotation(runCtx, cli, w.networkID, cfg.Container.RotateInterval)
+	}
+
+	// Register in WORKERS and start heartbeating
+	if err := workers.Register(ctx, db, w.id, w.instanceID, cfg.Worker.Region, cfg.Worker.StaleAfter); err != nil {
+		if errors.Is(err, workers.ErrDuplicateWorker) {
+			logging.Log(ctx, fmt.Sprintf("ALERT: refusing to start, %v", err), slog.LevelError)
+		}
+		return err
+	}
+	go workers.RunHeartbeat(runCtx, db, w.id, w.instanceID, cfg.Worker.HeartbeatInterval, w.drain)
+
+	// Elect the worker running the cluster-wide maintenance jobs. A draining
+	// worker steps down so a healthy one takes over right away.
+	electionCtx, stopElection := context.WithCancel(runCtx)
+	defer stopElection()
+	go func() {
+		select {
+		case <-w.lifecycle.Draining():
+			stopElection()
+		case <-electionCtx.Done():
+		}
+	}()
+	if cfg.Worker.LeaderElection {
+		election := leader.NewAdvisory(db, w.id, cfg.Worker.LeaderInterval)
+		go election.Run(electionCtx)
+		w.leader = election
+	} else {
+		w.leader = leader.Always{}
+	}
+	go leader.Run(electionCtx, w.leader, func(ctx context.Context) {
+		w.stats.SetLeader(true)
+		<-ctx.Done()
+		w.stats.SetLeader(false)
+	})
+	go leader.Run(electionCtx, w.leader, w.recoverTasks)
+	if cfg.Worker.ReconcileInterval > 0 {
+		go leader.Run(electionCtx, w.leader, w.reconcileTasks)
+	}
+
+	// Reconcile to the fleet configuration before claiming anything
+	if cfg.Fleet.Source != "" {
+		fleet.RegisterMetrics()
+		w.fleet = fleet.New(cfg.Fleet, db, cli, w.id, w.instanceID, cfg.Worker, cfg.Container.MaxConcurrentExecs)
+		w.fleet.Reconcile(ctx)
+		go w.fleet.Run(runCtx)
+	}
+
+	// Pull every runtime image at once, waiting only for the default one
+	go w.runtimeImages.Run(runCtx)
+	imageName := containerization.DefaultImage()
+	fmt.Printf("Ensuring Docker image %s is available...\n", imageName)
+	if err := w.runtimeImages.WaitReady(ctx, imageName); err != nil {
+		fmt.Printf("Warning: %v. Execution might fail if image is not present locally.\n", err)
+	} else {
+		fmt.Println("Docker image is ready.")
+	}
+
+	// Setup Worker OpenTelemetry Metrics
+	processor.RegisterMetrics()
+	containerization.RegisterMetrics()
+	egress.RegisterMetrics()
+	logging.InitializeFloatGauge("worker_leader", "Whether this worker runs the cluster-wide maintenance jobs (1) or not (0)", "",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			if w.leader.IsLeader() {
+				record(1)
+			} else {
+				record(0)
+			}
+		})
+	logging.InitializeFloatGauge("worker_listener_connected", "Whether the task queue connection is up (1) or down (0)", "",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			if w.queue.Connected() {
+				record(1)
+			} else {
+				record(0)
+			}
+		})
+	go processor.RunQueueSampler(runCtx, db, cfg.Worker.QueueSampleInterval)
+
+	// Check the attempt history for tasks that ran more than once
+	audit.RegisterMetrics()
+	if cfg.Worker.DuplicateScanInterval > 0 {
+		go leader.Run(electionCtx, w.leader, func(ctx context.Context) {
+			audit.RunDetector(ctx, db, cfg.Worker.DuplicateScanInterval)
+		})
+	}
+
+	// Probe the database while it is down and replay the write journal
+	dbwrite.RegisterMetrics()
+	go dbwrite.Run(runCtx, db)
+
+	// Deliver task events to their webhooks
+	webhooks.RegisterMetrics()
+	if cfg.Webhooks.PollInterval > 0 {
+		go webhooks.RunDispatcher(runCtx, db, cfg.Webhooks)
+	}
+
+	// Move expired tasks out of TASKS
+	retention.RegisterMetrics()
+	if cfg.Retention.TTL > 0 {
+		go leader.Run(electionCtx, w.leader, func(ctx context.Context) {
+			retention.Run(ctx, db, cfg.Retention)
+		})
+	}
+
+	// Prepare the sandboxes of scheduled tasks before they are due
+	if cfg.Worker.PrewarmLookahead > 0 {
+		go w.prewarmScheduled(ctx)
+	}
+
+	go w.serveSubmissions(runCtx)
+
+	// Read announcements as they arrive so the listener never backs up, and
+	// fold them into the latch
+	logging.InitializeFloatCounter(metricNotifications, "Task queue announcements received, by result (delivered, coalesced, dropped)", "")
+	go w.pumpDeliveries(runCtx)
+
+	logging.Log(ctx, fmt.Sprintf("Worker started. Waiting for tasks (%s + Fallback Polling)...", taskqueue.Name(cfg.Queue)), slog.LevelInfo)
+
+	// Run the main loop under the deadman switch. With WORKER_STALL_RESTART a
+	// stalled loop is abandoned for a new one; the worker counts as
+	// restarted, so the tasks of the stalled loop are recovered.
+	logging.InitializeFloatGauge("worker_loop_stalled", "Whether the main loop is stalled past WORKER_STALL_TIMEOUT (1) or not (0)", "",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			if _, stalled := w.deadman.Stalled(); stalled {
+				record(1)
+			} else {
+				record(0)
+			}
+		})
+	go w.deadman.Run(runCtx)
+	for {
+		loopCtx, cancelLoop := context.WithCancel(workers.WithDeadman(runCtx, w.deadman))
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			w.loop(ctx, loopCtx)
+		}()
+
+		select {
+		case <-stopped:
+			cancelLoop()
+			// Tasks run inline, so reaching this point means nothing is in flight
+			logging.Log(ctx, "Shutting down worker gracefully...", slog.LevelInfo)
+			if err := workers.MarkStopped(context.Background(), db, w.id, w.instanceID); err != nil {
+				logging.Log(ctx, fmt.Sprintf("Failed to mark worker as stopped: %v", err), slog.LevelError)
+			}
+			containerization.CleanupContainers(context.Background(), cli)
+			return nil
+		case <-w.deadman.Restarts():
+			cancelLoop()
+			logging.Log(ctx, "ALERT: restarting the stalled main loop, its tasks will be recovered", slog.LevelError)
+			if err := workers.MarkRestarted(runCtx, db, w.id, w.instanceID); err != nil {
+				logging.Log(ctx, fmt.Sprintf("Failed to mark worker as restarted: %v", err), slog.LevelError)
+			}
+			w.deadman.Beat()
+		}
+	}
+}
+
+// loop claims and runs tasks until draining starts or loopCtx is cancelled.
+// Executions use loopCtx, derived from the execution context, so a shutdown
+// signal doesn't abort a script midway.
+func (w *Worker) loop(ctx, loopCtx context.Context) {
+	db, cli := w.db, w.cli
+
+	// Setup a Timer for checking the task (Fall-back polling)
+	ticker := time.NewTicker(w.cfg.Worker.PollingInterval)
+	defer ticker.Stop()
+
+	// A scheduled task isn't announced when it becomes due, so the worker
+	// wakes up for the earliest one instead of waiting for the next poll
+	scheduled := time.NewTimer(time.Hour)
+	scheduled.Stop()
+	defer scheduled.Stop()
+	processNext := func() {
+		defer workers.Progress(loopCtx)
+		// Claiming while the database circuit breaker is open would only
+		// produce results for the journal
+		if w.lifecycle.IsDraining() || dbwrite.Open() || loopCtx.Err() != nil {
+			return
+		}
+		workerCfg := w.workerConfig()
+		held := w.takeHeld()
+		processor.ProcessTasks(loopCtx, db, cli, workerCfg, w.id, w.networkID, w.stats, w.drain)
+		w.settle(loopCtx, held)
+
+		due, ok, err := processor.NextScheduled(loopCtx, db, workerCfg)
+		if err != nil {
+			logging.Log(ctx, fmt.Sprintf("Failed to look up the next scheduled task: %v", err), slog.LevelWarn)
+		}
+		if ok {
+			scheduled.Reset(due)
+		}
+	}
+
+	// Initial check
+	processNext()
+
+	for {
+		select {
+		case <-w.lifecycle.Draining():
+			return
+		case <-loopCtx.Done():
+			return
+		case <-ticker.C:
+			// Periodic fallback check
+			processNext()
+		case <-w.latch.C():
+			// Immediate trigger from the task queue or an in-process submission
+			processNext()
+		case <-scheduled.C:
+			// A scheduled task is due
+			processNext()
+		}
+	}
+}
+
+// recoverTasks returns the tasks of dead workers to the queue every polling
+// interval while this worker leads
+func (w *Worker) recoverTasks(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Worker.PollingInterval)
+	defer ticker.Stop()
+	for {
+		processor.RecoverTasks(ctx, w.db, w.workerConfig(), w.stats)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prewarmScheduled prepares the sandboxes of the tasks due within
+// PREWARM_LOOKAHEAD every polling interval, until ctx is cancelled. A
+// draining or quarantined worker won't claim them, so it prepares nothing.
+func (w *Worker) prewarmScheduled(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Worker.PollingInterval)
+	defer ticker.Stop()
+	for {
+		if !w.lifecycle.IsDraining() && !w.drain.Quarantined() && !dbwrite.Open() {
+			processor.PrewarmScheduled(ctx, w.db, w.cli, w.workerConfig(), w.networkID)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileTasks recovers the tasks of workers that are gone every reconcile
+// interval while this worker leads
+func (w *Worker) reconcileTasks(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Worker.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		processor.ReconcileTasks(ctx, w.db, w.workerConfig(), w.stats)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pumpDeliveries signals the latch for every announcement. Those arriving
+// while a wake-up is already pending are coalesced, and those arriving while
+// the worker is draining or quarantined are dropped and given back. Deliveries
+// naming a task are held for the next claim pass to settle, and no more are
+// taken meanwhile so announcements go to workers free to act on them; bare
+// wake-ups (LISTEN/NOTIFY) are settled right away so the listener never backs
+// up.
+func (w *Worker) pumpDeliveries(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := w.queue.Claim(ctx, max(w.workerConfig().ClaimBatchSize, 1), queueWait)
+		if errors.Is(err, taskqueue.ErrClosed) {
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			logging.Log(ctx, fmt.Sprintf("Failed to read the task queue: %v", err), slog.LevelWarn)
+			select {
+			case <-ctx.Done():
+			case <-time.After(queueWait):
+			}
+		}
+
+		var held int
+		for _, d := range deliveries {
+			result := stats.NotificationDelivered
+			if w.lifecycle.IsDraining() || w.drain.Quarantined() {
+				result = stats.NotificationDropped
+				if err := w.queue.Nack(ctx, d); err != nil {
+					logging.Log(ctx, fmt.Sprintf("Failed to give back the announcement of task %d: %v", d.TaskID, err), slog.LevelWarn)
+				}
+			} else {
+				if d.TaskID != 0 {
+					w.hold(d)
+					held++
+				} else if err := w.queue.Ack(ctx, d); err != nil {
+					logging.Log(ctx, fmt.Sprintf("Failed to acknowledge a task queue wake-up: %v", err), slog.LevelWarn)
+				}
+				if !w.latch.Signal() {
+					result = stats.NotificationCoalesced
+				}
+			}
+			w.stats.RecordNotification(result)
+			logging.Inc(ctx, metricNotifications, attribute.String("result", result))
+		}
+		if held > 0 {
+			select {
+			case <-ctx.Done():
+			case <-w.settled:
+			}
+		}
+	}
+}
+
+func (w *Worker) hold(d taskqueue.Delivery) {
+	w.heldMu.Lock()
+	defer w.heldMu.Unlock()
+	w.held = append(w.held, d)
+}
+
+// takeHeld hands the announcements received so far to a claim pass
+func (w *Worker) takeHeld() []taskqueue.Delivery {
+	w.heldMu.Lock()
+	defer w.heldMu.Unlock()
+	held := w.held
+	w.held = nil
+	return held
+}
+
+// settle acknowledges the announcements of tasks that no longer need a
+// worker after a claim pass, whoever claimed them, and gives back those
+// still claimable so another worker picks them up
+func (w *Worker) settle(ctx context.Context, held []taskqueue.Delivery) {
+	if len(held) == 0 {
+		return
+	}
+	defer func() {
+		select {
+		case w.settled <- struct{}{}:
+		default:
+		}
+	}()
+
+	ids := make([]int64, 0, len(held))
+	for _, d := range held {
+		ids = append(ids, int64(d.TaskID))
+	}
+	claimable := make(map[int]bool)
+	rows, err := w.db.QueryContext(ctx, `SELECT id FROM TASKS WHERE id = ANY($1) AND status = 'pending'
+		AND (run_at IS NULL OR run_at <= NOW())`, ids)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to settle task queue announcements: %v", err), slog.LevelWarn)
+		// Treat them all as still claimable; redelivery is harmless
+		for _, id := range ids {
+			claimable[int(id)] = true
+		}
+	} else {
+		for rows.Next() {
+			var id int
+			if rows.Scan(&id) == nil {
+				claimable[id] = true
+			}
+		}
+		rows.Close()
+	}
+
+	for _, d := range held {
+		settle, verb := w.queue.Ack, "acknowledge"
+		if claimable[d.TaskID] {
+			settle, verb = w.queue.Nack, "give back"
+		}
+		if err := settle(ctx, d); err != nil {
+			logging.Log(ctx, fmt.Sprintf("Failed to %s the announcement of task %d: %v", verb, d.TaskID, err), slog.LevelWarn)
+		}
+	}
+}
+
+// Close releases the Docker client, and the database when New opened it.
+// Call it after Run returns.
+func (w *Worker) Close() error {
+	if w.lifecycle != nil {
+		w.lifecycle.Stop()
+	}
+	if w.egress != nil {
+		w.egress.Close()
+	}
+	if w.queue != nil {
+		w.queue.Close()
+	}
+	if w.cli != nil {
+		w.cli.Close()
+	}
+	if w.ownsDB && w.db != nil {
+		return w.db.Close()
+	}
+	return nil
+}
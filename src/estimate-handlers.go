@@ -0,0 +1,56 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"continuumworker/src/estimate"
+)
+
+// estimateTaskHandler predicts the runtime, resource usage and queue wait of
+// a task before it is submitted, from the history of its code
+func (s *APIServer) estimateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmitBodyBytes)
+
+	// A payload counts by its size, for clients that don't know it in bytes
+	var req struct {
+		estimate.Request
+		Payload json.RawMessage `json:"payload,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.PayloadBytes == nil && len(req.Payload) > 0 {
+		size := int64(len(req.Payload))
+		req.PayloadBytes = &size
+	}
+
+	est, err := estimate.Compute(r.Context(), s.db, req.Request)
+	switch {
+	case errors.Is(err, estimate.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, estimate.ErrUnknownCode):
+		http.Error(w, "Unknown code_id", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to estimate task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(est)
+}
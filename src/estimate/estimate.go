@@ -0,0 +1,228 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package estimate predicts, before a task is submitted, how long it will run,
+// what it will use and how long it will wait in its queue, from the history
+// of earlier executions of the same code.
+package estimate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"continuumworker/src/codestore"
+	"continuumworker/src/model"
+)
+
+const (
+	// DefaultWindow is the execution history considered when none is given
+	DefaultWindow = 7 * 24 * time.Hour
+	// waitWindow is the recent history the queue wait is measured over, as
+	// waits change much faster than runtimes
+	waitWindow = time.Hour
+	// The runtime is predicted from the payload size only when it explains
+	// enough of the variation over enough executions
+	minRegressionSamples = 20
+	minRegressionR2      = 0.5
+)
+
+var (
+	// ErrInvalid marks a request naming no code, or an invalid window
+	ErrInvalid = errors.New("invalid estimate request")
+	// ErrUnknownCode is returned when CodeID doesn't name a stored code
+	ErrUnknownCode = errors.New("unknown code_id")
+)
+
+// Request names the code, by ID, checksum or source, and describes the
+// payload and queue of the task to estimate
+type Request struct {
+	CodeID       string `json:"code_id,omitempty"`
+	CodeSHA256   string `json:"code_sha256,omitempty"`
+	Code         string `json:"code,omitempty"`
+	PayloadBytes *int64 `json:"payload_bytes,omitempty"`
+	Queue        string `json:"queue,omitempty"`
+	Window       string `json:"window,omitempty"` // History considered, like "72h"; DefaultWindow by default
+}
+
+// Duration is the expected runtime of one execution, in seconds. Expected
+// comes from the payload size when Model is "payload_size", and is the median
+// otherwise.
+type Duration struct {
+	Expected *float64 `json:"expected_seconds"`
+	P50      *float64 `json:"p50_seconds"`
+	P95      *float64 `json:"p95_seconds"`
+	Model    string   `json:"model"` // "payload_size", "history" or "none" without history
+}
+
+// Resources are the measured CPU time and peak memory of one execution
+type Resources struct {
+	CPUSecondsP50 *float64 `json:"cpu_seconds_p50"`
+	CPUSecondsP95 *float64 `json:"cpu_seconds_p95"`
+	MemoryMBP50   *float64 `json:"peak_memory_mb_p50"`
+	MemoryMBP95   *float64 `json:"peak_memory_mb_p95"`
+}
+
+// QueueWait is the recent wait from submission (or run_at) to the first
+// start in the task's queue, in seconds, and the tasks waiting right now
+type QueueWait struct {
+	Queue   string   `json:"queue"` // "" for tasks submitted without a queue
+	Pending int      `json:"pending"`
+	Samples int      `json:"samples"`
+	P50     *float64 `json:"p50_seconds"`
+	P95     *float64 `json:"p95_seconds"`
+}
+
+// Estimate is the prediction for one task. Samples are the finished
+// executions of the code in the window; SuccessRate is nil without any.
+type Estimate struct {
+	CodeSHA256  string    `json:"code_sha256"`
+	Window      string    `json:"window"`
+	Samples     int       `json:"samples"`
+	SuccessRate *float64  `json:"success_rate"`
+	Duration    Duration  `json:"duration"`
+	Resources   Resources `json:"resources"`
+	QueueWait   QueueWait `json:"queue_wait"`
+}
+
+// Compute estimates a task from the history of its code, the current version
+// of CodeID. Executions of the same source under any code_id or version
+// count, as codes are matched by checksum.
+func Compute(ctx context.Context, db *sql.DB, req Request) (Estimate, error) {
+	window := DefaultWindow
+	if req.Window != "" {
+		d, err := time.ParseDuration(req.Window)
+		if err != nil || d <= 0 {
+			return Estimate{}, fmt.Errorf("%w: window must be a positive duration like \"72h\"", ErrInvalid)
+		}
+		window = d
+	}
+	if req.PayloadBytes != nil && *req.PayloadBytes < 0 {
+		return Estimate{}, fmt.Errorf("%w: payload_bytes must not be negative", ErrInvalid)
+	}
+
+	sum, err := checksum(ctx, db, req)
+	if err != nil {
+		return Estimate{}, err
+	}
+	est := Estimate{CodeSHA256: sum, Window: window.String(), Duration: Duration{Model: "none"}, QueueWait: QueueWait{Queue: req.Queue}}
+
+	// Analysis-only tasks never ran and would skew the runtimes
+	var completed int
+	var slope, intercept, r2 sql.NullFloat64
+	var regressionSamples int
+	err = db.QueryRowContext(ctx, `
+		WITH history AS (
+			SELECT t.status, EXTRACT(EPOCH FROM t.finished - t.started) AS runtime, t.cpu_seconds,
+				t.peak_memory_bytes / 1048576.0 AS memory_mb, octet_length(t.payload::TEXT) AS payload_bytes
+			FROM TASKS t
+			JOIN CODE_CONTENTS cv ON cv.code_id = t.code AND cv.version = COALESCE(t.code_version, 1)
+			WHERE cv.sha256 = $1
+			AND t.task_type = 'execute'
+			AND t.status IN ($3, $4)
+			AND t.started IS NOT NULL
+			AND t.finished >= NOW() - $2 * INTERVAL '1 second'
+		)
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE status = $3),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime) FILTER (WHERE status = $3),
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY runtime) FILTER (WHERE status = $3),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY cpu_seconds),
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY cpu_seconds),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY memory_mb),
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY memory_mb),
+			regr_slope(runtime, payload_bytes) FILTER (WHERE status = $3),
+			regr_intercept(runtime, payload_bytes) FILTER (WHERE status = $3),
+			regr_r2(runtime, payload_bytes) FILTER (WHERE status = $3),
+			regr_count(runtime, payload_bytes) FILTER (WHERE status = $3)
+		FROM history`, sum, window.Seconds(), model.TaskCompleted, model.TaskFailed).Scan(
+		&est.Samples, &completed, nullable(&est.Duration.P50), nullable(&est.Duration.P95),
+		nullable(&est.Resources.CPUSecondsP50), nullable(&est.Resources.CPUSecondsP95),
+		nullable(&est.Resources.MemoryMBP50), nullable(&est.Resources.MemoryMBP95),
+		&slope, &intercept, &r2, &regressionSamples)
+	if err != nil {
+		return Estimate{}, fmt.Errorf("failed to read execution history: %w", err)
+	}
+	if est.Samples > 0 {
+		rate := float64(completed) / float64(est.Samples)
+		est.SuccessRate = &rate
+	}
+	switch {
+	case req.PayloadBytes != nil && regressionSamples >= minRegressionSamples && r2.Valid && r2.Float64 >= minRegressionR2:
+		expected := max(intercept.Float64+slope.Float64*float64(*req.PayloadBytes), 0)
+		est.Duration.Expected, est.Duration.Model = &expected, "payload_size"
+	case est.Duration.P50 != nil:
+		est.Duration.Expected, est.Duration.Model = est.Duration.P50, "history"
+	}
+
+	// Waits count from run_at for scheduled tasks
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY wait),
+			percentile_cont(0.95) WITHIN GROUP (ORDER BY wait),
+			(SELECT COUNT(*) FROM TASKS p
+			 WHERE p.status = $3 AND COALESCE(p.queue, '') = $1
+			 AND (p.run_at IS NULL OR p.run_at <= NOW()))
+		FROM (
+			SELECT EXTRACT(EPOCH FROM t.first_started_at - GREATEST(t.created_at, COALESCE(t.run_at, t.created_at))) AS wait
+			FROM TASKS t
+			WHERE COALESCE(t.queue, '') = $1
+			AND t.first_started_at >= NOW() - $2 * INTERVAL '1 second'
+		) w`, req.Queue, waitWindow.Seconds(), model.TaskPending).Scan(
+		&est.QueueWait.Samples, nullable(&est.QueueWait.P50), nullable(&est.QueueWait.P95), &est.QueueWait.Pending)
+	if err != nil {
+		return Estimate{}, fmt.Errorf("failed to read queue waits: %w", err)
+	}
+	return est, nil
+}
+
+// checksum resolves the code the request names to its SHA-256
+func checksum(ctx context.Context, db *sql.DB, req Request) (string, error) {
+	switch {
+	case req.CodeSHA256 != "":
+		return req.CodeSHA256, nil
+	case req.Code != "":
+		return codestore.Checksum(req.Code), nil
+	case req.CodeID != "":
+		var sum sql.NullString
+		err := db.QueryRowContext(ctx, `SELECT cv.sha256 FROM CODES c
+			JOIN CODE_CONTENTS cv ON cv.code_id = c.id AND cv.version = c.current_version
+			WHERE c.id::TEXT = $1`, req.CodeID).Scan(&sum)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%w: %s", ErrUnknownCode, req.CodeID)
+		} else if err != nil {
+			return "", fmt.Errorf("failed to read code: %w", err)
+		}
+		return sum.String, nil
+	}
+	return "", fmt.Errorf("%w: one of code_id, code_sha256 or code is required", ErrInvalid)
+}
+
+// nullable scans a nullable float into a pointer left nil for NULL
+func nullable(dest **float64) sql.Scanner {
+	return nullFloat{dest}
+}
+
+type nullFloat struct{ dest **float64 }
+
+func (n nullFloat) Scan(src any) error {
+	var v sql.NullFloat64
+	if err := v.Scan(src); err != nil {
+		return err
+	}
+	if v.Valid {
+		*n.dest = &v.Float64
+	} else {
+		*n.dest = nil
+	}
+	return nil
+}
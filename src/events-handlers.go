@@ -0,0 +1,79 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"continuumworker/src/model"
+)
+
+// TaskEvent is a state transition of a task, recorded in TASK_EVENTS
+type TaskEvent struct {
+	ID         int64             `json:"id"`
+	FromStatus *model.TaskStatus `json:"from_status"` // nil for the submission
+	ToStatus   model.TaskStatus  `json:"to_status"`
+	WorkerID   *string           `json:"worker_id"`
+	Reason     *string           `json:"reason,omitempty"`
+	ErrorCode  *model.ErrorCode  `json:"error_code,omitempty"`
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+// taskEventsHandler lists the state transitions of a task, oldest first
+func (s *APIServer) taskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM TASKS WHERE id = $1)", taskID).Scan(&exists); err != nil {
+		http.Error(w, "Failed to query task", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT id, from_status, to_status, worker_id, reason, error_code, occurred_at
+		FROM TASK_EVENTS
+		WHERE task_id = $1
+		ORDER BY id`, taskID)
+	if err != nil {
+		http.Error(w, "Failed to query task events", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []TaskEvent{}
+	for rows.Next() {
+		var e TaskEvent
+		if err := rows.Scan(&e.ID, &e.FromStatus, &e.ToStatus, &e.WorkerID, &e.Reason, &e.ErrorCode, &e.OccurredAt); err != nil {
+			http.Error(w, "Failed to read task events", http.StatusInternalServerError)
+			return
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read task events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(events)
+}
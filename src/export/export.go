@@ -0,0 +1,346 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"continuumworker/src/compression"
+	"continuumworker/src/retention"
+	"continuumworker/src/storage"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+type columnKind int
+
+const (
+	kindText columnKind = iota
+	kindInt
+	kindTime
+)
+
+// columns lists every TASKS column that can be exported and how to read it
+var columns = map[string]columnKind{
+	"id":           kindInt,
+	"name":         kindText,
+	"task_type":    kindText,
+	"description":  kindText,
+	"status":       kindText,
+	"priority":     kindInt,
+	"code":         kindText,
+	"code_version": kindInt,
+	"batch_id":     kindText,
+	"worker_id":    kindText,
+	"started":      kindTime,
+	"finished":     kindTime,
+	"locked_at":    kindTime,
+	"last_error":   kindText,
+	"error_code":   kindText,
+	"output":       kindText,
+	"result":       kindText,
+	"payload":      kindText,
+	"depends_on":   kindText,
+}
+
+// packed lists the columns whose large values are stored zstd-compressed in
+// <column>_zstd, see the compression package
+var packed = map[string]bool{"output": true, "payload": true}
+
+// DefaultColumns is used when no column selection is given
+var DefaultColumns = []string{"id", "name", "status", "priority", "code", "worker_id", "started", "finished", "last_error"}
+
+// Options controls what is exported and where it goes
+type Options struct {
+	Format      string    // "csv" or "parquet"
+	Columns     []string  // TASKS columns to export
+	Since       time.Time // Only tasks finished at or after this time (zero = no bound)
+	Until       time.Time // Only tasks finished before this time (zero = no bound)
+	Destination string    // Local file path, or s3://, gs:// or az://bucket/key
+}
+
+// Run exports task history according to opts and returns the number of rows written
+func Run(ctx context.Context, db *sql.DB, opts Options) (int, error) {
+	if len(opts.Columns) == 0 {
+		opts.Columns = DefaultColumns
+	}
+	for _, c := range opts.Columns {
+		if _, ok := columns[c]; !ok {
+			return 0, fmt.Errorf("unknown column %q", c)
+		}
+	}
+	if opts.Format != "csv" && opts.Format != "parquet" {
+		return 0, fmt.Errorf("unsupported format %q (expected csv or parquet)", opts.Format)
+	}
+
+	scheme, bucket, key, isObject := storage.ParseURL(opts.Destination)
+	if isObject && key == "" {
+		return 0, fmt.Errorf("missing object key in %s", opts.Destination)
+	}
+
+	// Always write to a local file first; uploads need a known size
+	var out *os.File
+	var err error
+	if isObject {
+		out, err = os.CreateTemp("", "continuum-export-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer os.Remove(out.Name())
+	} else {
+		out, err = os.Create(opts.Destination)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create %s: %w", opts.Destination, err)
+		}
+	}
+	defer out.Close()
+
+	rows, err := queryTasks(ctx, db, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int
+	switch opts.Format {
+	case "csv":
+		count, err = writeCSV(out, rows, opts.Columns)
+	case "parquet":
+		count, err = writeParquet(out, rows, opts.Columns)
+	}
+	if err != nil {
+		return count, err
+	}
+
+	if isObject {
+		info, err := out.Stat()
+		if err != nil {
+			return count, err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return count, err
+		}
+		client, err := storage.NewClientFromEnv(scheme)
+		if err != nil {
+			return count, err
+		}
+		contentType := "text/csv"
+		if opts.Format == "parquet" {
+			contentType = "application/vnd.apache.parquet"
+		}
+		if err := client.PutObject(ctx, bucket, key, out, info.Size(), contentType); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+func queryTasks(ctx context.Context, db *sql.DB, opts Options) (*sql.Rows, error) {
+	selects := make([]string, len(opts.Columns))
+	for i, c := range opts.Columns {
+		if columns[c] == kindText {
+			selects[i] = c + "::TEXT"
+		} else {
+			selects[i] = c
+		}
+	}
+	// The compressed form of packed columns follows, in the same order
+	for _, c := range opts.Columns {
+		if packed[c] {
+			selects = append(selects, c+"_zstd")
+		}
+	}
+
+	var since, until *time.Time
+	if !opts.Since.IsZero() {
+		since = &opts.Since
+	}
+	if !opts.Until.IsZero() {
+		until = &opts.Until
+	}
+
+	// Tasks the retention job moved to TASKS_ARCHIVE are part of the history
+	query := fmt.Sprintf(`
+		SELECT %s FROM (
+			SELECT * FROM TASKS
+			WHERE ($1::TIMESTAMP IS NULL OR finished >= $1)
+			AND ($2::TIMESTAMP IS NULL OR finished < $2)
+			UNION ALL
+			SELECT %s FROM TASKS_ARCHIVE
+			WHERE ($1::TIMESTAMP IS NULL OR finished >= $1)
+			AND ($2::TIMESTAMP IS NULL OR finished < $2)
+		) t
+		ORDER BY id`, strings.Join(selects, ", "), retention.Restored)
+
+	rows, err := db.QueryContext(ctx, query, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task history: %w", err)
+	}
+	return rows, nil
+}
+
+// scanRow reads one row into typed nullable holders matching the column
+// kinds, decompressing the values of packed columns
+func scanRow(rows *sql.Rows, cols []string) ([]any, error) {
+	dest := make([]any, len(cols))
+	var packedDest []any
+	for i, c := range cols {
+		if packed[c] {
+			packedDest = append(packedDest, &[]byte{})
+		}
+		switch columns[c] {
+		case kindInt:
+			dest[i] = &sql.NullInt64{}
+		case kindTime:
+			dest[i] = &sql.NullTime{}
+		default:
+			dest[i] = &sql.NullString{}
+		}
+	}
+	if err := rows.Scan(append(dest, packedDest...)...); err != nil {
+		return nil, fmt.Errorf("failed to scan task row: %w", err)
+	}
+
+	next := 0
+	for i, c := range cols {
+		if !packed[c] {
+			continue
+		}
+		data := *packedDest[next].(*[]byte)
+		next++
+		if data == nil {
+			continue
+		}
+		value, err := compression.Unpack("", data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", c, err)
+		}
+		*dest[i].(*sql.NullString) = sql.NullString{String: value, Valid: true}
+	}
+	return dest, nil
+}
+
+func writeCSV(w io.Writer, rows *sql.Rows, cols []string) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	record := make([]string, len(cols))
+	for rows.Next() {
+		values, err := scanRow(rows, cols)
+		if err != nil {
+			return count, err
+		}
+		for i, v := range values {
+			switch v := v.(type) {
+			case *sql.NullInt64:
+				record[i] = ""
+				if v.Valid {
+					record[i] = strconv.FormatInt(v.Int64, 10)
+				}
+			case *sql.NullTime:
+				record[i] = ""
+				if v.Valid {
+					record[i] = v.Time.UTC().Format(time.RFC3339Nano)
+				}
+			case *sql.NullString:
+				record[i] = v.String
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	cw.Flush()
+	return count, cw.Error()
+}
+
+func writeParquet(w io.Writer, rows *sql.Rows, cols []string) (int, error) {
+	group := parquet.Group{}
+	for _, c := range cols {
+		switch columns[c] {
+		case kindInt:
+			group[c] = parquet.Optional(parquet.Int(64))
+		case kindTime:
+			group[c] = parquet.Optional(parquet.Timestamp(parquet.Millisecond))
+		default:
+			group[c] = parquet.Optional(parquet.String())
+		}
+	}
+	schema := parquet.NewSchema("task", group)
+
+	// Parquet orders group fields by name; map our columns to leaf indexes
+	leafIndex := make(map[string]int, len(cols))
+	for i, path := range schema.Columns() {
+		leafIndex[path[0]] = i
+	}
+
+	pw := parquet.NewWriter(w, schema)
+	count := 0
+	for rows.Next() {
+		values, err := scanRow(rows, cols)
+		if err != nil {
+			return count, err
+		}
+
+		row := make(parquet.Row, len(cols))
+		for i, v := range values {
+			idx := leafIndex[cols[i]]
+			value := parquet.NullValue()
+			switch v := v.(type) {
+			case *sql.NullInt64:
+				if v.Valid {
+					value = parquet.Int64Value(v.Int64)
+				}
+			case *sql.NullTime:
+				if v.Valid {
+					value = parquet.Int64Value(v.Time.UnixMilli())
+				}
+			case *sql.NullString:
+				if v.Valid {
+					value = parquet.ByteArrayValue([]byte(v.String))
+				}
+			}
+			definitionLevel := 0
+			if !value.IsNull() {
+				definitionLevel = 1
+			}
+			row[idx] = value.Level(0, definitionLevel, idx)
+		}
+
+		if _, err := pw.WriteRows([]parquet.Row{row}); err != nil {
+			return count, fmt.Errorf("failed to write parquet row: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	return count, pw.Close()
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package fleet reconciles workers to the fleet configuration: a versioned
+// document, kept in FLEET_CONFIG or fetched from a file or URL, that sets the
+// queues, concurrency, priority band and pre-pulled images of every worker
+// so they change without redeploying the nodes
+package fleet
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+	"continuumworker/src/policy"
+
+	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Compliance of a worker, reported in WORKERS.config_status
+const (
+	// StatusCompliant is a worker running the desired settings
+	StatusCompliant = "compliant"
+	// StatusDrifted is a worker that could not apply some of them, e.g. an
+	// image failed to pull
+	StatusDrifted = "drifted"
+	// StatusError is a worker that could not read or accept the document; it
+	// keeps the settings it applied last
+	StatusError = "error"
+)
+
+// SourceDB reads the document from the FLEET_CONFIG table
+const SourceDB = "db"
+
+const metricReconciles = "worker_fleet_reconciles"
+
+// Document is the fleet configuration. Workers overrides Defaults for single
+// workers, by worker ID.
+type Document struct {
+	Version  string              `json:"version"`
+	Defaults Settings            `json:"defaults"`
+	Workers  map[string]Settings `json:"workers"`
+}
+
+// Settings are the desired settings of a worker. Unset fields keep the
+// worker's own configuration; an empty queues list claims every task.
+type Settings struct {
+	Queues      []string `json:"queues,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"` // Executions at a time
+	MinPriority *int     `json:"min_priority,omitempty"`
+	MaxPriority *int     `json:"max_priority,omitempty"`
+	Images      []string `json:"images,omitempty"` // Pre-pulled sandbox images
+}
+
+// For returns the settings of the worker, its overrides over the defaults
+func (d Document) For(workerID string) Settings {
+	s := d.Defaults
+	o, ok := d.Workers[workerID]
+	if !ok {
+		return s
+	}
+	if o.Queues != nil {
+		s.Queues = o.Queues
+	}
+	if o.Concurrency != 0 {
+		s.Concurrency = o.Concurrency
+	}
+	if o.MinPriority != nil {
+		s.MinPriority = o.MinPriority
+	}
+	if o.MaxPriority != nil {
+		s.MaxPriority = o.MaxPriority
+	}
+	if o.Images != nil {
+		s.Images = o.Images
+	}
+	return s
+}
+
+// RegisterMetrics registers the reconciler metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricReconciles, "Fleet configuration reconciliations, by resulting status (compliant, drifted, error)", "")
+}
+
+// Reconciler applies the fleet configuration to this worker
+type Reconciler struct {
+	cfg        config.Fleet
+	db         *sql.DB
+	cli        *client.Client
+	workerID   string
+	instanceID string
+	// base is the worker's own configuration, which unset settings keep
+	base            config.Worker
+	baseConcurrency int
+
+	current atomic.Pointer[config.Worker]
+	version string // Applied last, only used by the reconciling goroutine
+}
+
+// New creates a reconciler over the worker's own settings. Until the first
+// Reconcile they are the settings in effect.
+func New(cfg config.Fleet, db *sql.DB, cli *client.Client, workerID, instanceID string, base config.Worker, baseConcurrency int) *Reconciler {
+	r := &Reconciler{cfg: cfg, db: db, cli: cli, workerID: workerID, instanceID: instanceID, base: base, baseConcurrency: baseConcurrency}
+	r.current.Store(&base)
+	return r
+}
+
+// Worker returns the worker settings in effect
+func (r *Reconciler) Worker() config.Worker {
+	return *r.current.Load()
+}
+
+// Run reconciles every interval until ctx is cancelled
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reconcile(ctx)
+		}
+	}
+}
+
+// Reconcile reads the document, applies this worker's settings and reports
+// the resulting compliance in WORKERS. It returns the status.
+func (r *Reconciler) Reconcile(ctx context.Context) string {
+	status, version, detail := StatusCompliant, r.version, ""
+	doc, err := r.load(ctx)
+	if err == nil {
+		var problems []string
+		problems, err = r.apply(ctx, doc)
+		version = doc.Version
+		if len(problems) > 0 {
+			status, detail = StatusDrifted, strings.Join(problems, "; ")
+			logging.Log(ctx, fmt.Sprintf("Fleet configuration %s only partly applied: %s", version, detail), slog.LevelWarn)
+		}
+	}
+	if err != nil {
+		status, detail = StatusError, err.Error()
+		if ctx.Err() == nil {
+			logging.Log(ctx, fmt.Sprintf("Error reconciling to the fleet configuration, keeping %q: %v", r.version, err), slog.LevelWarn)
+		}
+	} else if version != r.version {
+		logging.Log(ctx, fmt.Sprintf("Reconciled to fleet configuration %s", version), slog.LevelInfo)
+		r.version = version
+	}
+
+	logging.Inc(ctx, metricReconciles, attribute.String("status", status))
+	_, err = r.db.ExecContext(ctx, `UPDATE WORKERS SET config_version = NULLIF($1, ''), config_status = $2, config_detail = NULLIF($3, ''),
+		config_checked_at = NOW() WHERE id = $4 AND instance_id = $5`, r.version, status, detail, r.workerID, r.instanceID)
+	if err != nil && ctx.Err() == nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to report fleet configuration compliance: %v", err), slog.LevelWarn)
+	}
+	return status
+}
+
+// apply installs the settings the document sets for this worker. Settings
+// that couldn't be applied are returned as problems; an invalid document is
+// an error and changes nothing.
+func (r *Reconciler) apply(ctx context.Context, doc Document) ([]string, error) {
+	s := doc.For(r.workerID)
+	w := r.base
+	if s.Queues != nil {
+		w.Queues = s.Queues
+	}
+	if s.MinPriority != nil {
+		w.MinPriority = *s.MinPriority
+	}
+	if s.MaxPriority != nil {
+		w.MaxPriority = *s.MaxPriority
+	}
+	switch {
+	case s.Concurrency < 0:
+		return nil, fmt.Errorf("concurrency %d is negative", s.Concurrency)
+	case w.MinPriority < 0 || w.MaxPriority < 0:
+		return nil, errors.New("priorities must not be negative")
+	case w.MaxPriority != 0 && w.MinPriority > w.MaxPriority:
+		return nil, fmt.Errorf("min priority %d is above max priority %d", w.MinPriority, w.MaxPriority)
+	}
+
+	concurrency := r.baseConcurrency
+	if s.Concurrency > 0 {
+		concurrency = s.Concurrency
+	}
+	r.current.Store(&w)
+	containerization.DefaultExecQueue().SetLimit(concurrency)
+
+	// Pulling is skipped for images already present, so this also notices
+	// images removed since the last reconciliation
+	var problems []string
+	for _, image := range s.Images {
+		if err := containerization.EnsureImage(ctx, r.cli, image); err != nil {
+			problems = append(problems, fmt.Sprintf("image %s: %v", image, err))
+		}
+	}
+	return problems, nil
+}
+
+// load reads the document from the configured source. Without any version in
+// FLEET_CONFIG the worker keeps its own settings.
+func (r *Reconciler) load(ctx context.Context) (Document, error) {
+	var doc Document
+	if r.cfg.Source == SourceDB {
+		var raw []byte
+		err := r.db.QueryRowContext(ctx, `SELECT version, document FROM FLEET_CONFIG ORDER BY created_at DESC LIMIT 1`).Scan(&doc.Version, &raw)
+		if errors.Is(err, sql.ErrNoRows) {
+			return doc, nil
+		}
+		if err != nil {
+			return doc, fmt.Errorf("failed to read FLEET_CONFIG: %w", err)
+		}
+		version := doc.Version
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return doc, fmt.Errorf("failed to parse fleet configuration %s: %w", version, err)
+		}
+		doc.Version = version
+		return doc, nil
+	}
+
+	raw, err := policy.Fetch(ctx, r.cfg.Source)
+	if err != nil {
+		return doc, fmt.Errorf("failed to read fleet configuration: %w", err)
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return doc, fmt.Errorf("failed to parse fleet configuration: %w", err)
+	}
+	if doc.Version == "" {
+		return doc, fmt.Errorf("fleet configuration %s has no version", r.cfg.Source)
+	}
+	return doc, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package health checks the dependencies a worker needs to process tasks
+// and reports them per component for the /healthz and /readyz probes.
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Component is the outcome of one dependency check
+type Component struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type check struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Checker runs the registered dependency checks concurrently, each bounded
+// by the timeout
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+}
+
+// NewChecker creates a checker without any check
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check; fn returns nil when the dependency is usable. Checks
+// must all be added before the first Run.
+func (c *Checker) Add(name string, fn func(context.Context) error) {
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Run runs every check and returns their outcomes in registration order.
+// healthy is false if any check failed.
+func (c *Checker) Run(ctx context.Context) (components []Component, healthy bool) {
+	components = make([]Component, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := ch.fn(checkCtx)
+			components[i] = Component{Name: ch.name, Healthy: err == nil, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				components[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	healthy = true
+	for _, comp := range components {
+		healthy = healthy && comp.Healthy
+	}
+	return components, healthy
+}
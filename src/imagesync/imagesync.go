@@ -0,0 +1,296 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package imagesync coordinates sandbox image pulls across the fleet, so
+// workers starting together don't all pull the same image from the registry.
+// Workers sharing a Docker daemon let one of them pull and wait for it; with
+// peer transfer enabled, daemons also import an image from a peer that
+// already has it instead of pulling it again.
+package imagesync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// Pull states in IMAGE_PULLS
+const (
+	statusPulling = "pulling"
+	statusReady   = "ready"
+	statusFailed  = "failed"
+)
+
+const (
+	// pollInterval is how often a waiting worker checks on the pull
+	pollInterval = 2 * time.Second
+	// staleAfter is when a pull whose worker stopped refreshing it is taken over
+	staleAfter = time.Minute
+)
+
+// ExportPath serves the images of this daemon to peers, see ServeHTTP
+const ExportPath = "/images/export"
+
+// Coordinator pulls images on behalf of the workers of one Docker daemon
+type Coordinator struct {
+	db       *sql.DB
+	cli      *client.Client
+	workerID string
+	daemonID string
+	// peerURL is this worker's API address advertised to peers; "" disables
+	// peer transfer
+	peerURL string
+	// peerToken authenticates the exports of peers requiring a token
+	peerToken string
+	wait      time.Duration
+}
+
+// New creates the coordinator of the worker, keyed by its daemon's ID
+func New(ctx context.Context, db *sql.DB, cli *client.Client, workerID string, cfg config.Container) (*Coordinator, error) {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read docker daemon ID: %w", err)
+	}
+	return &Coordinator{
+		db:        db,
+		cli:       cli,
+		workerID:  workerID,
+		daemonID:  info.ID,
+		peerURL:   strings.TrimSuffix(cfg.ImagePeerURL, "/"),
+		wait:      cfg.ImagePullWait,
+		peerToken: cfg.ImagePeerToken,
+	}, nil
+}
+
+// Pull is a containerization.Puller. The first worker of the daemon to ask
+// for the image fetches it, from a peer or the registry, while the others
+// poll the daemon until it appears or the pull fails.
+func (c *Coordinator) Pull(ctx context.Context, cli *client.Client, imageName string) error {
+	deadline := time.Now().Add(c.wait)
+	for {
+		won, err := c.claim(ctx, imageName)
+		if err != nil {
+			// Without the database, pull like a worker on its own
+			logging.Log(ctx, fmt.Sprintf("Failed to coordinate the pull of %s, pulling it directly: %v", imageName, err), slog.LevelWarn)
+			return containerization.PullImage(ctx, cli, imageName)
+		}
+		if won {
+			return c.fetch(ctx, cli, imageName)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for another worker to pull %s", imageName)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+		if _, err := cli.ImageInspect(ctx, imageName); err == nil {
+			return nil
+		}
+	}
+}
+
+// claim takes the pull of the image on this daemon unless another worker of
+// the daemon is pulling it
+func (c *Coordinator) claim(ctx context.Context, imageName string) (bool, error) {
+	res, err := c.db.ExecContext(ctx, `
+		INSERT INTO IMAGE_PULLS (image, daemon_id, worker_id, status, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (image, daemon_id) DO UPDATE
+		SET worker_id = EXCLUDED.worker_id, status = EXCLUDED.status, error = NULL, updated_at = NOW()
+		WHERE IMAGE_PULLS.status <> $4
+		OR IMAGE_PULLS.updated_at < NOW() - $5 * INTERVAL '1 second'`,
+		imageName, c.daemonID, c.workerID, statusPulling, staleAfter.Seconds())
+	if err != nil {
+		return false, err
+	}
+	count, err := res.RowsAffected()
+	return count > 0, err
+}
+
+// fetch brings the image onto this daemon and records the outcome. The pull
+// is refreshed meanwhile so it isn't taken over.
+func (c *Coordinator) fetch(ctx context.Context, cli *client.Client, imageName string) error {
+	refreshCtx, stopRefresh := context.WithCancel(ctx)
+	go c.refresh(refreshCtx, imageName)
+
+	err := c.fromPeer(ctx, cli, imageName)
+	if err != nil {
+		if !errors.Is(err, errNoPeer) {
+			logging.Log(ctx, fmt.Sprintf("Failed to import %s from a peer, pulling it from the registry: %v", imageName, err), slog.LevelWarn)
+		}
+		err = containerization.PullImage(ctx, cli, imageName)
+	}
+	stopRefresh()
+
+	var imageID string
+	status, errMsg := statusReady, ""
+	if err == nil {
+		inspect, inspectErr := cli.ImageInspect(ctx, imageName)
+		err = inspectErr
+		imageID = inspect.ID
+	}
+	if err != nil {
+		status, errMsg = statusFailed, err.Error()
+	}
+	_, dbErr := c.db.ExecContext(context.WithoutCancel(ctx), `UPDATE IMAGE_PULLS
+		SET status = $1, image_id = NULLIF($2, ''), peer_url = NULLIF($3, ''), error = NULLIF($4, ''), updated_at = NOW()
+		WHERE image = $5 AND daemon_id = $6 AND worker_id = $7`,
+		status, imageID, c.peerURL, errMsg, imageName, c.daemonID, c.workerID)
+	if dbErr != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to record the pull of %s: %v", imageName, dbErr), slog.LevelWarn)
+	}
+	return err
+}
+
+// refresh keeps the pull from looking abandoned until ctx is cancelled
+func (c *Coordinator) refresh(ctx context.Context, imageName string) {
+	ticker := time.NewTicker(staleAfter / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.db.ExecContext(ctx, "UPDATE IMAGE_PULLS SET updated_at = NOW() WHERE image = $1 AND daemon_id = $2 AND worker_id = $3",
+				imageName, c.daemonID, c.workerID)
+		}
+	}
+}
+
+// errNoPeer means no peer has the image, or peer transfer is disabled
+var errNoPeer = errors.New("no peer has the image")
+
+// fromPeer imports the image from another daemon that has it. When another
+// daemon is still pulling it, it waits for that pull rather than start a
+// second one from the registry.
+func (c *Coordinator) fromPeer(ctx context.Context, cli *client.Client, imageName string) error {
+	if c.peerURL == "" {
+		return errNoPeer
+	}
+
+	deadline := time.Now().Add(c.wait)
+	for {
+		// Spread imports across the peers that have the image
+		var peer, imageID string
+		err := c.db.QueryRowContext(ctx, `SELECT peer_url, COALESCE(image_id, '') FROM IMAGE_PULLS
+			WHERE image = $1 AND daemon_id <> $2 AND status = $3 AND peer_url IS NOT NULL
+			ORDER BY random() LIMIT 1`, imageName, c.daemonID, statusReady).Scan(&peer, &imageID)
+		if err == nil {
+			return c.importFrom(ctx, cli, peer, imageName, imageID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		var pulling bool
+		err = c.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM IMAGE_PULLS
+			WHERE image = $1 AND daemon_id <> $2 AND status = $3 AND updated_at >= NOW() - $4 * INTERVAL '1 second')`,
+			imageName, c.daemonID, statusPulling, staleAfter.Seconds()).Scan(&pulling)
+		if err != nil {
+			return err
+		}
+		if !pulling || time.Now().After(deadline) {
+			return errNoPeer
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// importFrom loads the image exported by the peer, and removes it again if
+// its ID is not the one the peer recorded
+func (c *Coordinator) importFrom(ctx context.Context, cli *client.Client, peer, imageName, imageID string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, peer+ExportPath+"?name="+url.QueryEscape(imageName), nil)
+	if err != nil {
+		return err
+	}
+	if c.peerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.peerToken)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", peer, resp.Status)
+	}
+
+	logging.Log(ctx, fmt.Sprintf("Importing sandbox image %s from %s...", imageName, peer), slog.LevelInfo)
+	loaded, err := cli.ImageLoad(ctx, resp.Body, client.ImageLoadWithQuiet(true))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, loaded.Body)
+	loaded.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	inspect, err := cli.ImageInspect(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("image missing after import: %w", err)
+	}
+	if imageID != "" && inspect.ID != imageID {
+		cli.ImageRemove(ctx, inspect.ID, image.RemoveOptions{Force: true})
+		return fmt.Errorf("imported image has ID %s, expected %s", inspect.ID, imageID)
+	}
+	return nil
+}
+
+// ServeHTTP exports an image of this daemon as a docker save tarball. Only
+// images recorded as ready on this daemon are served, never arbitrary host
+// images.
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	var ready bool
+	err := c.db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM IMAGE_PULLS WHERE image = $1 AND daemon_id = $2 AND status = $3)",
+		name, c.daemonID, statusReady).Scan(&ready)
+	if err != nil {
+		http.Error(w, "Failed to look up image", http.StatusInternalServerError)
+		return
+	}
+	if !ready {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+
+	body, err := c.cli.ImageSave(r.Context(), []string{name})
+	if err != nil {
+		http.Error(w, "Failed to export image", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", "application/x-tar")
+	if _, err := io.Copy(w, body); err != nil {
+		logging.Log(r.Context(), fmt.Sprintf("Failed to export image %s to a peer: %v", name, err), slog.LevelWarn)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package imagesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/client"
+)
+
+// Image states reported by the Manager
+const (
+	ImagePending = "pending"
+	ImagePulling = "pulling"
+	ImageReady   = "ready"
+	ImageFailed  = "failed"
+)
+
+// retryInterval is how often images that failed to pull are tried again
+const retryInterval = time.Minute
+
+// ImageState is the readiness of one runtime image
+type ImageState struct {
+	Image  string `json:"image"`
+	Status string `json:"status"`
+	// Bytes downloaded out of those known so far, while pulling from a
+	// registry
+	DownloadedBytes int64     `json:"downloaded_bytes,omitempty"`
+	TotalBytes      int64     `json:"total_bytes,omitempty"`
+	Digest          string    `json:"digest,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Manager preheats the runtime images: it pulls them all concurrently at
+// startup, through the installed Puller, retries those that failed, and
+// pulls an image again when its registry digest changes
+type Manager struct {
+	cli     *client.Client
+	refresh time.Duration
+
+	mu     sync.Mutex
+	states map[string]*ImageState
+	order  []string
+	// settled is closed once the first attempt at each image is over
+	settled map[string]chan struct{}
+}
+
+// NewManager tracks images, all pending until Run starts pulling them.
+// refresh is how often their registry digests are checked, 0 never.
+func NewManager(cli *client.Client, images []string, refresh time.Duration) *Manager {
+	m := &Manager{cli: cli, refresh: refresh, states: map[string]*ImageState{}, settled: map[string]chan struct{}{}}
+	for _, imageName := range images {
+		if _, ok := m.states[imageName]; ok {
+			continue
+		}
+		m.order = append(m.order, imageName)
+		m.states[imageName] = &ImageState{Image: imageName, Status: ImagePending, UpdatedAt: time.Now()}
+		m.settled[imageName] = make(chan struct{})
+	}
+	return m
+}
+
+// Run pulls every image at once, then retries the failed ones and checks
+// the registry digests until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, imageName := range m.order {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(m.settled[imageName])
+			m.ensure(ctx, imageName)
+		}()
+	}
+	wg.Wait()
+
+	retry := time.NewTicker(retryInterval)
+	defer retry.Stop()
+	var refresh <-chan time.Time
+	if m.refresh > 0 {
+		ticker := time.NewTicker(m.refresh)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-retry.C:
+			for _, imageName := range m.order {
+				if m.state(imageName).Status == ImageFailed {
+					m.ensure(ctx, imageName)
+				}
+			}
+		case <-refresh:
+			for _, imageName := range m.order {
+				m.checkDigest(ctx, imageName)
+			}
+		}
+	}
+}
+
+// WaitReady waits for the first attempt at the image and returns its error.
+// An image the manager doesn't track is ensured directly.
+func (m *Manager) WaitReady(ctx context.Context, imageName string) error {
+	settled, ok := m.settled[imageName]
+	if !ok {
+		return containerization.EnsureImage(ctx, m.cli, imageName)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-settled:
+	}
+	if state := m.state(imageName); state.Status != ImageReady {
+		return errors.New(state.Error)
+	}
+	return nil
+}
+
+// Status returns the state of every image, in configuration order
+func (m *Manager) Status() []ImageState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	states := make([]ImageState, 0, len(m.order))
+	for _, imageName := range m.order {
+		states = append(states, *m.states[imageName])
+	}
+	return states
+}
+
+// Check is a health check failing while any image is not ready
+func (m *Manager) Check(ctx context.Context) error {
+	var problems []string
+	for _, state := range m.Status() {
+		switch state.Status {
+		case ImageReady:
+		case ImagePulling:
+			if state.TotalBytes > 0 {
+				problems = append(problems, fmt.Sprintf("%s pulling (%d%%)", state.Image, state.DownloadedBytes*100/state.TotalBytes))
+			} else {
+				problems = append(problems, state.Image+" pulling")
+			}
+		case ImageFailed:
+			problems = append(problems, fmt.Sprintf("%s failed: %s", state.Image, state.Error))
+		default:
+			problems = append(problems, state.Image+" "+state.Status)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ensure makes sure the image is present, pulling it if it is missing
+func (m *Manager) ensure(ctx context.Context, imageName string) {
+	m.update(imageName, func(s *ImageState) { *s = ImageState{Image: imageName, Status: ImagePulling} })
+	err := containerization.EnsureImage(containerization.WithPullProgress(ctx, m.progress(imageName)), m.cli, imageName)
+	m.settle(ctx, imageName, err)
+}
+
+// checkDigest pulls the image again when its tag now points to another
+// digest in the registry. Containers already created keep the old image
+// until they are replaced.
+func (m *Manager) checkDigest(ctx context.Context, imageName string) {
+	dist, err := m.cli.DistributionInspect(ctx, imageName, "")
+	if err != nil {
+		// e.g. an image only ever built or imported locally
+		logging.Log(ctx, fmt.Sprintf("Failed to check the registry digest of %s: %v", imageName, err), slog.LevelWarn)
+		return
+	}
+	digest := dist.Descriptor.Digest.String()
+	if inspect, err := m.cli.ImageInspect(ctx, imageName); err == nil && slices.ContainsFunc(inspect.RepoDigests, func(d string) bool {
+		return strings.HasSuffix(d, "@"+digest)
+	}) {
+		return
+	}
+
+	logging.Log(ctx, fmt.Sprintf("Sandbox image %s changed in its registry (%s), pulling it again", imageName, digest), slog.LevelInfo)
+	m.update(imageName, func(s *ImageState) { *s = ImageState{Image: imageName, Status: ImagePulling, Digest: s.Digest} })
+	err = containerization.PullImage(containerization.WithPullProgress(ctx, m.progress(imageName)), m.cli, imageName)
+	m.settle(ctx, imageName, err)
+}
+
+// settle records the outcome of a pull, and the digest the image now has
+func (m *Manager) settle(ctx context.Context, imageName string, err error) {
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to pull sandbox image %s, retrying in %s: %v", imageName, retryInterval, err), slog.LevelWarn)
+		m.update(imageName, func(s *ImageState) { s.Status, s.Error = ImageFailed, err.Error() })
+		return
+	}
+	var digest string
+	if inspect, err := m.cli.ImageInspect(ctx, imageName); err == nil && len(inspect.RepoDigests) > 0 {
+		_, digest, _ = strings.Cut(inspect.RepoDigests[0], "@")
+	}
+	logging.Log(ctx, fmt.Sprintf("Sandbox image %s is ready", imageName), slog.LevelInfo)
+	m.update(imageName, func(s *ImageState) { s.Status, s.Digest, s.Error = ImageReady, digest, "" })
+}
+
+// progress records the download of a registry pull
+func (m *Manager) progress(imageName string) containerization.PullProgress {
+	return func(current, total int64) {
+		m.update(imageName, func(s *ImageState) { s.DownloadedBytes, s.TotalBytes = current, total })
+	}
+}
+
+func (m *Manager) update(imageName string, fn func(*ImageState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(m.states[imageName])
+	m.states[imageName].UpdatedAt = time.Now()
+}
+
+func (m *Manager) state(imageName string) ImageState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.states[imageName]
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package leader elects the one worker that runs the cluster-wide maintenance
+// jobs (zombie task recovery, archival, duplicate-execution scans), so the
+// fleet doesn't repeat them on every worker. Election holds a Postgres
+// advisory lock, which the server releases when the leader's session ends,
+// so another worker takes over when the leader dies.
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"continuumworker/src/logging"
+)
+
+// lockKey is the advisory lock held by the leader ("continuum" in ASCII,
+// truncated to 8 bytes)
+const lockKey int64 = 0x636f6e74696e7575
+
+// Leader tells whether this worker runs the maintenance jobs
+type Leader interface {
+	// IsLeader reports whether this worker holds leadership right now
+	IsLeader() bool
+	// Changed is closed at the next gain or loss of leadership
+	Changed() <-chan struct{}
+}
+
+// Run runs job each time l is elected, with a context cancelled as soon as
+// leadership is lost, until ctx is done. job should return once its context
+// is cancelled.
+func Run(ctx context.Context, l Leader, job func(ctx context.Context)) {
+	for ctx.Err() == nil {
+		changed := l.Changed()
+		if !l.IsLeader() {
+			select {
+			case <-ctx.Done():
+			case <-changed:
+			}
+			continue
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			job(jobCtx)
+		}()
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+		cancel()
+		<-done
+	}
+}
+
+// Always is the leader of a single-worker deployment, or of one where every
+// worker runs the maintenance jobs (LEADER_ELECTION=false)
+type Always struct{}
+
+func (Always) IsLeader() bool { return true }
+
+// Changed never closes
+func (Always) Changed() <-chan struct{} { return nil }
+
+// Advisory campaigns for the advisory lock every interval and, once elected,
+// holds it on a dedicated connection checked every interval. Leadership is
+// given up as soon as the check fails, since the server may already have
+// ended the session and elected another worker.
+type Advisory struct {
+	db       *sql.DB
+	workerID string
+	interval time.Duration
+
+	mu      sync.Mutex
+	leader  bool
+	changed chan struct{}
+}
+
+// NewAdvisory returns a candidate that campaigns once Run is called
+func NewAdvisory(db *sql.DB, workerID string, interval time.Duration) *Advisory {
+	return &Advisory{db: db, workerID: workerID, interval: interval, changed: make(chan struct{})}
+}
+
+func (a *Advisory) IsLeader() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.leader
+}
+
+func (a *Advisory) Changed() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.changed
+}
+
+func (a *Advisory) set(leader bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.leader == leader {
+		return
+	}
+	a.leader = leader
+	close(a.changed)
+	a.changed = make(chan struct{})
+}
+
+// Run campaigns until ctx is done, then gives leadership up
+func (a *Advisory) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := a.campaign(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.Log(ctx, fmt.Sprintf("Leader election failed: %v", err), slog.LevelWarn)
+		}
+		if conn != nil {
+			logging.Log(ctx, fmt.Sprintf("Worker %s elected leader, running maintenance jobs", a.workerID), slog.LevelInfo)
+			a.set(true)
+			err := a.hold(ctx, conn, ticker.C)
+			a.set(false)
+			discard(conn)
+			if ctx.Err() != nil {
+				logging.Log(context.Background(), fmt.Sprintf("Worker %s stepped down as leader", a.workerID), slog.LevelInfo)
+				return
+			}
+			logging.Log(ctx, fmt.Sprintf("ALERT: worker %s lost leadership: %v", a.workerID, err), slog.LevelError)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign returns the connection holding the lock, or nil when another
+// worker holds it
+func (a *Advisory) campaign(ctx context.Context) (*sql.Conn, error) {
+	conn, err := a.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&acquired); err != nil {
+		discard(conn)
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, nil
+	}
+
+	// Have the server notice a vanished leader within seconds rather than
+	// the hours of the default TCP keepalive, so the lock is released
+	seconds := max(int(a.interval.Seconds()), 1)
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("SET tcp_keepalives_idle = %d; SET tcp_keepalives_interval = %d; SET tcp_keepalives_count = 3",
+		seconds, seconds))
+	if err != nil {
+		discard(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hold checks the leader's connection at every tick until it fails or ctx
+// is done
+func (a *Advisory) hold(ctx context.Context, conn *sql.Conn, tick <-chan time.Time) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+		}
+		checkCtx, cancel := context.WithTimeout(ctx, a.interval)
+		_, err := conn.ExecContext(checkCtx, "SELECT 1")
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// discard closes the connection's session instead of returning it to the
+// pool, which releases the lock (if held) and the session settings
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
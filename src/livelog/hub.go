@@ -0,0 +1,211 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package livelog broadcasts the stdout/stderr of running tasks to live
+// subscribers, e.g. the SSE endpoint of the API server.
+package livelog
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// backlogBytes is how much recent output a late subscriber is replayed
+	backlogBytes = 64 * 1024
+	// subscriberBuffer is the number of chunks a slow subscriber may lag
+	// behind before chunks are dropped for it
+	subscriberBuffer = 256
+)
+
+// Event is a chunk of output written by a task
+type Event struct {
+	Stream string `json:"stream"` // "stdout" or "stderr"
+	Data   string `json:"data"`
+}
+
+type taskLog struct {
+	backlog     []Event
+	size        int
+	subscribers map[chan Event]struct{}
+}
+
+// Hub fans the output of running tasks out to subscribers
+type Hub struct {
+	mu    sync.Mutex
+	tasks map[int]*taskLog
+}
+
+// Default is the hub shared by the processor and the API server
+var Default = NewHub()
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{tasks: make(map[int]*taskLog)}
+}
+
+// Open starts broadcasting for a task. It must be paired with Close.
+func (h *Hub) Open(taskID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tasks[taskID] = &taskLog{subscribers: make(map[chan Event]struct{})}
+}
+
+// Close ends the broadcast for a task and closes every subscriber channel
+func (h *Hub) Close(taskID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tl, ok := h.tasks[taskID]
+	if !ok {
+		return
+	}
+	for ch := range tl.subscribers {
+		close(ch)
+	}
+	delete(h.tasks, taskID)
+}
+
+// Publish sends a chunk of output to every subscriber of the task
+func (h *Hub) Publish(taskID int, stream string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tl, ok := h.tasks[taskID]
+	if !ok {
+		return
+	}
+
+	ev := Event{Stream: stream, Data: string(data)}
+	tl.backlog = append(tl.backlog, ev)
+	tl.size += len(ev.Data)
+	for tl.size > backlogBytes && len(tl.backlog) > 1 {
+		tl.size -= len(tl.backlog[0].Data)
+		tl.backlog = tl.backlog[1:]
+	}
+
+	for ch := range tl.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Never let a slow client block the task
+		}
+	}
+}
+
+// Subscribe returns the recent backlog and a channel of new output for a
+// running task. The channel is closed when the task finishes; call cancel to
+// unsubscribe early. ok is false if the task is not running on this worker.
+func (h *Hub) Subscribe(taskID int) (backlog []Event, events <-chan Event, cancel func(), ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tl, found := h.tasks[taskID]
+	if !found {
+		return nil, nil, nil, false
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	tl.subscribers[ch] = struct{}{}
+	backlog = append([]Event(nil), tl.backlog...)
+
+	cancel = func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if current, ok := h.tasks[taskID]; ok && current == tl {
+			if _, subscribed := tl.subscribers[ch]; subscribed {
+				delete(tl.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+	return backlog, ch, cancel, true
+}
+
+// Writer returns an io.Writer that publishes everything written to it as
+// output of the given stream
+func (h *Hub) Writer(taskID int, stream string) *Writer {
+	return &Writer{hub: h, taskID: taskID, stream: stream}
+}
+
+// RedactingWriter is Writer replacing each of secrets with mask before
+// anything is published. Output that could be the start of a secret is held
+// back until the next write shows it isn't, so a secret split across writes
+// is still caught; Flush publishes what is held back.
+func (h *Hub) RedactingWriter(taskID int, stream string, secrets []string, mask string) *Writer {
+	w := h.Writer(taskID, stream)
+	for _, s := range secrets {
+		if s != "" {
+			w.secrets = append(w.secrets, []byte(s))
+		}
+	}
+	w.mask = []byte(mask)
+	return w
+}
+
+// Writer publishes writes to a Hub
+type Writer struct {
+	hub    *Hub
+	taskID int
+	stream string
+
+	mu      sync.Mutex
+	secrets [][]byte
+	mask    []byte
+	// pending is redacted output held back as it ends with the start of a secret
+	pending []byte
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(w.secrets) == 0 {
+		w.hub.Publish(w.taskID, w.stream, p)
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := append(w.pending, p...)
+	for _, s := range w.secrets {
+		out = bytes.ReplaceAll(out, s, w.mask)
+	}
+	held := w.heldBack(out)
+	if ready := out[:len(out)-held]; len(ready) > 0 {
+		w.hub.Publish(w.taskID, w.stream, ready)
+	}
+	w.pending = append([]byte(nil), out[len(out)-held:]...)
+	return len(p), nil
+}
+
+// Flush publishes the output held back by a redacting writer, once nothing
+// more is written
+func (w *Writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) > 0 {
+		w.hub.Publish(w.taskID, w.stream, w.pending)
+		w.pending = nil
+	}
+}
+
+// heldBack is the length of the longest suffix of out that is a proper
+// prefix of a secret
+func (w *Writer) heldBack(out []byte) int {
+	held := 0
+	for _, s := range w.secrets {
+		for n := min(len(s)-1, len(out)); n > held; n-- {
+			if bytes.HasSuffix(out, s[:n]) {
+				held = n
+				break
+			}
+		}
+	}
+	return held
+}
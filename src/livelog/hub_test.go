@@ -0,0 +1,68 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package livelog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactingWriter(t *testing.T) {
+	const secret = "hunter2-s3cr3t"
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "no secret", writes: []string{"hello ", "world\n"}, want: "hello world\n"},
+		{name: "whole secret", writes: []string{"token=" + secret + "\n"}, want: "token=[redacted]\n"},
+		{name: "split secret", writes: []string{"token=hunt", "er2-s3", "cr3t\n"}, want: "token=[redacted]\n"},
+		{name: "byte by byte", writes: strings.Split("a "+secret+" b", ""), want: "a [redacted] b"},
+		{name: "prefix only", writes: []string{"token=hunter2", "-other\n"}, want: "token=hunter2-other\n"},
+		{name: "prefix at the end", writes: []string{"token=hunter"}, want: "token=hunter"},
+		{name: "repeated secret", writes: []string{secret + secret[:5], secret[5:] + "\n"}, want: "[redacted][redacted]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub()
+			hub.Open(1)
+			_, events, cancel, ok := hub.Subscribe(1)
+			if !ok {
+				t.Fatal("task not open")
+			}
+			defer cancel()
+
+			w := hub.RedactingWriter(1, "stdout", []string{secret}, "[redacted]")
+			for _, chunk := range tt.writes {
+				if n, err := w.Write([]byte(chunk)); err != nil || n != len(chunk) {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+			w.Flush()
+			hub.Close(1)
+
+			var got strings.Builder
+			for ev := range events {
+				if strings.Contains(ev.Data, secret[:len(secret)/2]) && strings.Contains(tt.want, "[redacted]") {
+					t.Fatalf("event %q leaks part of the secret", ev.Data)
+				}
+				got.WriteString(ev.Data)
+			}
+			if strings.Contains(got.String(), secret) {
+				t.Fatalf("subscriber received the secret: %q", got.String())
+			}
+			if got.String() != tt.want {
+				t.Fatalf("subscriber received %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
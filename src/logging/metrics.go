@@ -0,0 +1,140 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PhaseDurationMetric is the histogram ObservePhase records to
+const PhaseDurationMetric = "worker_phase_duration_seconds"
+
+// The registry keeps every instrument by name so any package can record to
+// it. Instruments used before being initialized are created on the fly
+// without a description.
+var (
+	registryMu sync.Mutex
+	counters   = map[string]metric.Float64Counter{}
+	histograms = map[string]metric.Float64Histogram{}
+)
+
+// InitializeFloatCounter registers a counter, or returns the existing one
+func InitializeFloatCounter(name, description, unit string) (metric.Float64Counter, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return counterLocked(name, metric.WithDescription(description), metric.WithUnit(unit))
+}
+
+// InitializeFloatHistogram registers a histogram, or returns the existing one
+func InitializeFloatHistogram(name, description, unit string) (metric.Float64Histogram, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return histogramLocked(name, metric.WithDescription(description), metric.WithUnit(unit))
+}
+
+// GaugeRecorder reports one current value of a gauge
+type GaugeRecorder func(value float64, attrs ...attribute.KeyValue)
+
+// InitializeFloatGauge registers an observable gauge. observe is called at
+// every collection and must be cheap: report cached state rather than query.
+func InitializeFloatGauge(name, description, unit string, observe func(ctx context.Context, record GaugeRecorder)) error {
+	_, err := meter.Float64ObservableGauge(name,
+		metric.WithDescription(description),
+		metric.WithUnit(unit),
+		metric.WithFloat64Callback(func(ctx context.Context, o metric.Float64Observer) error {
+			observe(ctx, func(value float64, attrs ...attribute.KeyValue) {
+				o.Observe(value, metric.WithAttributes(attrs...))
+			})
+			return nil
+		}))
+	if err != nil {
+		Log(context.Background(), "Failed to create metric: "+err.Error(), slog.LevelError)
+	}
+	return err
+}
+
+func counterLocked(name string, opts ...metric.Float64CounterOption) (metric.Float64Counter, error) {
+	if c, ok := counters[name]; ok {
+		return c, nil
+	}
+	c, err := meter.Float64Counter(name, opts...)
+	if err != nil {
+		Log(context.Background(), "Failed to create metric: "+err.Error(), slog.LevelError)
+		return nil, err
+	}
+	counters[name] = c
+	return c, nil
+}
+
+func histogramLocked(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	if h, ok := histograms[name]; ok {
+		return h, nil
+	}
+	h, err := meter.Float64Histogram(name, opts...)
+	if err != nil {
+		Log(context.Background(), "Failed to create metric: "+err.Error(), slog.LevelError)
+		return nil, err
+	}
+	histograms[name] = h
+	return h, nil
+}
+
+// Counter returns the registered counter, creating it if needed
+func Counter(name string) metric.Float64Counter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	c, _ := counterLocked(name)
+	return c
+}
+
+// Histogram returns the registered histogram, creating it if needed
+func Histogram(name string) metric.Float64Histogram {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	h, _ := histogramLocked(name)
+	return h
+}
+
+// Add adds value to the named counter
+func Add(ctx context.Context, name string, value float64, attrs ...attribute.KeyValue) {
+	if c := Counter(name); c != nil {
+		c.Add(ctx, value, metric.WithAttributes(attrs...))
+	}
+}
+
+// Inc adds one to the named counter
+func Inc(ctx context.Context, name string, attrs ...attribute.KeyValue) {
+	Add(ctx, name, 1, attrs...)
+}
+
+// Observe records value in the named histogram
+func Observe(ctx context.Context, name string, value float64, attrs ...attribute.KeyValue) {
+	if h := Histogram(name); h != nil {
+		h.Record(ctx, value, metric.WithAttributes(attrs...))
+	}
+}
+
+// ObservePhase records the time since start as the duration of a pipeline
+// phase, in the PhaseDurationMetric histogram and as an event on the span
+// active in ctx
+func ObservePhase(ctx context.Context, phase string, start time.Time) {
+	d := time.Since(start)
+	Observe(ctx, PhaseDurationMetric, d.Seconds(), attribute.String("phase", phase))
+	trace.SpanFromContext(ctx).AddEvent(phase, trace.WithAttributes(attribute.Float64("duration_ms", float64(d.Microseconds())/1000)))
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"continuumworker/src/livelog"
+)
+
+// sseKeepAlive is how often a comment is sent on idle streams so proxies
+// don't close the connection
+const sseKeepAlive = 15 * time.Second
+
+// taskLogStreamHandler streams the stdout/stderr of a running task as
+// Server-Sent Events. Only the worker running the task can serve its stream.
+func (s *APIServer) taskLogStreamHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	backlog, events, cancel, ok := livelog.Default.Subscribe(taskID)
+	if !ok {
+		http.Error(w, "Task is not running on this worker", http.StatusNotFound)
+		return
+	}
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, ev := range backlog {
+		writeSSE(w, ev.Stream, ev)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case ev, open := <-events:
+			if !open {
+				fmt.Fprint(w, "event: end\ndata: {}\n\n")
+				_ = rc.Flush()
+				return
+			}
+			writeSSE(w, ev.Stream, ev)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes one event; the data is JSON encoded so it never contains
+// the raw newlines that would split an SSE frame
+func writeSSE(w http.ResponseWriter, event string, data any) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+}
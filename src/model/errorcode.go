@@ -0,0 +1,74 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package model
+
+// ErrorCode classifies why a task failed, was held or was requeued, so
+// clients can branch on it rather than parse LastError. New codes may be
+// added; clients should treat unknown ones like ErrCodeInternal.
+type ErrorCode string
+
+const (
+	// ErrCodeTimeout: the task's timeout expired while the script ran
+	ErrCodeTimeout ErrorCode = "E_TIMEOUT"
+	// ErrCodeOOM: the script was killed by the container memory limit
+	ErrCodeOOM ErrorCode = "E_OOM"
+	// ErrCodeSyntax: the script doesn't compile (SyntaxError, IndentationError)
+	ErrCodeSyntax ErrorCode = "E_CODE_SYNTAX"
+	// ErrCodeScript: the script exited with a non-zero status
+	ErrCodeScript ErrorCode = "E_SCRIPT"
+	// ErrCodeRequirements: the declared requirements failed to install
+	ErrCodeRequirements ErrorCode = "E_REQUIREMENTS"
+	// ErrCodeInvalidInput: the payload, its size, runtime or sandbox settings
+	// were refused before running
+	ErrCodeInvalidInput ErrorCode = "E_INVALID_INPUT"
+	// ErrCodeSecret: an env variable was denied or a secret doesn't exist, or
+	// the provider was unreachable and the task was requeued
+	ErrCodeSecret ErrorCode = "E_SECRET"
+	// ErrCodeCodeIntegrity: code kept in object storage failed its checksum
+	ErrCodeCodeIntegrity ErrorCode = "E_CODE_INTEGRITY"
+	// ErrCodeMalicious: code analysis flagged the code
+	ErrCodeMalicious ErrorCode = "E_MALICIOUS"
+	// ErrCodeAnalysis: code analysis failed; the task was requeued
+	ErrCodeAnalysis ErrorCode = "E_ANALYSIS"
+	// ErrCodeDependency: a task this one depends on didn't complete
+	ErrCodeDependency ErrorCode = "E_DEPENDENCY"
+	// ErrCodeInfraDocker: the container runtime failed, not the script
+	ErrCodeInfraDocker ErrorCode = "E_INFRA_DOCKER"
+	// ErrCodeWorkerLost: the worker running the task stopped heartbeating;
+	// the task was requeued, or abandoned after too many attempts
+	ErrCodeWorkerLost ErrorCode = "E_WORKER_LOST"
+	// ErrCodePoison: the task damaged several workers and is held
+	ErrCodePoison ErrorCode = "E_POISON"
+	// ErrCodeResultRejected: the database refused the task's result
+	ErrCodeResultRejected ErrorCode = "E_RESULT_REJECTED"
+	// ErrCodeResultFormat: the result doesn't match the format its code declares
+	ErrCodeResultFormat ErrorCode = "E_RESULT_FORMAT"
+	// ErrCodeArtifacts: the task completed but its artifacts weren't stored
+	ErrCodeArtifacts ErrorCode = "E_ARTIFACTS"
+	// ErrCodeInternal: any other failure
+	ErrCodeInternal ErrorCode = "E_INTERNAL"
+)
+
+// ErrorCodes lists every code, for documentation and validation
+var ErrorCodes = []ErrorCode{ErrCodeTimeout, ErrCodeOOM, ErrCodeSyntax, ErrCodeScript, ErrCodeRequirements,
+	ErrCodeInvalidInput, ErrCodeSecret, ErrCodeCodeIntegrity, ErrCodeMalicious, ErrCodeAnalysis, ErrCodeDependency,
+	ErrCodeInfraDocker, ErrCodeWorkerLost, ErrCodePoison, ErrCodeResultRejected, ErrCodeResultFormat, ErrCodeArtifacts, ErrCodeInternal}
+
+// Valid reports whether c is one of ErrorCodes
+func (c ErrorCode) Valid() bool {
+	for _, code := range ErrorCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Statuses is the authoritative set of task statuses, the one the TASKS
+// CHECK constraint in init.sql allows
+var Statuses = []TaskStatus{TaskPending, TaskRunning, TaskCompleted, TaskFailed, TaskCancelled, TaskMalicious, TaskAbandoned, TaskHeld}
+
+// FinalStatuses end a task: finished is set and only an operator changes
+// them. Held tasks wait for an operator and aren't final.
+var FinalStatuses = []TaskStatus{TaskCompleted, TaskFailed, TaskCancelled, TaskMalicious, TaskAbandoned}
+
+// FailureStatuses count as failures in stats and reports
+var FailureStatuses = []TaskStatus{TaskFailed, TaskMalicious, TaskAbandoned}
+
+// UnmetStatuses are the final statuses other than completed: a task
+// depending on one never runs
+var UnmetStatuses = []TaskStatus{TaskFailed, TaskCancelled, TaskMalicious, TaskAbandoned}
+
+// legacyStatuses are spellings written by older versions, rewritten by
+// migrations/001_task_status_taxonomy.sql
+var legacyStatuses = map[string]TaskStatus{
+	"done":        TaskCompleted,
+	"not_started": TaskPending,
+	"canceled":    TaskCancelled,
+}
+
+// Valid reports whether s is one of Statuses
+func (s TaskStatus) Valid() bool {
+	return s.in(Statuses)
+}
+
+// Final reports whether s is one of FinalStatuses
+func (s TaskStatus) Final() bool {
+	return s.in(FinalStatuses)
+}
+
+// Failure reports whether s is one of FailureStatuses
+func (s TaskStatus) Failure() bool {
+	return s.in(FailureStatuses)
+}
+
+func (s TaskStatus) in(statuses []TaskStatus) bool {
+	for _, status := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatus maps a status as given by a client, or read from a row not
+// migrated yet, to one of Statuses. Case and legacy spellings are ignored.
+func ParseStatus(s string) (TaskStatus, error) {
+	status := TaskStatus(strings.ToLower(strings.TrimSpace(s)))
+	if legacy, ok := legacyStatuses[string(status)]; ok {
+		return legacy, nil
+	}
+	if !status.Valid() {
+		return "", fmt.Errorf("unknown task status %q, expected one of %s", s, strings.Join(StatusStrings(Statuses), ", "))
+	}
+	return status, nil
+}
+
+// NormalizeStatus is ParseStatus for values read back from the database,
+// which are kept as they are when unknown
+func NormalizeStatus(s TaskStatus) TaskStatus {
+	if status, err := ParseStatus(string(s)); err == nil {
+		return status
+	}
+	return s
+}
+
+// StatusStrings converts statuses to query arguments
+func StatusStrings(statuses []TaskStatus) []string {
+	strs := make([]string, len(statuses))
+	for i, s := range statuses {
+		strs[i] = string(s)
+	}
+	return strs
+}
+
+// StatusList formats statuses as an SQL list for IN (...), e.g. 'failed',
+// 'malicious'. The values are the constants above, never client input.
+func StatusList(statuses []TaskStatus) string {
+	quoted := make([]string, len(statuses))
+	for i, s := range statuses {
+		quoted[i] = "'" + string(s) + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
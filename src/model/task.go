@@ -11,32 +11,85 @@
 
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// TaskStatus is one of Statuses, see status.go
 type TaskStatus string
 
 const (
-	TaskNotStarted TaskStatus = "not_started"
-	TaskPending    TaskStatus = "pending"
-	TaskRunning    TaskStatus = "running"
-	TaskDone       TaskStatus = "done"
-	TaskCompleted  TaskStatus = "completed"
-	TaskCancelled  TaskStatus = "cancelled"
-	TaskFailed     TaskStatus = "failed"
-	TaskMalicious  TaskStatus = "malicious"
+	TaskPending   TaskStatus = "pending"
+	TaskRunning   TaskStatus = "running"
+	TaskCompleted TaskStatus = "completed"
+	TaskFailed    TaskStatus = "failed"
+	TaskCancelled TaskStatus = "cancelled"
+	TaskMalicious TaskStatus = "malicious"
+	TaskAbandoned TaskStatus = "abandoned"
+	TaskHeld      TaskStatus = "held"
+)
+
+// TaskType is what a worker does with a task
+type TaskType string
+
+const (
+	// TaskExecute runs the code in a sandbox, the default
+	TaskExecute TaskType = "execute"
+	// TaskAnalyze only runs the code analysis; the verdict is the output and
+	// the code never executes
+	TaskAnalyze TaskType = "analyze"
 )
 
 type Task struct {
-	ID          int
-	Name        string
-	Description *string
-	Started     *time.Time
-	Finished    *time.Time
-	LockedAt    *time.Time
-	LastError   *string
-	Priority    int
-	Status      TaskStatus
-	Payload     string // JSON RUN INSTRUCTIONs
-	Code        string // PYTHON CODE UUID
-	Output      *string // OUTPUT
-}
\ No newline at end of file
+	ID                 int             `json:"id"`
+	Name               string          `json:"name"`
+	Type               TaskType        `json:"type"`
+	Description        *string         `json:"description"`
+	CreatedAt          time.Time       `json:"created_at"` // Submission time
+	Started            *time.Time      `json:"started"`
+	Finished           *time.Time      `json:"finished"`
+	LockedAt           *time.Time      `json:"locked_at"`
+	LastError          *string         `json:"last_error"`
+	ErrorCode          *ErrorCode      `json:"error_code"` // Why the task failed, was held or was requeued, see errorcode.go
+	Priority           int             `json:"priority"`
+	Status             TaskStatus      `json:"status"`
+	Payload            string          `json:"payload"`               // JSON RUN INSTRUCTIONs
+	Code               string          `json:"code"`                  // PYTHON CODE UUID
+	CodeVersion        *int            `json:"code_version"`          // Pinned version, or the one run; nil for "latest" until claimed
+	Output             *string         `json:"output"`                // OUTPUT
+	WorkerID           *string         `json:"worker_id"`             // Worker currently (or last) running the task
+	DependsOn          []int64         `json:"depends_on"`            // IDs of tasks that must complete first
+	TenantID           *string         `json:"tenant_id"`             // Owning tenant, if any
+	PythonVersion      string          `json:"python_version"`        // Requested interpreter (e.g. "3.11"), empty for default image
+	InterpreterVersion *string         `json:"interpreter_version"`   // Interpreter version the task actually ran with
+	CPUSeconds         *float64        `json:"cpu_seconds"`           // CPU time consumed by the execution
+	PeakMemoryBytes    *int64          `json:"peak_memory_bytes"`     // Peak memory observed during the execution
+	Attempts           int             `json:"attempts"`              // Times the task was recovered from a dead worker
+	MaxAttempts        int             `json:"max_attempts"`          // Recoveries allowed before the task is abandoned
+	FirstStartedAt     *time.Time      `json:"first_started_at"`      // When the first attempt started, used to cap retry age
+	PolicyVersion      *string         `json:"policy_version"`        // Policy bundle in force for the last attempt
+	RetryPolicy        *string         `json:"retry_policy"`          // Execution retry policy overriding the worker default
+	Deadline           *time.Time      `json:"deadline"`              // When the task should be done by, for deadline-first claiming
+	WebhookURL         *string         `json:"webhook_url"`           // Receives an event when the task completes, fails or is flagged malicious
+	Annotations        json.RawMessage `json:"annotations,omitempty"` // Key/values the script attached to its task
+	Result             json.RawMessage `json:"result,omitempty"`      // Result decoded from the format its code declares, as JSON
+	ExitCode           *int            `json:"exit_code"`             // Exit status of the last execution, nil if the script never finished
+	RunAt              *time.Time      `json:"run_at"`                // Not claimed before this time: scheduled by the submitter or requeued by a rate limit
+	Queue              *string         `json:"queue"`                 // Queue whose defaults apply to the settings below left nil
+	TimeoutSeconds     *float64        `json:"timeout_seconds"`       // Bounds the execution, retries included
+	StaleAfterSeconds  *float64        `json:"stale_after_seconds"`   // Heartbeat gap of its worker after which the task is recovered
+	MemoryMB           *int64          `json:"memory_mb"`             // Memory limit of the sandbox container
+	CPULimit           *float64        `json:"cpu_limit"`             // Fractional CPU limit of the sandbox container
+	BandwidthKbps      *int64          `json:"bandwidth_kbps"`        // Network limit of the sandbox container each way, in kbit/s
+	Isolation          *string         `json:"isolation"`             // "strict" hardens the sandbox beyond the worker's profile
+	Network            *string         `json:"network"`               // "none" runs the script without a network, "allowlist" behind the egress proxy
+	EgressAllowlist    []string        `json:"egress_allowlist"`      // Hosts reachable with the allowlist network policy
+	GPURequired        bool            `json:"gpu_required"`          // Only claimed by workers with CONTAINER_GPU=all
+	Timezone           *string         `json:"timezone"`              // TZ of the script, overriding SANDBOX_TZ
+	Locale             *string         `json:"locale"`                // LANG/LC_ALL of the script, overriding SANDBOX_LOCALE
+	Ulimits            []string        `json:"ulimits"`               // "name=value" soft ulimits over SANDBOX_EXEC_ULIMITS
+	BatchID            *string         `json:"batch_id"`              // The batch the task was submitted in, see POST /batches
+	PreferredRegion    *string         `json:"preferred_region"`      // Region whose workers claim the task first
+	Receipt            json.RawMessage `json:"receipt,omitempty"`     // Signed execution receipt of a completed task
+}
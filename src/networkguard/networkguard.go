@@ -0,0 +1,195 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package networkguard enforces the egress rules of the sandbox networks on
+// the host rather than in each container. A privileged helper container in
+// the host's network and PID namespaces installs an nftables table dropping
+// the traffic of the sandbox bridge to the blocked ranges and redirecting
+// the HTTP(S) traffic of the egress bridge to the proxy, and runs tc in the
+// namespace of containers whose bandwidth is limited. Sandbox containers
+// then need neither iptables nor NET_ADMIN.
+package networkguard
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+const (
+	// helperName is the helper container, shared by the workers of a daemon
+	helperName = "continuum-network-guard"
+	// table holds every rule of the guard, replaced as a whole
+	table = "continuum_guard"
+)
+
+// tools installs what the helper needs when its image lacks it
+const tools = "{ command -v nft && command -v tc && command -v nsenter; } >/dev/null 2>&1 || " +
+	"apk add --no-cache -q nftables iproute2 util-linux-misc >/dev/null 2>&1 || " +
+	"(apt-get update -qq && apt-get install -qq -y nftables iproute2 util-linux) >/dev/null 2>&1; " +
+	"command -v nft && command -v tc && command -v nsenter"
+
+// Guard runs commands with the host's network privileges in the helper
+type Guard struct {
+	cli      *client.Client
+	helperID string
+}
+
+// Start makes sure the helper container runs and installs the rules of the
+// sandbox network and, when an egress proxy serves at proxyAddr ("" for
+// none), of the egress network. The rules replace those of an earlier start
+// atomically, and are left in place when the worker stops since its sandbox
+// containers may outlive it.
+func Start(ctx context.Context, cli *client.Client, cfg config.Container, sandboxNetworkID, proxyAddr string) (*Guard, error) {
+	helperID, err := helper(ctx, cli, cfg.GuardImage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the network guard helper: %w", err)
+	}
+	g := &Guard{cli: cli, helperID: helperID}
+	if _, stderr, exitCode, err := containerization.Exec(ctx, cli, helperID, "", []string{"sh", "-c", tools}); err != nil || exitCode != 0 {
+		return nil, fmt.Errorf("network guard helper lacks nft, tc or nsenter (exit %d): %v %s", exitCode, err, strings.TrimSpace(stderr))
+	}
+
+	sandboxBridge, err := bridgeName(ctx, cli, sandboxNetworkID)
+	if err != nil {
+		return nil, err
+	}
+	egressBridge := ""
+	if proxyAddr != "" {
+		egressID, _, err := containerization.EnsureEgressNetwork(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		if egressBridge, err = bridgeName(ctx, cli, egressID); err != nil {
+			return nil, err
+		}
+	}
+
+	allowed, blocked := containerization.EgressRanges()
+	rules := ruleset(sandboxBridge, egressBridge, proxyAddr, allowed, blocked)
+	_, stderr, exitCode, err := containerization.Exec(ctx, cli, helperID, "", []string{"sh", "-c", `printf '%s' "$1" | nft -f -`, "sh", rules})
+	if err != nil || exitCode != 0 {
+		return nil, fmt.Errorf("failed to install the host rules, set NETWORK_GUARD=container to filter in each container instead (exit %d): %v %s",
+			exitCode, err, strings.TrimSpace(stderr))
+	}
+	logging.Log(ctx, fmt.Sprintf("Network guard rules installed on %s", strings.TrimSpace(sandboxBridge+" "+egressBridge)), slog.LevelInfo)
+	return g, nil
+}
+
+// ExecInNetns runs script in the network namespace of the container, entered
+// from the helper, so the container itself needs no network privileges
+func (g *Guard) ExecInNetns(ctx context.Context, containerID, script string) (string, error) {
+	inspect, err := g.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+	if inspect.State == nil || inspect.State.Pid == 0 {
+		return "", fmt.Errorf("container %s is not running", containerID[:12])
+	}
+	stdout, stderr, exitCode, err := containerization.Exec(ctx, g.cli, g.helperID, "",
+		[]string{"nsenter", "-t", strconv.Itoa(inspect.State.Pid), "-n", "sh", "-c", script})
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return stdout, fmt.Errorf("exit %d: %s", exitCode, strings.TrimSpace(stderr))
+	}
+	return stdout, nil
+}
+
+// helper returns the running helper container, creating it on first use
+func helper(ctx context.Context, cli *client.Client, imageName string) (string, error) {
+	inspect, err := cli.ContainerInspect(ctx, helperName)
+	switch {
+	case err == nil && inspect.State != nil && inspect.State.Running:
+		return inspect.ID, nil
+	case err == nil:
+		return inspect.ID, cli.ContainerStart(ctx, inspect.ID, container.StartOptions{})
+	case !client.IsErrNotFound(err):
+		return "", err
+	}
+
+	if err := containerization.EnsureImage(ctx, cli, imageName); err != nil {
+		return "", err
+	}
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:  imageName,
+		Cmd:    []string{"sleep", "infinity"},
+		Labels: map[string]string{"continuum.role": "network-guard"},
+	}, &container.HostConfig{
+		NetworkMode:   "host",
+		PidMode:       "host",
+		Privileged:    true,
+		RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyUnlessStopped},
+	}, nil, nil, helperName)
+	if errdefs.IsConflict(err) {
+		// Another worker of the daemon created it meanwhile
+		return helper(ctx, cli, imageName)
+	}
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, cli.ContainerStart(ctx, resp.ID, container.StartOptions{})
+}
+
+// bridgeName returns the host interface of a bridge network
+func bridgeName(ctx context.Context, cli *client.Client, networkID string) (string, error) {
+	inspect, err := cli.NetworkInspect(ctx, networkID, network.InspectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect network %s: %w", networkID, err)
+	}
+	if name := inspect.Options["com.docker.network.bridge.name"]; name != "" {
+		return name, nil
+	}
+	return "br-" + inspect.ID[:12], nil
+}
+
+// ruleset returns the nftables script replacing the guard's table. Traffic
+// of the sandbox bridge is filtered both to the host (input) and through it
+// (forward, which also sees bridged traffic between containers); accepting
+// the allowed ranges first only ends this table, Docker's own rules still
+// apply.
+func ruleset(sandboxBridge, egressBridge, proxyAddr string, allowed, blocked []string) string {
+	var b strings.Builder
+	// Declaring the table first lets the delete succeed on a fresh host
+	fmt.Fprintf(&b, "table inet %s\ndelete table inet %[1]s\ntable inet %[1]s {\n", table)
+	for _, hook := range []string{"input", "forward"} {
+		fmt.Fprintf(&b, "\tchain %s {\n\t\ttype filter hook %[1]s priority filter - 1; policy accept;\n", hook)
+		if len(allowed) > 0 {
+			fmt.Fprintf(&b, "\t\tiifname %q ip daddr { %s } accept\n", sandboxBridge, strings.Join(allowed, ", "))
+		}
+		if len(blocked) > 0 {
+			fmt.Fprintf(&b, "\t\tiifname %q ip daddr { %s } drop\n", sandboxBridge, strings.Join(blocked, ", "))
+		}
+		b.WriteString("\t}\n")
+	}
+	if egressBridge != "" {
+		// Clients ignoring HTTP_PROXY are sent to the proxy too
+		host, _, _ := net.SplitHostPort(proxyAddr)
+		b.WriteString("\tchain prerouting {\n\t\ttype nat hook prerouting priority dstnat - 1; policy accept;\n")
+		fmt.Fprintf(&b, "\t\tiifname %q ip daddr != %s tcp dport { 80, 443 } dnat ip to %s\n", egressBridge, host, proxyAddr)
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
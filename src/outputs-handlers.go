@@ -0,0 +1,98 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RichOutput describes a stored rich output without its payload
+type RichOutput struct {
+	Seq       int       `json:"seq"`
+	MIMEType  string    `json:"mime_type"`
+	Name      *string   `json:"name,omitempty"`
+	Size      int       `json:"size"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// taskOutputsHandler lists the rich outputs of a task
+func (s *APIServer) taskOutputsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT seq, mime_type, name, LENGTH(data), created_at
+		FROM TASK_OUTPUTS
+		WHERE task_id = $1
+		ORDER BY seq`, taskID)
+	if err != nil {
+		http.Error(w, "Failed to query task outputs", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	outputs := []RichOutput{}
+	for rows.Next() {
+		var out RichOutput
+		if err := rows.Scan(&out.Seq, &out.MIMEType, &out.Name, &out.Size, &out.CreatedAt); err != nil {
+			http.Error(w, "Failed to read task outputs", http.StatusInternalServerError)
+			return
+		}
+		out.URL = fmt.Sprintf("/tasks/%d/outputs/%d", taskID, out.Seq)
+		outputs = append(outputs, out)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(outputs)
+}
+
+// taskOutputHandler serves a single rich output with its own content type so
+// browsers and dashboards can render it directly
+func (s *APIServer) taskOutputHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+	seq, err := strconv.Atoi(r.PathValue("seq"))
+	if err != nil {
+		http.Error(w, "Invalid output sequence", http.StatusBadRequest)
+		return
+	}
+
+	var mimeType string
+	var data []byte
+	err = s.db.QueryRowContext(r.Context(),
+		"SELECT mime_type, data FROM TASK_OUTPUTS WHERE task_id = $1 AND seq = $2", taskID, seq).Scan(&mimeType, &data)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query task output", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Script-produced HTML/SVG is untrusted: render it in a sandboxed origin
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package pgdb opens the Postgres pool shared by the worker, the API server
+// and continuumctl. Connections go through pgx's database/sql driver, which
+// caches prepared statements per connection unless disabled.
+package pgdb
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"continuumworker/src/config"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Open returns a pool on the configured database, sized and recycled
+// according to cfg. Connections are opened lazily.
+func Open(cfg config.Database) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	// Poolers in transaction mode (e.g. PgBouncer) can't keep prepared
+	// statements across transactions
+	if !cfg.StatementCache {
+		connConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+
+	db := stdlib.OpenDB(*connConfig)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
+}
+
+// typeMaps holds the pgtype maps used to scan arrays; a map caches scan
+// plans and must not be shared by concurrent scans
+var typeMaps = sync.Pool{New: func() any { return pgtype.NewMap() }}
+
+type arrayScanner struct {
+	dest any
+}
+
+// Array scans a Postgres array into dest, a pointer to a slice such as
+// *[]int64 or *[]string. A NULL array leaves a nil slice. Slices passed as
+// query arguments need no wrapping.
+func Array(dest any) sql.Scanner {
+	return arrayScanner{dest: dest}
+}
+
+func (a arrayScanner) Scan(src any) error {
+	m := typeMaps.Get().(*pgtype.Map)
+	defer typeMaps.Put(m)
+	return m.SQLScanner(a.dest).Scan(src)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"continuumworker/src/analysis"
+	"continuumworker/src/containerization"
+	"continuumworker/src/policy"
+	"continuumworker/src/receipts"
+)
+
+// PolicyResponse is the effective security posture of this worker
+type PolicyResponse struct {
+	WorkerID string                  `json:"worker_id"`
+	Sandbox  containerization.Policy `json:"sandbox"`
+	Analysis AnalysisPolicy          `json:"analysis"`
+	Bundle   *policy.Info            `json:"bundle"`   // nil without POLICY_BUNDLE
+	Receipts *ReceiptPolicy          `json:"receipts"` // nil without RECEIPT_SIGNING_KEY
+}
+
+// ReceiptPolicy is the key this worker signs its task receipts with
+type ReceiptPolicy struct {
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+}
+
+// AnalysisPolicy describes the pre-execution code analysis in force
+type AnalysisPolicy struct {
+	RuleSetVersion string                  `json:"rule_set_version"`
+	Analyzers      []analysis.AnalyzerInfo `json:"analyzers"`
+}
+
+// policyHandler lets auditors verify a node's sandbox and analysis settings
+// without access to the host environment
+func (s *APIServer) policyHandler(w http.ResponseWriter, r *http.Request) {
+	sandbox, err := containerization.EffectivePolicy()
+	if err != nil {
+		http.Error(w, "Failed to resolve sandbox policy", http.StatusInternalServerError)
+		return
+	}
+	engine, err := analysis.Default()
+	if err != nil {
+		http.Error(w, "Failed to resolve analysis policy", http.StatusInternalServerError)
+		return
+	}
+
+	resp := PolicyResponse{
+		WorkerID: s.stats.Snapshot().ID,
+		Sandbox:  sandbox,
+		Bundle:   policy.Loaded(),
+		Analysis: AnalysisPolicy{
+			RuleSetVersion: engine.RuleSetVersion(),
+			Analyzers:      engine.Describe(),
+		},
+	}
+
+	if signer := receipts.Default(); signer != nil {
+		resp.Receipts = &ReceiptPolicy{KeyID: signer.KeyID(), PublicKey: signer.PublicKey()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package policy loads signed, versioned policy bundles that package the
+// analyzer rules, network allowlists and sandbox settings of a fleet
+package policy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"continuumworker/src/analysis"
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+)
+
+// ErrUnsigned is returned when strict mode requires a signature that the
+// bundle does not have
+var ErrUnsigned = errors.New("policy bundle is not signed")
+
+// errNotFound marks a missing remote file, like os.ErrNotExist for paths
+var errNotFound = errors.New("not found")
+
+// Bundle is the on-disk format of a policy bundle
+type Bundle struct {
+	Version       string        `json:"version"`
+	AnalyzerRules []BundleRule  `json:"analyzer_rules"`
+	Network       BundleNetwork `json:"network"`
+	Sandbox       BundleSandbox `json:"sandbox"`
+}
+
+// BundleRule is a named regex denylist rule. Severity is "block" (default)
+// or "warn".
+type BundleRule struct {
+	Name     string `json:"name"`
+	Pattern  string `json:"pattern"`
+	Severity string `json:"severity"`
+}
+
+// BundleNetwork lists egress ranges; nil keeps the worker defaults
+type BundleNetwork struct {
+	BlockedEgress []string `json:"blocked_egress"`
+	AllowedEgress []string `json:"allowed_egress"`
+}
+
+// BundleSandbox overrides the sandbox profile and resource limits
+type BundleSandbox struct {
+	Profile  string  `json:"profile"`
+	MemoryMB int64   `json:"memory_mb"`
+	CPULimit float64 `json:"cpu_limit"`
+}
+
+// Info describes the loaded bundle for /policy and the TASKS table
+type Info struct {
+	Version string `json:"version"`
+	Signed  bool   `json:"signed"`
+	Source  string `json:"source"`
+}
+
+var loaded *Info
+
+// Load reads the configured bundle (a file path or http(s) URL), verifies its
+// signature and installs it. It is a no-op when no bundle is configured and
+// must run before the sandbox profile and analysis engine are built.
+//
+// The signature is a base64 ed25519 signature over the raw bundle bytes,
+// read from the signature location (default: the bundle location + ".sig")
+// and checked against the configured public key. An invalid signature is always
+// fatal; a missing one is only accepted outside strict mode.
+func Load(ctx context.Context, cfg *config.Config) (*Info, error) {
+	source := cfg.Policy.Bundle
+	if source == "" {
+		return nil, nil
+	}
+
+	raw, err := Fetch(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy bundle: %w", err)
+	}
+	var b Bundle
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse policy bundle: %w", err)
+	}
+	if b.Version == "" {
+		return nil, fmt.Errorf("policy bundle %s has no version", source)
+	}
+
+	signed, err := verify(ctx, cfg.Policy, source, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !signed {
+		if strictMode(cfg, b) {
+			return nil, fmt.Errorf("%w: strict mode refuses %s", ErrUnsigned, source)
+		}
+		logging.Log(ctx, fmt.Sprintf("Policy bundle %s is unsigned, accepting outside strict mode", b.Version), slog.LevelWarn)
+	}
+
+	rules := make([]analysis.Rule, 0, len(b.AnalyzerRules))
+	for _, r := range b.AnalyzerRules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid analyzer rule %q in policy bundle: %w", r.Name, err)
+		}
+		var warn bool
+		switch r.Severity {
+		case "", "block":
+		case "warn":
+			warn = true
+		default:
+			return nil, fmt.Errorf("invalid severity %q for analyzer rule %q in policy bundle", r.Severity, r.Name)
+		}
+		rules = append(rules, analysis.Rule{Name: r.Name, Pattern: re, Warn: warn})
+	}
+	if len(rules) > 0 {
+		analysis.UseRules(rules)
+	}
+	containerization.ApplyPolicyOverrides(containerization.PolicyOverrides{
+		Profile:       b.Sandbox.Profile,
+		BlockedEgress: b.Network.BlockedEgress,
+		AllowedEgress: b.Network.AllowedEgress,
+		MemoryMB:      b.Sandbox.MemoryMB,
+		CPULimit:      b.Sandbox.CPULimit,
+	})
+
+	loaded = &Info{Version: b.Version, Signed: signed, Source: source}
+	logging.Log(ctx, fmt.Sprintf("Loaded policy bundle %s (signed: %t)", b.Version, signed), slog.LevelInfo)
+	return loaded, nil
+}
+
+// Loaded returns the installed bundle, or nil when none is configured
+func Loaded() *Info {
+	return loaded
+}
+
+// Version returns the installed bundle version, or "" without a bundle
+func Version() string {
+	if loaded == nil {
+		return ""
+	}
+	return loaded.Version
+}
+
+// verify reports whether the bundle carries a valid signature
+func verify(ctx context.Context, c config.Policy, source string, raw []byte) (bool, error) {
+	sigSource := c.Signature
+	if sigSource == "" {
+		sigSource = source + ".sig"
+	}
+	sigText, err := Fetch(ctx, sigSource)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, errNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read policy bundle signature: %w", err)
+	}
+
+	keyText := c.PublicKey
+	if keyText == "" {
+		return false, errors.New("policy bundle is signed but POLICY_PUBLIC_KEY is not set")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(keyText))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return false, errors.New("POLICY_PUBLIC_KEY is not a base64 ed25519 public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigText)))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode policy bundle signature: %w", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), raw, sig) {
+		return false, fmt.Errorf("policy bundle %s has an invalid signature", source)
+	}
+	return true, nil
+}
+
+// strictMode is on for the strict sandbox profile or when signatures are required
+func strictMode(cfg *config.Config, b Bundle) bool {
+	return strings.EqualFold(cfg.Container.Profile, "strict") ||
+		strings.EqualFold(b.Sandbox.Profile, "strict") ||
+		cfg.Policy.RequireSigned
+}
+
+// Fetch reads a local file or an http(s) URL of at most 1 MiB
+func Fetch(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", source, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: unexpected status %s", source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
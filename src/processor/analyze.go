@@ -0,0 +1,51 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"encoding/json"
+
+	"continuumworker/src/analysis"
+)
+
+// analysisReport is the output of an analysis-only task: the verdict of the
+// code analysis and the rules it was reached with
+type analysisReport struct {
+	Malicious      bool                    `json:"malicious"`
+	Reasons        []string                `json:"reasons"`
+	Warnings       []string                `json:"warnings"`
+	RuleSetVersion string                  `json:"rule_set_version"`
+	Analyzers      []analysis.AnalyzerInfo `json:"analyzers"`
+}
+
+// analysisOutput formats a verdict as the output of an analysis-only task
+func analysisOutput(verdict analysis.Verdict) (string, error) {
+	engine, err := analysis.Default()
+	if err != nil {
+		return "", err
+	}
+	report := analysisReport{
+		Malicious:      verdict.Malicious,
+		Reasons:        verdict.Reasons,
+		Warnings:       verdict.Warnings,
+		RuleSetVersion: engine.RuleSetVersion(),
+		Analyzers:      engine.Describe(),
+	}
+	if report.Reasons == nil {
+		report.Reasons = []string{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []string{}
+	}
+	out, err := json.Marshal(report)
+	return string(out), err
+}
@@ -0,0 +1,479 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"continuumworker/src/analysis"
+	"continuumworker/src/codestore"
+	"continuumworker/src/compression"
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/dbwrite"
+	"continuumworker/src/logging"
+	"continuumworker/src/model"
+	"continuumworker/src/pgdb"
+	"continuumworker/src/policy"
+	"continuumworker/src/results"
+	"continuumworker/src/schema"
+	"continuumworker/src/stats"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// outageRetryDelay is how long a task waits before it is claimed again when
+// a service its claim needs, e.g. the analyzer or secrets provider, failed
+const outageRetryDelay = 30 * time.Second
+
+// claimedTask is a task this worker marked as running, waiting for execution
+type claimedTask struct {
+	task      *model.Task
+	imageName string
+	// env are the script's NAME=value pairs, secrets included; secrets are
+	// the resolved values, redacted from what is persisted
+	env     []string
+	secrets []string
+	// settings are the task's own, queue or worker settings
+	settings taskSettings
+	// traceReasons flag the task as suspicious, see traceReasons
+	traceReasons []string
+	// result is the format the code declares for its stdout
+	result results.Contract
+	// warmup is the warm-up snippet of the code, "" for none
+	warmup string
+	// ctx carries the task's root span, which the executor ends
+	ctx       context.Context
+	span      trace.Span
+	claimSpan trace.Span
+}
+
+// end closes the task's root span with its final status
+func (c *claimedTask) end() {
+	c.span.SetAttributes(attribute.String("task.status", string(c.task.Status)))
+	c.span.End()
+}
+
+// claimTasks locks up to cfg.ClaimBatchSize pending tasks in a single
+// transaction. Tasks rejected by code analysis or asking for an unsupported
+// interpreter are finished right away, as are analysis-only tasks once their
+// code is analyzed; the others are marked running and
+// returned in priority order. On any database error nothing is claimed.
+func claimTasks(ctx context.Context, db *sql.DB, cfg config.Worker, workerID string, workerstats *stats.WorkerStats) []*claimedTask {
+	claimStart := time.Now()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error starting transaction: %v", err), slog.LevelError)
+		return nil
+	}
+	defer tx.Rollback()
+
+	strategy, err := StrategyByName(cfg.ClaimStrategy)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error claiming tasks: %v", err), slog.LevelError)
+		return nil
+	}
+	order, orderArgs := strategy.Order(11)
+
+	query := `
+		SELECT t.id, t.name, t.description, t.created_at, t.started, t.finished, t.locked_at, t.last_error, t.status, COALESCE(t.payload::TEXT, ''), COALESCE(cv.code, ''), t.depends_on,
+			COALESCE(t.python_version, ''), t.tenant_id, t.retry_policy::TEXT, COALESCE(cv.json_schema::TEXT, ''),
+			COALESCE(cv.object_uri, ''), COALESCE(cv.sha256, ''), c.id::TEXT, t.payload_zstd, cv.code_zstd, t.task_type, cv.version,
+			COALESCE(cv.result_format, ''), COALESCE(cv.result_schema, ''), t.preferred_region, COALESCE(c.warmup, ''), ` + queueColumns + `
+		FROM TASKS t
+		JOIN CODES c ON c.id = t.code
+		-- The pinned version, else the latest one
+		JOIN CODE_CONTENTS cv ON cv.code_id = c.id AND cv.version = COALESCE(t.code_version, c.current_version)
+		LEFT JOIN QUEUES q ON q.name = t.queue
+		WHERE t.STATUS = 'pending' 
+		AND t.LOCKED_AT IS NULL
+		AND (t.RUN_AT IS NULL OR t.RUN_AT <= NOW())
+		AND ($1 = 0 OR t.priority >= $1)
+		AND ($2 = 0 OR t.priority <= $2)
+		AND (COALESCE(CARDINALITY($4::TEXT[]), 0) = 0 OR t.queue = ANY($4))
+		-- Only GPU workers claim tasks requiring a GPU
+		AND (NOT t.gpu_required OR $5)
+		-- Nor tasks asking for more memory or CPU than this worker allows
+		AND ($6 = 0 OR COALESCE(t.memory_mb, q.memory_mb, 0) <= $6)
+		AND ($7::DOUBLE PRECISION = 0 OR COALESCE(t.cpu_limit, q.cpu_limit, 0) <= $7)
+		-- Only workers running an egress proxy claim allowlist tasks
+		AND (COALESCE(t.network, q.network, '') <> 'allowlist' OR $8)
+		-- Workers of the preferred region claim the task first, the others
+		-- once it has waited CROSS_REGION_WAIT
+		AND (t.preferred_region IS NULL OR t.preferred_region = $9
+			OR COALESCE(t.run_at, t.created_at) <= NOW() - $10 * INTERVAL '1 second')
+		-- Only claim tasks whose dependencies have all completed, archived
+		-- or not; a dependency found in neither table never is
+		AND NOT EXISTS (
+			SELECT 1 FROM UNNEST(t.depends_on) AS d(id)
+			WHERE NOT EXISTS (SELECT 1 FROM TASKS dep WHERE dep.id = d.id AND dep.status = 'completed')
+			AND NOT EXISTS (SELECT 1 FROM TASKS_ARCHIVE a WHERE a.id = d.id AND a.status = 'completed')
+		)
+		ORDER BY ` + order + `
+		LIMIT $3
+		FOR UPDATE OF t SKIP LOCKED
+	`
+
+	maxMemoryMB, maxCPULimit := containerization.MaxResources()
+	args := append([]any{cfg.MinPriority, cfg.MaxPriority, cfg.ClaimBatchSize, cfg.Queues, containerization.GPUEnabled(), maxMemoryMB, maxCPULimit,
+		containerization.EgressProxyEnabled(), cfg.Region, cfg.CrossRegionWait.Seconds()}, orderArgs...)
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error querying task: %v\n", err), slog.LevelError)
+		return nil
+	}
+	var tasks []*model.Task
+	var schemas []string // JSON Schema of each task's code, "" if none
+	var refs []codestore.Ref
+	var codeIDs []string
+	var contracts []results.Contract
+	var warmups []string
+	var settings []taskSettings
+	var packedPayloads, packedCodes [][]byte // zstd-compressed payload and code, nil when stored as is
+	for rows.Next() {
+		task := &model.Task{}
+		var schema, codeID string
+		var ref codestore.Ref
+		var contract results.Contract
+		var warmup string
+		var s taskSettings
+		var packedPayload, packedCode []byte
+		dest := []any{&task.ID, &task.Name, &task.Description, &task.CreatedAt, &task.Started, &task.Finished,
+			&task.LockedAt, &task.LastError, &task.Status, &task.Payload, &task.Code, pgdb.Array(&task.DependsOn),
+			&task.PythonVersion, &task.TenantID, &task.RetryPolicy, &schema, &ref.ObjectURI, &ref.SHA256, &codeID, &packedPayload, &packedCode, &task.Type, &task.CodeVersion,
+			&contract.Format, &contract.Schema, &task.PreferredRegion, &warmup}
+		if err := rows.Scan(append(dest, s.dest()...)...); err != nil {
+			rows.Close()
+			logging.Log(ctx, fmt.Sprintf("Error querying task: %v\n", err), slog.LevelError)
+			return nil
+		}
+		tasks = append(tasks, task)
+		schemas = append(schemas, schema)
+		refs = append(refs, ref)
+		codeIDs = append(codeIDs, codeID)
+		contracts = append(contracts, contract)
+		warmups = append(warmups, warmup)
+		settings = append(settings, s)
+		packedPayloads = append(packedPayloads, packedPayload)
+		packedCodes = append(packedCodes, packedCode)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error querying task: %v\n", err), slog.LevelError)
+		return nil
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	// Trace each task from the start of the claim; polls that find nothing
+	// are not traced. Each phase is a child span.
+	var all, claimed, rejected, analyzed []*claimedTask
+	committed := false
+	defer func() {
+		for _, c := range all {
+			c.claimSpan.End()
+			// Claimed tasks are ended by the executor
+			if !committed || c.task.Status != model.TaskRunning {
+				c.end()
+			}
+		}
+	}()
+	// reject finishes a task that must not run with the given status and code
+	reject := func(c *claimedTask, claimCtx context.Context, status model.TaskStatus, code model.ErrorCode, reason string) error {
+		c.task.Status = status
+		_, err := tx.ExecContext(claimCtx, "UPDATE TASKS SET STATUS = $1, FINISHED = NOW(), LAST_ERROR = $2, ERROR_CODE = $4 WHERE ID = $3",
+			status, reason, c.task.ID, code)
+		if err != nil {
+			logging.Log(c.ctx, fmt.Sprintf("Error updating task status to %s: %v\n", status, err), slog.LevelError)
+			recordDatabaseFailure(c.ctx, workerstats)
+			return err
+		}
+		rejected = append(rejected, c)
+		return nil
+	}
+	// postpone leaves a task that can't be checked now pending until delay has
+	// passed, without counting an attempt
+	postpone := func(c *claimedTask, claimCtx context.Context, delay time.Duration, code model.ErrorCode, reason string) error {
+		_, err := tx.ExecContext(claimCtx, "UPDATE TASKS SET RUN_AT = NOW() + $1 * INTERVAL '1 second', LAST_ERROR = $2, ERROR_CODE = $3 WHERE ID = $4",
+			delay.Seconds(), reason, code, c.task.ID)
+		if err != nil {
+			logging.Log(c.ctx, fmt.Sprintf("Error requeuing task %d: %v\n", c.task.ID, err), slog.LevelError)
+			recordDatabaseFailure(c.ctx, workerstats)
+			return err
+		}
+		logging.Log(c.ctx, fmt.Sprintf("Task %d requeued for %s: %s\n", c.task.ID, delay, reason), slog.LevelWarn)
+		return nil
+	}
+	// complete finishes an analysis-only task with the verdict as its output
+	complete := func(c *claimedTask, claimCtx context.Context, verdict analysis.Verdict) error {
+		output, err := analysisOutput(verdict)
+		if err != nil {
+			logging.Log(c.ctx, fmt.Sprintf("Error formatting the analysis of task %d: %v\n", c.task.ID, err), slog.LevelError)
+			return err
+		}
+		storedOutput, packedOutput := compression.Pack(output, cfg.Limits.CompressAboveBytes)
+		c.task.Status = model.TaskCompleted
+		_, err = tx.ExecContext(claimCtx, `UPDATE TASKS SET STATUS = $1, STARTED = NOW(), FINISHED = NOW(), FIRST_STARTED_AT = COALESCE(FIRST_STARTED_AT, NOW()),
+			WORKER_ID = $2, POLICY_VERSION = NULLIF($3, ''), OUTPUT = $4, OUTPUT_ZSTD = $5, LAST_ERROR = NULL, ERROR_CODE = NULL, CODE_VERSION = $7 WHERE ID = $6`,
+			c.task.Status, workerID, policy.Version(), storedOutput, packedOutput, c.task.ID, c.task.CodeVersion)
+		if err != nil {
+			logging.Log(c.ctx, fmt.Sprintf("Error updating task status to %s: %v\n", c.task.Status, err), slog.LevelError)
+			recordDatabaseFailure(c.ctx, workerstats)
+			return err
+		}
+		analyzed = append(analyzed, c)
+		return nil
+	}
+	for i, task := range tasks {
+		taskCtx, span := logging.StartSpan(ctx, "task", trace.WithTimestamp(claimStart), trace.WithAttributes(
+			attribute.Int("task.id", task.ID),
+			attribute.String("worker.id", workerID),
+		))
+		c := &claimedTask{task: task, settings: settings[i], result: contracts[i], warmup: warmups[i], ctx: taskCtx, span: span}
+		claimCtx, claimSpan := logging.StartSpan(taskCtx, "claim", trace.WithTimestamp(claimStart))
+		c.claimSpan = claimSpan
+		all = append(all, c)
+
+		// Decompress the payload and code stored compressed
+		task.Payload, err = compression.Unpack(task.Payload, packedPayloads[i])
+		if err == nil {
+			task.Code, err = compression.Unpack(task.Code, packedCodes[i])
+		}
+		if err != nil {
+			if reject(c, claimCtx, model.TaskFailed, model.ErrCodeInternal, err.Error()) != nil {
+				return nil
+			}
+			continue
+		}
+
+		// Fetch code kept in object storage. A store outage leaves the task
+		// pending for outageRetryDelay; code that fails its checksum never runs.
+		if refs[i].ObjectURI != "" {
+			fetchCtx, fetchSpan := logging.StartSpan(claimCtx, "fetch_code")
+			task.Code, err = fetchCode(fetchCtx, refs[i])
+			logging.EndSpan(fetchSpan, err)
+			if err != nil && !errors.Is(err, codestore.ErrChecksumMismatch) {
+				logging.Log(taskCtx, fmt.Sprintf("Error fetching code of task %d: %v\n", task.ID, err), slog.LevelError)
+				if postpone(c, claimCtx, outageRetryDelay, model.ErrCodeInternal, "Code fetch failed: "+err.Error()) != nil {
+					return nil
+				}
+				continue
+			}
+			if err != nil {
+				if reject(c, claimCtx, model.TaskFailed, model.ErrCodeCodeIntegrity, err.Error()) != nil {
+					return nil
+				}
+				continue
+			}
+		}
+
+		// Check if code is malicious
+		analyzeStart := time.Now()
+		analyzeCtx, analyzeSpan := logging.StartSpan(claimCtx, "analyze")
+		verdict, err := analysis.AnalyzeCode(analyzeCtx, task.Code)
+		logging.ObservePhase(claimCtx, "analysis", analyzeStart)
+		analyzeSpan.SetAttributes(attribute.Bool("analysis.malicious", verdict.Malicious))
+		logging.EndSpan(analyzeSpan, err)
+		// An analyzer outage leaves the task pending for a later claim
+		if err != nil {
+			logging.Log(taskCtx, fmt.Sprintf("Error analyzing code of task %d: %v\n", task.ID, err), slog.LevelError)
+			if postpone(c, claimCtx, outageRetryDelay, model.ErrCodeAnalysis, "Code analysis failed: "+err.Error()) != nil {
+				return nil
+			}
+			continue
+		}
+		// Analysis-only tasks end here, whatever the verdict
+		if task.Type == model.TaskAnalyze {
+			if complete(c, claimCtx, verdict) != nil {
+				return nil
+			}
+			continue
+		}
+		if verdict.Malicious {
+			if reject(c, claimCtx, model.TaskMalicious, model.ErrCodeMalicious, verdict.String()) != nil {
+				return nil
+			}
+			logging.Log(taskCtx, fmt.Sprintf("Task %d flagged as malicious: %s\n", task.ID, verdict.String()), slog.LevelWarn)
+			continue
+		}
+		// The code's warm-up runs in the same sandbox, under the same rules
+		if c.warmup != "" {
+			warmupVerdict, err := analysis.AnalyzeCode(claimCtx, c.warmup)
+			if err != nil {
+				logging.Log(taskCtx, fmt.Sprintf("Error analyzing the warm-up of task %d: %v\n", task.ID, err), slog.LevelError)
+				if postpone(c, claimCtx, outageRetryDelay, model.ErrCodeAnalysis, "Warm-up analysis failed: "+err.Error()) != nil {
+					return nil
+				}
+				continue
+			}
+			if warmupVerdict.Malicious {
+				if reject(c, claimCtx, model.TaskMalicious, model.ErrCodeMalicious, "Warm-up: "+warmupVerdict.String()) != nil {
+					return nil
+				}
+				logging.Log(taskCtx, fmt.Sprintf("Task %d flagged as malicious: warm-up: %s\n", task.ID, warmupVerdict.String()), slog.LevelWarn)
+				continue
+			}
+		}
+
+		// Suspicious tasks still run, under the tracer when one is configured
+		c.traceReasons, err = traceReasons(claimCtx, tx, task.ID, verdict)
+		if err != nil {
+			logging.Log(taskCtx, fmt.Sprintf("Error checking the attempts of task %d: %v\n", task.ID, err), slog.LevelError)
+			recordDatabaseFailure(taskCtx, workerstats)
+			return nil
+		}
+
+		// Resolve the sandbox image (and warm pool) for the requested interpreter,
+		// and reject oversized input or a payload the code's schema doesn't accept
+		c.imageName, err = containerization.ImageForPythonVersion(task.PythonVersion)
+		if err == nil {
+			err = CheckInputLimits(task.Code, task.Payload, cfg.Limits)
+		}
+		if err == nil {
+			err = schema.Validate(schemas[i], task.Payload)
+		}
+		if err == nil {
+			err = containerization.ValidateExecEnvironment(c.settings.environment)
+		}
+		if err != nil {
+			if reject(c, claimCtx, model.TaskFailed, model.ErrCodeInvalidInput, err.Error()) != nil {
+				return nil
+			}
+			continue
+		}
+
+		// Resolve the env map and its secrets. A provider outage leaves the
+		// task pending for outageRetryDelay; a denied variable or an unknown secret fails it.
+		resolveCtx, resolveSpan := logging.StartSpan(claimCtx, "resolve_env")
+		c.env, c.secrets, err = resolveEnv(resolveCtx, task.Payload)
+		logging.EndSpan(resolveSpan, err)
+		if err != nil && !permanentEnvError(err) {
+			logging.Log(taskCtx, fmt.Sprintf("Error resolving secrets of task %d: %v\n", task.ID, err), slog.LevelError)
+			if postpone(c, claimCtx, outageRetryDelay, model.ErrCodeSecret, "Secret resolution failed: "+err.Error()) != nil {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			if reject(c, claimCtx, model.TaskFailed, model.ErrCodeSecret, err.Error()) != nil {
+				return nil
+			}
+			continue
+		}
+
+		// Requeue a task whose code or tenant is over its rate limit for when
+		// a token is available, without counting an attempt
+		scope, wait, err := throttle(claimCtx, tx, cfg.RateLimit, codeIDs[i], task.TenantID)
+		if err == nil && wait > 0 {
+			_, err = tx.ExecContext(claimCtx, "UPDATE TASKS SET RUN_AT = NOW() + $1 * INTERVAL '1 second' WHERE ID = $2", wait.Seconds(), task.ID)
+		}
+		if err != nil {
+			logging.Log(taskCtx, fmt.Sprintf("Error applying rate limits to task %d: %v\n", task.ID, err), slog.LevelError)
+			recordDatabaseFailure(taskCtx, workerstats)
+			return nil
+		}
+		if wait > 0 {
+			logging.Inc(taskCtx, metricTasksThrottled, attribute.String("scope", scope))
+			logging.Log(taskCtx, fmt.Sprintf("Task %d throttled by its %s rate limit, requeued for %s\n", task.ID, scope, wait.Round(time.Millisecond)), slog.LevelInfo)
+			continue
+		}
+
+		claimed = append(claimed, c)
+	}
+
+	// Mark every runnable task as running in one statement, recording the
+	// code version of those asking for the latest
+	if len(claimed) > 0 {
+		ids := make([]int64, len(claimed))
+		versions := make([]int64, len(claimed))
+		for i, c := range claimed {
+			ids[i] = int64(c.task.ID)
+			versions[i] = int64(*c.task.CodeVersion)
+		}
+		now := time.Now()
+		_, err = tx.ExecContext(ctx, `UPDATE TASKS t SET LOCKED_AT = NOW(), WORKER_ID = $1, STARTED = $2, STATUS = $3, FIRST_STARTED_AT = COALESCE(t.FIRST_STARTED_AT, $2),
+			POLICY_VERSION = NULLIF($4, ''), CODE_VERSION = v.version
+			FROM UNNEST($5::BIGINT[], $6::INT[]) AS v(id, version) WHERE t.ID = v.id`,
+			workerID, now, model.TaskRunning, policy.Version(), ids, versions)
+		if err != nil {
+			logging.Log(ctx, fmt.Sprintf("Error updating task status to running: %v\n", err), slog.LevelError)
+			recordDatabaseFailure(ctx, workerstats)
+			return nil
+		}
+		for _, c := range claimed {
+			c.task.Started = &now
+			c.task.Status = model.TaskRunning
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error committing transaction: %v\n", err), slog.LevelError)
+		recordDatabaseFailure(ctx, workerstats)
+		return nil
+	}
+	committed = true
+	logging.ObservePhase(ctx, "claim", claimStart)
+	for _, c := range claimed {
+		recordCrossRegion(c.ctx, c.task, cfg.Region)
+	}
+
+	for _, c := range rejected {
+		recordFailed(c.ctx, c.task.Status)
+		FailDependents(c.ctx, db, c.task.ID, workerstats)
+	}
+	for _, c := range analyzed {
+		logging.Log(c.ctx, fmt.Sprintf("Task %d analyzed without executing\n", c.task.ID), slog.LevelInfo)
+		workerstats.RecordSuccess()
+		logging.Inc(c.ctx, metricTasksSucceeded)
+	}
+	return claimed
+}
+
+// releaseTasks puts claimed tasks that never started executing back in the
+// queue, e.g. when the worker is quarantined halfway through a batch
+func releaseTasks(ctx context.Context, db *sql.DB, workerID string, claimed []*claimedTask, workerstats *stats.WorkerStats) {
+	ids := make([]int64, len(claimed))
+	for i, c := range claimed {
+		ids[i] = int64(c.task.ID)
+	}
+	_, err := dbwrite.Exec(ctx, db, fmt.Sprintf("release of %d tasks", len(claimed)), `UPDATE TASKS SET STATUS = 'pending', LOCKED_AT = NULL, WORKER_ID = NULL,
+		FIRST_STARTED_AT = NULLIF(FIRST_STARTED_AT, STARTED), STARTED = NULL
+		WHERE ID = ANY($1) AND STATUS = 'running' AND WORKER_ID = $2`, ids, workerID)
+	for _, c := range claimed {
+		if err == nil {
+			c.task.Status = model.TaskPending
+		}
+		c.end()
+	}
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error releasing %d claimed tasks: %v\n", len(claimed), err), slog.LevelError)
+		recordDatabaseFailure(ctx, workerstats)
+		return
+	}
+	logging.Log(ctx, fmt.Sprintf("Released %d claimed tasks back to the queue\n", len(claimed)), slog.LevelInfo)
+}
+
+// fetchCode reads code kept in object storage through the configured store
+func fetchCode(ctx context.Context, ref codestore.Ref) (string, error) {
+	store, err := codestore.Default()
+	if err != nil {
+		return "", err
+	}
+	return store.Get(ctx, ref)
+}
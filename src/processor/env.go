@@ -0,0 +1,83 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/livelog"
+	"continuumworker/src/secrets"
+)
+
+const (
+	// redactedSecret replaces secret values in what is persisted or streamed
+	redactedSecret = "[redacted]"
+	// minRedactedLen is the shortest secret value redacted
+	minRedactedLen = 4
+)
+
+// resolveEnv reads the task's env map and resolves its secrets, returning
+// the NAME=value pairs and the secret values
+func resolveEnv(ctx context.Context, payload string) ([]string, []string, error) {
+	vars, err := containerization.EnvFromPayload(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := make([]string, 0, len(vars))
+	var values []string
+	for _, v := range vars {
+		if v.Secret != "" {
+			v.Value, err = secrets.Get(ctx, v.Secret)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to resolve %s: %w", v.Name, err)
+			}
+			values = append(values, v.Value)
+		}
+		env = append(env, v.String())
+	}
+	return env, values, nil
+}
+
+// permanentEnvError reports whether resolving the env can never succeed, as
+// opposed to a provider outage
+func permanentEnvError(err error) bool {
+	return errors.Is(err, containerization.ErrTaskEnv) || errors.Is(err, secrets.ErrNotFound) || errors.Is(err, secrets.ErrNoProvider)
+}
+
+// redact replaces the secret values in s. Very short values are left alone,
+// as they would mangle unrelated text.
+func redact(s string, values []string) string {
+	for _, v := range values {
+		if len(v) >= minRedactedLen {
+			s = strings.ReplaceAll(s, v, redactedSecret)
+		}
+	}
+	return s
+}
+
+// liveWriter streams the output of a task to its live log subscribers with
+// the secret values redacted like in what is persisted. It must be flushed
+// once the execution ends.
+func liveWriter(taskID int, stream string, values []string) *livelog.Writer {
+	var redacted []string
+	for _, v := range values {
+		if len(v) >= minRedactedLen {
+			redacted = append(redacted, v)
+		}
+	}
+	return livelog.Default.RedactingWriter(taskID, stream, redacted, redactedSecret)
+}
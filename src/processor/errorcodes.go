@@ -0,0 +1,56 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"errors"
+	"strings"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/model"
+	"continuumworker/src/results"
+)
+
+// exitOOMKilled is the exit status of a script SIGKILLed by the kernel OOM
+// killer when it exceeds the container memory limit
+const exitOOMKilled = 137
+
+// compileErrors are the exceptions Python raises for code that doesn't compile
+var compileErrors = []string{"SyntaxError", "IndentationError", "TabError"}
+
+// execErrorCode maps a failed execution to its error code. timedOut is set
+// when the task's timeout expired, which surfaces as a script error.
+func execErrorCode(err error, exitCode *int, timedOut bool) model.ErrorCode {
+	switch {
+	case timedOut:
+		return model.ErrCodeTimeout
+	case errors.Is(err, containerization.ErrRequirements):
+		return model.ErrCodeRequirements
+	case errors.Is(err, results.ErrMismatch):
+		return model.ErrCodeResultFormat
+	case errors.Is(err, containerization.ErrScript):
+		if exitCode != nil && *exitCode == exitOOMKilled {
+			return model.ErrCodeOOM
+		}
+		// The exception is the last line of the traceback kept in the error
+		msg := strings.TrimSpace(err.Error())
+		last := msg[strings.LastIndex(msg, "\n")+1:]
+		for _, name := range compileErrors {
+			if strings.Contains(last, name+":") {
+				return model.ErrCodeSyntax
+			}
+		}
+		return model.ErrCodeScript
+	default:
+		return model.ErrCodeInfraDocker
+	}
+}
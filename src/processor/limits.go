@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"continuumworker/src/artifacts"
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+)
+
+const (
+	// OverflowTruncate keeps the start of an oversized output
+	OverflowTruncate = "truncate"
+	// OverflowArtifact also keeps the whole output in the artifact store
+	OverflowArtifact = "artifact"
+)
+
+// Artifacts holding an oversized output or error in full
+const (
+	spilledOutputPath = ".continuum/stdout.txt"
+	spilledErrorPath  = ".continuum/last_error.txt"
+)
+
+// CheckInputLimits rejects code or a payload larger than the limits
+func CheckInputLimits(code, payload string, limits config.Limits) error {
+	if len(code) > limits.CodeBytes {
+		return fmt.Errorf("code is %d bytes, over the %d bytes limit", len(code), limits.CodeBytes)
+	}
+	if len(payload) > limits.PayloadBytes {
+		return fmt.Errorf("payload is %d bytes, over the %d bytes limit", len(payload), limits.PayloadBytes)
+	}
+	return nil
+}
+
+// limitOutput bounds the output stored in TASKS to limits.OutputBytes. An
+// oversized output is truncated with a marker; under the artifact policy it
+// is first stored whole through collector, when one is configured.
+func limitOutput(ctx context.Context, taskID int, output string, limits config.Limits, collector *artifacts.Collector) string {
+	output = storable(output)
+	if len(output) <= limits.OutputBytes {
+		return output
+	}
+
+	spilled := spill(ctx, taskID, "output", spilledOutputPath, output, limits, collector)
+	n := runeStart(output, limits.OutputBytes)
+	if spilled {
+		return output[:n] + fmt.Sprintf("\n[output truncated: %d of %d bytes kept, full output in artifact %s]", n, len(output), spilledOutputPath)
+	}
+	return output[:n] + fmt.Sprintf("\n[output truncated: %d of %d bytes kept]", n, len(output))
+}
+
+// limitError bounds the error stored in LAST_ERROR to limits.ErrorBytes. The
+// start and the end of an oversized error are kept, since a traceback ends
+// with the exception; the middle is replaced by a marker and, under the
+// artifact policy, the whole error is stored through collector.
+func limitError(ctx context.Context, taskID int, msg string, limits config.Limits, collector *artifacts.Collector) string {
+	msg = storable(msg)
+	if len(msg) <= limits.ErrorBytes {
+		return msg
+	}
+
+	spilled := spill(ctx, taskID, "error", spilledErrorPath, msg, limits, collector)
+	head := runeStart(msg, limits.ErrorBytes/2)
+	tail := runeStart(msg, len(msg)-limits.ErrorBytes/2)
+	marker := fmt.Sprintf("\n[error truncated: %d bytes omitted]\n", tail-head)
+	if spilled {
+		marker = fmt.Sprintf("\n[error truncated: %d bytes omitted, full error in artifact %s]\n", tail-head, spilledErrorPath)
+	}
+	return msg[:head] + marker + msg[tail:]
+}
+
+// spill stores an oversized text whole under the artifact policy, and
+// reports whether it was
+func spill(ctx context.Context, taskID int, what, path, text string, limits config.Limits, collector *artifacts.Collector) bool {
+	if limits.OutputOverflow != OverflowArtifact || collector == nil {
+		return false
+	}
+	if err := collector.Store(ctx, path, int64(len(text)), strings.NewReader(text)); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Task %d: failed to store oversized %s as an artifact: %v", taskID, what, err), slog.LevelWarn)
+		return false
+	}
+	return true
+}
+
+// storable makes text acceptable to a Postgres TEXT column, which rejects
+// NUL bytes and invalid UTF-8 and would fail the whole result write
+func storable(text string) string {
+	return strings.ToValidUTF8(strings.ReplaceAll(text, "\x00", ""), "\uFFFD")
+}
+
+// runeStart moves n back to the start of the rune it falls in, so cutting
+// there keeps valid UTF-8
+func runeStart(s string, n int) int {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+	"continuumworker/src/model"
+	"continuumworker/src/stats"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Metrics recorded by the processor
+const (
+	metricTasksTotal       = "worker_tasks_total"
+	metricTasksSucceeded   = "worker_tasks_succeeded"
+	metricTasksFailed      = "worker_tasks_failed"
+	metricTasksRecovered   = "worker_tasks_recovered"
+	metricDatabaseFailures = "worker_database_update_failures"
+	metricTaskCPUSeconds   = "worker_task_cpu_seconds"
+	metricTaskPeakMemory   = "worker_task_peak_memory_bytes"
+	metricTasksInFlight    = "worker_tasks_in_flight"
+	metricQueuePending     = "worker_queue_pending_tasks"
+	metricTasksThrottled   = "worker_tasks_throttled"
+	metricTasksTraced      = "worker_tasks_traced"
+	metricTasksCrossRegion = "worker_tasks_cross_region"
+	metricTasksPrewarmed   = "worker_tasks_prewarmed"
+)
+
+var (
+	// inFlight counts the executions currently running on this worker
+	inFlight atomic.Int64
+	// queueDepth holds the pending task count per priority from the last
+	// sample, see RunQueueSampler
+	queueDepth atomic.Pointer[map[int]int64]
+)
+
+// RegisterMetrics registers the processor metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricTasksTotal, "Number of tasks started by the worker", "Task")
+	logging.InitializeFloatCounter(metricTasksSucceeded, "Number of tasks completed by the worker", "Task")
+	logging.InitializeFloatCounter(metricTasksFailed, "Number of tasks the worker did not complete, by status", "Task")
+	logging.InitializeFloatCounter(metricTasksRecovered, "Number of tasks recovered from dead workers, by resulting status and source", "Task")
+	logging.InitializeFloatCounter(metricTasksThrottled, "Number of claimed tasks requeued by a code or tenant rate limit, by scope", "Task")
+	logging.InitializeFloatCounter(metricTasksTraced, "Number of executions of suspicious tasks run under the tracer, by tracer", "Task")
+	logging.InitializeFloatCounter(metricTasksCrossRegion, "Number of tasks claimed outside their preferred region, by preferred and worker region", "Task")
+	logging.InitializeFloatCounter(metricTasksPrewarmed, "Number of scheduled tasks whose sandbox was prepared ahead of their run_at, by result", "Task")
+	logging.InitializeFloatCounter(metricDatabaseFailures, "Number of database update failures of the worker", "Task")
+	logging.InitializeFloatHistogram(metricTaskCPUSeconds, "CPU time consumed by a task execution", "s")
+	logging.InitializeFloatHistogram(metricTaskPeakMemory, "Peak memory used by a task execution", "By")
+	logging.InitializeFloatHistogram(logging.PhaseDurationMetric, "Time spent in each phase of the task pipeline", "s")
+	logging.InitializeFloatGauge(metricTasksInFlight, "Number of task executions running on the worker", "Task",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			record(float64(inFlight.Load()))
+		})
+	logging.InitializeFloatGauge(metricQueuePending, "Number of pending tasks by priority, as of the last queue sample", "Task",
+		func(ctx context.Context, record logging.GaugeRecorder) {
+			depth := queueDepth.Load()
+			if depth == nil {
+				return
+			}
+			for priority, count := range *depth {
+				record(float64(count), attribute.String("priority", strconv.Itoa(priority)))
+			}
+		})
+}
+
+// RunQueueSampler counts the pending tasks by priority every interval until
+// ctx is cancelled. The gauge reports the last sample, so collections never
+// hit the database.
+func RunQueueSampler(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := sampleQueue(ctx, db); err != nil && ctx.Err() == nil {
+			logging.Log(ctx, fmt.Sprintf("Error sampling queue depth: %v", err), slog.LevelWarn)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sampleQueue(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT COALESCE(priority, 0), COUNT(*) FROM TASKS WHERE STATUS = 'pending' GROUP BY 1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	depth := map[int]int64{}
+	for rows.Next() {
+		var priority int
+		var count int64
+		if err := rows.Scan(&priority, &count); err != nil {
+			return err
+		}
+		depth[priority] += count
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	queueDepth.Store(&depth)
+	return nil
+}
+
+// recordDatabaseFailure counts a failed database update in the worker stats
+// and the metrics
+func recordDatabaseFailure(ctx context.Context, workerstats *stats.WorkerStats) {
+	workerstats.RecordDatabaseFailure()
+	logging.Inc(ctx, metricDatabaseFailures)
+}
+
+// recordFailed counts a task that ended without completing
+func recordFailed(ctx context.Context, status model.TaskStatus) {
+	logging.Inc(ctx, metricTasksFailed, attribute.String("status", string(status)))
+}
+
+// recordUsage exports the resource usage of an execution as OTel metrics
+func recordUsage(ctx context.Context, usage containerization.ResourceUsage) {
+	logging.Observe(ctx, metricTaskCPUSeconds, usage.CPUSeconds)
+	logging.Observe(ctx, metricTaskPeakMemory, float64(usage.PeakMemoryBytes))
+}
+
+// recordCrossRegion counts a claimed task preferring another region than the
+// worker's, claimed after CROSS_REGION_WAIT
+func recordCrossRegion(ctx context.Context, task *model.Task, region string) {
+	if task.PreferredRegion == nil || *task.PreferredRegion == region {
+		return
+	}
+	logging.Log(ctx, fmt.Sprintf("Task %d prefers region %s, running it in region %q\n", task.ID, *task.PreferredRegion, region), slog.LevelInfo)
+	logging.Inc(ctx, metricTasksCrossRegion, attribute.String("preferred_region", *task.PreferredRegion), attribute.String("region", region))
+}
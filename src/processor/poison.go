@@ -0,0 +1,65 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"continuumworker/src/dbwrite"
+	"continuumworker/src/logging"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Outcomes recorded in TASK_ATTEMPTS
+const (
+	attemptCompleted  = "completed"
+	attemptInfraError = "infra_error"
+	attemptWorkerLost = "worker_lost"
+	// attemptRequirementsError is the task's own fault and never counts as damage
+	attemptRequirementsError = "requirements_error"
+	// attemptScriptError is a non-zero exit of the script, also the task's fault
+	attemptScriptError = "script_error"
+)
+
+// recordAttempt appends an execution attempt to the task's history
+func recordAttempt(ctx context.Context, db *sql.DB, taskID int, workerID string, started time.Time, outcome string, errMsg string) {
+	_, err := dbwrite.Exec(ctx, db, fmt.Sprintf("attempt of task %d", taskID), `INSERT INTO TASK_ATTEMPTS (task_id, worker_id, started_at, finished_at, outcome, error)
+		VALUES ($1, $2, $3, NOW(), $4, NULLIF($5, ''))`, taskID, workerID, started, outcome, errMsg)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error recording attempt of task %d: %v\n", taskID, err), slog.LevelError)
+	}
+}
+
+// isPoison reports whether the task's attempt history shows it damaging at
+// least threshold distinct workers (infra errors or lost workers), i.e. the
+// failures follow the payload rather than the node. 0 disables detection.
+func isPoison(ctx context.Context, db *sql.DB, taskID int, threshold int) (bool, int, error) {
+	if threshold <= 0 {
+		return false, 0, nil
+	}
+
+	var workers int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(DISTINCT worker_id) FROM TASK_ATTEMPTS
+		WHERE task_id = $1 AND outcome IN ($2, $3)`, taskID, attemptInfraError, attemptWorkerLost).Scan(&workers)
+	if err != nil {
+		return false, 0, err
+	}
+	return workers >= threshold, workers, nil
+}
+
+// alertPoison raises an alert for a task that was isolated in the held status
+func alertPoison(ctx context.Context, taskID int, workers int) {
+	logging.Log(ctx, fmt.Sprintf("ALERT: task %d held as a poison task after damaging %d workers; release it by setting its status back to 'pending'\n",
+		taskID, workers), slog.LevelError)
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"continuumworker/src/analysis"
+	"continuumworker/src/compression"
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+	"continuumworker/src/model"
+
+	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// prewarmed holds the run_at of the scheduled tasks whose sandbox was
+// prepared, so each is prepared once. Entries go once the task is due.
+var prewarmed = struct {
+	sync.Mutex
+	runAt map[int]time.Time
+}{runAt: map[int]time.Time{}}
+
+// PrewarmScheduled prepares the sandboxes of the pending tasks due within
+// cfg.PrewarmLookahead that this worker may claim, earliest first and at most
+// CLAIM_BATCH_SIZE per pass: their container, virtualenv and warm-up are
+// ready when they are claimed. Tasks whose code or warm-up can't be prepared
+// are skipped; the claim deals with them.
+func PrewarmScheduled(ctx context.Context, db *sql.DB, cli *client.Client, cfg config.Worker, networkID string) {
+	if cfg.PrewarmLookahead <= 0 {
+		return
+	}
+	now := time.Now()
+	prewarmed.Lock()
+	for id, runAt := range prewarmed.runAt {
+		if !runAt.After(now) {
+			delete(prewarmed.runAt, id)
+		}
+	}
+	prewarmed.Unlock()
+
+	args := append(scheduledArgs(cfg), cfg.PrewarmLookahead.Seconds(), cfg.Region, cfg.ClaimBatchSize)
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.id, t.run_at, COALESCE(t.payload::TEXT, ''), t.payload_zstd, COALESCE(t.python_version, ''), t.tenant_id,
+			COALESCE(c.warmup, ''), `+queueColumns+`
+		FROM TASKS t
+		JOIN CODES c ON c.id = t.code
+		LEFT JOIN QUEUES q ON q.name = t.queue
+		WHERE t.status = 'pending'
+		AND t.task_type = 'execute'
+		AND t.run_at > NOW()
+		AND t.run_at <= NOW() + $8 * INTERVAL '1 second'
+		-- Another region's worker is expected to claim the task
+		AND (t.preferred_region IS NULL OR t.preferred_region = $9)`+scheduledFilters+`
+		ORDER BY t.run_at
+		LIMIT $10`, args...)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to look up the tasks to pre-warm: %v", err), slog.LevelWarn)
+		return
+	}
+	type scheduledTask struct {
+		task     model.Task
+		runAt    time.Time
+		packed   []byte
+		warmup   string
+		settings taskSettings
+	}
+	var scheduled []scheduledTask
+	for rows.Next() {
+		var s scheduledTask
+		dest := append([]any{&s.task.ID, &s.runAt, &s.task.Payload, &s.packed, &s.task.PythonVersion, &s.task.TenantID, &s.warmup},
+			s.settings.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			logging.Log(ctx, fmt.Sprintf("Failed to read the tasks to pre-warm: %v", err), slog.LevelWarn)
+			return
+		}
+		scheduled = append(scheduled, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to read the tasks to pre-warm: %v", err), slog.LevelWarn)
+		return
+	}
+
+	for _, s := range scheduled {
+		if ctx.Err() != nil {
+			return
+		}
+		prewarmed.Lock()
+		_, done := prewarmed.runAt[s.task.ID]
+		prewarmed.Unlock()
+		if done {
+			continue
+		}
+		result := prewarmTask(ctx, cli, networkID, &s.task, s.packed, s.warmup, s.settings)
+		logging.Inc(ctx, metricTasksPrewarmed, attribute.String("result", result))
+		// A busy container is tried again on the next pass
+		if result != prewarmBusy {
+			prewarmed.Lock()
+			prewarmed.runAt[s.task.ID] = s.runAt
+			prewarmed.Unlock()
+		}
+	}
+}
+
+// Results of a pre-warm, see metricTasksPrewarmed
+const (
+	prewarmReady   = "ready"
+	prewarmBusy    = "busy"
+	prewarmSkipped = "skipped" // Invalid input, left for the claim to reject
+	prewarmError   = "error"
+)
+
+// prewarmTask prepares the sandbox of one scheduled task and returns the
+// result
+func prewarmTask(ctx context.Context, cli *client.Client, networkID string, task *model.Task, packed []byte, warmup string, settings taskSettings) string {
+	payload, err := compression.Unpack(task.Payload, packed)
+	if err != nil {
+		return prewarmSkipped
+	}
+	imageName, err := containerization.ImageForPythonVersion(task.PythonVersion)
+	if err != nil {
+		return prewarmSkipped
+	}
+	requirements, err := containerization.RequirementsFromPayload(payload)
+	if err != nil {
+		return prewarmSkipped
+	}
+	// The warm-up runs under the same rules as at claim time
+	if warmup != "" {
+		verdict, err := analysis.AnalyzeCode(ctx, warmup)
+		if err != nil || verdict.Malicious {
+			warmup = ""
+		}
+	}
+
+	ready, err := containerization.Prewarm(ctx, cli, networkID, containerization.ExecRequest{
+		TaskID:       task.ID,
+		Image:        imageName,
+		TenantID:     tenantOf(task),
+		Requirements: requirements,
+		Warmup:       warmup,
+		Sandbox:      settings.sandbox,
+		Environment:  settings.environment,
+	})
+	switch {
+	case err != nil:
+		logging.Log(ctx, fmt.Sprintf("Failed to pre-warm the sandbox of task %d: %v", task.ID, err), slog.LevelWarn)
+		return prewarmError
+	case !ready:
+		return prewarmBusy
+	}
+	return prewarmReady
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"time"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/pgdb"
+	"continuumworker/src/retry"
+)
+
+// queueColumns select the settings of a task joined with its queue (q), the
+// task's own values first. They are scanned into taskSettings.dest.
+const queueColumns = `COALESCE(t.timeout_seconds, q.timeout_seconds, 0), COALESCE(t.memory_mb, q.memory_mb, 0),
+	COALESCE(t.cpu_limit, q.cpu_limit, 0), COALESCE(t.isolation, q.isolation, ''), COALESCE(t.network, q.network, ''),
+	COALESCE(q.retry_policy::TEXT, ''), t.gpu_required, COALESCE(t.timezone, ''), COALESCE(t.locale, ''), t.ulimits,
+	COALESCE(t.egress_allowlist, q.egress_allowlist), COALESCE(t.bandwidth_kbps, q.bandwidth_kbps, 0)`
+
+// taskSettings are the settings a task runs with: its own, else its
+// queue's, else (zero values) the worker configuration
+type taskSettings struct {
+	sandbox        containerization.Sandbox
+	timeoutSeconds float64 // Bounds the execution, retries included; 0 is unbounded
+	queueRetry     string  // Retry policy of the queue, the task's own applies over it
+	// environment is the task's own timezone, locale and ulimits
+	environment containerization.ExecEnvironment
+}
+
+// dest returns the scan destinations of queueColumns
+func (s *taskSettings) dest() []any {
+	return []any{&s.timeoutSeconds, &s.sandbox.MemoryMB, &s.sandbox.CPULimit, &s.sandbox.Isolation, &s.sandbox.Network, &s.queueRetry, &s.sandbox.GPU,
+		&s.environment.TZ, &s.environment.Locale, pgdb.Array(&s.environment.Ulimits), pgdb.Array(&s.sandbox.Allowlist), &s.sandbox.Bandwidth}
+}
+
+func (s taskSettings) timeout() time.Duration {
+	return time.Duration(s.timeoutSeconds * float64(time.Second))
+}
+
+// retryPolicy layers the queue's retry policy and then the task's over the
+// worker default
+func (s taskSettings) retryPolicy(defaults retry.Policy, task string) (retry.Policy, error) {
+	p, err := TaskRetryPolicy(defaults, s.queueRetry)
+	if err != nil {
+		return defaults, err
+	}
+	return TaskRetryPolicy(p, task)
+}
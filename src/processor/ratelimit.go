@@ -0,0 +1,82 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"continuumworker/src/config"
+)
+
+// Rate limit scopes, the scope column of RATE_LIMITS
+const (
+	scopeCode   = "code"
+	scopeTenant = "tenant"
+)
+
+// throttle takes a token from the code's and the tenant's buckets. When one
+// of them is empty it returns the scope and how long until a token is
+// available, and the task must be requeued. The buckets are rows of
+// RATE_LIMITS locked by tx, so every worker draws from the same buckets and
+// tokens taken by a rolled back claim are given back.
+func throttle(ctx context.Context, tx *sql.Tx, limits config.RateLimit, codeID string, tenantID *string) (string, time.Duration, error) {
+	wait, err := takeToken(ctx, tx, scopeCode, codeID, limits.PerCode)
+	if err != nil || wait > 0 {
+		return scopeCode, wait, err
+	}
+	if tenantID != nil && *tenantID != "" {
+		wait, err = takeToken(ctx, tx, scopeTenant, *tenantID, limits.PerTenant)
+		if err != nil || wait > 0 {
+			return scopeTenant, wait, err
+		}
+	}
+	return "", 0, nil
+}
+
+// takeToken refills the bucket of key at perMinute tokens a minute, up to
+// perMinute, and takes a token from it. A per_minute set on the bucket's row
+// overrides the default; a limit of 0 is unlimited. It returns 0 once a
+// token was taken, or the wait until one is available.
+func takeToken(ctx context.Context, tx *sql.Tx, scope, key string, perMinute int) (time.Duration, error) {
+	var override sql.NullInt64
+	err := tx.QueryRowContext(ctx, "SELECT per_minute FROM RATE_LIMITS WHERE scope = $1 AND key = $2", scope, key).Scan(&override)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if override.Valid {
+		perMinute = int(override.Int64)
+	}
+	if perMinute <= 0 {
+		return 0, nil
+	}
+
+	// A bucket without tokens (new, or just configured) starts full
+	var tokens float64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO RATE_LIMITS AS r (scope, key, tokens, refilled_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (scope, key) DO UPDATE
+		SET tokens = LEAST($3, COALESCE(r.tokens + EXTRACT(EPOCH FROM NOW() - r.refilled_at) * $3 / 60.0, $3)),
+		    refilled_at = NOW()
+		RETURNING tokens`, scope, key, perMinute).Scan(&tokens)
+	if err != nil {
+		return 0, err
+	}
+	if tokens < 1 {
+		return time.Duration((1 - tokens) * 60 / float64(perMinute) * float64(time.Second)), nil
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE RATE_LIMITS SET tokens = tokens - 1 WHERE scope = $1 AND key = $2", scope, key)
+	return 0, err
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"encoding/json"
+	"time"
+
+	"continuumworker/src/model"
+	"continuumworker/src/receipts"
+)
+
+// signReceipt returns the signed receipt of a completed task as JSON, or ""
+// when RECEIPT_SIGNING_KEY is not set. output is the output as stored.
+func signReceipt(task *model.Task, workerID, output string) string {
+	signer := receipts.Default()
+	if signer == nil {
+		return ""
+	}
+	r := receipts.Receipt{
+		WorkerID:    workerID,
+		TaskID:      task.ID,
+		CodeHash:    receipts.Hash(task.Code),
+		PayloadHash: receipts.Hash(task.Payload),
+		OutputHash:  receipts.Hash(output),
+		FinishedAt:  time.Now(),
+	}
+	if task.CodeVersion != nil {
+		r.CodeVersion = *task.CodeVersion
+	}
+	if task.Started != nil {
+		r.StartedAt = *task.Started
+	}
+	encoded, _ := json.Marshal(signer.Sign(r))
+	return string(encoded)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"continuumworker/src/config"
+	"continuumworker/src/results"
+)
+
+// decodeResult decodes the stdout of a code declaring a result format into
+// normalized JSON. Binary formats also return the raw bytes, which the task's
+// text output can't hold; the output then becomes the JSON. A result is
+// never truncated, so one over limits.OutputBytes doesn't match its format.
+func decodeResult(contract results.Contract, output string, limits config.Limits) (string, []byte, error) {
+	if len(output) > limits.OutputBytes {
+		return "", nil, fmt.Errorf("%w: the result is %d bytes, over the %d bytes limit", results.ErrMismatch, len(output), limits.OutputBytes)
+	}
+	decoded, err := results.Decode(contract, []byte(output))
+	if err != nil {
+		return "", nil, err
+	}
+	if !contract.Binary() {
+		return string(decoded), nil, nil
+	}
+	return string(decoded), []byte(output), nil
+}
+
+// redactResult removes secret values from a decoded result. Replacing them in
+// the raw bytes of a binary format would corrupt its encoding, so raw bytes
+// holding a secret are dropped, as is JSON the replacement made invalid.
+func redactResult(decoded string, raw []byte, secrets []string) (string, []byte) {
+	decoded = redact(decoded, secrets)
+	if decoded != "" && !json.Valid([]byte(decoded)) {
+		decoded = ""
+	}
+	for _, v := range secrets {
+		if len(v) >= 4 && bytes.Contains(raw, []byte(v)) {
+			return decoded, nil
+		}
+	}
+	return decoded, raw
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"continuumworker/src/containerization"
+	"continuumworker/src/results"
+	"continuumworker/src/retry"
+)
+
+// Error classes a retry policy can list in retry_on
+const (
+	classInfra        = "infra"        // Docker or container failures, the worker's fault
+	classScript       = "script"       // The script exited with a non-zero status
+	classRequirements = "requirements" // The declared requirements could not be installed
+)
+
+// classifyExecError maps an execution error to its retry class
+func classifyExecError(err error) string {
+	switch {
+	case errors.Is(err, containerization.ErrRequirements):
+		return classRequirements
+	case errors.Is(err, containerization.ErrScript), errors.Is(err, results.ErrMismatch):
+		return classScript
+	default:
+		return classInfra
+	}
+}
+
+// ValidateRetryPolicy checks a retry policy, including its error classes
+func ValidateRetryPolicy(p retry.Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for _, class := range p.RetryOn {
+		switch class {
+		case classInfra, classScript, classRequirements:
+		default:
+			return fmt.Errorf("unknown error class %q in retry_on (want %s, %s or %s)", class, classInfra, classScript, classRequirements)
+		}
+	}
+	return nil
+}
+
+// TaskRetryPolicy applies a task's retry_policy JSON over the default policy.
+// Fields the task leaves out are inherited.
+func TaskRetryPolicy(defaults retry.Policy, override string) (retry.Policy, error) {
+	p := defaults
+	if override == "" {
+		return p, nil
+	}
+	if err := json.Unmarshal([]byte(override), &p); err != nil {
+		return defaults, fmt.Errorf("invalid retry policy: %w", err)
+	}
+	if err := ValidateRetryPolicy(p); err != nil {
+		return defaults, fmt.Errorf("invalid retry policy: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+)
+
+// scheduledFilters restrict pending tasks (t) with their queue (q) to those
+// this worker may claim, given $1 MIN_PRIORITY, $2 MAX_PRIORITY, $3 the
+// queues, $4 GPU support, $5 and $6 the memory and CPU limits and $7 egress
+// proxy support, see scheduledArgs. They mirror the claim query.
+const scheduledFilters = `
+		AND ($1 = 0 OR t.priority >= $1)
+		AND ($2 = 0 OR t.priority <= $2)
+		AND (COALESCE(CARDINALITY($3::TEXT[]), 0) = 0 OR t.queue = ANY($3))
+		AND (NOT t.gpu_required OR $4)
+		AND ($5 = 0 OR COALESCE(t.memory_mb, q.memory_mb, 0) <= $5)
+		AND ($6::DOUBLE PRECISION = 0 OR COALESCE(t.cpu_limit, q.cpu_limit, 0) <= $6)
+		AND (COALESCE(t.network, q.network, '') <> 'allowlist' OR $7)`
+
+// scheduledArgs returns the arguments of scheduledFilters
+func scheduledArgs(cfg config.Worker) []any {
+	maxMemoryMB, maxCPULimit := containerization.MaxResources()
+	return []any{cfg.MinPriority, cfg.MaxPriority, cfg.Queues, containerization.GPUEnabled(), maxMemoryMB, maxCPULimit,
+		containerization.EgressProxyEnabled()}
+}
+
+// NextScheduled returns how long until the earliest pending task with a
+// future run_at this worker may claim is due, and false when there is none.
+// The run loop wakes up then instead of waiting for the next poll.
+func NextScheduled(ctx context.Context, db *sql.DB, cfg config.Worker) (time.Duration, bool, error) {
+	var seconds sql.NullFloat64
+	err := db.QueryRowContext(ctx, `
+		SELECT EXTRACT(EPOCH FROM MIN(t.run_at) - NOW())::DOUBLE PRECISION
+		FROM TASKS t
+		LEFT JOIN QUEUES q ON q.name = t.queue
+		WHERE t.status = 'pending'
+		AND t.run_at > NOW()`+scheduledFilters,
+		scheduledArgs(cfg)...).Scan(&seconds)
+	if err != nil || !seconds.Valid {
+		return 0, false, err
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), true, nil
+}
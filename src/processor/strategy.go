@@ -0,0 +1,126 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// Strategy decides which pending tasks a worker claims first. Strategies
+// only rank the candidates; eligibility (status, priority bounds,
+// dependencies) is the same for all of them.
+type Strategy interface {
+	Name() string
+	// Order returns the ORDER BY clause ranking the candidate tasks (aliased
+	// t). Its placeholders start at $next and are bound to args.
+	Order(next int) (clause string, args []any)
+}
+
+// strategies lists the claim strategies by CLAIM_STRATEGY name
+var strategies = map[string]Strategy{
+	"priority":        priorityStrategy{},
+	"weighted-random": weightedRandomStrategy{},
+	"oldest-first":    oldestFirstStrategy{},
+	"tenant-fair":     tenantFairStrategy{},
+	"deadline-first":  deadlineFirstStrategy{},
+}
+
+// StrategyByName returns the claim strategy configured as name
+func StrategyByName(name string) (Strategy, error) {
+	s, ok := strategies[name]
+	if !ok {
+		names := make([]string, 0, len(strategies))
+		for n := range strategies {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown claim strategy %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return s, nil
+}
+
+// priorityStrategy claims strictly by priority, lowest number first
+type priorityStrategy struct{}
+
+func (priorityStrategy) Name() string { return "priority" }
+
+func (priorityStrategy) Order(next int) (string, []any) {
+	return "t.priority ASC, t.id ASC", nil
+}
+
+// weightedRandomStrategy picks a priority level at random, weighting level p
+// by 1/(p+1) among the levels with pending tasks, so low-priority work keeps
+// a share of the fleet instead of starving. Levels come from the last queue
+// sample; without one it falls back to strict priority.
+type weightedRandomStrategy struct{}
+
+func (weightedRandomStrategy) Name() string { return "weighted-random" }
+
+func (weightedRandomStrategy) Order(next int) (string, []any) {
+	depth := queueDepth.Load()
+	if depth == nil || len(*depth) == 0 {
+		return priorityStrategy{}.Order(next)
+	}
+
+	var total float64
+	for p, count := range *depth {
+		if count > 0 {
+			total += 1 / float64(max(p, 0)+1)
+		}
+	}
+	pick := rand.Float64() * total
+	level := 0
+	for p, count := range *depth {
+		if count == 0 {
+			continue
+		}
+		level = p
+		if pick -= 1 / float64(max(p, 0)+1); pick < 0 {
+			break
+		}
+	}
+	return fmt.Sprintf("(t.priority = $%d) DESC, t.priority ASC, t.id ASC", next), []any{level}
+}
+
+// oldestFirstStrategy claims in submission order, ignoring priority
+type oldestFirstStrategy struct{}
+
+func (oldestFirstStrategy) Name() string { return "oldest-first" }
+
+func (oldestFirstStrategy) Order(next int) (string, []any) {
+	return "t.id ASC", nil
+}
+
+// tenantFairStrategy claims first for the tenant with the fewest running
+// tasks, so one tenant's burst can't occupy the whole fleet. Tasks without a
+// tenant form one more tenant.
+type tenantFairStrategy struct{}
+
+func (tenantFairStrategy) Name() string { return "tenant-fair" }
+
+func (tenantFairStrategy) Order(next int) (string, []any) {
+	return `(SELECT COUNT(*) FROM TASKS r WHERE r.status = 'running'
+			AND r.tenant_id IS NOT DISTINCT FROM t.tenant_id) ASC, t.priority ASC, t.id ASC`, nil
+}
+
+// deadlineFirstStrategy claims the task with the earliest deadline first;
+// tasks without one follow in priority order
+type deadlineFirstStrategy struct{}
+
+func (deadlineFirstStrategy) Name() string { return "deadline-first" }
+
+func (deadlineFirstStrategy) Order(next int) (string, []any) {
+	return "t.deadline ASC NULLS LAST, t.priority ASC, t.id ASC", nil
+}
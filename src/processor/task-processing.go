@@ -2,170 +2,590 @@ package processor
 
 import (
 	"context"
+	"continuumworker/src/analysis"
+	"continuumworker/src/annotations"
+	"continuumworker/src/artifacts"
+	"continuumworker/src/compression"
+	"continuumworker/src/config"
 	"continuumworker/src/containerization"
+	"continuumworker/src/dbwrite"
+	"continuumworker/src/display"
+	"continuumworker/src/livelog"
 	"continuumworker/src/logging"
 	"continuumworker/src/model"
+	"continuumworker/src/retry"
+	"continuumworker/src/stats"
+	"continuumworker/src/workers"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func ProcessTasks(ctx context.Context, db *sql.DB, cli *client.Client, workerID string, networkID string, workerstats *logging.WorkerStats, maxPriority int, minPriority int) {
-	// Get task using transaction for locking
-	tx, err := db.Begin()
-	if err != nil {
-		fmt.Printf("Error starting transaction: %v\n", err)
+// ProcessTasks claims a batch of up to ClaimBatchSize tasks and executes them
+// through the exec queue: up to MAX_CONCURRENT_EXECS at a time, in priority
+// order within a tenant and round-robin across tenants. It returns once the
+// whole batch is done. Tasks of the batch that haven't started when the
+// worker is quarantined or its execution context is cancelled are released.
+func ProcessTasks(ctx context.Context, db *sql.DB, cli *client.Client, cfg config.Worker, workerID string, networkID string, workerstats *stats.WorkerStats, drain *workers.Drain) {
+	// A quarantined worker must not claim tasks it can't run
+	if drain.Quarantined() {
 		return
 	}
-	defer tx.Rollback()
-
-	task := &model.Task{}
-	query := `
-		SELECT id, name, description, started, finished, locked_at, last_error, status, payload, code 
-		FROM TASKS 
-		WHERE STATUS = 'pending' 
-		AND LOCKED_AT IS NULL
-		AND ($1 = 0 OR priority >= $1)
-		AND ($2 = 0 OR priority <= $2)
-		ORDER BY priority ASC
-		LIMIT 1 
-		FOR UPDATE SKIP LOCKED
-	`
-
-	err = tx.QueryRow(query, minPriority, maxPriority).Scan(
-		&task.ID, &task.Name, &task.Description, &task.Started, &task.Finished,
-		&task.LockedAt, &task.LastError, &task.Status, &task.Payload, &task.Code,
-	)
-
-	if err == sql.ErrNoRows {
-		return
-	} else if err != nil {
-		logging.Log(fmt.Sprintf("Error querying task: %v\n", err), slog.LevelError)
-		return
+
+	claimed := claimTasks(ctx, db, cfg, workerID, workerstats)
+	workers.Progress(ctx)
+	queue := containerization.DefaultExecQueue()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var unstarted []*claimedTask
+	for _, c := range claimed {
+		// Take places in line in claim order, then wait concurrently
+		ticket := queue.Enqueue(tenantOf(c.task))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ticket.Wait(ctx); err != nil {
+				mu.Lock()
+				unstarted = append(unstarted, c)
+				mu.Unlock()
+				return
+			}
+			defer ticket.Release()
+			if drain.Quarantined() || ctx.Err() != nil {
+				mu.Lock()
+				unstarted = append(unstarted, c)
+				mu.Unlock()
+				return
+			}
+			runTask(ctx, db, cli, cfg, workerID, networkID, c, workerstats, drain)
+			workers.Progress(ctx)
+		}()
 	}
+	wg.Wait()
 
-	// Get the code reference using Code UUID
-	err = db.QueryRow("SELECT code FROM CODES WHERE id = $1", task.Code).Scan(&task.Code)
-	if err != nil {
-		logging.Log(fmt.Sprintf("Error fetching code: %v\n", err), slog.LevelError)
-		return
+	if len(unstarted) > 0 {
+		releaseTasks(context.WithoutCancel(ctx), db, workerID, unstarted, workerstats)
 	}
+}
 
-	// Check if code is malicious
-	isMalicious, err := containerization.AnalyzeCode(task.Code)
-	if err != nil {
-		logging.Log(fmt.Sprintf("Error analyzing code: %v\n", err), slog.LevelError)
-		return
+// tenantOf returns the task's tenant, "" for the shared partition
+func tenantOf(task *model.Task) string {
+	if task.TenantID != nil {
+		return *task.TenantID
 	}
-	if isMalicious {
-		task.Status = model.TaskMalicious
-		_, err = tx.Exec("UPDATE TASKS SET STATUS = $1 WHERE ID = $2", task.Status, task.ID)
-		if err != nil {
-			logging.Log(fmt.Sprintf("Error updating task status to malicious: %v\n", err), slog.LevelError)
-			workerstats.UpdateStats("", 0, 0, 0, 1, nil)
-			return
-		}
-		if err := tx.Commit(); err != nil {
-			logging.Log(fmt.Sprintf("Error committing transaction: %v\n", err), slog.LevelError)
-			workerstats.UpdateStats("", 0, 0, 0, 1, nil)
-			return
-		}
-		return
+	return ""
+}
+
+// runTask executes a claimed task and persists its result
+func runTask(ctx context.Context, db *sql.DB, cli *client.Client, cfg config.Worker, workerID string, networkID string, c *claimedTask, workerstats *stats.WorkerStats, drain *workers.Drain) {
+	defer c.end()
+	ctx = c.ctx
+	task, imageName, now := c.task, c.imageName, *c.task.Started
+
+	logging.Log(ctx, fmt.Sprintf("Processing task: %s (ID: %d)\n", task.Name, task.ID), slog.LevelInfo)
+	workerstats.RecordStarted(task)
+	logging.Inc(ctx, metricTasksTotal)
+	inFlight.Add(1)
+	defer inFlight.Add(-1)
+
+	// Requirements are resolved once; an invalid list fails the task below
+	requirements, reqErr := containerization.RequirementsFromPayload(task.Payload)
+
+	// Warm containers are partitioned by tenant
+	tenantID := tenantOf(task)
+
+	// Files written to /outputs are kept when an artifact store is configured
+	var collector *artifacts.Collector
+	var sink containerization.ArtifactSink
+	if store, err := artifacts.Default(); err == nil && store != nil {
+		collector = artifacts.NewCollector(store, task.ID)
+		sink = collector
 	}
 
-	now := time.Now()
-	task.Started = &now
-	task.Status = model.TaskRunning
+	// Broadcast the output to live log subscribers while the script runs
+	livelog.Default.Open(task.ID)
+	defer livelog.Default.Close(task.ID)
 
-	_, err = tx.Exec("UPDATE TASKS SET LOCKED_AT = NOW(), WORKER_ID = $1, STARTED = $2, STATUS = $3 WHERE ID = $4",
-		workerID, task.Started, task.Status, task.ID)
+	// Retry under the task's policy over its queue's, or the worker default
+	override := ""
+	if task.RetryPolicy != nil {
+		override = *task.RetryPolicy
+	}
+	retryPolicy, err := c.settings.retryPolicy(cfg.Retry, override)
 	if err != nil {
-		logging.Log(fmt.Sprintf("Error updating task status to running: %v\n", err), slog.LevelError)
-		workerstats.UpdateStats("", 0, 0, 0, 1, nil)
-		return
+		logging.Log(ctx, fmt.Sprintf("Task %d: %v, using the default retry policy\n", task.ID, err), slog.LevelWarn)
 	}
 
-	if err := tx.Commit(); err != nil {
-		logging.Log(fmt.Sprintf("Error committing transaction: %v\n", err), slog.LevelError)
-		workerstats.UpdateStats("", 0, 0, 0, 1, nil)
-		return
+	// Suspicious tasks are traced, the trace being kept as an artifact
+	tracer := ""
+	if len(c.traceReasons) > 0 {
+		tracer = analysis.Tracer()
+		logging.Log(ctx, fmt.Sprintf("Task %d flagged as suspicious, tracing its execution with %s: %s\n", task.ID, tracer, strings.Join(c.traceReasons, "; ")), slog.LevelWarn)
 	}
 
-	logging.Log(fmt.Sprintf("Processing task: %s (ID: %d)\n", task.Name, task.ID), slog.LevelInfo)
-	workerstats.UpdateStats("", 1, 0, 0, 0, task)
+	var result containerization.ExecResult
+	execCtx, execSpan := logging.StartSpan(ctx, "execute", trace.WithAttributes(attribute.String("container.image", imageName)))
+	defer execSpan.End()
+	// The task's (or its queue's) timeout bounds the execution, retries included
+	timeout := c.settings.timeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(execCtx, timeout)
+		defer cancel()
+	}
+	execErr := reqErr
+	if reqErr == nil {
+		execErr = retry.Do(execCtx, retryPolicy, classifyExecError, func(attempt int) error {
+			// Secret values never reach live log subscribers either
+			stdout, stderr := liveWriter(task.ID, "stdout", c.secrets), liveWriter(task.ID, "stderr", c.secrets)
+			defer stdout.Flush()
+			defer stderr.Flush()
+			var err error
+			result, err = containerization.ExecuteTaskInDocker(execCtx, cli, networkID, containerization.ExecRequest{
+				TaskID:       task.ID,
+				Code:         task.Code,
+				Payload:      task.Payload,
+				Image:        imageName,
+				TenantID:     tenantID,
+				Requirements: requirements,
+				Warmup:       c.warmup,
+				Env:          c.env,
+				Sandbox:      c.settings.sandbox,
+				Environment:  c.settings.environment,
+				Artifacts:    sink,
+				Trace:        tracer,
+				Stdout:       stdout,
+				Stderr:       stderr,
+			})
+			return err
+		}, func(attempt int, err error, delay time.Duration) {
+			logging.Log(ctx, fmt.Sprintf("Attempt %d/%d failed: %v. Retrying in %s...\n", attempt, retryPolicy.MaxAttempts, err, delay.Truncate(time.Millisecond)), slog.LevelError)
+		})
+	}
 
-	// Execute with Retry (Watchdog)
-	var output string
-	var execErr error
-	maxRetries := 3
+	// A timed out script is the task's own fault
+	timedOut := false
+	if execErr != nil && ctx.Err() == nil && errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+		execErr = fmt.Errorf("%w: timed out after %s", containerization.ErrScript, timeout)
+		timedOut = true
+	}
 
-	for i := 0; i < maxRetries; i++ {
-		output, execErr = containerization.ExecuteTaskInDocker(ctx, cli, task.Code, task.Payload, networkID)
-		if execErr == nil {
-			break
-		}
-		
-		// If context is cancelled, don't retry and exit early
-		if ctx.Err() != nil {
-			logging.Log(fmt.Sprintf("Task execution cancelled: %v\n", ctx.Err()), slog.LevelError)
-			return
-		}
+	// If context is cancelled, leave the task running so it gets recovered
+	if execErr != nil && ctx.Err() != nil {
+		logging.EndSpan(execSpan, ctx.Err())
+		logging.Log(ctx, fmt.Sprintf("Task execution cancelled: %v\n", ctx.Err()), slog.LevelError)
+		return
+	}
 
-		logging.Log(fmt.Sprintf("Attempt %d/%d failed: %v. Retrying...\n", i+1, maxRetries, execErr), slog.LevelError)
-		
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(2 * time.Second):
-			// small backoff
+	// A code declaring a result format must write a result that decodes in it
+	var decoded string
+	var raw []byte
+	if execErr == nil && c.result.Format != "" {
+		decoded, raw, execErr = decodeResult(c.result, result.Output, cfg.Limits)
+		if raw != nil {
+			result.Output = decoded
 		}
 	}
 
+	logging.EndSpan(execSpan, execErr)
+	recordUsage(ctx, result.Usage)
+	if result.Traced {
+		logging.Inc(ctx, metricTasksTraced, attribute.String("tracer", tracer))
+	}
+
+	// Secret values never reach the database
+	result.Output = redact(result.Output, c.secrets)
+	decoded, raw = redactResult(decoded, raw, c.secrets)
+
+	// The result is persisted even if the drain timeout cancels ctx meanwhile.
+	// If it has to be journaled, it is only replayed while the task is still ours.
+	persistStart := time.Now()
+	persistCtx, persistSpan := logging.StartSpan(dbwrite.WithTask(context.WithoutCancel(ctx), task.ID, workerID), "persist")
+	defer persistSpan.End()
+
 	if execErr != nil {
-		logging.Log(fmt.Sprintf("Task execution failed after retries: %v\n", execErr), slog.LevelError)
-		// Use db.Exec instead of tx.Exec because tx is already committed
-		_, updateErr := db.Exec("UPDATE TASKS SET FINISHED = NOW(), STATUS = $1, LAST_ERROR = $2 WHERE ID = $3",
-			model.TaskFailed, execErr.Error(), task.ID)
+		// Bounded before anything stores it, a huge traceback included
+		lastError := limitError(persistCtx, task.ID, redact(execErr.Error(), c.secrets), cfg.Limits, collector)
+		logging.Log(persistCtx, fmt.Sprintf("Task execution failed: %s\n", lastError), slog.LevelError)
+		class := classifyExecError(execErr)
+		infraFailure := class == classInfra
+
+		// A task that damaged other workers too is isolated rather than failed,
+		// and the failure is blamed on the payload instead of this node
+		status := model.TaskFailed
+		poison, damaged := false, 0
+		if infraFailure {
+			recordAttempt(persistCtx, db, task.ID, workerID, now, attemptInfraError, lastError)
+			var err error
+			poison, damaged, err = isPoison(persistCtx, db, task.ID, cfg.PoisonThreshold)
+			if err != nil {
+				logging.Log(persistCtx, fmt.Sprintf("Error checking task %d for poison: %v\n", task.ID, err), slog.LevelError)
+			}
+		} else if class == classScript {
+			recordAttempt(persistCtx, db, task.ID, workerID, now, attemptScriptError, lastError)
+		} else {
+			recordAttempt(persistCtx, db, task.ID, workerID, now, attemptRequirementsError, lastError)
+		}
+		code := execErrorCode(execErr, result.ExitCode, timedOut)
+		if poison {
+			status, code = model.TaskHeld, model.ErrCodePoison
+		}
+
+		// Annotations printed before the failure are kept
+		plainOutput, taskAnnotations := annotations.Parse(result.Output)
+
+		// Use db instead of tx because tx is already committed. The only
+		// artifacts a failed run keeps are its execution trace and its
+		// oversized output and error.
+		storedOutput, packedOutput := compression.Pack(limitOutput(persistCtx, task.ID, plainOutput, cfg.Limits, collector), cfg.Limits.CompressAboveBytes)
+		stmts := []dbwrite.Statement{{
+			Query: `UPDATE TASKS SET FINISHED = NOW(), STATUS = $1, LAST_ERROR = $2, INTERPRETER_VERSION = NULLIF($3, ''),
+			CPU_SECONDS = $4, PEAK_MEMORY_BYTES = $5, OUTPUT = NULLIF($7, ''), ANNOTATIONS = NULLIF($8, '')::JSONB, EXIT_CODE = $9,
+			ERROR_CODE = $10, OUTPUT_ZSTD = $11, RESULT = NULL, RESULT_RAW = NULL, RECEIPT = NULL WHERE ID = $6`,
+			Args: []any{status, lastError, result.PythonVersion, result.Usage.CPUSeconds, int64(result.Usage.PeakMemoryBytes), task.ID,
+				storedOutput, annotations.Encode(taskAnnotations), result.ExitCode, code, packedOutput},
+		}}
+		if collector != nil && len(collector.Artifacts) > 0 {
+			stmts = append(stmts, artifactStatements(task.ID, collector.Artifacts)...)
+		}
+		updateErr := dbwrite.Batch(persistCtx, db, fmt.Sprintf("task %d result", task.ID), stmts...)
+		task.Status = status
+		logging.ObservePhase(persistCtx, "persist", persistStart)
+		logging.EndSpan(persistSpan, updateErr)
 		if updateErr != nil {
-			logging.Log(fmt.Sprintf("Error updating task status to failed: %v\n", updateErr), slog.LevelError)
-			workerstats.UpdateStats("", 0, 0, 0, 1, nil)
+			logging.Log(persistCtx, fmt.Sprintf("Error updating task status to %s: %v\n", status, updateErr), slog.LevelError)
+			recordDatabaseFailure(persistCtx, workerstats)
+			finishWithoutResult(persistCtx, db, task.ID, status, updateErr)
+		} else if poison {
+			alertPoison(persistCtx, task.ID, damaged)
+		} else {
+			FailDependents(persistCtx, db, task.ID, workerstats)
+		}
+		workerstats.RecordFailure()
+		recordFailed(persistCtx, status)
+
+		// Every other error out of ExecuteTaskInDocker is an infrastructure failure
+		if infraFailure && !poison && drain.RecordFailure(execErr) {
+			quarantine(persistCtx, db, workerID, drain)
 		}
-		workerstats.UpdateStats("", 0, 0, 1, 0, nil)
 	} else {
+		recordAttempt(persistCtx, db, task.ID, workerID, now, attemptCompleted, "")
+		drain.RecordSuccess()
+
+		// Split annotations and rich outputs (images, HTML, tables...) from the
+		// plain stdout; a result in a declared format is kept whole
+		plainOutput, taskAnnotations := result.Output, map[string]any(nil)
+		var richOutputs []display.Output
+		if c.result.Format == "" {
+			plainOutput, taskAnnotations = annotations.Parse(result.Output)
+			plainOutput, richOutputs = display.Parse(plainOutput, cfg.RichOutputMaxBytes)
+		}
+		plainOutput = limitOutput(persistCtx, task.ID, plainOutput, cfg.Limits, collector)
+
 		// UPDATE THE TASK
-		_, updateErr := db.Exec("UPDATE TASKS SET FINISHED = NOW(), STATUS = $1, OUTPUT = $2 WHERE ID = $3",
-			model.TaskCompleted, output, task.ID)
+		var stored []artifacts.Artifact
+		if collector != nil {
+			stored = collector.Artifacts
+		}
+		receipt := signReceipt(task, workerID, plainOutput)
+		updateErr := completeTask(persistCtx, db, task.ID, plainOutput, taskAnnotations, result, decoded, raw, richOutputs, stored, receipt, cfg.Limits)
+		task.Status = model.TaskCompleted
+		logging.ObservePhase(persistCtx, "persist", persistStart)
+		logging.EndSpan(persistSpan, updateErr)
 		if updateErr != nil {
-			logging.Log(fmt.Sprintf("Error marking task as completed: %v\n", updateErr), slog.LevelError)
-			workerstats.UpdateStats("", 0, 0, 0, 1, nil)
+			logging.Log(persistCtx, fmt.Sprintf("Error marking task as completed: %v\n", updateErr), slog.LevelError)
+			recordDatabaseFailure(persistCtx, workerstats)
+			finishWithoutResult(persistCtx, db, task.ID, model.TaskCompleted, updateErr)
 		} else {
-			logging.Log(fmt.Sprintf("Task %d completed successfully. Output: %s\n", task.ID, output), slog.LevelInfo)
+			logging.Log(persistCtx, fmt.Sprintf("Task %d completed successfully (%d rich outputs, %d artifacts). Output: %s\n", task.ID, len(richOutputs), len(stored), plainOutput), slog.LevelInfo)
 		}
-		workerstats.UpdateStats("", 0, 1, 0, 0, nil)
+		workerstats.RecordSuccess()
+		logging.Inc(persistCtx, metricTasksSucceeded)
+	}
+}
+
+// quarantine flags the worker unhealthy and raises an alert once the drain trips
+func quarantine(ctx context.Context, db *sql.DB, workerID string, drain *workers.Drain) {
+	logging.Log(ctx, fmt.Sprintf("ALERT: worker %s quarantined after %d consecutive infrastructure failures, no longer claiming tasks. Last error: %s\n",
+		workerID, drain.ConsecutiveFailures(), drain.Reason()), slog.LevelError)
+	logging.SetSpanAttributes(ctx, attribute.Bool("worker.quarantined", true))
+
+	if err := workers.MarkUnhealthy(ctx, db, workerID); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error flagging worker as unhealthy: %v\n", err), slog.LevelError)
 	}
 }
 
-func RecoverTasks(db *sql.DB, workerstats *logging.WorkerStats) {
-	// Fault Recovery: Fail tasks that have been locked for > 1 hour
-	// This handles cases where a worker crashed while processing a task.
-	res, err := db.Exec(`
-		UPDATE TASKS 
-		SET STATUS = 'failed', 
-		    FINISHED = NOW(), 
-			LAST_ERROR = 'Timeout/Worker Crash (1h limit)' 
-		WHERE STATUS = 'running' 
-		AND LOCKED_AT < NOW() - INTERVAL '1 hour'`)
-	
+// completeTask stores the result, annotations, rich outputs, artifact
+// metadata and signed receipt ("" for none) atomically. decoded and raw are
+// the normalized JSON and raw bytes of a result in a declared format, empty
+// otherwise.
+func completeTask(ctx context.Context, db *sql.DB, taskID int, output string, taskAnnotations map[string]any, result containerization.ExecResult, decoded string, raw []byte, richOutputs []display.Output, stored []artifacts.Artifact, receipt string, limits config.Limits) error {
+	// A failed artifact upload doesn't fail the task, but is surfaced in
+	// LAST_ERROR and ERROR_CODE
+	lastError, code := "", model.ErrorCode("")
+	if result.ArtifactsErr != nil {
+		lastError = limitError(ctx, taskID, "Artifact collection failed: "+result.ArtifactsErr.Error(), limits, nil)
+		code = model.ErrCodeArtifacts
+	}
+
+	storedOutput, packedOutput := compression.Pack(output, limits.CompressAboveBytes)
+	stmts := []dbwrite.Statement{{
+		Query: `UPDATE TASKS SET FINISHED = NOW(), STATUS = $1, OUTPUT = $2, INTERPRETER_VERSION = $3,
+		CPU_SECONDS = $4, PEAK_MEMORY_BYTES = $5, LAST_ERROR = NULLIF($6, ''), ANNOTATIONS = NULLIF($8, '')::JSONB, EXIT_CODE = $9,
+		ERROR_CODE = NULLIF($10, ''), OUTPUT_ZSTD = $11, RESULT = NULLIF($12, '')::JSONB, RESULT_RAW = $13, RECEIPT = NULLIF($14, '')::JSONB WHERE ID = $7`,
+		Args: []any{model.TaskCompleted, storedOutput, result.PythonVersion, result.Usage.CPUSeconds, int64(result.Usage.PeakMemoryBytes), lastError, taskID,
+			annotations.Encode(taskAnnotations), result.ExitCode, code, packedOutput, decoded, raw, receipt},
+	}}
+
+	// A re-executed task replaces the outputs of any earlier run
+	stmts = append(stmts, dbwrite.Statement{Query: "DELETE FROM TASK_OUTPUTS WHERE task_id = $1", Args: []any{taskID}})
+	for _, out := range richOutputs {
+		stmts = append(stmts, dbwrite.Statement{
+			Query: "INSERT INTO TASK_OUTPUTS (task_id, seq, mime_type, name, data) VALUES ($1, $2, $3, NULLIF($4, ''), $5)",
+			Args:  []any{taskID, out.Seq, out.MIMEType, out.Name, out.Data},
+		})
+	}
+
+	stmts = append(stmts, artifactStatements(taskID, stored)...)
+	return dbwrite.Batch(ctx, db, fmt.Sprintf("task %d result", taskID), stmts...)
+}
+
+// finishWithoutResult sets the final status of a task whose result write was
+// refused by the database (e.g. a value it can't store), so the task doesn't
+// stay running until recovery runs it again. Transient failures are left to
+// the write journal, which keeps the whole result.
+func finishWithoutResult(ctx context.Context, db *sql.DB, taskID int, status model.TaskStatus, cause error) {
+	if dbwrite.Transient(cause) {
+		return
+	}
+	msg := limitError(ctx, taskID, "Result could not be stored: "+cause.Error(), config.Limits{ErrorBytes: 1024}, nil)
+	_, err := dbwrite.Exec(ctx, db, fmt.Sprintf("task %d status", taskID),
+		"UPDATE TASKS SET FINISHED = NOW(), STATUS = $1, LAST_ERROR = $2, ERROR_CODE = $4, OUTPUT = NULL, OUTPUT_ZSTD = NULL, RESULT = NULL, RESULT_RAW = NULL, RECEIPT = NULL WHERE ID = $3",
+		status, msg, taskID, model.ErrCodeResultRejected)
 	if err != nil {
-		logging.Log(fmt.Sprintf("Error recovering tasks: %v\n", err), slog.LevelError)
-		workerstats.UpdateStats("", 0, 0, 0, 1, nil)
-	} else {
-		count, _ := res.RowsAffected()
-		if count > 0 {
-			logging.Log(fmt.Sprintf("Recovered %d stale tasks (marked as failed)\n", count), slog.LevelInfo)
+		logging.Log(ctx, fmt.Sprintf("Error finishing task %d without its result: %v\n", taskID, err), slog.LevelError)
+		return
+	}
+	logging.Log(ctx, fmt.Sprintf("Task %d finished as %s without its result, which the database refused\n", taskID, status), slog.LevelWarn)
+}
+
+// artifactStatements replace the task's artifact metadata with stored
+func artifactStatements(taskID int, stored []artifacts.Artifact) []dbwrite.Statement {
+	stmts := []dbwrite.Statement{{Query: "DELETE FROM TASK_ARTIFACTS WHERE task_id = $1", Args: []any{taskID}}}
+	for _, a := range stored {
+		stmts = append(stmts, dbwrite.Statement{
+			Query: "INSERT INTO TASK_ARTIFACTS (task_id, path, size, content_type, sha256, uri) VALUES ($1, $2, $3, $4, $5, $6)",
+			Args:  []any{taskID, a.Path, a.Size, a.ContentType, a.SHA256, a.URI},
+		})
+	}
+	return stmts
+}
+
+// RecoverTasks re-queues running tasks whose owning worker is no longer
+// alive: it stopped heartbeating for longer than the task's
+// stale_after_seconds (else its queue's, else StaleAfter), shut down, or
+// never registered at all. Long-running tasks on live workers (including
+// quarantined ones) are left alone. Each recovery counts as an attempt; a task
+// that has used up max_attempts, or whose first attempt started more than
+// RecoveryMaxAge ago, is abandoned instead of cycling through the fleet forever, and a
+// task that has now taken down enough distinct workers is held as poison.
+// Only tasks locked for longer than that threshold are considered, which also
+// catches tasks running without a WORKER_ID; see ReconcileTasks.
+func RecoverTasks(ctx context.Context, db *sql.DB, cfg config.Worker, workerstats *stats.WorkerStats) {
+	recoverTasks(ctx, db, cfg, workerstats, false)
+}
+
+// ReconcileTasks cross-checks the WORKER_ID of running tasks against the
+// WORKERS table and recovers, like RecoverTasks, those owned by a worker that
+// is gone, without waiting for the task's lock to age: the worker stopped,
+// never registered, stopped heartbeating, or restarted under the same
+// identity since it claimed the task.
+func ReconcileTasks(ctx context.Context, db *sql.DB, cfg config.Worker, workerstats *stats.WorkerStats) {
+	recoverTasks(ctx, db, cfg, workerstats, true)
+}
+
+// recoverTasks re-queues the running tasks of dead workers; reconcile skips
+// the lock age check for tasks with a WORKER_ID
+func recoverTasks(ctx context.Context, db *sql.DB, cfg config.Worker, workerstats *stats.WorkerStats, reconcile bool) {
+	rows, err := db.QueryContext(ctx, `
+		WITH dead AS (
+			SELECT t.ID, t.WORKER_ID, t.STARTED,
+				t.ATTEMPTS + 1 >= t.MAX_ATTEMPTS
+				OR ($2 > 0 AND t.FIRST_STARTED_AT < NOW() - $2 * INTERVAL '1 second') AS give_up,
+				$3 > 0 AND (
+					SELECT COUNT(DISTINCT w) FROM (
+						SELECT a.worker_id AS w FROM TASK_ATTEMPTS a
+						WHERE a.task_id = t.ID AND a.outcome IN ('infra_error', 'worker_lost')
+						UNION SELECT t.WORKER_ID
+					) damaged
+				) >= $3 AS poison
+			FROM TASKS t
+			LEFT JOIN QUEUES q ON q.name = t.QUEUE
+			WHERE t.STATUS = 'running'
+			AND CASE WHEN $6 THEN t.WORKER_ID IS NOT NULL
+				ELSE t.LOCKED_AT < NOW() - COALESCE(t.STALE_AFTER_SECONDS, q.stale_after_seconds, $1) * INTERVAL '1 second'
+			END
+			AND NOT EXISTS (
+				SELECT 1 FROM WORKERS w
+				WHERE w.id = t.WORKER_ID
+				AND w.status <> 'stopped'
+				AND w.last_heartbeat > NOW() - COALESCE(t.STALE_AFTER_SECONDS, q.stale_after_seconds, $1) * INTERVAL '1 second'
+				-- A worker restarted under the same identity lost the tasks of its previous process
+				AND w.started_at <= t.LOCKED_AT
+			)
+			FOR UPDATE OF t SKIP LOCKED
+		),
+		history AS (
+			INSERT INTO TASK_ATTEMPTS (task_id, worker_id, started_at, finished_at, outcome, error)
+			SELECT ID, WORKER_ID, STARTED, NOW(), 'worker_lost', 'Worker stopped heartbeating'
+			FROM dead
+		)
+		UPDATE TASKS t
+		SET ATTEMPTS = t.ATTEMPTS + 1,
+		    STATUS = CASE WHEN d.give_up THEN 'abandoned' WHEN d.poison THEN 'held' ELSE 'pending' END,
+		    FINISHED = CASE WHEN d.give_up OR d.poison THEN NOW() ELSE NULL END,
+		    LOCKED_AT = NULL,
+		    STARTED = NULL,
+		    LAST_ERROR = CASE WHEN d.give_up
+		        THEN 'Abandoned: worker ' || COALESCE(t.WORKER_ID, 'unknown') || ' stopped heartbeating after ' || (t.ATTEMPTS + 1)::TEXT ||
+		             ' attempts since ' || COALESCE(t.FIRST_STARTED_AT::TEXT, 'unknown')
+		        WHEN d.poison
+		        THEN 'Held: poison task, worker ' || COALESCE(t.WORKER_ID, 'unknown') || ' stopped heartbeating while running it'
+		        ELSE 'Requeued: worker ' || COALESCE(t.WORKER_ID, 'unknown') || ' stopped heartbeating'
+		    END,
+		    ERROR_CODE = CASE WHEN d.poison AND NOT d.give_up THEN $4 ELSE $5 END,
+		    WORKER_ID = NULL
+		FROM dead d
+		WHERE t.ID = d.ID
+		RETURNING t.ID, t.STATUS`, cfg.StaleAfter.Seconds(), cfg.RecoveryMaxAge.Seconds(), cfg.PoisonThreshold,
+		model.ErrCodePoison, model.ErrCodeWorkerLost, reconcile)
+
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error recovering tasks: %v\n", err), slog.LevelError)
+		recordDatabaseFailure(ctx, workerstats)
+		return
+	}
+
+	source := "lock_age"
+	if reconcile {
+		source = "reconciler"
+	}
+	var requeued int
+	var abandoned []int
+	for rows.Next() {
+		var id int
+		var status model.TaskStatus
+		if err := rows.Scan(&id, &status); err != nil {
+			logging.Log(ctx, fmt.Sprintf("Error reading recovered task: %v\n", err), slog.LevelError)
+			continue
+		}
+		logging.Inc(ctx, metricTasksRecovered, attribute.String("status", string(status)), attribute.String("source", source))
+		switch status {
+		case model.TaskAbandoned:
+			abandoned = append(abandoned, id)
+		case model.TaskHeld:
+			alertPoison(ctx, id, cfg.PoisonThreshold)
+		default:
+			requeued++
 		}
 	}
-}
\ No newline at end of file
+	rows.Close()
+
+	if requeued > 0 {
+		logging.Log(ctx, fmt.Sprintf("Recovered %d tasks from dead workers (re-queued as pending, %s)\n", requeued, source), slog.LevelInfo)
+	}
+	if len(abandoned) > 0 {
+		logging.Log(ctx, fmt.Sprintf("Abandoned %d tasks that exhausted their recovery attempts or age: %v\n", len(abandoned), abandoned), slog.LevelWarn)
+	}
+	for _, id := range abandoned {
+		FailDependents(ctx, db, id, workerstats)
+	}
+	if !reconcile {
+		failUnmetDependents(ctx, db, workerstats)
+	}
+}
+
+// failUnmetDependents fails the pending tasks with a dependency that ended
+// without completing, which FailDependents missed as they were committed
+// after the cascade, or that is no longer found (archived tasks count). Their
+// own dependents follow through FailDependents.
+func failUnmetDependents(ctx context.Context, db *sql.DB, workerstats *stats.WorkerStats) {
+	rows, err := db.QueryContext(ctx, `
+		WITH unmet AS (
+			SELECT DISTINCT ON (t.ID) t.ID, d.id AS dep_id, COALESCE(dep.STATUS, a.STATUS) IS NULL AS missing
+			FROM TASKS t
+			CROSS JOIN LATERAL UNNEST(t.DEPENDS_ON) AS d(id)
+			LEFT JOIN TASKS dep ON dep.ID = d.id
+			LEFT JOIN TASKS_ARCHIVE a ON a.ID = d.id
+			WHERE t.STATUS = 'pending'
+			AND (COALESCE(dep.STATUS, a.STATUS) IS NULL OR COALESCE(dep.STATUS, a.STATUS) IN (`+model.StatusList(model.UnmetStatuses)+`))
+			ORDER BY t.ID, d.id
+		)
+		UPDATE TASKS t
+		SET STATUS = 'failed',
+		    FINISHED = NOW(),
+		    LAST_ERROR = 'Dependency task ' || u.dep_id::TEXT || CASE WHEN u.missing THEN ' does not exist' ELSE ' did not complete' END,
+		    ERROR_CODE = $1
+		FROM unmet u
+		WHERE t.ID = u.ID
+		AND t.STATUS = 'pending'
+		RETURNING t.ID`, model.ErrCodeDependency)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error failing tasks with unmet dependencies: %v\n", err), slog.LevelError)
+		recordDatabaseFailure(ctx, workerstats)
+		return
+	}
+	var failed []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			logging.Log(ctx, fmt.Sprintf("Error reading task with unmet dependencies: %v\n", err), slog.LevelError)
+			continue
+		}
+		failed = append(failed, id)
+	}
+	rows.Close()
+
+	if len(failed) > 0 {
+		logging.Log(ctx, fmt.Sprintf("Failed %d tasks whose dependencies did not complete: %v\n", len(failed), failed), slog.LevelInfo)
+	}
+	for _, id := range failed {
+		FailDependents(ctx, db, id, workerstats)
+	}
+}
+
+// FailDependents cascades a failure to every pending task that depends,
+// directly or transitively, on the given parent task.
+func FailDependents(ctx context.Context, db *sql.DB, parentID int, workerstats *stats.WorkerStats) {
+	res, err := dbwrite.Exec(ctx, db, fmt.Sprintf("dependents of task %d", parentID), `
+		WITH RECURSIVE dependents AS (
+			SELECT id FROM TASKS WHERE depends_on @> ARRAY[$1::INT]
+			UNION
+			SELECT t.id FROM TASKS t JOIN dependents d ON t.depends_on @> ARRAY[d.id]
+		)
+		UPDATE TASKS
+		SET STATUS = 'failed',
+		    FINISHED = NOW(),
+		    LAST_ERROR = 'Dependency task ' || $1::TEXT || ' did not complete',
+		    ERROR_CODE = $2
+		WHERE ID IN (SELECT id FROM dependents)
+		AND STATUS = 'pending'`, parentID, model.ErrCodeDependency)
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error cascading failure of task %d to dependents: %v\n", parentID, err), slog.LevelError)
+		recordDatabaseFailure(ctx, workerstats)
+		return
+	}
+
+	count, _ := res.RowsAffected()
+	if count > 0 {
+		logging.Log(ctx, fmt.Sprintf("Failed %d dependent tasks of task %d\n", count, parentID), slog.LevelInfo)
+	}
+}
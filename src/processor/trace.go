@@ -0,0 +1,42 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package processor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"continuumworker/src/analysis"
+)
+
+// traceReasons lists why the task's execution should be traced: warn-level
+// analyzer findings, and earlier attempts that ended in an infrastructure
+// failure or a lost worker. It is empty when tracing is disabled.
+func traceReasons(ctx context.Context, tx *sql.Tx, taskID int, verdict analysis.Verdict) ([]string, error) {
+	if analysis.Tracer() == "" {
+		return nil, nil
+	}
+	reasons := slices.Clone(verdict.Warnings)
+
+	var damaged int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM TASK_ATTEMPTS WHERE task_id = $1 AND outcome IN ($2, $3)`,
+		taskID, attemptInfraError, attemptWorkerLost).Scan(&damaged)
+	if err != nil {
+		return nil, err
+	}
+	if damaged > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d earlier attempts ended in an infrastructure failure or a lost worker", damaged))
+	}
+	return reasons, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"continuumworker/src/pgdb"
+)
+
+// Queue is a workload class whose settings its tasks inherit
+type Queue struct {
+	Name           string   `json:"name"`
+	Description    *string  `json:"description"`
+	TimeoutSeconds *float64 `json:"timeout_seconds"`
+	// StaleAfterSeconds is how long a worker may stop heartbeating before
+	// the queue's tasks it runs are recovered
+	StaleAfterSeconds *float64        `json:"stale_after_seconds"`
+	MemoryMB          *int64          `json:"memory_mb"`
+	CPULimit          *float64        `json:"cpu_limit"`
+	BandwidthKbps     *int64          `json:"bandwidth_kbps"`
+	RetryPolicy       json.RawMessage `json:"retry_policy,omitempty"`
+	Isolation         *string         `json:"isolation"`
+	Network           *string         `json:"network"`
+	EgressAllowlist   []string        `json:"egress_allowlist"`
+	CreatedAt         time.Time       `json:"created_at"`
+	Pending           int             `json:"pending"` // Tasks of the queue waiting to run
+	Running           int             `json:"running"`
+}
+
+// queuesHandler lists the queues with their defaults and current load
+func (s *APIServer) queuesHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT q.name, q.description, q.timeout_seconds, q.memory_mb, q.cpu_limit, COALESCE(q.retry_policy::TEXT, ''),
+			q.isolation, q.network, q.egress_allowlist, q.stale_after_seconds, q.bandwidth_kbps, q.created_at,
+			COUNT(t.id) FILTER (WHERE t.status = 'pending'), COUNT(t.id) FILTER (WHERE t.status = 'running')
+		FROM QUEUES q
+		LEFT JOIN TASKS t ON t.queue = q.name AND t.status IN ('pending', 'running')
+		GROUP BY q.name
+		ORDER BY q.name`)
+	if err != nil {
+		http.Error(w, "Failed to query queues", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	queues := []Queue{}
+	for rows.Next() {
+		var q Queue
+		var retryPolicy string
+		if err := rows.Scan(&q.Name, &q.Description, &q.TimeoutSeconds, &q.MemoryMB, &q.CPULimit, &retryPolicy,
+			&q.Isolation, &q.Network, pgdb.Array(&q.EgressAllowlist), &q.StaleAfterSeconds, &q.BandwidthKbps, &q.CreatedAt, &q.Pending, &q.Running); err != nil {
+			http.Error(w, "Failed to read queues", http.StatusInternalServerError)
+			return
+		}
+		if retryPolicy != "" {
+			q.RetryPolicy = json.RawMessage(retryPolicy)
+		}
+		queues = append(queues, q)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(queues)
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package receipts signs a receipt for every completed task, so consumers of
+// its result can check that the output they read is the one the worker
+// produced, from that code and payload. A receipt binds the worker, the task,
+// SHA-256 hashes of the code, payload and output, and the execution times
+// under an ed25519 signature made with the worker's RECEIPT_SIGNING_KEY.
+package receipts
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"continuumworker/src/config"
+)
+
+// Version is the layout of the signed message, see Message
+const Version = 1
+
+// ErrInvalid is returned by Verify for a receipt that doesn't check out
+var ErrInvalid = errors.New("invalid receipt")
+
+// Receipt is stored in TASKS.receipt
+type Receipt struct {
+	Version     int       `json:"version"`
+	WorkerID    string    `json:"worker_id"`
+	TaskID      int       `json:"task_id"`
+	CodeVersion int       `json:"code_version"`
+	CodeHash    string    `json:"code_sha256"`
+	PayloadHash string    `json:"payload_sha256"`
+	OutputHash  string    `json:"output_sha256"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	// KeyID names the signing key: the first 8 bytes of the SHA-256 of its
+	// public key, in hex
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"` // Base64 ed25519 signature over Message
+}
+
+// Message is what the signature covers: the fields as lines, in this order,
+// with the times in RFC 3339 with nanoseconds, in UTC
+func (r Receipt) Message() []byte {
+	return []byte(strings.Join([]string{
+		"continuum-receipt-v" + strconv.Itoa(r.Version),
+		r.WorkerID,
+		strconv.Itoa(r.TaskID),
+		strconv.Itoa(r.CodeVersion),
+		r.CodeHash,
+		r.PayloadHash,
+		r.OutputHash,
+		r.StartedAt.UTC().Format(time.RFC3339Nano),
+		r.FinishedAt.UTC().Format(time.RFC3339Nano),
+		r.KeyID,
+	}, "\n"))
+}
+
+// Hash is the hex SHA-256 of a code, payload or output
+func Hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyID names a public key in receipts
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Signer signs the receipts of one worker
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+var signer *Signer
+
+// Configure loads RECEIPT_SIGNING_KEY; without one no receipt is signed
+func Configure(c config.Receipts) error {
+	signer = nil
+	if c.SigningKey == "" {
+		return nil
+	}
+	key, err := ParsePrivateKey(c.SigningKey)
+	if err != nil {
+		return err
+	}
+	signer = &Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}
+	return nil
+}
+
+// Default is the worker's signer, nil when receipts are disabled
+func Default() *Signer {
+	return signer
+}
+
+// PublicKey is the base64 public key receipts are verified with
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// KeyID names the signer's key in its receipts
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Sign fills in the version and key and signs the receipt
+func (s *Signer) Sign(r Receipt) Receipt {
+	r.Version = Version
+	r.KeyID = s.keyID
+	r.StartedAt, r.FinishedAt = r.StartedAt.UTC(), r.FinishedAt.UTC()
+	r.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, r.Message()))
+	return r
+}
+
+// ParsePrivateKey decodes a base64 ed25519 private key, or its 32-byte seed
+func ParsePrivateKey(text string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	switch {
+	case err != nil:
+	case len(raw) == ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case len(raw) == ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	}
+	return nil, errors.New("RECEIPT_SIGNING_KEY is not a base64 ed25519 private key or seed")
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key
+func ParsePublicKey(text string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%q is not a base64 ed25519 public key", text)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Verify checks the receipt's signature against the trusted key it names,
+// then that it covers the given task, code, payload and output
+func Verify(r Receipt, trusted []ed25519.PublicKey, taskID int, code, payload, output string) error {
+	if r.Version != Version {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalid, r.Version)
+	}
+	var key ed25519.PublicKey
+	for _, k := range trusted {
+		if KeyID(k) == r.KeyID {
+			key = k
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("%w: signed with key %s, which is not trusted", ErrInvalid, r.KeyID)
+	}
+	sig, err := base64.StdEncoding.DecodeString(r.Signature)
+	if err != nil || !ed25519.Verify(key, r.Message(), sig) {
+		return fmt.Errorf("%w: bad signature", ErrInvalid)
+	}
+
+	switch {
+	case r.TaskID != taskID:
+		return fmt.Errorf("%w: issued for task %d", ErrInvalid, r.TaskID)
+	case r.CodeHash != Hash(code):
+		return fmt.Errorf("%w: code differs from the one executed", ErrInvalid)
+	case r.PayloadHash != Hash(payload):
+		return fmt.Errorf("%w: payload differs from the one executed", ErrInvalid)
+	case r.OutputHash != Hash(output):
+		return fmt.Errorf("%w: output differs from the one produced", ErrInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultReportWindow = 7 * 24 * time.Hour
+	defaultReportLimit  = 10
+	maxReportLimit      = 100
+)
+
+// reportWindows are the windows a report can cover. Reports are cached per
+// window, so a fixed set keeps the cache bounded.
+var reportWindows = map[string]time.Duration{
+	"1h":   time.Hour,
+	"24h":  24 * time.Hour,
+	"7d":   7 * 24 * time.Hour,
+	"168h": 7 * 24 * time.Hour,
+}
+
+// reportParams reads the common ?window=&limit= query parameters
+func reportParams(r *http.Request) (time.Duration, int, bool) {
+	window := defaultReportWindow
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, ok := reportWindows[v]
+		if !ok {
+			return 0, 0, false
+		}
+		window = d
+	}
+
+	limit := defaultReportLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, false
+		}
+		limit = min(n, maxReportLimit)
+	}
+	return window, limit, true
+}
+
+func writeReport(w http.ResponseWriter, window time.Duration, data any, err error) {
+	if err != nil {
+		http.Error(w, "Failed to compute report", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"window": window.String(),
+		"data":   data,
+	})
+}
+
+func (s *APIServer) reportsIndexHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode([]string{
+		"/reports/top-failing-codes",
+		"/reports/slowest-tasks",
+		"/reports/busiest-tenants",
+		"/reports/failure-reasons",
+	})
+}
+
+func (s *APIServer) topFailingCodesHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, ok := reportParams(r)
+	if !ok {
+		http.Error(w, "Invalid window or limit", http.StatusBadRequest)
+		return
+	}
+	data, err := s.reports.TopFailingCodes(r.Context(), window, limit)
+	writeReport(w, window, data, err)
+}
+
+func (s *APIServer) slowestTasksHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, ok := reportParams(r)
+	if !ok {
+		http.Error(w, "Invalid window or limit", http.StatusBadRequest)
+		return
+	}
+	data, err := s.reports.SlowestTasks(r.Context(), window, limit)
+	writeReport(w, window, data, err)
+}
+
+func (s *APIServer) busiestTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, ok := reportParams(r)
+	if !ok {
+		http.Error(w, "Invalid window or limit", http.StatusBadRequest)
+		return
+	}
+	data, err := s.reports.BusiestTenants(r.Context(), window, limit)
+	writeReport(w, window, data, err)
+}
+
+func (s *APIServer) failureReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, ok := reportParams(r)
+	if !ok {
+		http.Error(w, "Invalid window or limit", http.StatusBadRequest)
+		return
+	}
+	data, err := s.reports.FailureReasons(r.Context(), window, limit)
+	writeReport(w, window, data, err)
+}
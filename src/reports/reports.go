@@ -0,0 +1,247 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package reports
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"continuumworker/src/model"
+)
+
+// failureStatuses is the SQL list of the statuses counted as failures
+var failureStatuses = model.StatusList(model.FailureStatuses)
+
+// FailingCode is a code entry ranked by failures
+type FailingCode struct {
+	CodeID   string `json:"code_id"`
+	CodeHash string `json:"code_hash"`
+	Failures int    `json:"failures"`
+	Total    int    `json:"total"`
+}
+
+// SlowTask is a finished task ranked by execution time
+type SlowTask struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	CodeID      string    `json:"code_id"`
+	Status      string    `json:"status"`
+	DurationSec float64   `json:"duration_seconds"`
+	Finished    time.Time `json:"finished"`
+}
+
+// TenantActivity is a tenant ranked by task volume
+type TenantActivity struct {
+	TenantID  string `json:"tenant_id"`
+	Tasks     int    `json:"tasks"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+}
+
+// FailureReason groups failed tasks by error message
+type FailureReason struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// Service computes operator reports and caches them for a short TTL so
+// dashboards refreshing every few seconds don't hammer the database.
+type Service struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewService creates a report service with the given cache TTL
+func NewService(db *sql.DB, ttl time.Duration) *Service {
+	return &Service{
+		db:    db,
+		ttl:   ttl,
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// cached returns the cached value for key or computes and stores it.
+// Expired entries are dropped whenever a value is stored.
+func (s *Service) cached(key string, compute func() (any, error)) (any, error) {
+	s.mu.Lock()
+	if entry, ok := s.cache[key]; ok && time.Now().Before(entry.expires) {
+		s.mu.Unlock()
+		return entry.value, nil
+	}
+	s.mu.Unlock()
+
+	value, err := compute()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	for k, entry := range s.cache {
+		if !now.Before(entry.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = cacheEntry{value: value, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return value, nil
+}
+
+// TopFailingCodes ranks code entries by number of failed tasks within the
+// window, each version the tasks ran (pinned or latest) ranked on its own
+func (s *Service) TopFailingCodes(ctx context.Context, window time.Duration, limit int) ([]FailingCode, error) {
+	key := fmt.Sprintf("top-failing-codes:%s:%d", window, limit)
+	v, err := s.cached(key, func() (any, error) {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT t.code::TEXT, COALESCE(cv.sha256, ''),
+				COUNT(*) FILTER (WHERE t.status IN (`+failureStatuses+`)) AS failures,
+				COUNT(*) AS total
+			FROM TASKS t
+			JOIN CODES c ON c.id = t.code
+			JOIN CODE_CONTENTS cv ON cv.code_id = c.id AND cv.version = COALESCE(t.code_version, c.current_version)
+			WHERE t.finished > NOW() - $1 * INTERVAL '1 second'
+			GROUP BY t.code, cv.sha256
+			HAVING COUNT(*) FILTER (WHERE t.status IN (`+failureStatuses+`)) > 0
+			ORDER BY failures DESC
+			LIMIT $2`, window.Seconds(), limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		result := []FailingCode{}
+		for rows.Next() {
+			var fc FailingCode
+			if err := rows.Scan(&fc.CodeID, &fc.CodeHash, &fc.Failures, &fc.Total); err != nil {
+				return nil, err
+			}
+			result = append(result, fc)
+		}
+		return result, rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]FailingCode), nil
+}
+
+// SlowestTasks ranks finished tasks by wall-clock execution time within the window
+func (s *Service) SlowestTasks(ctx context.Context, window time.Duration, limit int) ([]SlowTask, error) {
+	key := fmt.Sprintf("slowest-tasks:%s:%d", window, limit)
+	v, err := s.cached(key, func() (any, error) {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id, name, COALESCE(code::TEXT, ''), status,
+				EXTRACT(EPOCH FROM (finished - started)) AS duration, finished
+			FROM TASKS
+			WHERE finished > NOW() - $1 * INTERVAL '1 second'
+			AND started IS NOT NULL
+			ORDER BY duration DESC
+			LIMIT $2`, window.Seconds(), limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		result := []SlowTask{}
+		for rows.Next() {
+			var st SlowTask
+			if err := rows.Scan(&st.ID, &st.Name, &st.CodeID, &st.Status, &st.DurationSec, &st.Finished); err != nil {
+				return nil, err
+			}
+			result = append(result, st)
+		}
+		return result, rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]SlowTask), nil
+}
+
+// BusiestTenants ranks tenants by number of tasks submitted within the window
+func (s *Service) BusiestTenants(ctx context.Context, window time.Duration, limit int) ([]TenantActivity, error) {
+	key := fmt.Sprintf("busiest-tenants:%s:%d", window, limit)
+	v, err := s.cached(key, func() (any, error) {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT COALESCE(tenant_id, ''),
+				COUNT(*) AS tasks,
+				COUNT(*) FILTER (WHERE status = 'completed'),
+				COUNT(*) FILTER (WHERE status IN (`+failureStatuses+`))
+			FROM TASKS
+			WHERE created_at > NOW() - $1 * INTERVAL '1 second'
+			GROUP BY tenant_id
+			ORDER BY tasks DESC
+			LIMIT $2`, window.Seconds(), limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		result := []TenantActivity{}
+		for rows.Next() {
+			var ta TenantActivity
+			if err := rows.Scan(&ta.TenantID, &ta.Tasks, &ta.Completed, &ta.Failed); err != nil {
+				return nil, err
+			}
+			result = append(result, ta)
+		}
+		return result, rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]TenantActivity), nil
+}
+
+// FailureReasons breaks failed tasks down by the first line of their error
+func (s *Service) FailureReasons(ctx context.Context, window time.Duration, limit int) ([]FailureReason, error) {
+	key := fmt.Sprintf("failure-reasons:%s:%d", window, limit)
+	v, err := s.cached(key, func() (any, error) {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT COALESCE(NULLIF(split_part(last_error, E'\n', 1), ''), status) AS reason, COUNT(*)
+			FROM TASKS
+			WHERE status IN (`+failureStatuses+`)
+			AND finished > NOW() - $1 * INTERVAL '1 second'
+			GROUP BY reason
+			ORDER BY COUNT(*) DESC
+			LIMIT $2`, window.Seconds(), limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		result := []FailureReason{}
+		for rows.Next() {
+			var fr FailureReason
+			if err := rows.Scan(&fr.Reason, &fr.Count); err != nil {
+				return nil, err
+			}
+			result = append(result, fr)
+		}
+		return result, rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]FailureReason), nil
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package results
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxDepth bounds the nesting of decoded msgpack values
+const maxDepth = 512
+
+// msgpackDecoder decodes MessagePack. Maps with non-string keys get their
+// keys formatted as strings, bin values become base64 strings, timestamps
+// RFC 3339 strings and other extensions {"ext_type": n, "data": base64}.
+type msgpackDecoder struct{}
+
+func (msgpackDecoder) Decode(raw []byte, _ string) ([]byte, error) {
+	r := &msgpackReader{buf: raw}
+	v, err := r.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.buf) {
+		return nil, fmt.Errorf("%d trailing bytes after the value", len(r.buf)-r.pos)
+	}
+	return json.Marshal(v)
+}
+
+func (msgpackDecoder) CheckSchema(schema string) error {
+	if schema != "" {
+		return errors.New("msgpack results take no schema")
+	}
+	return nil
+}
+
+func (msgpackDecoder) Binary() bool { return true }
+
+var errTruncated = errors.New("truncated value")
+
+type msgpackReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.buf)-r.pos < n {
+		return nil, errTruncated
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// uint reads an n-byte big-endian unsigned integer
+func (r *msgpackReader) uint(n int) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// length reads an n-byte length, checked against the bytes left so a forged
+// length can't allocate more than the input holds
+func (r *msgpackReader) length(n int) (int, error) {
+	v, err := r.uint(n)
+	if err != nil {
+		return 0, err
+	}
+	if v > uint64(len(r.buf)-r.pos) {
+		return 0, errTruncated
+	}
+	return int(v), nil
+}
+
+func (r *msgpackReader) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("nested deeper than %d levels", maxDepth)
+	}
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return r.mapOf(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return r.arrayOf(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return r.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.length(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.next(n)
+		return append([]byte(nil), data...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return r.ext(n)
+	case 0xca:
+		v, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := r.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return r.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		v, err := r.uint(n)
+		// Sign-extend from n bytes
+		shift := 64 - 8*n
+		return int64(v<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(n)
+	case 0xdc, 0xdd:
+		n, err := r.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.arrayOf(n, depth)
+	case 0xde, 0xdf:
+		n, err := r.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.mapOf(n, depth)
+	}
+	return nil, fmt.Errorf("invalid type byte 0x%02x at offset %d", c, r.pos-1)
+}
+
+func (r *msgpackReader) str(n int) (string, error) {
+	b, err := r.next(n)
+	return string(b), err
+}
+
+func (r *msgpackReader) arrayOf(n, depth int) ([]any, error) {
+	if n > len(r.buf)-r.pos {
+		return nil, errTruncated
+	}
+	out := make([]any, n)
+	for i := range out {
+		v, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (r *msgpackReader) mapOf(n, depth int) (map[string]any, error) {
+	if n > len(r.buf)-r.pos {
+		return nil, errTruncated
+	}
+	out := make(map[string]any, n)
+	for range n {
+		k, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			key = fmt.Sprint(k)
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+// ext reads the type and n data bytes of an extension value
+func (r *msgpackReader) ext(n int) (any, error) {
+	t, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t[0]) == -1 {
+		return timestamp(data)
+	}
+	return map[string]any{"ext_type": int8(t[0]), "data": append([]byte(nil), data...)}, nil
+}
+
+// timestamp decodes the timestamp extension (type -1) in its 32, 64 and
+// 96-bit forms
+func timestamp(data []byte) (string, error) {
+	var t time.Time
+	switch len(data) {
+	case 4:
+		t = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		t = time.Unix(int64(v&0x3ffffffff), int64(v>>34))
+	case 12:
+		t = time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data[:4])))
+	default:
+		return "", fmt.Errorf("invalid timestamp of %d bytes", len(data))
+	}
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package results
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobuf decodes results against the messages of the configured
+// descriptor set (protoc --include_imports --descriptor_set_out)
+var protobuf = &protobufDecoder{}
+
+type protobufDecoder struct {
+	mu    sync.RWMutex
+	files *protoregistry.Files
+}
+
+// load reads a serialized FileDescriptorSet
+func (p *protobufDecoder) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read protobuf descriptors: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("invalid protobuf descriptor set %s: %w", path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return fmt.Errorf("invalid protobuf descriptor set %s: %w", path, err)
+	}
+	p.mu.Lock()
+	p.files = files
+	p.mu.Unlock()
+	return nil
+}
+
+// message resolves a fully-qualified message name, e.g. "billing.v1.Invoice"
+func (p *protobufDecoder) message(name string) (protoreflect.MessageDescriptor, error) {
+	if name == "" {
+		return nil, errors.New("protobuf results need the message name as schema")
+	}
+	p.mu.RLock()
+	files := p.files
+	p.mu.RUnlock()
+	if files == nil {
+		return nil, errors.New("no protobuf descriptors loaded, set RESULT_PROTO_DESCRIPTORS")
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("unknown message %s: %w", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
+
+func (p *protobufDecoder) Decode(raw []byte, schema string) ([]byte, error) {
+	md, err := p.message(schema)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(raw, msg); err != nil {
+		return nil, err
+	}
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+}
+
+func (p *protobufDecoder) CheckSchema(schema string) error {
+	_, err := p.message(schema)
+	return err
+}
+
+func (p *protobufDecoder) Binary() bool { return true }
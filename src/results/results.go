@@ -0,0 +1,156 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package results decodes the result a script writes to stdout in the format
+// its code declares (json, msgpack or protobuf) into normalized JSON, stored
+// next to the raw result so strongly-typed consumers get what the script
+// produced. Codes declaring no format keep free-form text output.
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"continuumworker/src/config"
+)
+
+// ErrMismatch wraps every failure to decode a result in its declared format
+var ErrMismatch = errors.New("result doesn't match its declared format")
+
+// Contract is the result format a code declares
+type Contract struct {
+	Format string // "" for free-form text output
+	Schema string // Schema reference, e.g. the message name of protobuf results
+}
+
+// Decoder turns the raw results of one format into JSON
+type Decoder interface {
+	// Decode returns the JSON form of raw, read against schema
+	Decode(raw []byte, schema string) ([]byte, error)
+	// CheckSchema validates the schema reference of a code declaring the format
+	CheckSchema(schema string) error
+	// Binary reports whether raw results are bytes rather than text, so
+	// they can't be stored as the task's text output
+	Binary() bool
+}
+
+var (
+	mu       sync.RWMutex
+	decoders = map[string]Decoder{
+		"json":     jsonDecoder{},
+		"msgpack":  msgpackDecoder{},
+		"protobuf": protobuf,
+	}
+)
+
+// Register adds (or replaces) the decoder of a result format, for formats
+// beyond the built-in json, msgpack and protobuf
+func Register(format string, d Decoder) {
+	mu.Lock()
+	defer mu.Unlock()
+	decoders[format] = d
+}
+
+// Formats lists the registered result formats
+func Formats() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	formats := make([]string, 0, len(decoders))
+	for format := range decoders {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// Configure loads the protobuf descriptor set protobuf results are decoded
+// with, if one is configured
+func Configure(c config.Code) error {
+	if c.ResultDescriptors == "" {
+		return nil
+	}
+	return protobuf.load(c.ResultDescriptors)
+}
+
+func decoder(format string) (Decoder, error) {
+	mu.RLock()
+	d, ok := decoders[format]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown result format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return d, nil
+}
+
+// Validate checks the contract when a code declares it
+func (c Contract) Validate() error {
+	if c.Format == "" {
+		if c.Schema != "" {
+			return errors.New("result_schema requires a result_format")
+		}
+		return nil
+	}
+	d, err := decoder(c.Format)
+	if err != nil {
+		return err
+	}
+	if err := d.CheckSchema(c.Schema); err != nil {
+		return fmt.Errorf("result_schema: %w", err)
+	}
+	return nil
+}
+
+// Binary reports whether the contract's raw results are bytes
+func (c Contract) Binary() bool {
+	if c.Format == "" {
+		return false
+	}
+	d, err := decoder(c.Format)
+	return err == nil && d.Binary()
+}
+
+// Decode returns the JSON form of a raw result. Every error wraps ErrMismatch.
+func Decode(c Contract, raw []byte) (json.RawMessage, error) {
+	d, err := decoder(c.Format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMismatch, err)
+	}
+	out, err := d.Decode(raw, c.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrMismatch, c.Format, err)
+	}
+	return out, nil
+}
+
+// jsonDecoder checks that the result is a single JSON value and compacts it
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(raw []byte, _ string) ([]byte, error) {
+	var out bytes.Buffer
+	if err := json.Compact(&out, bytes.TrimSpace(raw)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (jsonDecoder) CheckSchema(schema string) error {
+	if schema != "" {
+		return errors.New("json results take no schema")
+	}
+	return nil
+}
+
+func (jsonDecoder) Binary() bool { return false }
@@ -0,0 +1,211 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package retention keeps the TASKS table small: finished tasks older than
+// the retention TTL are moved to TASKS_ARCHIVE, or exported as JSONL to
+// object storage, and deleted from TASKS along with their attempts, outputs,
+// artifact records and events
+package retention
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"path"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+	"continuumworker/src/model"
+	"continuumworker/src/pgdb"
+	"continuumworker/src/storage"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const metricArchived = "worker_tasks_archived"
+
+// Statuses are the final task statuses that expire; held tasks wait for an
+// operator and never do
+var Statuses = model.StatusStrings(model.FinalStatuses)
+
+// document is the archived form of a task: its TASKS row with its attempts,
+// rich outputs, artifact records, network log and state transitions, which
+// are deleted along with it
+const document = `to_jsonb(t) || jsonb_build_object(
+		'attempts', COALESCE((SELECT jsonb_agg(to_jsonb(a) ORDER BY a.id) FROM TASK_ATTEMPTS a WHERE a.task_id = t.id), '[]'),
+		'outputs', COALESCE((SELECT jsonb_agg(to_jsonb(o) ORDER BY o.seq) FROM TASK_OUTPUTS o WHERE o.task_id = t.id), '[]'),
+		'artifacts', COALESCE((SELECT jsonb_agg(to_jsonb(f) ORDER BY f.path) FROM TASK_ARTIFACTS f WHERE f.task_id = t.id), '[]'),
+		'network_log', COALESCE((SELECT jsonb_agg(to_jsonb(n) ORDER BY n.id) FROM TASK_NETWORK_LOG n WHERE n.task_id = t.id), '[]'),
+		'events', COALESCE((SELECT jsonb_agg(to_jsonb(e) ORDER BY e.id) FROM TASK_EVENTS e WHERE e.task_id = t.id), '[]'))`
+
+// Restored selects the TASKS row of an archived task (a TASKS_ARCHIVE row),
+// in the column order of TASKS. Columns added to TASKS since the task was
+// archived are NULL.
+const Restored = `(jsonb_populate_record(NULL::TASKS, task)).*`
+
+// RegisterMetrics registers the retention metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricArchived, "Number of expired tasks moved out of TASKS, by destination (table, object)", "Task")
+}
+
+// Run archives expired tasks every interval until ctx is cancelled. Every
+// worker may run it: batches are locked with SKIP LOCKED, so workers archive
+// different tasks.
+func Run(ctx context.Context, db *sql.DB, cfg config.Retention) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			count, err := Archive(ctx, db, cfg)
+			if err != nil && ctx.Err() == nil {
+				logging.Log(ctx, fmt.Sprintf("Error archiving expired tasks: %v", err), slog.LevelWarn)
+			}
+			if count > 0 {
+				logging.Log(ctx, fmt.Sprintf("Archived %d tasks finished more than %s ago", count, cfg.TTL), slog.LevelInfo)
+			}
+		}
+	}
+}
+
+// target is where expired tasks go: TASKS_ARCHIVE when store is nil
+type target struct {
+	store  storage.ObjectClient
+	bucket string
+	prefix string
+}
+
+func (t target) name() string {
+	if t.store == nil {
+		return "table"
+	}
+	return "object"
+}
+
+// open resolves the configured destination and its object storage client
+func open(cfg config.Retention) (target, error) {
+	if cfg.Destination == "" {
+		return target{}, nil
+	}
+	scheme, bucket, prefix, ok := storage.ParseURL(cfg.Destination)
+	if !ok {
+		return target{}, fmt.Errorf("archive destination %q is not an s3://, gs:// or az:// URL", cfg.Destination)
+	}
+	store, err := storage.NewClientFromEnv(scheme)
+	if err != nil {
+		return target{}, err
+	}
+	return target{store: store, bucket: bucket, prefix: prefix}, nil
+}
+
+// Check reports a destination that can't be used, so it fails at startup
+func Check(cfg config.Retention) error {
+	_, err := open(cfg)
+	return err
+}
+
+// Archive moves every task that finished more than cfg.TTL ago out of TASKS,
+// cfg.BatchSize tasks per transaction, and returns how many it moved
+func Archive(ctx context.Context, db *sql.DB, cfg config.Retention) (int, error) {
+	dest, err := open(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for {
+		count, err := archiveBatch(ctx, db, cfg, dest)
+		total += count
+		if count > 0 {
+			logging.Add(ctx, metricArchived, float64(count), attribute.String("destination", dest.name()))
+		}
+		if err != nil || count < cfg.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// archiveBatch archives one batch of expired tasks in a transaction. If the
+// delete fails after an export was uploaded, the tasks stay in TASKS and are
+// exported again by a later pass.
+func archiveBatch(ctx context.Context, db *sql.DB, cfg config.Retention, dest target) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var ids []int64
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(array_agg(id ORDER BY id), '{}') FROM (
+			SELECT id FROM TASKS
+			WHERE status = ANY($1) AND finished < NOW() - $2 * INTERVAL '1 second'
+			ORDER BY finished
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		) batch`, Statuses, cfg.TTL.Seconds(), cfg.BatchSize).Scan(pgdb.Array(&ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to select expired tasks: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if dest.store == nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO TASKS_ARCHIVE (id, status, finished, task)
+			SELECT t.id, t.status, t.finished, `+document+`
+			FROM TASKS t WHERE t.id = ANY($1)
+			ON CONFLICT (id) DO NOTHING`, ids)
+	} else {
+		err = export(ctx, tx, dest, ids)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive tasks: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM TASKS WHERE id = ANY($1)", ids); err != nil {
+		return 0, fmt.Errorf("failed to delete archived tasks: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// export uploads the tasks as one JSONL object named after their ID range
+func export(ctx context.Context, tx *sql.Tx, dest target, ids []int64) error {
+	rows, err := tx.QueryContext(ctx, `SELECT `+document+`::TEXT FROM TASKS t WHERE t.id = ANY($1) ORDER BY t.id`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var buf bytes.Buffer
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	key := path.Join(dest.prefix, fmt.Sprintf("tasks-%s-%d-%d.jsonl", time.Now().UTC().Format("20060102T150405Z"), ids[0], ids[len(ids)-1]))
+	return dest.store.PutObject(ctx, dest.bucket, key, &buf, int64(buf.Len()), "application/x-ndjson")
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package retry runs operations under a retry policy: a bounded number of
+// attempts separated by exponentially growing, jittered delays, retrying
+// only the error classes the policy lists.
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// Policy controls how often and how fast an operation is retried
+type Policy struct {
+	MaxAttempts int           `yaml:"max_attempts"` // Total attempts, including the first one
+	BaseDelay   time.Duration `yaml:"base_delay"`   // Delay after the first failure, doubled after each further one
+	MaxDelay    time.Duration `yaml:"max_delay"`    // Upper bound of a single delay
+	Jitter      float64       `yaml:"jitter"`       // Fraction (0-1) by which a delay is randomly shortened
+	RetryOn     []string      `yaml:"retry_on"`     // Error classes worth another attempt
+}
+
+// Validate checks the policy bounds
+func (p Policy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return errors.New("max attempts must be at least 1")
+	case p.BaseDelay < 0:
+		return errors.New("base delay must not be negative")
+	case p.MaxDelay < p.BaseDelay:
+		return errors.New("max delay must not be below the base delay")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return errors.New("jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// Retries reports whether errors of the class are retried
+func (p Policy) Retries(class string) bool {
+	return slices.Contains(p.RetryOn, class)
+}
+
+// Delay returns the wait after the given failed attempt (1 for the first)
+func (p Policy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	return d - time.Duration(float64(d)*p.Jitter*rand.Float64())
+}
+
+// UnmarshalJSON overrides only the fields present in data, so a partial
+// policy (e.g. a task's {"max_attempts": 5}) inherits the rest from the
+// policy it is decoded into. Delays are duration strings like "500ms".
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MaxAttempts *int     `json:"max_attempts"`
+		BaseDelay   *string  `json:"base_delay"`
+		MaxDelay    *string  `json:"max_delay"`
+		Jitter      *float64 `json:"jitter"`
+		RetryOn     []string `json:"retry_on"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.MaxAttempts != nil {
+		p.MaxAttempts = *raw.MaxAttempts
+	}
+	if raw.BaseDelay != nil {
+		d, err := time.ParseDuration(*raw.BaseDelay)
+		if err != nil {
+			return fmt.Errorf("base_delay: %w", err)
+		}
+		p.BaseDelay = d
+	}
+	if raw.MaxDelay != nil {
+		d, err := time.ParseDuration(*raw.MaxDelay)
+		if err != nil {
+			return fmt.Errorf("max_delay: %w", err)
+		}
+		p.MaxDelay = d
+	}
+	if raw.Jitter != nil {
+		p.Jitter = *raw.Jitter
+	}
+	if raw.RetryOn != nil {
+		p.RetryOn = raw.RetryOn
+	}
+	return nil
+}
+
+// Do calls fn until it succeeds, fails with an error whose class (as told by
+// classify) the policy doesn't retry, runs out of attempts or ctx is done.
+// onRetry, if not nil, is told about each failure that will be retried. The
+// last error is returned.
+func Do(ctx context.Context, p Policy, classify func(error) string, fn func(attempt int) error, onRetry func(attempt int, err error, delay time.Duration)) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.Retries(classify(err)) {
+			return err
+		}
+
+		delay := p.Delay(attempt)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
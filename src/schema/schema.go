@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package schema validates task payloads against the JSON Schema stored with
+// their code, so malformed input fails fast with a clear error instead of
+// crashing the script.
+package schema
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// ErrInvalidPayload marks a payload that doesn't match its code's schema
+var ErrInvalidPayload = errors.New("payload does not match the code's schema")
+
+// maxCached bounds the compiled schema cache; it is reset when full
+const maxCached = 256
+
+var (
+	cacheMu sync.Mutex
+	cache   = map[[32]byte]*jsonschema.Schema{}
+)
+
+// Compile parses and compiles a JSON Schema document. Only the document
+// itself is used: remote references are not fetched.
+func Compile(doc string) (*jsonschema.Schema, error) {
+	key := sha256.Sum256([]byte(doc))
+	cacheMu.Lock()
+	sch, ok := cache[key]
+	cacheMu.Unlock()
+	if ok {
+		return sch, nil
+	}
+
+	parsed, err := jsonschema.UnmarshalJSON(strings.NewReader(doc))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("schema.json", parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	sch, err = c.Compile("schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+
+	cacheMu.Lock()
+	if len(cache) >= maxCached {
+		clear(cache)
+	}
+	cache[key] = sch
+	cacheMu.Unlock()
+	return sch, nil
+}
+
+// Validate checks a JSON payload against a JSON Schema document. An empty
+// schema accepts any payload.
+func Validate(doc, payload string) error {
+	if doc == "" {
+		return nil
+	}
+	sch, err := Compile(doc)
+	if err != nil {
+		return err
+	}
+	inst, err := jsonschema.UnmarshalJSON(strings.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("%w: invalid JSON: %v", ErrInvalidPayload, err)
+	}
+	if err := sch.Validate(inst); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	return nil
+}
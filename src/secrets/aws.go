@@ -0,0 +1,121 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"continuumworker/src/storage"
+)
+
+// AWS reads secrets from AWS Secrets Manager. A name is a secret ID (name or
+// ARN), optionally followed by "#key" to pick a key of a JSON secret.
+type AWS struct {
+	Endpoint    string
+	Region      string
+	Credentials storage.Credentials
+	HTTPClient  *http.Client
+}
+
+// NewAWSFromEnv builds a Secrets Manager client from the standard AWS_*
+// variables. SECRETSMANAGER_ENDPOINT overrides the regional endpoint, e.g.
+// for a VPC endpoint or LocalStack.
+func NewAWSFromEnv() (*AWS, error) {
+	creds := storage.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for the %s secrets provider", ProviderAWS)
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimSuffix(os.Getenv("SECRETSMANAGER_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", region)
+	}
+
+	return &AWS{
+		Endpoint:    endpoint,
+		Region:      region,
+		Credentials: creds,
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (a *AWS) Get(ctx context.Context, name string) (string, error) {
+	id, key, _ := strings.Cut(name, "#")
+	payload, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to build Secrets Manager request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	storage.SignRequest(req, a.Credentials, a.Region, "secretsmanager", payload)
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s from Secrets Manager: %w", id, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if bytes.Contains(msg, []byte("ResourceNotFoundException")) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return "", fmt.Errorf("failed to read secret %s from Secrets Manager: %s: %s", id, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var body struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode secret %s from Secrets Manager: %w", id, err)
+	}
+	if body.SecretString == nil {
+		return "", fmt.Errorf("secret %s is binary, only string secrets can be injected", id)
+	}
+	if key == "" {
+		return *body.SecretString, nil
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal([]byte(*body.SecretString), &values); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, can't read key %q", id, key)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no key %q", ErrNotFound, id, key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
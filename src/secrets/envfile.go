@@ -0,0 +1,49 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// EnvFile reads secrets from a KEY=value file, e.g. a mounted Kubernetes
+// secret. The file is read on every lookup so rotations apply right away.
+type EnvFile struct {
+	Path string
+}
+
+// NewEnvFile checks that the file is readable
+func NewEnvFile(path string) (*EnvFile, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SECRETS_FILE must be set for the %s secrets provider", ProviderEnvFile)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open secrets file: %w", err)
+	}
+	return &EnvFile{Path: path}, nil
+}
+
+func (f *EnvFile) Get(ctx context.Context, name string) (string, error) {
+	values, err := godotenv.Read(f.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	value, ok := values[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package secrets resolves the secret names task payloads reference in their
+// env map. Values are fetched from the configured provider when the task is
+// claimed and only ever live in the worker's memory and the sandbox's
+// environment; they are never written to the database.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/logging"
+)
+
+// Provider names accepted in SECRETS_PROVIDER
+const (
+	ProviderEnvFile = "env-file"
+	ProviderVault   = "vault"
+	ProviderAWS     = "aws"
+)
+
+var (
+	// ErrNotFound is returned when the provider has no secret of that name
+	ErrNotFound = errors.New("secret not found")
+	// ErrNoProvider is returned when a task references a secret but no
+	// provider is configured
+	ErrNoProvider = errors.New("no secrets provider configured")
+)
+
+// Provider fetches secret values by name
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// cached wraps a provider, keeping values in memory for ttl so a batch of
+// tasks using the same secret makes a single request
+type cached struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+}
+
+func (c *cached) Get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[name] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// NewProviderFromConfig builds the configured provider, or returns nil when
+// SECRETS_PROVIDER is unset
+func NewProviderFromConfig(c config.Secrets) (Provider, error) {
+	var provider Provider
+	var err error
+	switch c.Provider {
+	case "":
+		return nil, nil
+	case ProviderEnvFile:
+		provider, err = NewEnvFile(c.File)
+	case ProviderVault:
+		provider, err = NewVaultFromEnv()
+	case ProviderAWS:
+		provider, err = NewAWSFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (expected %s, %s or %s)", c.Provider, ProviderEnvFile, ProviderVault, ProviderAWS)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.CacheTTL > 0 {
+		provider = &cached{provider: provider, ttl: c.CacheTTL, entries: make(map[string]cacheEntry)}
+	}
+	return provider, nil
+}
+
+// settings is the secrets configuration, see Configure
+var settings = config.Default().Secrets
+
+// Configure installs the secrets configuration. It must be called before
+// Default.
+func Configure(c config.Secrets) {
+	settings = c
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultProvider Provider
+	defaultErr      error
+)
+
+// Default returns the process-wide provider built from the configuration,
+// nil if none is configured
+func Default() (Provider, error) {
+	defaultOnce.Do(func() {
+		defaultProvider, defaultErr = NewProviderFromConfig(settings)
+		if defaultErr == nil && defaultProvider != nil {
+			logging.Log(context.Background(), fmt.Sprintf("Secrets provider enabled: %s", settings.Provider), slog.LevelInfo)
+		}
+	})
+	return defaultProvider, defaultErr
+}
+
+// Get resolves a secret through the default provider
+func Get(ctx context.Context, name string) (string, error) {
+	provider, err := Default()
+	if err != nil {
+		return "", err
+	}
+	if provider == nil {
+		return "", fmt.Errorf("%w: secret %s can't be resolved", ErrNoProvider, name)
+	}
+	return provider.Get(ctx, name)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Vault reads secrets from a HashiCorp Vault KV version 2 engine. A name is
+// "path#field"; without a field the "value" field is read.
+type Vault struct {
+	Addr       string
+	Token      string
+	Namespace  string // Vault Enterprise namespace, "" for none
+	Mount      string // Mount path of the KV engine
+	HTTPClient *http.Client
+}
+
+// NewVaultFromEnv builds a Vault client from VAULT_ADDR, VAULT_TOKEN,
+// VAULT_NAMESPACE and VAULT_KV_MOUNT (default "secret")
+func NewVaultFromEnv() (*Vault, error) {
+	v := &Vault{
+		Addr:       strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/"),
+		Token:      os.Getenv("VAULT_TOKEN"),
+		Namespace:  os.Getenv("VAULT_NAMESPACE"),
+		Mount:      strings.Trim(os.Getenv("VAULT_KV_MOUNT"), "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if v.Addr == "" || v.Token == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN must be set for the %s secrets provider", ProviderVault)
+	}
+	if v.Mount == "" {
+		v.Mount = "secret"
+	}
+	return v, nil
+}
+
+func (v *Vault) Get(ctx context.Context, name string) (string, error) {
+	path, field, _ := strings.Cut(name, "#")
+	if field == "" {
+		field = "value"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/%s/data/%s", v.Addr, v.Mount, strings.TrimPrefix(path, "/")), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build Vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s from Vault: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("failed to read secret %s from Vault: %s: %s", name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode secret %s from Vault: %w", name, err)
+	}
+	value, ok := body.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no field %q", ErrNotFound, path, field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
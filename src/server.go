@@ -17,130 +17,271 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
+	"continuumworker/src/auth"
+	"continuumworker/src/config"
+	"continuumworker/src/health"
+	"continuumworker/src/imagesync"
 	"continuumworker/src/logging"
+	"continuumworker/src/model"
+	"continuumworker/src/reports"
+	"continuumworker/src/stats"
+	"continuumworker/src/taskwait"
+	"continuumworker/src/workers"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // APIServer holds dependencies for the HTTP handlers
 type APIServer struct {
-	db    *sql.DB
-	stats *logging.WorkerStats
+	db        *sql.DB
+	stats     *stats.WorkerStats
+	reports   *reports.Service
+	drain     *workers.Drain
+	lifecycle *workers.Lifecycle
+	health    *health.Checker
+	deadman   *workers.Deadman
+	images    *imagesync.Manager
+	// Lifetime of signed artifact URLs, see signedURLHandler
+	signedURLTTL    time.Duration
+	signedURLMaxTTL time.Duration
+	// Waits on finishing tasks, see taskWaitHandler
+	waiter         *taskwait.Waiter
+	waitTimeout    time.Duration
+	waitMaxTimeout time.Duration
+
+	httpServer *http.Server
 }
 
-// StartAPIServer starts the HTTP server with graceful shutdown and OTel
-func StartAPIServer(port string, db *sql.DB, workerStats *logging.WorkerStats) error {
-	// 1. Setup Context for Graceful Shutdown
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+// NewAPIServer builds the HTTP server and its routes. It doesn't listen
+// until Start is called; the caller owns OTel and the shutdown signal. The
+// server closes waiter on Shutdown.
+func NewAPIServer(cfg config.API, db *sql.DB, workerStats *stats.WorkerStats, drain *workers.Drain, lifecycle *workers.Lifecycle, checker *health.Checker, deadman *workers.Deadman, imageExport http.Handler, images *imagesync.Manager, waiter *taskwait.Waiter) *APIServer {
+	srv := &APIServer{
+		db:        db,
+		stats:     workerStats,
+		reports:   reports.NewService(db, cfg.ReportsCacheTTL),
+		drain:     drain,
+		lifecycle: lifecycle,
+		health:    checker,
+		deadman:   deadman,
+		images:    images,
 
-	// 2. Setup OpenTelemetry
-	otelShutdown, err := logging.SetupOTelSDK(context.Background())
-	if err != nil {
-		return fmt.Errorf("failed to setup OTel SDK: %w", err)
+		signedURLTTL:    cfg.SignedURLTTL,
+		signedURLMaxTTL: cfg.SignedURLMaxTTL,
+		waiter:          waiter,
+		waitTimeout:     cfg.WaitTimeout,
+		waitMaxTimeout:  cfg.WaitMaxTimeout,
 	}
-	defer func() {
-		// Ensure OTel flushes spans before exiting
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := otelShutdown(shutdownCtx); err != nil {
-			fmt.Fprintf(os.Stderr, "OTel shutdown error: %v\n", err)
-		}
-	}()
 
-	srv := &APIServer{
-		db:    db,
-		stats: workerStats,
+	mux := http.NewServeMux()
+
+	// Probes stay open; the rest needs the read role, and changes to tasks
+	// or the worker the operator role
+	authn := auth.New(cfg)
+	if !authn.Enabled() {
+		logging.Log(context.Background(), "API authentication is disabled by API_AUTH_DISABLED, every request gets the operator role", slog.LevelWarn)
+	} else if !authn.Configured() {
+		logging.Log(context.Background(), "No API credentials are configured, every request but the probes is refused: set API_READ_TOKENS, API_OPERATOR_TOKENS or API_JWT_SECRET", slog.LevelError)
+	}
+	read := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, authn.Require(auth.RoleRead, handler))
+	}
+	operate := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, authn.Require(auth.RoleOperator, handler))
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/status", srv.statusHandler)
-	mux.HandleFunc("/global-status", srv.globalStatusHandler)
+	mux.HandleFunc("GET /healthz", srv.healthzHandler)
+	mux.HandleFunc("GET /readyz", srv.readyzHandler)
+	read("/status", http.HandlerFunc(srv.statusHandler))
+	read("/global-status", http.HandlerFunc(srv.globalStatusHandler))
+	read("GET /policy", http.HandlerFunc(srv.policyHandler))
+	read("GET /images", http.HandlerFunc(srv.imagesHandler))
+	operate("POST /drain", http.HandlerFunc(srv.drainHandler))
+	read("GET /workers", http.HandlerFunc(srv.workersHandler))
+	read("GET /queues", http.HandlerFunc(srv.queuesHandler))
+	operate("POST /tasks", http.HandlerFunc(srv.submitTaskHandler))
+	read("POST /tasks/estimate", http.HandlerFunc(srv.estimateTaskHandler))
+	operate("POST /batches", http.HandlerFunc(srv.createBatchHandler))
+	read("GET /batches/{id}", http.HandlerFunc(srv.batchHandler))
+	read("GET /codes/{id}/versions", http.HandlerFunc(srv.codeVersionsHandler))
+	operate("POST /codes/{id}/versions", http.HandlerFunc(srv.publishCodeHandler))
+	operate("POST /codes/{id}/rollback", http.HandlerFunc(srv.rollbackCodeHandler))
+	read("GET /codes/{id}/warmup", http.HandlerFunc(srv.codeWarmupHandler))
+	operate("PUT /codes/{id}/warmup", http.HandlerFunc(srv.setCodeWarmupHandler))
+	read("GET /tasks", http.HandlerFunc(srv.listTasksHandler))
+	read("GET /tasks/{id}", http.HandlerFunc(srv.taskHandler))
+	read("GET /tasks/{id}/wait", http.HandlerFunc(srv.taskWaitHandler))
+	read("GET /tasks/{id}/events", http.HandlerFunc(srv.taskEventsHandler))
+	read("GET /tasks/{id}/webhooks", http.HandlerFunc(srv.taskWebhooksHandler))
+	read("GET /webhooks/deliveries", http.HandlerFunc(srv.webhookDeliveriesHandler))
+	read("GET /tasks/{id}/logs/stream", http.HandlerFunc(srv.taskLogStreamHandler))
+	read("GET /tasks/{id}/artifacts", http.HandlerFunc(srv.taskArtifactsHandler))
+	read("GET /tasks/{id}/artifacts/{path...}", http.HandlerFunc(srv.taskArtifactHandler))
+	read("POST /tasks/{id}/signed-urls", http.HandlerFunc(srv.signedURLHandler))
+	read("GET /tasks/{id}/outputs", http.HandlerFunc(srv.taskOutputsHandler))
+	read("GET /tasks/{id}/outputs/{seq}", http.HandlerFunc(srv.taskOutputHandler))
+	read("GET /tasks/{id}/diff", http.HandlerFunc(srv.taskDiffHandler))
+	read("GET /reports", http.HandlerFunc(srv.reportsIndexHandler))
+	read("GET /reports/top-failing-codes", http.HandlerFunc(srv.topFailingCodesHandler))
+	read("GET /reports/slowest-tasks", http.HandlerFunc(srv.slowestTasksHandler))
+	read("GET /reports/busiest-tenants", http.HandlerFunc(srv.busiestTenantsHandler))
+	read("GET /reports/failure-reasons", http.HandlerFunc(srv.failureReasonsHandler))
+	if imageExport != nil {
+		read("GET "+imagesync.ExportPath, imageExport)
+	}
 
-	// 3. Wrap Mux with OTel Middleware
-	// CRITICAL: We must use the returned handler from otelhttp.NewHandler
-	otelHandler := otelhttp.NewHandler(mux, "worker-api-server")
+	// Wrap the mux with the OTel middleware, spans and metrics go to the
+	// providers set up by the caller
+	srv.httpServer = &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.Port),
+		Handler: otelhttp.NewHandler(mux, "worker-api-server"),
+	}
+	return srv
+}
 
-	httpServer := &http.Server{
-		Addr:    ":" + port,
-		Handler: otelHandler,
+// Start listens on the configured port and serves in the background. A
+// failure to listen (e.g. the port is taken) is returned right away.
+func (s *APIServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("server startup failed: %w", err)
 	}
 
-	// 4. Run Server in Background
-	serverErr := make(chan error, 1)
+	logging.Log(ctx, fmt.Sprintf("API Server listening on %s", listener.Addr()), slog.LevelInfo)
 	go func() {
-		fmt.Printf("API Server starting on :%s\n", port)
-		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			serverErr <- err
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Log(ctx, fmt.Sprintf("API Server stopped: %v", err), slog.LevelError)
 		}
 	}()
+	return nil
+}
 
-	// 5. Wait for Shutdown Signal or Error
-	select {
-	case err := <-serverErr:
-		return fmt.Errorf("server startup failed: %w", err)
-	case <-ctx.Done():
-		fmt.Println("\nShutdown signal received, closing server...")
-		
-		// Gracefully shut down the HTTP server (max 10s timeout)
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		
-		if err := httpServer.Shutdown(shutdownCtx); err != nil {
-			return fmt.Errorf("graceful shutdown failed: %w", err)
-		}
-		fmt.Println("Server exited cleanly")
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done. Requests waiting on a task return its current state
+// right away.
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	_ = s.waiter.Close()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
 	}
-
+	logging.Log(ctx, "Server exited cleanly", slog.LevelInfo)
 	return nil
 }
 
+// imagesHandler reports the readiness and pull progress of the runtime images
+func (s *APIServer) imagesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.images.Status())
+}
+
 func (s *APIServer) statusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(s.stats.GetStats())
+	_ = json.NewEncoder(w).Encode(s.stats.Snapshot())
+}
+
+// healthzHandler reports liveness: the process is up and serving, and its
+// main loop is making progress. The dependencies are reported too, but a
+// failing one doesn't fail the probe: restarting the worker wouldn't bring
+// the database or Docker back. A stalled main loop does, with a 503, as
+// restarting the worker is what recovers it.
+func (s *APIServer) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	components, healthy := s.health.Run(r.Context())
+	idle, stalled := s.deadman.Stalled()
+	resp := struct {
+		Status       string             `json:"status"`
+		LoopIdleSecs float64            `json:"loop_idle_seconds"`
+		Components   []health.Component `json:"components"`
+	}{Status: "ok", LoopIdleSecs: idle.Seconds(), Components: components}
+	switch {
+	case stalled:
+		resp.Status = "stalled"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	case !healthy:
+		resp.Status = "degraded"
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// readyzHandler reports whether the worker is accepting tasks. It returns 503
+// once the worker has quarantined itself after repeated infrastructure
+// failures, while it is draining, while its main loop is stalled, while the database, the Docker daemon
+// or the task queue is unreachable, or while a runtime image is not pulled.
+func (s *APIServer) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	components, healthy := s.health.Run(r.Context())
+	_, stalled := s.deadman.Stalled()
+	resp := struct {
+		Ready               bool               `json:"ready"`
+		Draining            bool               `json:"draining"`
+		ConsecutiveFailures int64              `json:"consecutive_infra_failures"`
+		Reason              string             `json:"reason,omitempty"`
+		Components          []health.Component `json:"components"`
+	}{
+		Ready:               healthy && !s.drain.Quarantined() && !s.lifecycle.IsDraining() && !stalled,
+		Draining:            s.lifecycle.IsDraining(),
+		ConsecutiveFailures: s.drain.ConsecutiveFailures(),
+		Reason:              s.drain.Reason(),
+		Components:          components,
+	}
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// drainHandler starts a graceful drain: the worker finishes its in-flight
+// task (up to DRAIN_TIMEOUT), then cleans up and exits
+func (s *APIServer) drainHandler(w http.ResponseWriter, r *http.Request) {
+	s.lifecycle.Drain("requested via API")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("draining"))
 }
 
 func (s *APIServer) globalStatusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var gs logging.GlobalStats
-
-	// Combined query for better performance
-	query := `
-		WITH counts AS (
-			SELECT 
-				COUNT(*) as total,
-				COUNT(*) FILTER (WHERE status = 'pending') as pending,
-				COUNT(*) FILTER (WHERE status = 'running') as running,
-				COUNT(*) FILTER (WHERE status = 'completed') as completed,
-				COUNT(*) FILTER (WHERE status = 'failed') as failed
-			FROM TASKS
-		),
-		performance AS (
-			SELECT 
-				COALESCE(AVG(EXTRACT(EPOCH FROM (finished - started))), 0) as avg_exec,
-				COALESCE(COUNT(*) FILTER (WHERE finished > NOW() - INTERVAL '1 hour'), 0) as throughput
-			FROM TASKS 
-			WHERE status = 'completed' AND finished IS NOT NULL AND started IS NOT NULL
-		)
-		SELECT * FROM counts, performance;
-	`
-
-	err := s.db.QueryRowContext(r.Context(), query).Scan(
-		&gs.TotalTasks, &gs.PendingTasks, &gs.RunningTasks, 
-		&gs.CompletedTasks, &gs.FailedTasks, &gs.AvgExecutionSec, &gs.ThroughputTasks,
-	)
+	var gs stats.GlobalStats
+
+	// Counted per status, then mapped to the taxonomy by GlobalStats.Count
+	rows, err := s.db.QueryContext(r.Context(), "SELECT status, COUNT(*) FROM TASKS GROUP BY status")
+	if err != nil {
+		http.Error(w, "Failed to query system stats", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			http.Error(w, "Failed to query system stats", http.StatusInternalServerError)
+			return
+		}
+		gs.Count(status, count)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to query system stats", http.StatusInternalServerError)
+		return
+	}
 
+	err = s.db.QueryRowContext(r.Context(), `
+		SELECT
+			COALESCE(AVG(EXTRACT(EPOCH FROM (finished - started))), 0) as avg_exec,
+			COALESCE(COUNT(*) FILTER (WHERE finished > NOW() - INTERVAL '1 hour'), 0) as throughput
+		FROM TASKS
+		WHERE status = $1 AND finished IS NOT NULL AND started IS NOT NULL`, model.TaskCompleted,
+	).Scan(&gs.AvgExecutionSec, &gs.ThroughputTasks)
 	if err != nil {
 		http.Error(w, "Failed to query system stats", http.StatusInternalServerError)
 		return
 	}
 
 	_ = json.NewEncoder(w).Encode(gs)
-}
\ No newline at end of file
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package stats
+
+import (
+	"continuumworker/src/model"
+	"sync/atomic"
+	"time"
+)
+
+// StatusResponse for JSON output
+type StatusResponse struct {
+	ID               string      `json:"id"`
+	StartTime        time.Time   `json:"start_time"`
+	Uptime           string      `json:"uptime"`
+	TasksProcessed   uint64      `json:"tasks_processed"`
+	TasksSuccessful  uint64      `json:"tasks_successful"`
+	TasksFailed      uint64      `json:"tasks_failed"`
+	DatabaseFailures uint64      `json:"database_failures"`
+	CurrentTask      *model.Task `json:"current_task,omitempty"`
+
+	// LISTEN/NOTIFY notifications received, and those folded into a pending
+	// wake-up or ignored while draining; the rest each triggered a claim
+	NotificationsReceived  uint64 `json:"notifications_received"`
+	NotificationsCoalesced uint64 `json:"notifications_coalesced"`
+	NotificationsDropped   uint64 `json:"notifications_dropped"`
+
+	// Leader is set while this worker runs the cluster-wide maintenance jobs
+	Leader bool `json:"leader"`
+}
+
+// GlobalStats represents system-wide metrics
+type GlobalStats struct {
+	TotalTasks      int     `json:"total_tasks"`
+	PendingTasks    int     `json:"pending_tasks"`
+	RunningTasks    int     `json:"running_tasks"`
+	CompletedTasks  int     `json:"completed_tasks"`
+	FailedTasks     int     `json:"failed_tasks"`
+	AbandonedTasks  int     `json:"abandoned_tasks"`
+	HeldTasks       int     `json:"held_tasks"`
+	CancelledTasks  int     `json:"cancelled_tasks"`
+	MaliciousTasks  int     `json:"malicious_tasks"`
+	AvgExecutionSec float64 `json:"avg_execution_seconds"`
+	ThroughputTasks float64 `json:"throughput_tasks_per_hour"`
+}
+
+// Count adds count tasks in status, normalized with model.ParseStatus so
+// rows not migrated yet land in the right counter. Unknown statuses only
+// count towards the total.
+func (gs *GlobalStats) Count(status string, count int) {
+	gs.TotalTasks += count
+	s, _ := model.ParseStatus(status)
+	switch s {
+	case model.TaskPending:
+		gs.PendingTasks += count
+	case model.TaskRunning:
+		gs.RunningTasks += count
+	case model.TaskCompleted:
+		gs.CompletedTasks += count
+	case model.TaskFailed:
+		gs.FailedTasks += count
+	case model.TaskAbandoned:
+		gs.AbandonedTasks += count
+	case model.TaskHeld:
+		gs.HeldTasks += count
+	case model.TaskCancelled:
+		gs.CancelledTasks += count
+	case model.TaskMalicious:
+		gs.MaliciousTasks += count
+	}
+}
+
+// WorkerStats tracks the internal state of the worker.
+// Counters are updated atomically so the processor and the API server can
+// share a single instance without lock contention.
+type WorkerStats struct {
+	id        string
+	startTime time.Time
+
+	tasksProcessed   atomic.Uint64
+	tasksSuccessful  atomic.Uint64
+	tasksFailed      atomic.Uint64
+	databaseFailures atomic.Uint64
+	notifications    atomic.Uint64
+	coalesced        atomic.Uint64
+	dropped          atomic.Uint64
+	leader           atomic.Bool
+	currentTask      atomic.Pointer[model.Task]
+}
+
+// New creates the stats tracker for the worker with the given ID
+func New(id string) *WorkerStats {
+	return &WorkerStats{
+		id:        id,
+		startTime: time.Now(),
+	}
+}
+
+// RecordStarted marks a task as picked up by this worker
+func (s *WorkerStats) RecordStarted(task *model.Task) {
+	s.tasksProcessed.Add(1)
+	s.currentTask.Store(task)
+}
+
+// RecordSuccess marks the current task as successfully completed
+func (s *WorkerStats) RecordSuccess() {
+	s.tasksSuccessful.Add(1)
+	s.currentTask.Store(nil)
+}
+
+// RecordFailure marks the current task as failed
+func (s *WorkerStats) RecordFailure() {
+	s.tasksFailed.Add(1)
+	s.currentTask.Store(nil)
+}
+
+// RecordDatabaseFailure counts a failed status/result write
+func (s *WorkerStats) RecordDatabaseFailure() {
+	s.databaseFailures.Add(1)
+}
+
+// Results of a LISTEN/NOTIFY notification, see RecordNotification
+const (
+	NotificationDelivered = "delivered"
+	NotificationCoalesced = "coalesced"
+	NotificationDropped   = "dropped"
+)
+
+// RecordNotification counts a LISTEN/NOTIFY notification by result
+func (s *WorkerStats) RecordNotification(result string) {
+	s.notifications.Add(1)
+	switch result {
+	case NotificationCoalesced:
+		s.coalesced.Add(1)
+	case NotificationDropped:
+		s.dropped.Add(1)
+	}
+}
+
+// Snapshot returns a consistent-enough copy of the current statistics
+func (s *WorkerStats) Snapshot() StatusResponse {
+	return StatusResponse{
+		ID:               s.id,
+		StartTime:        s.startTime,
+		Uptime:           time.Since(s.startTime).Truncate(time.Second).String(),
+		TasksProcessed:   s.tasksProcessed.Load(),
+		TasksSuccessful:  s.tasksSuccessful.Load(),
+		TasksFailed:      s.tasksFailed.Load(),
+		DatabaseFailures: s.databaseFailures.Load(),
+		CurrentTask:      s.currentTask.Load(),
+
+		NotificationsReceived:  s.notifications.Load(),
+		NotificationsCoalesced: s.coalesced.Load(),
+		NotificationsDropped:   s.dropped.Load(),
+
+		Leader: s.leader.Load(),
+	}
+}
+
+// SetLeader records whether this worker holds leadership
+func (s *WorkerStats) SetLeader(leader bool) {
+	s.leader.Store(leader)
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// azureAPIVersion is the Blob service version requests are made against
+const azureAPIVersion = "2021-08-06"
+
+// Azure is a minimal Azure Blob Storage client. Requests are authorized with
+// the account key (Shared Key) or, when no key is set, a SAS token.
+type Azure struct {
+	Account    string
+	Key        []byte // Decoded account key
+	SASToken   string // Query string without the leading '?'
+	Endpoint   string // e.g. http://127.0.0.1:10000/devstoreaccount1 for Azurite, empty for Azure
+	HTTPClient *http.Client
+}
+
+// NewAzureFromEnv builds an Azure Blob client from AZURE_STORAGE_ACCOUNT and
+// either AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN. AZURE_STORAGE_ENDPOINT
+// can point to an emulator such as Azurite.
+func NewAzureFromEnv() (*Azure, error) {
+	a := &Azure{
+		Account:    os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		SASToken:   strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"),
+		Endpoint:   strings.TrimSuffix(os.Getenv("AZURE_STORAGE_ENDPOINT"), "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Minute},
+	}
+	if a.Account == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT must be set for Azure Blob access")
+	}
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("AZURE_STORAGE_KEY is not valid base64: %w", err)
+		}
+		a.Key = decoded
+	} else if a.SASToken == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN must be set for Azure Blob access")
+	}
+	return a, nil
+}
+
+// blobURL returns the URL of a blob of the container
+func (a *Azure) blobURL(container, key string) string {
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", a.Account)
+	}
+	u := fmt.Sprintf("%s/%s/%s", endpoint, container, uriEncode(strings.TrimPrefix(key, "/"), false))
+	if len(a.Key) == 0 {
+		u += "?" + a.SASToken
+	}
+	return u
+}
+
+// authorize stamps the request and signs it with the account key, if any
+func (a *Azure) authorize(req *http.Request, now time.Time) {
+	req.Header.Set("x-ms-date", now.UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	if len(a.Key) == 0 {
+		return
+	}
+
+	// https://learn.microsoft.com/rest/api/storageservices/authorize-with-shared-key
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var headerNames []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			headerNames = append(headerNames, lower)
+		}
+	}
+	sort.Strings(headerNames)
+
+	var b strings.Builder
+	b.WriteString(req.Method + "\n")
+	b.WriteString("\n\n" + length + "\n\n") // Content-Encoding, Content-Language, Content-Length, Content-MD5
+	b.WriteString(req.Header.Get("Content-Type") + "\n")
+	b.WriteString("\n\n\n\n\n\n") // Date (x-ms-date is used), conditionals and Range
+	for _, name := range headerNames {
+		b.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	b.WriteString("/" + a.Account + req.URL.EscapedPath())
+
+	mac := hmac.New(sha256.New, a.Key)
+	mac.Write([]byte(b.String()))
+	req.Header.Set("Authorization", "SharedKey "+a.Account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// PutObject uploads size bytes read from body as a block blob
+func (a *Azure) PutObject(ctx context.Context, container, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.blobURL(container, key), body)
+	if err != nil {
+		return fmt.Errorf("failed to build Azure Blob request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	a.authorize(req, time.Now())
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload az://%s/%s: %w", container, key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to upload az://%s/%s: %s: %s", container, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// GetObject downloads a blob. The caller must close the returned body.
+func (a *Azure) GetObject(ctx context.Context, container, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.blobURL(container, key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Azure Blob request: %w", err)
+	}
+	a.authorize(req, time.Now())
+
+	resp, err := a.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download az://%s/%s: %w", container, key, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("failed to download az://%s/%s: %s: %s", container, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
+
+// PresignGetObject returns the blob's URL with a read-only service SAS signed
+// by the account key. A client configured with only a SAS token can't scope
+// a URL to one blob and returns ErrPresignUnsupported.
+func (a *Azure) PresignGetObject(container, key string, expires time.Duration, opts DownloadOptions) (string, error) {
+	if len(a.Key) == 0 {
+		return "", ErrPresignUnsupported
+	}
+
+	// https://learn.microsoft.com/rest/api/storageservices/create-service-sas
+	expiry := time.Now().Add(expires).UTC().Format("2006-01-02T15:04:05Z")
+	disposition := opts.contentDisposition()
+	stringToSign := strings.Join([]string{
+		"r",    // signedPermissions
+		"",     // signedStart
+		expiry, // signedExpiry
+		"/blob/" + a.Account + "/" + container + "/" + strings.TrimPrefix(key, "/"),
+		"",              // signedIdentifier
+		"",              // signedIP
+		"",              // signedProtocol
+		azureAPIVersion, // signedVersion
+		"b",             // signedResource
+		"",              // signedSnapshotTime
+		"",              // signedEncryptionScope
+		"",              // rscc
+		disposition,     // rscd
+		"",              // rsce
+		"",              // rscl
+		opts.ContentType,
+	}, "\n")
+	mac := hmac.New(sha256.New, a.Key)
+	mac.Write([]byte(stringToSign))
+
+	query := url.Values{}
+	query.Set("sp", "r")
+	query.Set("se", expiry)
+	query.Set("sv", azureAPIVersion)
+	query.Set("sr", "b")
+	if disposition != "" {
+		query.Set("rscd", disposition)
+	}
+	if opts.ContentType != "" {
+		query.Set("rsct", opts.ContentType)
+	}
+	query.Set("sig", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return a.blobURL(container, key) + "?" + query.Encode(), nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// gcsEndpoint is the XML API of Google Cloud Storage, which accepts SigV4
+// requests signed with HMAC keys
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// NewGCSFromEnv builds a Google Cloud Storage client from the HMAC key of a
+// service account (GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET). GCS is reached
+// through its S3-compatible XML API. GCS_ENDPOINT overrides the endpoint,
+// e.g. for an emulator.
+func NewGCSFromEnv() (*S3, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("GCS_HMAC_ACCESS_ID"),
+		SecretAccessKey: os.Getenv("GCS_HMAC_SECRET"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET must be set for GCS access")
+	}
+
+	endpoint := strings.TrimSuffix(os.Getenv("GCS_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = gcsEndpoint
+	}
+
+	return &S3{
+		Scheme:      SchemeGCS,
+		Endpoint:    endpoint,
+		Region:      "auto",
+		Credentials: creds,
+		HTTPClient:  &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
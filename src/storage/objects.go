@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ObjectClient reads and writes the objects of a bucket (an S3 or GCS bucket,
+// an Azure Blob container)
+type ObjectClient interface {
+	PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// ErrPresignUnsupported is returned when a client has no key to sign URLs with
+var ErrPresignUnsupported = errors.New("object storage credentials cannot sign URLs")
+
+// Presigner issues URLs that download one object without credentials until
+// they expire
+type Presigner interface {
+	PresignGetObject(bucket, key string, expires time.Duration, opts DownloadOptions) (string, error)
+}
+
+// DownloadOptions override the headers of a presigned download
+type DownloadOptions struct {
+	ContentType string
+	Filename    string // Served as an attachment under this name
+}
+
+// contentDisposition returns the attachment header for the filename, "" for none
+func (o DownloadOptions) contentDisposition() string {
+	if o.Filename == "" {
+		return ""
+	}
+	return fmt.Sprintf("attachment; filename=%q", o.Filename)
+}
+
+// Schemes of the object URLs, e.g. gs://bucket/key
+const (
+	SchemeS3    = "s3"
+	SchemeGCS   = "gs"
+	SchemeAzure = "az"
+)
+
+// ParseURL splits an s3://, gs:// or az:// object URL into its scheme, bucket
+// and key. The key may be empty when only a bucket (and prefix) is named.
+func ParseURL(raw string) (scheme, bucket, key string, ok bool) {
+	scheme, rest, found := strings.Cut(raw, "://")
+	if !found {
+		return "", "", "", false
+	}
+	switch scheme {
+	case SchemeS3, SchemeGCS, SchemeAzure:
+	default:
+		return "", "", "", false
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" {
+		return "", "", "", false
+	}
+	return scheme, bucket, key, true
+}
+
+// NewClientFromEnv builds the client for an object URL scheme from its
+// provider's environment variables
+func NewClientFromEnv(scheme string) (ObjectClient, error) {
+	// Return typed nils as a nil interface
+	var client ObjectClient
+	var err error
+	switch scheme {
+	case SchemeS3:
+		var s3 *S3
+		if s3, err = NewS3FromEnv(); err == nil {
+			client = s3
+		}
+	case SchemeGCS:
+		var gcs *S3
+		if gcs, err = NewGCSFromEnv(); err == nil {
+			client = gcs
+		}
+	case SchemeAzure:
+		var az *Azure
+		if az, err = NewAzureFromEnv(); err == nil {
+			client = az
+		}
+	default:
+		err = fmt.Errorf("unsupported object storage scheme %q", scheme)
+	}
+	return client, err
+}
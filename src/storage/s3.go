@@ -0,0 +1,133 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3 is a minimal S3-compatible object storage client (AWS, MinIO, Ceph...)
+type S3 struct {
+	Scheme      string // URL scheme of its objects, "s3" when empty
+	Endpoint    string // Custom endpoint (path-style), empty for AWS
+	Region      string
+	Credentials Credentials
+	HTTPClient  *http.Client
+}
+
+// NewS3FromEnv builds an S3 client from the standard AWS_* variables.
+// S3_ENDPOINT can point to an S3-compatible service such as MinIO.
+func NewS3FromEnv() (*S3, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set for S3 access")
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3{
+		Endpoint:    strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+		Region:      region,
+		Credentials: creds,
+		HTTPClient:  &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+// objectURL returns the URL of an object, using virtual-hosted style for AWS
+// and path style for custom endpoints.
+func (s *S3) objectURL(bucket, key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if s.Endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", s.Endpoint, bucket, uriEncode(key, false))
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, s.Region, uriEncode(key, false))
+}
+
+// objectName is the bucket/key URL used in errors
+func (s *S3) objectName(bucket, key string) string {
+	scheme := s.Scheme
+	if scheme == "" {
+		scheme = "s3"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, bucket, key)
+}
+
+// PutObject uploads size bytes read from body to bucket/key
+func (s *S3) PutObject(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(bucket, key), body)
+	if err != nil {
+		return fmt.Errorf("failed to build S3 request: %w", err)
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signV4(req, s.Credentials, s.Region, "s3", unsignedPayload, time.Now())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.objectName(bucket, key), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to upload %s: %s: %s", s.objectName(bucket, key), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// PresignGetObject returns a SigV4 query-signed URL of bucket/key
+func (s *S3) PresignGetObject(bucket, key string, expires time.Duration, opts DownloadOptions) (string, error) {
+	params := url.Values{}
+	if opts.ContentType != "" {
+		params.Set("response-content-type", opts.ContentType)
+	}
+	if disposition := opts.contentDisposition(); disposition != "" {
+		params.Set("response-content-disposition", disposition)
+	}
+	return presignV4(s.objectURL(bucket, key), s.Credentials, s.Region, "s3", expires, params, time.Now())
+}
+
+// GetObject downloads bucket/key. The caller must close the returned body.
+func (s *S3) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build S3 request: %w", err)
+	}
+	signV4(req, s.Credentials, s.Region, "s3", hashHex(nil), time.Now())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", s.objectName(bucket, key), err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("failed to download %s: %s: %s", s.objectName(bucket, key), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package submit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"continuumworker/src/model"
+)
+
+// MaxBatchTasks bounds the tasks of a single batch
+const MaxBatchTasks = 1000
+
+// ErrUnknownBatch is returned when an ID doesn't name a batch
+var ErrUnknownBatch = errors.New("unknown batch")
+
+// Aggregate statuses of a batch
+const (
+	BatchPending   = "pending"   // No task has started yet
+	BatchRunning   = "running"   // Some task started and not every task is final
+	BatchCompleted = "completed" // Every task completed
+	BatchFailed    = "failed"    // Every task is final but some did not complete
+)
+
+// failureStatuses is the SQL list of the statuses counted as failed
+var failureStatuses = model.StatusList(model.FailureStatuses)
+
+// unmetStatuses is the SQL list of the statuses a dependency never completes from
+var unmetStatuses = model.StatusList(model.UnmetStatuses)
+
+// BatchRequest describes tasks to create together and follow as one
+type BatchRequest struct {
+	Name     *string `json:"name,omitempty"`
+	TenantID *string `json:"tenant_id,omitempty"` // Inherited by the tasks that set none
+	// WebhookURL receives a batch.finished event once every task is final
+	WebhookURL *string   `json:"webhook_url,omitempty"`
+	Tasks      []Request `json:"tasks"`
+}
+
+// BatchResponse identifies the batch and its tasks, in request order
+type BatchResponse struct {
+	ID    string     `json:"id"`
+	Tasks []Response `json:"tasks"`
+}
+
+// Validate checks the batch and each of its tasks
+func (req *BatchRequest) Validate() error {
+	if len(req.Tasks) == 0 || len(req.Tasks) > MaxBatchTasks {
+		return fmt.Errorf("a batch needs between 1 and %d tasks", MaxBatchTasks)
+	}
+	if err := validateWebhookURL(req.WebhookURL); err != nil {
+		return err
+	}
+	for i := range req.Tasks {
+		if req.Tasks[i].TenantID == nil {
+			req.Tasks[i].TenantID = req.TenantID
+		}
+		if err := req.Tasks[i].Validate(); err != nil {
+			return fmt.Errorf("tasks[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// CreateBatch creates the batch and all its tasks in one transaction, so
+// either every task is created or none is. Rejected requests wrap the
+// errors of Create, naming the task at fault.
+func CreateBatch(ctx context.Context, db *sql.DB, req BatchRequest) (BatchResponse, error) {
+	if err := req.Validate(); err != nil {
+		return BatchResponse{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return BatchResponse{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var resp BatchResponse
+	err = tx.QueryRowContext(ctx, "INSERT INTO BATCHES (name, tenant_id, webhook_url, total) VALUES ($1, $2, $3, $4) RETURNING id",
+		req.Name, req.TenantID, req.WebhookURL, len(req.Tasks)).Scan(&resp.ID)
+	if err != nil {
+		return BatchResponse{}, fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	var ready []int
+	for i, task := range req.Tasks {
+		created, isReady, err := insert(ctx, tx, task, &resp.ID)
+		if err != nil {
+			if errors.Is(err, ErrInvalid) || errors.Is(err, ErrUnknownCode) || errors.Is(err, ErrUnknownVersion) {
+				err = fmt.Errorf("tasks[%d]: %w", i, err)
+			}
+			return BatchResponse{}, err
+		}
+		resp.Tasks = append(resp.Tasks, created)
+		if isReady {
+			ready = append(ready, created.ID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return BatchResponse{}, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	for _, id := range ready {
+		announce(ctx, id)
+	}
+	return resp, nil
+}
+
+// Batch is the aggregate progress of a batch. Held tasks count as pending
+// and malicious or abandoned ones as failed.
+type Batch struct {
+	ID         string     `json:"id"`
+	Name       *string    `json:"name,omitempty"`
+	TenantID   *string    `json:"tenant_id,omitempty"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Pending    int        `json:"pending"`
+	Running    int        `json:"running"`
+	Completed  int        `json:"completed"`
+	Failed     int        `json:"failed"`
+	Cancelled  int        `json:"cancelled"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// GetBatch reads the progress of a batch from the current status of its tasks
+func GetBatch(ctx context.Context, db *sql.DB, batchID string) (Batch, error) {
+	if _, err := uuid.Parse(batchID); err != nil {
+		return Batch{}, fmt.Errorf("%w: %s", ErrUnknownBatch, batchID)
+	}
+	var b Batch
+	err := db.QueryRowContext(ctx, `SELECT b.id, b.name, b.tenant_id, b.total, b.created_at, b.finished_at,
+			COUNT(t.id) FILTER (WHERE t.status IN ('pending', 'held')),
+			COUNT(t.id) FILTER (WHERE t.status = 'running'),
+			COUNT(t.id) FILTER (WHERE t.status = 'completed'),
+			COUNT(t.id) FILTER (WHERE t.status IN (`+failureStatuses+`)),
+			COUNT(t.id) FILTER (WHERE t.status = 'cancelled')
+		FROM BATCHES b
+		LEFT JOIN TASKS t ON t.batch_id = b.id
+		WHERE b.id = $1
+		GROUP BY b.id`, batchID).Scan(&b.ID, &b.Name, &b.TenantID, &b.Total, &b.CreatedAt, &b.FinishedAt,
+		&b.Pending, &b.Running, &b.Completed, &b.Failed, &b.Cancelled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Batch{}, fmt.Errorf("%w: %s", ErrUnknownBatch, batchID)
+	} else if err != nil {
+		return Batch{}, fmt.Errorf("failed to read batch: %w", err)
+	}
+
+	// finished_at rather than the counts decides, as retention may have
+	// deleted finished tasks since
+	switch {
+	case b.FinishedAt == nil && b.Pending == b.Total:
+		b.Status = BatchPending
+	case b.FinishedAt == nil:
+		b.Status = BatchRunning
+	case b.Failed == 0 && b.Cancelled == 0:
+		b.Status = BatchCompleted
+	default:
+		b.Status = BatchFailed
+	}
+	return b, nil
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package submit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"continuumworker/src/compression"
+	"continuumworker/src/processor"
+	"continuumworker/src/results"
+	"continuumworker/src/schema"
+
+	"github.com/google/uuid"
+)
+
+// Latest is the CodeVersion of tasks running whatever version of their code
+// is current when they are claimed
+const Latest CodeVersion = 0
+
+// CodeVersion is a version of a stored code, 1 being the code as first
+// submitted. It reads from JSON as a positive number or "latest".
+type CodeVersion int
+
+func (v *CodeVersion) UnmarshalJSON(data []byte) error {
+	if string(data) == `"latest"` {
+		*v = Latest
+		return nil
+	}
+	n, err := strconv.Atoi(string(data))
+	if err != nil || n < 1 {
+		return errors.New(`code_version must be a positive version number or "latest"`)
+	}
+	*v = CodeVersion(n)
+	return nil
+}
+
+// Version describes one version of a code
+type Version struct {
+	Version   int        `json:"version"`
+	SHA256    string     `json:"sha256"`
+	CreatedAt *time.Time `json:"created_at"` // nil for version 1, created with the code
+	Current   bool       `json:"current"`
+	// ResultFormat and ResultSchema are the version's result contract, if any
+	ResultFormat string `json:"result_format,omitempty"`
+	ResultSchema string `json:"result_schema,omitempty"`
+}
+
+// Publish stores code as the next version of a stored code and makes it the
+// one run by tasks asking for the latest. jsonSchema is the payload schema
+// of the new version and result its result contract; either is kept from the
+// current version when left empty. Tasks pinning a version keep running theirs.
+func Publish(ctx context.Context, db *sql.DB, codeID, code string, jsonSchema json.RawMessage, result results.Contract) (Version, error) {
+	if _, err := uuid.Parse(codeID); err != nil {
+		return Version{}, fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	if code == "" {
+		return Version{}, fmt.Errorf("%w: code is required", ErrInvalid)
+	}
+	if err := processor.CheckInputLimits(code, "{}", limits); err != nil {
+		return Version{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(jsonSchema) > 0 {
+		if _, err := schema.Compile(string(jsonSchema)); err != nil {
+			return Version{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	if err := result.Validate(); err != nil {
+		return Version{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the code serializes concurrent publications
+	var latest int
+	var currentSchema string
+	var current results.Contract
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE((SELECT MAX(version) FROM CODE_VERSIONS WHERE code_id = c.id), 1),
+			COALESCE(cv.json_schema::TEXT, ''), COALESCE(cv.result_format, ''), COALESCE(cv.result_schema, '')
+		FROM CODES c
+		JOIN CODE_CONTENTS cv ON cv.code_id = c.id AND cv.version = c.current_version
+		WHERE c.id = $1 FOR UPDATE OF c`, codeID).Scan(&latest, &currentSchema, &current.Format, &current.Schema)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Version{}, fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	} else if err != nil {
+		return Version{}, fmt.Errorf("failed to read code: %w", err)
+	}
+	if len(jsonSchema) == 0 {
+		jsonSchema = json.RawMessage(currentSchema)
+	}
+	if result.Format == "" {
+		result = current
+	}
+
+	ref, err := putCode(ctx, code)
+	if err != nil {
+		return Version{}, err
+	}
+	stored, packedCode := compression.Pack(ref.Code, limits.CompressAboveBytes)
+	v := Version{Version: latest + 1, SHA256: ref.SHA256, Current: true, ResultFormat: result.Format, ResultSchema: result.Schema}
+	v.CreatedAt = new(time.Time)
+	err = tx.QueryRowContext(ctx, `INSERT INTO CODE_VERSIONS (code_id, version, code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema)
+		VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF($5, ''), $6, NULLIF($7, '')::JSONB, NULLIF($8, ''), NULLIF($9, '')) RETURNING created_at`,
+		codeID, v.Version, stored, packedCode, ref.ObjectURI, ref.SHA256, string(jsonSchema), result.Format, result.Schema).Scan(v.CreatedAt)
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to store code version: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE CODES SET current_version = $1 WHERE id = $2", v.Version, codeID); err != nil {
+		return Version{}, fmt.Errorf("failed to publish code version: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Version{}, fmt.Errorf("failed to commit code version: %w", err)
+	}
+	return v, nil
+}
+
+// Rollback makes an earlier (or later) published version the one run by
+// tasks asking for the latest. version Latest rolls back to the version
+// before the current one.
+func Rollback(ctx context.Context, db *sql.DB, codeID string, version CodeVersion) (Version, error) {
+	if _, err := uuid.Parse(codeID); err != nil {
+		return Version{}, fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	var v Version
+	err := db.QueryRowContext(ctx, `
+		WITH target AS (
+			SELECT cv.code_id, cv.version, cv.sha256, cv.result_format, cv.result_schema
+			FROM CODES c
+			JOIN CODE_CONTENTS cv ON cv.code_id = c.id AND cv.version = COALESCE(NULLIF($2, 0), c.current_version - 1)
+			WHERE c.id = $1
+		)
+		UPDATE CODES c SET current_version = target.version
+		FROM target WHERE c.id = target.code_id
+		RETURNING target.version, COALESCE(target.sha256, ''), COALESCE(target.result_format, ''), COALESCE(target.result_schema, '')`,
+		codeID, int(version)).Scan(&v.Version, &v.SHA256, &v.ResultFormat, &v.ResultSchema)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Tell an unknown code from an unknown version
+		if _, err := Versions(ctx, db, codeID); err != nil {
+			return Version{}, err
+		}
+		return Version{}, fmt.Errorf("%w: no version to roll code %s back to", ErrUnknownVersion, codeID)
+	} else if err != nil {
+		return Version{}, fmt.Errorf("failed to roll back code: %w", err)
+	}
+	v.Current = true
+	return v, nil
+}
+
+// Versions lists the versions of a stored code, oldest first
+func Versions(ctx context.Context, db *sql.DB, codeID string) ([]Version, error) {
+	if _, err := uuid.Parse(codeID); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	rows, err := db.QueryContext(ctx, `SELECT cv.version, COALESCE(cv.sha256, ''), v.created_at, cv.version = c.current_version,
+			COALESCE(cv.result_format, ''), COALESCE(cv.result_schema, '')
+		FROM CODES c
+		JOIN CODE_CONTENTS cv ON cv.code_id = c.id
+		LEFT JOIN CODE_VERSIONS v ON v.code_id = cv.code_id AND v.version = cv.version
+		WHERE c.id = $1
+		ORDER BY cv.version`, codeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read code versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []Version
+	for rows.Next() {
+		var v Version
+		if err := rows.Scan(&v.Version, &v.SHA256, &v.CreatedAt, &v.Current, &v.ResultFormat, &v.ResultSchema); err != nil {
+			return nil, fmt.Errorf("failed to read code versions: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read code versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	return versions, nil
+}
+
+// SetWarmup registers the warm-up snippet of a stored code, run once in each
+// sandbox container and virtualenv before the first task of the code; ""
+// removes it. Unlike the code, it can change at any time, and applies to
+// every version.
+func SetWarmup(ctx context.Context, db *sql.DB, codeID, warmup string) error {
+	if _, err := uuid.Parse(codeID); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	if err := processor.CheckInputLimits(warmup, "{}", limits); err != nil {
+		return fmt.Errorf("%w: warmup: %v", ErrInvalid, err)
+	}
+	res, err := db.ExecContext(ctx, "UPDATE CODES SET warmup = NULLIF($1, '') WHERE id = $2", warmup, codeID)
+	if err != nil {
+		return fmt.Errorf("failed to store warm-up: %w", err)
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	return nil
+}
+
+// Warmup returns the warm-up snippet of a stored code, "" if it has none
+func Warmup(ctx context.Context, db *sql.DB, codeID string) (string, error) {
+	if _, err := uuid.Parse(codeID); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	}
+	var warmup string
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(warmup, '') FROM CODES WHERE id = $1", codeID).Scan(&warmup)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read warm-up: %w", err)
+	}
+	return warmup, nil
+}
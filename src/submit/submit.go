@@ -0,0 +1,450 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package submit creates tasks. It backs both POST /tasks and the embedded
+// worker's in-process submitter, so both accept exactly the same requests.
+package submit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"continuumworker/src/codestore"
+	"continuumworker/src/compression"
+	"continuumworker/src/config"
+	"continuumworker/src/containerization"
+	"continuumworker/src/logging"
+	"continuumworker/src/model"
+	"continuumworker/src/processor"
+	"continuumworker/src/results"
+	"continuumworker/src/schema"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalid marks a request that can never be accepted as is
+	ErrInvalid = errors.New("invalid task")
+	// ErrUnknownCode is returned when CodeID doesn't name a stored code
+	ErrUnknownCode = errors.New("unknown code_id")
+	// ErrUnknownVersion is returned when CodeVersion isn't a version of the code
+	ErrUnknownVersion = errors.New("unknown code_version")
+)
+
+// limits are the size limits checked on submission, see Configure
+var limits = config.Default().Worker.Limits
+
+// Configure installs the size limits submissions are checked against
+func Configure(l config.Limits) {
+	limits = l
+}
+
+// notify announces created tasks to the workers, see UseNotifier
+var notify func(ctx context.Context, taskID int) error
+
+// UseNotifier installs the announcement of tasks that are claimable right
+// away, the task queue's Notify. Other tasks are found by the workers'
+// polling and scheduled wake-ups.
+func UseNotifier(fn func(ctx context.Context, taskID int) error) {
+	notify = fn
+}
+
+// Request describes a task to create. Exactly one of Code (inline source) or
+// CodeID (an existing CODES row) must be set.
+type Request struct {
+	Name        string          `json:"name"`
+	Description *string         `json:"description,omitempty"`
+	Code        string          `json:"code,omitempty"`
+	CodeID      string          `json:"code_id,omitempty"`
+	CodeVersion CodeVersion     `json:"code_version,omitempty"` // Version of CodeID to pin, "latest" by default
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Priority    int             `json:"priority"`
+	Runtime     string          `json:"runtime,omitempty"` // Python version, e.g. "3.11"
+	DependsOn   []int64         `json:"depends_on,omitempty"`
+	TenantID    *string         `json:"tenant_id,omitempty"`
+	RetryPolicy json.RawMessage `json:"retry_policy,omitempty"` // Overrides the worker's execution retry policy
+	Deadline    *time.Time      `json:"deadline,omitempty"`     // RFC3339, used by the deadline-first claim strategy
+	JSONSchema  json.RawMessage `json:"json_schema,omitempty"`  // Payload schema stored with inline code
+	// ResultFormat ("json", "msgpack" or "protobuf") and ResultSchema (the
+	// protobuf message) declare the result inline code writes to stdout
+	ResultFormat string     `json:"result_format,omitempty"`
+	ResultSchema string     `json:"result_schema,omitempty"`
+	WebhookURL   *string    `json:"webhook_url,omitempty"` // Receives an event when the task completes, fails or is flagged malicious
+	RunAt        *time.Time `json:"run_at,omitempty"`      // RFC3339, the task isn't claimed before
+	RunIn        string     `json:"run_in,omitempty"`      // Delay like "30m" from submission, instead of run_at
+	// Type is "execute" (the default) or "analyze" to only run the code
+	// analysis and get its verdict as the output
+	Type model.TaskType `json:"type,omitempty"`
+	// Queue whose defaults apply to the settings below that are left unset
+	Queue   *string `json:"queue,omitempty"`
+	Timeout string  `json:"timeout,omitempty"` // Duration like "10m" bounding the execution, retries included
+	// StaleAfter is how long the task's worker may stop heartbeating, like
+	// "15m", before the task is recovered; WORKER_STALE_AFTER by default
+	StaleAfter string   `json:"stale_after,omitempty"`
+	MemoryMB   *int64   `json:"memory_mb,omitempty"`
+	CPULimit   *float64 `json:"cpu_limit,omitempty"`
+	Isolation  *string  `json:"isolation,omitempty"` // "default" or "strict"
+	Network    *string  `json:"network,omitempty"`   // "sandbox", "none" or "allowlist"
+	// EgressAllowlist are the hosts ("*.domain" for subdomains) a task with
+	// the allowlist network policy may reach
+	EgressAllowlist []string `json:"egress_allowlist,omitempty"`
+	// GPURequired runs the task only on a worker with CONTAINER_GPU=all
+	GPURequired bool `json:"gpu_required,omitempty"`
+	// Timezone, Locale and Ulimits ("name=value" soft limits) override the
+	// worker's standard script environment
+	Timezone *string  `json:"timezone,omitempty"`
+	Locale   *string  `json:"locale,omitempty"`
+	Ulimits  []string `json:"ulimits,omitempty"`
+	// BandwidthKbps limits the sandbox's network traffic each way, in kbit/s
+	BandwidthKbps *int64 `json:"bandwidth_kbps,omitempty"`
+	// PreferredRegion is claimed first by workers of that WORKER_REGION, by
+	// the others only after their CROSS_REGION_WAIT
+	PreferredRegion *string `json:"preferred_region,omitempty"`
+}
+
+// Response identifies the rows created for a request. CodeVersion is nil
+// for a task running the latest version.
+type Response struct {
+	ID          int    `json:"id"`
+	CodeID      string `json:"code_id"`
+	CodeVersion *int   `json:"code_version,omitempty"`
+	Status      string `json:"status"`
+}
+
+// Validate checks the request without touching the database, defaulting an
+// empty payload to {}
+func (req *Request) Validate() error {
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if (req.Code == "") == (req.CodeID == "") {
+		return errors.New("exactly one of code or code_id is required")
+	}
+	if req.CodeID != "" {
+		if _, err := uuid.Parse(req.CodeID); err != nil {
+			return errors.New("code_id must be a UUID")
+		}
+	}
+	if req.CodeVersion != Latest && req.Code != "" {
+		return errors.New("code_version can only be set with code_id")
+	}
+	if len(req.Payload) == 0 {
+		req.Payload = json.RawMessage("{}")
+	}
+	if !json.Valid(req.Payload) {
+		return errors.New("payload must be valid JSON")
+	}
+	if err := processor.CheckInputLimits(req.Code, string(req.Payload), limits); err != nil {
+		return err
+	}
+	if _, err := containerization.ImageForPythonVersion(req.Runtime); err != nil {
+		return err
+	}
+	if _, err := containerization.EnvFromPayload(string(req.Payload)); err != nil {
+		return err
+	}
+	if len(req.JSONSchema) > 0 {
+		if req.Code == "" {
+			return errors.New("json_schema can only be set with inline code")
+		}
+		if _, err := schema.Compile(string(req.JSONSchema)); err != nil {
+			return err
+		}
+	}
+	if req.ResultFormat != "" || req.ResultSchema != "" {
+		if req.Code == "" {
+			return errors.New("result_format can only be set with inline code")
+		}
+		if err := (results.Contract{Format: req.ResultFormat, Schema: req.ResultSchema}).Validate(); err != nil {
+			return err
+		}
+	}
+	if err := validateWebhookURL(req.WebhookURL); err != nil {
+		return err
+	}
+	if req.RunAt != nil && req.RunIn != "" {
+		return errors.New("at most one of run_at or run_in can be set")
+	}
+	if req.RunIn != "" {
+		if d, err := time.ParseDuration(req.RunIn); err != nil || d < 0 {
+			return errors.New("run_in must be a non-negative duration like 30m")
+		}
+	}
+	if req.Timeout != "" {
+		if d, err := time.ParseDuration(req.Timeout); err != nil || d <= 0 {
+			return errors.New("timeout must be a positive duration like 10m")
+		}
+	}
+	switch req.Type {
+	case "", model.TaskExecute, model.TaskAnalyze:
+	default:
+		return fmt.Errorf("type must be %s or %s, got %q", model.TaskExecute, model.TaskAnalyze, req.Type)
+	}
+	if req.StaleAfter != "" {
+		if d, err := time.ParseDuration(req.StaleAfter); err != nil || d <= 0 {
+			return errors.New("stale_after must be a positive duration like 15m")
+		}
+	}
+	if (req.MemoryMB != nil && *req.MemoryMB <= 0) || (req.CPULimit != nil && *req.CPULimit <= 0) {
+		return errors.New("memory_mb and cpu_limit must be positive")
+	}
+	if err := containerization.ValidateSandbox(deref(req.Isolation), deref(req.Network)); err != nil {
+		return err
+	}
+	if err := containerization.ValidateAllowlist(req.EgressAllowlist); err != nil {
+		return err
+	}
+	if req.EgressAllowlist != nil && req.Network != nil && *req.Network != containerization.NetworkAllowlist {
+		return fmt.Errorf("egress_allowlist requires network %s", containerization.NetworkAllowlist)
+	}
+	var memoryMB int64
+	var cpuLimit float64
+	if req.MemoryMB != nil {
+		memoryMB = *req.MemoryMB
+	}
+	if req.CPULimit != nil {
+		cpuLimit = *req.CPULimit
+	}
+	if err := containerization.ValidateResources(memoryMB, cpuLimit); err != nil {
+		return err
+	}
+	if req.BandwidthKbps != nil {
+		if *req.BandwidthKbps <= 0 {
+			return errors.New("bandwidth_kbps must be positive")
+		}
+		if err := containerization.ValidateBandwidth(*req.BandwidthKbps); err != nil {
+			return err
+		}
+	}
+	if req.PreferredRegion != nil && strings.TrimSpace(*req.PreferredRegion) == "" {
+		return errors.New("preferred_region must not be empty")
+	}
+	if err := containerization.ValidateExecEnvironment(containerization.ExecEnvironment{
+		TZ: deref(req.Timezone), Locale: deref(req.Locale), Ulimits: req.Ulimits,
+	}); err != nil {
+		return err
+	}
+	if len(req.RetryPolicy) > 0 {
+		// Checked over the built-in defaults; each worker applies it over its own
+		if _, err := processor.TaskRetryPolicy(config.Default().Worker.Retry, string(req.RetryPolicy)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateWebhookURL checks an optional webhook_url
+func validateWebhookURL(webhookURL *string) error {
+	if webhookURL == nil {
+		return nil
+	}
+	u, err := url.Parse(*webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook_url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// Create validates the request, then inserts the code (when given inline)
+// and the task in one transaction. Inline code is version 1 of a new code,
+// which the task pins. The TASKS insert trigger emits tasks_updated on
+// commit, and the notifier (if any) announces the task, which wakes the
+// workers. Rejected requests wrap ErrInvalid, ErrUnknownCode or
+// ErrUnknownVersion.
+func Create(ctx context.Context, db *sql.DB, req Request) (Response, error) {
+	if err := req.Validate(); err != nil {
+		return Response{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	resp, ready, err := insert(ctx, tx, req, nil)
+	if err != nil {
+		return Response{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Response{}, fmt.Errorf("failed to commit task: %w", err)
+	}
+	if ready {
+		announce(ctx, resp.ID)
+	}
+	return resp, nil
+}
+
+// insert stores a validated request in tx as a task of batchID, if not nil,
+// and reports whether the task can be claimed right away
+func insert(ctx context.Context, tx *sql.Tx, req Request, batchID *string) (Response, bool, error) {
+	var err error
+	codeID := req.CodeID
+	jsonSchema := string(req.JSONSchema)
+	var codeVersion *int
+	if req.Code != "" {
+		// Large code is uploaded first; an object left behind by a failed
+		// transaction is harmless as objects are named by their checksum
+		var ref codestore.Ref
+		ref, err = putCode(ctx, req.Code)
+		if err != nil {
+			return Response{}, false, err
+		}
+		code, packedCode := compression.Pack(ref.Code, limits.CompressAboveBytes)
+		err = tx.QueryRowContext(ctx, `INSERT INTO CODES (code, code_zstd, object_uri, sha256, json_schema, result_format, result_schema)
+			VALUES (NULLIF($1, ''), $5, NULLIF($2, ''), $3, NULLIF($4, '')::JSONB, NULLIF($6, ''), NULLIF($7, '')) RETURNING id`,
+			code, ref.ObjectURI, ref.SHA256, jsonSchema, packedCode, req.ResultFormat, req.ResultSchema).Scan(&codeID)
+		first := 1
+		codeVersion = &first
+	} else {
+		// The payload is checked against the schema of the version that
+		// runs, the latest one for now when none is pinned
+		var found bool
+		err = tx.QueryRowContext(ctx, `SELECT c.id, cv.code_id IS NOT NULL, COALESCE(cv.json_schema::TEXT, '') FROM CODES c
+			LEFT JOIN CODE_CONTENTS cv ON cv.code_id = c.id AND cv.version = COALESCE(NULLIF($2, 0), c.current_version)
+			WHERE c.id = $1`, codeID, int(req.CodeVersion)).Scan(&codeID, &found, &jsonSchema)
+		if err == nil && !found {
+			return Response{}, false, fmt.Errorf("%w: %d of code %s", ErrUnknownVersion, req.CodeVersion, codeID)
+		}
+		if req.CodeVersion != Latest {
+			pinned := int(req.CodeVersion)
+			codeVersion = &pinned
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return Response{}, false, fmt.Errorf("%w: %s", ErrUnknownCode, codeID)
+	} else if err != nil {
+		return Response{}, false, fmt.Errorf("failed to store code: %w", err)
+	}
+	// Reject a payload the code can't accept now rather than at claim time
+	if err := schema.Validate(jsonSchema, string(req.Payload)); err != nil {
+		return Response{}, false, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	dependsOn := req.DependsOn
+	if dependsOn == nil {
+		dependsOn = []int64{}
+	}
+	// A dependency that doesn't exist, or already ended without completing,
+	// would leave the task pending forever; archived tasks count too
+	if len(dependsOn) > 0 {
+		var depID int64
+		var depStatus sql.NullString
+		err := tx.QueryRowContext(ctx, `
+			SELECT d.id, s.status
+			FROM UNNEST($1::BIGINT[]) AS d(id)
+			LEFT JOIN LATERAL (
+				SELECT status FROM TASKS WHERE id = d.id
+				UNION ALL
+				SELECT status FROM TASKS_ARCHIVE WHERE id = d.id
+				LIMIT 1
+			) s ON TRUE
+			WHERE s.status IS NULL OR s.status IN (`+unmetStatuses+`)
+			ORDER BY d.id
+			LIMIT 1`, dependsOn).Scan(&depID, &depStatus)
+		if err == nil && !depStatus.Valid {
+			return Response{}, false, fmt.Errorf("%w: dependency task %d does not exist", ErrInvalid, depID)
+		} else if err == nil {
+			return Response{}, false, fmt.Errorf("%w: dependency task %d is %s", ErrInvalid, depID, depStatus.String)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return Response{}, false, fmt.Errorf("failed to look up dependencies: %w", err)
+		}
+	}
+
+	if req.Queue != nil {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM QUEUES WHERE name = $1)", *req.Queue).Scan(&exists); err != nil {
+			return Response{}, false, fmt.Errorf("failed to look up queue: %w", err)
+		}
+		if !exists {
+			return Response{}, false, fmt.Errorf("%w: unknown queue %q", ErrInvalid, *req.Queue)
+		}
+	}
+
+	// run_in counts from the database clock, which run_at is compared with
+	runIn := seconds(req.RunIn)
+
+	resp := Response{CodeID: codeID, CodeVersion: codeVersion, Status: "pending"}
+	payload, packedPayload := compression.Pack(string(req.Payload), limits.CompressAboveBytes)
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO TASKS (name, description, status, payload, code, priority, python_version, depends_on, tenant_id, retry_policy, deadline, webhook_url, run_at,
+			queue, timeout_seconds, memory_mb, cpu_limit, isolation, network, gpu_required, timezone, locale, ulimits, egress_allowlist, payload_zstd,
+			stale_after_seconds, task_type, code_version, bandwidth_kbps, batch_id, preferred_region)
+		VALUES ($1, $2, 'pending', $3, $4, $5, NULLIF($6, ''), $7, $8, NULLIF($9, '')::JSONB, $10, $11, COALESCE($12, NOW() + $13 * INTERVAL '1 second'),
+			$14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, COALESCE(NULLIF($27, ''), 'execute'), $28, $29, $30, $31)
+		RETURNING id`,
+		req.Name, req.Description, payload, codeID, req.Priority, req.Runtime, dependsOn, req.TenantID, string(req.RetryPolicy),
+		req.Deadline, req.WebhookURL, req.RunAt, runIn,
+		req.Queue, seconds(req.Timeout), req.MemoryMB, req.CPULimit, req.Isolation, req.Network, req.GPURequired,
+		req.Timezone, req.Locale, req.Ulimits, req.EgressAllowlist, packedPayload,
+		seconds(req.StaleAfter), string(req.Type), codeVersion, req.BandwidthKbps, batchID, req.PreferredRegion,
+	).Scan(&resp.ID)
+	if err != nil {
+		return Response{}, false, fmt.Errorf("failed to create task: %w", err)
+	}
+	// The task is due at run_at, else after run_in; run_in "0s" is due now
+	runAt := time.Now()
+	if req.RunAt != nil {
+		runAt = *req.RunAt
+	} else if runIn != nil {
+		runAt = runAt.Add(time.Duration(*runIn * float64(time.Second)))
+	}
+	ready := len(dependsOn) == 0 && !runAt.After(time.Now())
+	return resp, ready, nil
+}
+
+// announce wakes the workers for a committed task. A lost announcement only
+// delays the task until the next poll.
+func announce(ctx context.Context, taskID int) {
+	if notify == nil {
+		return
+	}
+	if err := notify(ctx, taskID); err != nil {
+		logging.Log(ctx, fmt.Sprintf("Failed to announce task %d: %v", taskID, err), slog.LevelWarn)
+	}
+}
+
+// putCode stores inline code through the configured code store
+func putCode(ctx context.Context, code string) (codestore.Ref, error) {
+	store, err := codestore.Default()
+	if err != nil {
+		return codestore.Ref{}, fmt.Errorf("failed to open code store: %w", err)
+	}
+	ref, err := store.Put(ctx, code)
+	if err != nil {
+		return codestore.Ref{}, fmt.Errorf("failed to store code: %w", err)
+	}
+	return ref, nil
+}
+
+// seconds converts a validated duration to seconds, nil when empty
+func seconds(duration string) *float64 {
+	if duration == "" {
+		return nil
+	}
+	d, _ := time.ParseDuration(duration)
+	s := d.Seconds()
+	return &s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
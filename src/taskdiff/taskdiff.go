@@ -0,0 +1,351 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package taskdiff compares two runs of the same code, typically a task and
+// its replay (a later task submitted with the same code_id), to validate a
+// fix or an environment change.
+package taskdiff
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"continuumworker/src/compression"
+)
+
+// maxChanges bounds the changes reported per section
+const maxChanges = 100
+
+// ErrNotFound is returned when either task doesn't exist
+var ErrNotFound = errors.New("task not found")
+
+// Run summarizes one of the compared tasks
+type Run struct {
+	ID                 int      `json:"id"`
+	Status             string   `json:"status"`
+	CodeID             string   `json:"code_id"`
+	ExitCode           *int     `json:"exit_code"`
+	DurationSeconds    *float64 `json:"duration_seconds"`
+	CPUSeconds         *float64 `json:"cpu_seconds"`
+	PeakMemoryBytes    *int64   `json:"peak_memory_bytes"`
+	InterpreterVersion *string  `json:"interpreter_version"`
+	PolicyVersion      *string  `json:"policy_version"`
+	Attempts           int      `json:"attempts"`
+
+	payload     string
+	output      string
+	annotations string
+	richOutputs map[string]any // seq -> "mime_type sha256"
+	artifacts   map[string]any // path -> sha256
+}
+
+// Change is a value that differs between the runs. Base or Against is nil
+// when the value only exists in the other run.
+type Change struct {
+	Path    string `json:"path"`
+	Base    any    `json:"base"`
+	Against any    `json:"against"`
+}
+
+// Section lists the changes of one part of the result
+type Section struct {
+	Equal     bool     `json:"equal"`
+	Changes   []Change `json:"changes"`
+	Truncated bool     `json:"truncated,omitempty"` // More than maxChanges changes
+}
+
+// OutputSection compares the plain output. Output that is a JSON document is
+// compared structurally; other output line by line.
+type OutputSection struct {
+	Section
+	Structured bool `json:"structured"`
+}
+
+// Delta is the difference of a measurement, Against minus Base
+type Delta struct {
+	Base    float64  `json:"base"`
+	Against float64  `json:"against"`
+	Change  float64  `json:"change"`
+	Ratio   *float64 `json:"ratio,omitempty"` // Against / Base
+}
+
+// Diff compares two runs
+type Diff struct {
+	Base        Run           `json:"base"`
+	Against     Run           `json:"against"`
+	SameCode    bool          `json:"same_code"`
+	SamePayload bool          `json:"same_payload"`
+	Run         Section       `json:"run"` // Status, exit code, interpreter and policy versions
+	Duration    *Delta        `json:"duration_seconds,omitempty"`
+	CPU         *Delta        `json:"cpu_seconds,omitempty"`
+	Memory      *Delta        `json:"peak_memory_bytes,omitempty"`
+	Output      OutputSection `json:"output"`
+	Annotations Section       `json:"annotations"`
+	RichOutputs Section       `json:"rich_outputs"`
+	Artifacts   Section       `json:"artifacts"`
+}
+
+// Compare loads both tasks with their outputs and artifacts and compares them
+func Compare(ctx context.Context, db *sql.DB, baseID, againstID int) (*Diff, error) {
+	base, err := load(ctx, db, baseID)
+	if err != nil {
+		return nil, err
+	}
+	against, err := load(ctx, db, againstID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Diff{
+		Base:        *base,
+		Against:     *against,
+		SameCode:    base.CodeID == against.CodeID,
+		SamePayload: jsonEqual(base.payload, against.payload),
+	}
+
+	var run differ
+	run.value("status", base.Status, against.Status)
+	run.value("exit_code", deref(base.ExitCode), deref(against.ExitCode))
+	run.value("interpreter_version", deref(base.InterpreterVersion), deref(against.InterpreterVersion))
+	run.value("policy_version", deref(base.PolicyVersion), deref(against.PolicyVersion))
+	run.value("attempts", base.Attempts, against.Attempts)
+	d.Run = run.section()
+
+	d.Duration = delta(base.DurationSeconds, against.DurationSeconds)
+	d.CPU = delta(base.CPUSeconds, against.CPUSeconds)
+	d.Memory = delta(toFloat(base.PeakMemoryBytes), toFloat(against.PeakMemoryBytes))
+
+	d.Output = compareOutput(base.output, against.output)
+
+	var annotations differ
+	annotations.json("", parseJSON(base.annotations, map[string]any{}), parseJSON(against.annotations, map[string]any{}))
+	d.Annotations = annotations.section()
+
+	var rich differ
+	rich.json("", base.richOutputs, against.richOutputs)
+	d.RichOutputs = rich.section()
+
+	var artifacts differ
+	artifacts.json("", base.artifacts, against.artifacts)
+	d.Artifacts = artifacts.section()
+	return d, nil
+}
+
+func load(ctx context.Context, db *sql.DB, id int) (*Run, error) {
+	r := &Run{ID: id, richOutputs: map[string]any{}, artifacts: map[string]any{}}
+	var packedPayload, packedOutput []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT status, COALESCE(code::TEXT, ''), exit_code, EXTRACT(EPOCH FROM finished - started)::DOUBLE PRECISION,
+			cpu_seconds, peak_memory_bytes, interpreter_version, policy_version, attempts,
+			COALESCE(payload::TEXT, ''), COALESCE(output, ''), COALESCE(annotations::TEXT, ''), payload_zstd, output_zstd
+		FROM TASKS WHERE id = $1`, id).Scan(&r.Status, &r.CodeID, &r.ExitCode, &r.DurationSeconds,
+		&r.CPUSeconds, &r.PeakMemoryBytes, &r.InterpreterVersion, &r.PolicyVersion, &r.Attempts,
+		&r.payload, &r.output, &r.annotations, &packedPayload, &packedOutput)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load task %d: %w", id, err)
+	}
+	if r.payload, err = compression.Unpack(r.payload, packedPayload); err != nil {
+		return nil, fmt.Errorf("failed to load task %d: %w", id, err)
+	}
+	if r.output, err = compression.Unpack(r.output, packedOutput); err != nil {
+		return nil, fmt.Errorf("failed to load task %d: %w", id, err)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT seq, mime_type || ' ' || encode(sha256(data), 'hex') FROM TASK_OUTPUTS WHERE task_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outputs of task %d: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var seq int
+		var digest string
+		if err := rows.Scan(&seq, &digest); err != nil {
+			return nil, fmt.Errorf("failed to load outputs of task %d: %w", id, err)
+		}
+		r.richOutputs[strconv.Itoa(seq)] = digest
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load outputs of task %d: %w", id, err)
+	}
+
+	rows, err = db.QueryContext(ctx, `SELECT path, sha256 FROM TASK_ARTIFACTS WHERE task_id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load artifacts of task %d: %w", id, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path, sum string
+		if err := rows.Scan(&path, &sum); err != nil {
+			return nil, fmt.Errorf("failed to load artifacts of task %d: %w", id, err)
+		}
+		r.artifacts[path] = sum
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load artifacts of task %d: %w", id, err)
+	}
+	return r, nil
+}
+
+// compareOutput compares JSON output structurally, other output by line
+func compareOutput(base, against string) OutputSection {
+	var d differ
+	b, bErr := decodeJSON(base)
+	a, aErr := decodeJSON(against)
+	if bErr == nil && aErr == nil {
+		d.json("", b, a)
+		return OutputSection{Section: d.section(), Structured: true}
+	}
+
+	baseLines := strings.Split(strings.TrimRight(base, "\n"), "\n")
+	againstLines := strings.Split(strings.TrimRight(against, "\n"), "\n")
+	for i := range max(len(baseLines), len(againstLines)) {
+		var bl, al any
+		if i < len(baseLines) {
+			bl = baseLines[i]
+		}
+		if i < len(againstLines) {
+			al = againstLines[i]
+		}
+		d.value(fmt.Sprintf("line %d", i+1), bl, al)
+	}
+	return OutputSection{Section: d.section()}
+}
+
+// differ accumulates changes up to maxChanges
+type differ struct {
+	changes   []Change
+	truncated bool
+}
+
+func (d *differ) value(path string, base, against any) {
+	if reflect.DeepEqual(base, against) {
+		return
+	}
+	if len(d.changes) >= maxChanges {
+		d.truncated = true
+		return
+	}
+	d.changes = append(d.changes, Change{Path: path, Base: base, Against: against})
+}
+
+// json walks two decoded JSON values, reporting the leaves that differ
+func (d *differ) json(path string, base, against any) {
+	bm, bOK := base.(map[string]any)
+	am, aOK := against.(map[string]any)
+	if bOK && aOK {
+		keys := make([]string, 0, len(bm)+len(am))
+		for k := range bm {
+			keys = append(keys, k)
+		}
+		for k := range am {
+			if _, ok := bm[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			d.json(joinPath(path, k), bm[k], am[k])
+		}
+		return
+	}
+
+	bs, bOK := base.([]any)
+	as, aOK := against.([]any)
+	if bOK && aOK {
+		for i := range max(len(bs), len(as)) {
+			var bv, av any
+			if i < len(bs) {
+				bv = bs[i]
+			}
+			if i < len(as) {
+				av = as[i]
+			}
+			d.json(fmt.Sprintf("%s[%d]", path, i), bv, av)
+		}
+		return
+	}
+	d.value(path, base, against)
+}
+
+func (d *differ) section() Section {
+	return Section{Equal: len(d.changes) == 0 && !d.truncated, Changes: append([]Change{}, d.changes...), Truncated: d.truncated}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func decodeJSON(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty")
+	}
+	var v any
+	return v, json.Unmarshal([]byte(s), &v)
+}
+
+// parseJSON decodes s, or returns fallback when it isn't JSON
+func parseJSON(s string, fallback any) any {
+	v, err := decodeJSON(s)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func jsonEqual(a, b string) bool {
+	av, aErr := decodeJSON(a)
+	bv, bErr := decodeJSON(b)
+	if aErr != nil || bErr != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func delta(base, against *float64) *Delta {
+	if base == nil || against == nil {
+		return nil
+	}
+	d := &Delta{Base: *base, Against: *against, Change: *against - *base}
+	if *base != 0 {
+		ratio := *against / *base
+		d.Ratio = &ratio
+	}
+	return d
+}
+
+func toFloat(v *int64) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+// deref returns the pointed value, or nil for a nil pointer
+func deref[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
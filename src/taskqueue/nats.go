@@ -0,0 +1,491 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package taskqueue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// natsMaxMsgs caps the stream; acknowledged messages are removed by the
+	// work queue retention
+	natsMaxMsgs = 100000
+	// natsTimeout bounds the handshake and API requests
+	natsTimeout = 10 * time.Second
+)
+
+// JetStream API error codes meaning the stream or consumer already exists
+// with another configuration, which is left as the operator set it
+var natsExists = map[int]bool{10058: true, 10013: true, 10148: true}
+
+// NATS announces tasks on a JetStream work queue stream pulled through a
+// durable consumer shared by the fleet. Messages not acknowledged within
+// redeliverAfter, or negatively acknowledged, go to the next worker pulling.
+// In pub/sub mode it publishes plain core NATS messages on <stream>.wake
+// instead, received by every worker and lost while it is disconnected, and
+// needs no JetStream.
+type NATS struct {
+	url            *url.URL
+	stream         string
+	subject        string
+	consumer       string
+	redeliverAfter time.Duration
+	connected      atomic.Bool
+	// pubsub queues the messages of subject in notify rather than pull them
+	pubsub bool
+	notify wakeups
+
+	// dialMu serializes reconnects; mu guards the connection and inboxes
+	dialMu  sync.Mutex
+	mu      sync.Mutex
+	conn    net.Conn
+	w       *bufio.Writer
+	closed  bool
+	inbox   string
+	seq     int
+	inboxes map[string]chan natsMsg
+}
+
+type natsMsg struct {
+	reply  string
+	status string // e.g. "408" on a fetch that expired, from the HMSG header
+	data   []byte
+}
+
+// natsAPIError is the error member of JetStream API responses
+type natsAPIError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *natsAPIError) Error() string {
+	return fmt.Sprintf("jetstream: %s (%d)", e.Description, e.ErrCode)
+}
+
+// OpenNATS connects to u and creates the stream and durable consumer
+func OpenNATS(ctx context.Context, u *url.URL, stream, consumer string, redeliverAfter time.Duration) (*NATS, error) {
+	q := &NATS{url: u, stream: stream, subject: stream + ".tasks", consumer: consumer, redeliverAfter: redeliverAfter}
+	if err := q.connection(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	return q, nil
+}
+
+// OpenNATSPubSub connects to u and subscribes to <stream>.wake
+func OpenNATSPubSub(ctx context.Context, u *url.URL, stream string) (*NATS, error) {
+	q := &NATS{url: u, stream: stream, subject: stream + ".wake", pubsub: true, notify: newWakeups()}
+	if err := q.connection(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	return q, nil
+}
+
+func (q *NATS) Notify(ctx context.Context, taskID int) error {
+	if err := q.connection(ctx); err != nil {
+		return err
+	}
+	if q.pubsub {
+		return q.publish(q.subject, "", []byte(strconv.Itoa(taskID)))
+	}
+	_, err := q.api(ctx, q.subject, []byte(strconv.Itoa(taskID)))
+	return err
+}
+
+// Claim pulls a batch of at most max messages, waiting up to wait. In
+// pub/sub mode it returns the messages received within wait.
+func (q *NATS) Claim(ctx context.Context, max int, wait time.Duration) ([]Delivery, error) {
+	if err := q.connection(ctx); err != nil {
+		return nil, err
+	}
+	if q.pubsub {
+		return q.notify.claim(ctx, max, wait)
+	}
+	request, _ := json.Marshal(map[string]any{"batch": max, "expires": wait.Nanoseconds()})
+	token, msgs := q.subscribe(max + 1)
+	defer q.unsubscribe(token)
+	if err := q.publish("$JS.API.CONSUMER.MSG.NEXT."+q.stream+"."+group, q.inbox+"."+token, request); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(wait + natsTimeout)
+	defer timer.Stop()
+	var deliveries []Delivery
+	for len(deliveries) < max {
+		select {
+		case <-ctx.Done():
+			return deliveries, ctx.Err()
+		case <-timer.C:
+			return deliveries, nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return deliveries, errors.New("nats connection lost")
+			}
+			if msg.status != "" {
+				// 404 no messages, 408 expired, 409 consumer changed
+				return deliveries, nil
+			}
+			d := Delivery{handle: msg.reply}
+			d.TaskID, _ = strconv.Atoi(string(msg.data))
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (q *NATS) Ack(ctx context.Context, d Delivery) error {
+	if q.pubsub {
+		return nil
+	}
+	return q.publish(d.handle, "", []byte("+ACK"))
+}
+
+// Nack redelivers the message once redeliverAfter has passed
+func (q *NATS) Nack(ctx context.Context, d Delivery) error {
+	if q.pubsub {
+		return nil
+	}
+	return q.publish(d.handle, "", []byte(fmt.Sprintf(`-NAK {"delay": %d}`, q.redeliverAfter.Nanoseconds())))
+}
+
+func (q *NATS) Connected() bool { return q.connected.Load() }
+
+func (q *NATS) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	if q.conn != nil {
+		q.conn.Close()
+	}
+	return nil
+}
+
+// connection (re)connects when the connection was lost, then makes sure the
+// stream and consumer exist since the server may have lost them meanwhile,
+// or in pub/sub mode resubscribes and wakes the worker for what it missed
+func (q *NATS) connection(ctx context.Context) error {
+	q.dialMu.Lock()
+	defer q.dialMu.Unlock()
+	q.mu.Lock()
+	up, closed := q.conn != nil, q.closed
+	q.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if up {
+		return nil
+	}
+
+	conn, r, err := q.dial(ctx)
+	if err != nil {
+		return err
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	q.mu.Lock()
+	q.conn, q.w = conn, bufio.NewWriter(conn)
+	q.inbox = "_INBOX." + hex.EncodeToString(id[:])
+	q.inboxes = make(map[string]chan natsMsg)
+	q.mu.Unlock()
+	go q.read(conn, r)
+
+	err = q.write(fmt.Sprintf("SUB %s.* 1\r\n", q.inbox), nil)
+	if err == nil && q.pubsub {
+		err = q.write(fmt.Sprintf("SUB %s 2\r\n", q.subject), nil)
+	} else if err == nil {
+		err = q.setup(ctx)
+	}
+	if err != nil {
+		q.drop(conn)
+		return err
+	}
+	q.connected.Store(true)
+	if q.pubsub {
+		q.notify.push(Delivery{})
+	}
+	return nil
+}
+
+// dial connects and completes the INFO/CONNECT/PING handshake, upgrading to
+// TLS when the server requires it
+func (q *NATS) dial(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	host := q.url.Host
+	if q.url.Port() == "" {
+		host = net.JoinHostPort(q.url.Hostname(), "4222")
+	}
+	d := net.Dialer{Timeout: natsTimeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, nil, fmt.Errorf("unexpected nats greeting %q: %v", line, err)
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+		Headers     bool `json:"headers"`
+		JetStream   bool `json:"jetstream"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("malformed nats INFO: %w", err)
+	}
+	if !q.pubsub && (!info.Headers || !info.JetStream) {
+		conn.Close()
+		return nil, nil, errors.New("nats server doesn't have JetStream enabled")
+	}
+	if info.TLSRequired {
+		conn = tls.Client(conn, &tls.Config{ServerName: q.url.Hostname()})
+		r = bufio.NewReader(conn)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "lang": "go", "version": "continuum",
+		"protocol": 1, "headers": info.Headers, "no_responders": info.Headers}
+	if user := q.url.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	line, err = r.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return nil, nil, fmt.Errorf("nats connect refused: %q %v", strings.TrimSpace(line), err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, r, nil
+}
+
+// setup creates the work queue stream and the shared durable consumer
+func (q *NATS) setup(ctx context.Context) error {
+	stream, _ := json.Marshal(map[string]any{"name": q.stream, "subjects": []string{q.subject},
+		"retention": "workqueue", "storage": "file", "max_msgs": natsMaxMsgs, "discard": "old"})
+	consumer, _ := json.Marshal(map[string]any{"stream_name": q.stream, "config": map[string]any{
+		"durable_name": group, "ack_policy": "explicit", "deliver_policy": "all",
+		"ack_wait": q.redeliverAfter.Nanoseconds(), "max_ack_pending": -1}})
+
+	var apiErr *natsAPIError
+	if _, err := q.api(ctx, "$JS.API.STREAM.CREATE."+q.stream, stream); err != nil && !(errors.As(err, &apiErr) && natsExists[apiErr.ErrCode]) {
+		return fmt.Errorf("failed to create stream %s: %w", q.stream, err)
+	}
+	if _, err := q.api(ctx, "$JS.API.CONSUMER.DURABLE.CREATE."+q.stream+"."+group, consumer); err != nil && !(errors.As(err, &apiErr) && natsExists[apiErr.ErrCode]) {
+		return fmt.Errorf("failed to create consumer %s: %w", group, err)
+	}
+	return nil
+}
+
+// api sends a request and decodes the JetStream error of its response, if any
+func (q *NATS) api(ctx context.Context, subject string, payload []byte) ([]byte, error) {
+	token, msgs := q.subscribe(1)
+	defer q.unsubscribe(token)
+	if err := q.publish(subject, q.inbox+"."+token, payload); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(natsTimeout)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("nats request to %s timed out", subject)
+	case msg, ok := <-msgs:
+		if !ok {
+			return nil, errors.New("nats connection lost")
+		}
+		if msg.status == "503" {
+			return nil, fmt.Errorf("no responders for %s, is JetStream enabled?", subject)
+		}
+		var resp struct {
+			Error *natsAPIError `json:"error"`
+		}
+		if err := json.Unmarshal(msg.data, &resp); err == nil && resp.Error != nil {
+			return nil, resp.Error
+		}
+		return msg.data, nil
+	}
+}
+
+// subscribe registers an inbox token receiving up to size messages
+func (q *NATS) subscribe(size int) (string, <-chan natsMsg) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	token := strconv.Itoa(q.seq)
+	msgs := make(chan natsMsg, size)
+	if q.inboxes != nil {
+		q.inboxes[token] = msgs
+	} else {
+		close(msgs)
+	}
+	return token, msgs
+}
+
+func (q *NATS) unsubscribe(token string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.inboxes, token)
+}
+
+func (q *NATS) publish(subject, reply string, payload []byte) error {
+	op := "PUB " + subject
+	if reply != "" {
+		op += " " + reply
+	}
+	return q.write(fmt.Sprintf("%s %d\r\n", op, len(payload)), payload)
+}
+
+// write sends an operation, and its payload when not nil
+func (q *NATS) write(op string, payload []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.conn == nil {
+		return errors.New("nats connection lost")
+	}
+	q.conn.SetWriteDeadline(time.Now().Add(natsTimeout))
+	q.w.WriteString(op)
+	if payload != nil {
+		q.w.Write(payload)
+		q.w.WriteString("\r\n")
+	}
+	return q.w.Flush()
+}
+
+// read dispatches incoming messages to their inbox until the connection
+// fails, then drops it so the next call reconnects
+func (q *NATS) read(conn net.Conn, r *bufio.Reader) {
+	defer q.drop(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			q.write("PONG\r\n", nil)
+		case "-ERR":
+			fmt.Printf("NATS error: %s\n", strings.TrimSpace(line))
+		case "MSG", "HMSG":
+			msg, subject, err := readNATSMsg(r, fields)
+			if err != nil {
+				return
+			}
+			if q.pubsub && subject == q.subject {
+				d := Delivery{}
+				d.TaskID, _ = strconv.Atoi(string(msg.data))
+				q.notify.push(d)
+				continue
+			}
+			q.deliver(strings.TrimPrefix(subject, q.inbox+"."), msg)
+		}
+	}
+}
+
+// deliver hands msg to the inbox token without blocking the reader. The
+// lock keeps drop from closing the channel meanwhile.
+func (q *NATS) deliver(token string, msg natsMsg) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	select {
+	case q.inboxes[token] <- msg:
+	default:
+		// Nobody waits anymore; unacknowledged messages are redelivered
+	}
+}
+
+// readNATSMsg reads the payload announced by MSG <subject> <sid> [reply]
+// <size> or HMSG <subject> <sid> [reply] <header size> <total size>
+func readNATSMsg(r *bufio.Reader, fields []string) (natsMsg, string, error) {
+	headered := fields[0] == "HMSG"
+	sizes := 1
+	if headered {
+		sizes = 2
+	}
+	if len(fields) < 3+sizes || len(fields) > 4+sizes {
+		return natsMsg{}, "", fmt.Errorf("malformed nats %s", fields[0])
+	}
+	var msg natsMsg
+	if len(fields) == 4+sizes {
+		msg.reply = fields[3]
+	}
+	total, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || total < 0 {
+		return natsMsg{}, "", fmt.Errorf("malformed nats %s size", fields[0])
+	}
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return natsMsg{}, "", err
+	}
+	msg.data = buf[:total]
+	if headered {
+		headerSize, err := strconv.Atoi(fields[len(fields)-2])
+		if err != nil || headerSize < 0 || headerSize > total {
+			return natsMsg{}, "", errors.New("malformed nats HMSG header size")
+		}
+		// NATS/1.0 408 Request Timeout
+		header := msg.data[:headerSize]
+		if status, _, _ := bytes.Cut(header, []byte("\r\n")); len(status) > len("NATS/1.0 ") {
+			if code := strings.Fields(string(status[len("NATS/1.0 "):])); len(code) > 0 {
+				msg.status = code[0]
+			}
+		}
+		msg.data = msg.data[headerSize:]
+	}
+	return msg, fields[1], nil
+}
+
+// drop forgets conn and fails the requests waiting on it
+func (q *NATS) drop(conn net.Conn) {
+	conn.Close()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.conn != conn {
+		return
+	}
+	q.conn = nil
+	q.connected.Store(false)
+	for token, msgs := range q.inboxes {
+		close(msgs)
+		delete(q.inboxes, token)
+	}
+	q.inboxes = nil
+}
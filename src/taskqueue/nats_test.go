@@ -0,0 +1,244 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package taskqueue
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadNATSMsg(t *testing.T) {
+	timeout := "NATS/1.0 408 Request Timeout\r\n\r\n"
+	header := "NATS/1.0\r\nNats-Msg-Id: 1\r\n\r\n"
+	size := func(s string) string { return strconv.Itoa(len(s)) }
+	tests := []struct {
+		name        string
+		op          string
+		payload     string
+		want        natsMsg
+		wantSubject string
+		wantErr     bool
+	}{
+		{
+			name: "message", op: "MSG tasks.wake 2 2", payload: "42",
+			want: natsMsg{data: []byte("42")}, wantSubject: "tasks.wake",
+		},
+		{
+			name: "message with reply", op: "MSG _INBOX.x.1 1 $JS.ACK.tasks.1 2", payload: "42",
+			want: natsMsg{reply: "$JS.ACK.tasks.1", data: []byte("42")}, wantSubject: "_INBOX.x.1",
+		},
+		{
+			name: "empty message", op: "MSG _INBOX.x.1 1 0", payload: "",
+			want: natsMsg{data: []byte{}}, wantSubject: "_INBOX.x.1",
+		},
+		{
+			name: "status", op: "HMSG _INBOX.x.1 1 " + size(timeout) + " " + size(timeout), payload: timeout,
+			want: natsMsg{status: "408", data: []byte{}}, wantSubject: "_INBOX.x.1",
+		},
+		{
+			name: "headers and data", op: "HMSG _INBOX.x.1 1 $JS.ACK.tasks.2 " + size(header) + " " + size(header+"7"), payload: header + "7",
+			want: natsMsg{reply: "$JS.ACK.tasks.2", data: []byte("7")}, wantSubject: "_INBOX.x.1",
+		},
+		{name: "missing size", op: "MSG _INBOX.x.1 1", wantErr: true},
+		{name: "too many fields", op: "MSG a 1 b c 2", payload: "42", wantErr: true},
+		{name: "bad size", op: "MSG a 1 x", wantErr: true},
+		{name: "negative size", op: "MSG a 1 -1", wantErr: true},
+		{name: "header larger than message", op: "HMSG a 1 10 4", payload: "abcd", wantErr: true},
+		{name: "truncated payload", op: "MSG a 1 10", payload: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.payload + "\r\n"))
+			msg, subject, err := readNATSMsg(r, strings.Fields(tt.op))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readNATSMsg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(msg, tt.want) || subject != tt.wantSubject {
+				t.Fatalf("readNATSMsg() = %#v, %q; want %#v, %q", msg, subject, tt.want, tt.wantSubject)
+			}
+		})
+	}
+}
+
+// natsServer is the server end of a pipe connected to a NATS queue
+type natsServer struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// pipeNATS connects q to a pipe, as connection does, and starts its reader
+func pipeNATS(t *testing.T, q *NATS) *natsServer {
+	t.Helper()
+	client, server := net.Pipe()
+	q.conn, q.w = client, bufio.NewWriter(client)
+	q.inbox = "_INBOX.test"
+	q.inboxes = make(map[string]chan natsMsg)
+	go q.read(client, bufio.NewReader(client))
+	t.Cleanup(func() { server.Close() })
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	return &natsServer{conn: server, r: bufio.NewReader(server)}
+}
+
+// next reads an operation and its payload, if it announces one
+func (s *natsServer) next(t *testing.T) (string, string) {
+	t.Helper()
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading operation: %v", err)
+	}
+	op := strings.TrimSuffix(line, "\r\n")
+	if !strings.HasPrefix(op, "PUB ") {
+		return op, ""
+	}
+	fields := strings.Fields(op)
+	n, _ := strconv.Atoi(fields[len(fields)-1])
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(s.r, buf); err != nil {
+		t.Fatalf("reading payload: %v", err)
+	}
+	return op, string(buf[:n])
+}
+
+func (s *natsServer) send(t *testing.T, ops ...string) {
+	t.Helper()
+	for _, op := range ops {
+		if _, err := s.conn.Write([]byte(op)); err != nil {
+			t.Fatalf("sending %q: %v", op, err)
+		}
+	}
+}
+
+func TestNATSAck(t *testing.T) {
+	tests := []struct {
+		name    string
+		pubsub  bool
+		nack    bool
+		wantOp  string
+		wantMsg string
+	}{
+		{name: "ack", wantOp: "PUB $JS.ACK.tasks.1 4", wantMsg: "+ACK"},
+		{name: "nack", nack: true, wantOp: "PUB $JS.ACK.tasks.1 27", wantMsg: `-NAK {"delay": 30000000000}`},
+		{name: "pub/sub ack", pubsub: true},
+		{name: "pub/sub nack", pubsub: true, nack: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &NATS{redeliverAfter: 30 * time.Second, pubsub: tt.pubsub}
+			server := pipeNATS(t, q)
+
+			done := make(chan error, 1)
+			go func() {
+				d := Delivery{TaskID: 1, handle: "$JS.ACK.tasks.1"}
+				if tt.nack {
+					done <- q.Nack(context.Background(), d)
+				} else {
+					done <- q.Ack(context.Background(), d)
+				}
+			}()
+			if tt.wantOp != "" {
+				op, msg := server.next(t)
+				if op != tt.wantOp || msg != tt.wantMsg {
+					t.Fatalf("sent %q %q, want %q %q", op, msg, tt.wantOp, tt.wantMsg)
+				}
+			}
+			if err := <-done; err != nil {
+				t.Fatalf("error = %v", err)
+			}
+		})
+	}
+}
+
+func TestNATSClaim(t *testing.T) {
+	timeout := "NATS/1.0 408 Request Timeout\r\n\r\n"
+	tests := []struct {
+		name    string
+		replies []string
+		close   bool
+		want    []Delivery
+		wantErr bool
+	}{
+		{
+			name: "full batch",
+			replies: []string{
+				"MSG _INBOX.test.1 1 $JS.ACK.tasks.1 1\r\n7\r\n",
+				"MSG _INBOX.test.1 1 $JS.ACK.tasks.2 1\r\n8\r\n",
+			},
+			want: []Delivery{{TaskID: 7, handle: "$JS.ACK.tasks.1"}, {TaskID: 8, handle: "$JS.ACK.tasks.2"}},
+		},
+		{
+			name: "expired fetch",
+			replies: []string{
+				"PING\r\n",
+				"MSG _INBOX.test.1 1 $JS.ACK.tasks.1 1\r\n7\r\n",
+				"HMSG _INBOX.test.1 1 " + strconv.Itoa(len(timeout)) + " " + strconv.Itoa(len(timeout)) + "\r\n" + timeout + "\r\n",
+			},
+			want: []Delivery{{TaskID: 7, handle: "$JS.ACK.tasks.1"}},
+		},
+		{name: "connection lost", close: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &NATS{stream: "tasks"}
+			server := pipeNATS(t, q)
+
+			type result struct {
+				deliveries []Delivery
+				err        error
+			}
+			done := make(chan result, 1)
+			go func() {
+				deliveries, err := q.Claim(context.Background(), 2, time.Second)
+				done <- result{deliveries, err}
+			}()
+
+			op, request := server.next(t)
+			if want := "PUB $JS.API.CONSUMER.MSG.NEXT.tasks." + group + " _INBOX.test.1 " + strconv.Itoa(len(request)); op != want {
+				t.Fatalf("sent %q, want %q", op, want)
+			}
+			if want := `{"batch":2,"expires":1000000000}`; request != want {
+				t.Fatalf("requested %s, want %s", request, want)
+			}
+			for _, reply := range tt.replies {
+				server.send(t, reply)
+				if reply == "PING\r\n" {
+					if pong, _ := server.next(t); pong != "PONG" {
+						t.Fatalf("answered PING with %q", pong)
+					}
+				}
+			}
+			if tt.close {
+				server.conn.Close()
+			}
+
+			got := <-done
+			if (got.err != nil) != tt.wantErr {
+				t.Fatalf("Claim() error = %v, wantErr %v", got.err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got.deliveries, tt.want) {
+				t.Fatalf("Claim() = %#v, want %#v", got.deliveries, tt.want)
+			}
+			if tt.close && q.Connected() {
+				t.Fatal("still connected after the connection was lost")
+			}
+		})
+	}
+}
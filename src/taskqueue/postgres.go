@@ -0,0 +1,127 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package taskqueue
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// notifyChannel is emitted by the TASKS trigger on every change
+const notifyChannel = "tasks_updated"
+
+// Reconnect backoff of the listening connection
+const (
+	minReconnectDelay = 10 * time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Postgres announces tasks through the tasks_updated trigger. Notifications
+// carry no delivery guarantee, so Claim only returns wake-ups and Ack/Nack
+// have nothing to settle.
+type Postgres struct {
+	dsn       string
+	notify    wakeups
+	connected atomic.Bool
+	stop      context.CancelFunc
+	done      chan struct{}
+}
+
+// OpenPostgres listens to tasks_updated on its own pgx connection to dsn,
+// outside the pool
+func OpenPostgres(ctx context.Context, dsn string) (*Postgres, error) {
+	conn, err := listen(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	runCtx, stop := context.WithCancel(context.Background())
+	p := &Postgres{dsn: dsn, notify: newWakeups(), stop: stop, done: make(chan struct{})}
+	p.connected.Store(true)
+	go p.run(runCtx, conn)
+	return p, nil
+}
+
+func listen(ctx context.Context, dsn string) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run waits for notifications until ctx is cancelled, reconnecting with
+// backoff when the connection drops. A reconnect also wakes the worker:
+// inserts may have been missed meanwhile.
+func (p *Postgres) run(ctx context.Context, conn *pgx.Conn) {
+	defer close(p.done)
+	defer close(p.notify)
+
+	delay := minReconnectDelay
+	for {
+		if conn == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			var err error
+			if conn, err = listen(ctx, p.dsn); err != nil {
+				fmt.Printf("Listener error: %v\n", err)
+				delay = min(delay*2, maxReconnectDelay)
+				continue
+			}
+			delay = minReconnectDelay
+			p.connected.Store(true)
+			p.notify.push(Delivery{})
+		}
+
+		_, err := conn.WaitForNotification(ctx)
+		if err == nil {
+			p.notify.push(Delivery{})
+			continue
+		}
+		p.connected.Store(false)
+		conn.Close(context.Background())
+		conn = nil
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Listener error: %v\n", err)
+	}
+}
+
+// Notify is a no-op: the TASKS trigger notifies on commit
+func (p *Postgres) Notify(ctx context.Context, taskID int) error { return nil }
+
+// Claim returns one wake-up per notification received within wait
+func (p *Postgres) Claim(ctx context.Context, max int, wait time.Duration) ([]Delivery, error) {
+	return p.notify.claim(ctx, max, wait)
+}
+
+func (p *Postgres) Ack(ctx context.Context, d Delivery) error  { return nil }
+func (p *Postgres) Nack(ctx context.Context, d Delivery) error { return nil }
+
+func (p *Postgres) Connected() bool { return p.connected.Load() }
+
+func (p *Postgres) Close() error {
+	p.stop()
+	<-p.done
+	return nil
+}
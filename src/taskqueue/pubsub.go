@@ -0,0 +1,150 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package taskqueue
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RedisPubSub wakes workers through a Redis channel named after the stream.
+// Like LISTEN/NOTIFY, every worker receives every announcement and those
+// published while it was disconnected are lost, so a reconnect wakes it.
+// It needs no stream or consumer group, and works with any Redis version.
+type RedisPubSub struct {
+	url       *url.URL
+	channel   string
+	cmd       *redisConn
+	notify    wakeups
+	connected atomic.Bool
+	closed    atomic.Bool
+	stop      context.CancelFunc
+	done      chan struct{}
+}
+
+// OpenRedisPubSub subscribes to the channel on its own connection to u
+func OpenRedisPubSub(ctx context.Context, u *url.URL, channel string) (*RedisPubSub, error) {
+	q := &RedisPubSub{url: u, channel: channel, notify: newWakeups(), done: make(chan struct{})}
+	q.cmd = &redisConn{dial: func(ctx context.Context) (*redisConn, error) {
+		if q.closed.Load() {
+			return nil, ErrClosed
+		}
+		return redisDial(ctx, u)
+	}}
+	sub, err := q.subscribe(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	runCtx, stop := context.WithCancel(context.Background())
+	q.stop = stop
+	q.connected.Store(true)
+	go q.run(runCtx, sub)
+	return q, nil
+}
+
+// subscribe opens a connection in subscriber mode, which only receives
+func (q *RedisPubSub) subscribe(ctx context.Context) (*redisConn, error) {
+	c, err := redisDial(ctx, q.url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.roundTrip(time.Now().Add(redisTimeout), []string{"SUBSCRIBE", q.channel}); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// run receives messages until ctx is cancelled, resubscribing with backoff
+// when the connection drops
+func (q *RedisPubSub) run(ctx context.Context, sub *redisConn) {
+	defer close(q.done)
+	defer close(q.notify)
+
+	delay := minReconnectDelay
+	for {
+		if sub == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			var err error
+			if sub, err = q.subscribe(ctx); err != nil {
+				fmt.Printf("Listener error: %v\n", err)
+				delay = min(delay*2, maxReconnectDelay)
+				continue
+			}
+			delay = minReconnectDelay
+			q.connected.Store(true)
+			q.notify.push(Delivery{})
+		}
+
+		// The read blocks without a deadline; closing the connection ends it
+		stopRead := context.AfterFunc(ctx, func() { sub.conn.Close() })
+		err := q.receive(sub)
+		stopRead()
+		q.connected.Store(false)
+		sub.conn.Close()
+		sub = nil
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Listener error: %v\n", err)
+	}
+}
+
+// receive queues the announcements of the subscription until the
+// connection fails
+func (q *RedisPubSub) receive(sub *redisConn) error {
+	for {
+		reply, err := sub.read()
+		if err != nil {
+			return err
+		}
+		// ["message", channel, payload]
+		if msg, _ := reply.([]any); len(msg) == 3 && msg[0] == "message" {
+			payload, _ := msg[2].(string)
+			d := Delivery{}
+			d.TaskID, _ = strconv.Atoi(payload)
+			q.notify.push(d)
+		}
+	}
+}
+
+func (q *RedisPubSub) Notify(ctx context.Context, taskID int) error {
+	_, err := q.cmd.do(ctx, redisTimeout, "PUBLISH", q.channel, strconv.Itoa(taskID))
+	return err
+}
+
+// Claim returns the announcements received within wait
+func (q *RedisPubSub) Claim(ctx context.Context, max int, wait time.Duration) ([]Delivery, error) {
+	return q.notify.claim(ctx, max, wait)
+}
+
+func (q *RedisPubSub) Ack(ctx context.Context, d Delivery) error  { return nil }
+func (q *RedisPubSub) Nack(ctx context.Context, d Delivery) error { return nil }
+
+func (q *RedisPubSub) Connected() bool { return q.connected.Load() }
+
+func (q *RedisPubSub) Close() error {
+	q.closed.Store(true)
+	q.stop()
+	<-q.done
+	q.cmd.close()
+	return nil
+}
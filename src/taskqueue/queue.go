@@ -0,0 +1,160 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package taskqueue announces claimable tasks to the workers. Postgres stays
+// the record of tasks and FOR UPDATE SKIP LOCKED still arbitrates claims; a
+// Queue only tells workers when to look, so a lost or duplicated announcement
+// costs latency, never correctness. Postgres LISTEN/NOTIFY is the default;
+// Redis Streams and NATS JetStream let Continuum run against databases that
+// can't hold a LISTEN connection (e.g. behind a transaction pooler), and
+// Redis or NATS pub/sub carry plain wake-ups over a bus the deployment
+// already runs.
+package taskqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"continuumworker/src/config"
+)
+
+// group is the consumer group (Redis) or durable consumer (JetStream) shared
+// by the fleet, so each announcement is handed to one worker at a time
+const group = "continuum-workers"
+
+// ErrClosed is returned by a Queue used after Close
+var ErrClosed = errors.New("task queue is closed")
+
+// Delivery is an announcement handed to a worker by Claim
+type Delivery struct {
+	// TaskID is the announced task, or 0 for a bare wake-up (LISTEN/NOTIFY,
+	// or a reconnect after which announcements may have been missed)
+	TaskID int
+	// handle settles the delivery with the backend, e.g. a stream entry ID
+	handle string
+}
+
+// Queue carries task announcements between submitters and workers
+type Queue interface {
+	// Notify announces a task that became claimable
+	Notify(ctx context.Context, taskID int) error
+	// Claim waits up to wait for announcements and returns at most max of
+	// them, or none when wait expires
+	Claim(ctx context.Context, max int, wait time.Duration) ([]Delivery, error)
+	// Ack settles a delivery whose task no longer needs a worker
+	Ack(ctx context.Context, d Delivery) error
+	// Nack gives the delivery back so another worker gets it
+	Nack(ctx context.Context, d Delivery) error
+	// Connected reports whether the backend connection is up
+	Connected() bool
+	Close() error
+}
+
+// Open connects to the backend named by cfg.URL, Postgres LISTEN/NOTIFY on
+// dsn when it is empty, in cfg.Mode. consumer names this worker to the backend.
+func Open(ctx context.Context, cfg config.Queue, dsn, consumer string) (Queue, error) {
+	if cfg.URL == "" {
+		return OpenPostgres(ctx, dsn)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid task queue URL: %w", err)
+	}
+	pubsub := cfg.Mode == "pubsub"
+	switch {
+	case (u.Scheme == "redis" || u.Scheme == "rediss") && pubsub:
+		return OpenRedisPubSub(ctx, u, cfg.Stream)
+	case u.Scheme == "redis" || u.Scheme == "rediss":
+		return OpenRedis(ctx, u, cfg.Stream, consumer, cfg.RedeliverAfter)
+	case u.Scheme == "nats" && pubsub:
+		return OpenNATSPubSub(ctx, u, cfg.Stream)
+	case u.Scheme == "nats":
+		return OpenNATS(ctx, u, cfg.Stream, consumer, cfg.RedeliverAfter)
+	}
+	return nil, fmt.Errorf("unsupported task queue %q", u.Scheme)
+}
+
+// Name is the backend kind, for logs
+func Name(cfg config.Queue) string {
+	if cfg.URL == "" {
+		return "LISTEN/NOTIFY"
+	}
+	if u, err := url.Parse(cfg.URL); err == nil {
+		pubsub := cfg.Mode == "pubsub"
+		switch {
+		case (u.Scheme == "redis" || u.Scheme == "rediss") && pubsub:
+			return "Redis pub/sub"
+		case u.Scheme == "redis" || u.Scheme == "rediss":
+			return "Redis Streams"
+		case u.Scheme == "nats" && pubsub:
+			return "NATS pub/sub"
+		case u.Scheme == "nats":
+			return "NATS JetStream"
+		}
+	}
+	return cfg.URL
+}
+
+// wakeups buffers the announcements of a broadcast backend (LISTEN/NOTIFY,
+// Redis or NATS pub/sub) until the next Claim. Every worker receives every
+// announcement and nothing is kept while it is disconnected, so there is
+// nothing to settle.
+type wakeups chan Delivery
+
+func newWakeups() wakeups {
+	return make(wakeups, 32)
+}
+
+// push queues an announcement; when the buffer is full, wake-ups are
+// already pending
+func (w wakeups) push(d Delivery) {
+	select {
+	case w <- d:
+	default:
+	}
+}
+
+// claim returns the announcements received within wait, at most max. It
+// fails with ErrClosed once the buffer is closed.
+func (w wakeups) claim(ctx context.Context, max int, wait time.Duration) ([]Delivery, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var first Delivery
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, nil
+	case d, ok := <-w:
+		if !ok {
+			return nil, ErrClosed
+		}
+		first = d
+	}
+	// Hand back what has arrived without waiting for more
+	deliveries := []Delivery{first}
+	for len(deliveries) < max {
+		select {
+		case d, ok := <-w:
+			if !ok {
+				return deliveries, nil
+			}
+			deliveries = append(deliveries, d)
+		default:
+			return deliveries, nil
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,325 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package taskqueue
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// redisMaxLen caps the stream; acknowledged entries are only trimmed
+	redisMaxLen = 100000
+	// redisTimeout bounds commands other than the blocking read
+	redisTimeout = 10 * time.Second
+)
+
+// redisError is an error reply, after which the connection is still usable
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Redis announces tasks on a stream read through a consumer group shared by
+// the fleet. An entry stays pending until acknowledged; Nack leaves it there
+// and XAUTOCLAIM hands it to the next worker asking once it has been idle
+// for redeliverAfter. Needs Redis 6.2 or later.
+type Redis struct {
+	url            *url.URL
+	stream         string
+	consumer       string
+	redeliverAfter time.Duration
+
+	// cmd sends short commands while claims block on their own connection,
+	// so Notify and Ack aren't stuck behind XREADGROUP
+	cmd, blocking *redisConn
+	connected     atomic.Bool
+	closed        atomic.Bool
+}
+
+// OpenRedis connects to u and creates the stream and consumer group
+func OpenRedis(ctx context.Context, u *url.URL, stream, consumer string, redeliverAfter time.Duration) (*Redis, error) {
+	q := &Redis{url: u, stream: stream, consumer: consumer, redeliverAfter: redeliverAfter}
+	q.cmd = &redisConn{dial: q.dial}
+	q.blocking = &redisConn{dial: q.dial}
+	if _, err := q.cmd.do(ctx, redisTimeout, "PING"); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	q.connected.Store(true)
+	return q, nil
+}
+
+// dial opens a connection and makes sure the consumer group exists, since
+// the stream may have been flushed while disconnected
+func (q *Redis) dial(ctx context.Context) (*redisConn, error) {
+	if q.closed.Load() {
+		return nil, ErrClosed
+	}
+	c, err := redisDial(ctx, q.url)
+	if err != nil {
+		return nil, err
+	}
+	_, err = c.roundTrip(time.Now().Add(redisTimeout), []string{"XGROUP", "CREATE", q.stream, group, "0", "MKSTREAM"})
+	if err != nil && !strings.HasPrefix(err.Error(), "redis: BUSYGROUP") {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// redisDial opens an authenticated connection to u on its database
+func redisDial(ctx context.Context, u *url.URL) (*redisConn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	d := net.Dialer{Timeout: redisTimeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "rediss" {
+		conn = tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	var setup [][]string
+	if user := u.User; user != nil {
+		if password, ok := user.Password(); ok {
+			setup = append(setup, []string{"AUTH", user.Username(), password})
+		} else {
+			setup = append(setup, []string{"AUTH", user.Username()})
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		setup = append(setup, []string{"SELECT", db})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(time.Now().Add(redisTimeout), args); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (q *Redis) Notify(ctx context.Context, taskID int) error {
+	_, err := q.do(ctx, q.cmd, redisTimeout, "XADD", q.stream, "MAXLEN", "~", strconv.Itoa(redisMaxLen), "*", "task", strconv.Itoa(taskID))
+	return err
+}
+
+// Claim first takes over entries other workers left pending for longer
+// than redeliverAfter, then waits for new ones
+func (q *Redis) Claim(ctx context.Context, max int, wait time.Duration) ([]Delivery, error) {
+	reply, err := q.do(ctx, q.blocking, redisTimeout, "XAUTOCLAIM", q.stream, group, q.consumer,
+		strconv.FormatInt(q.redeliverAfter.Milliseconds(), 10), "0-0", "COUNT", strconv.Itoa(max))
+	if err != nil {
+		return nil, err
+	}
+	if claimed, ok := reply.([]any); ok && len(claimed) > 1 {
+		if deliveries := redisEntries(claimed[1]); len(deliveries) > 0 {
+			return deliveries, nil
+		}
+	}
+
+	reply, err = q.do(ctx, q.blocking, wait+redisTimeout, "XREADGROUP", "GROUP", group, q.consumer,
+		"COUNT", strconv.Itoa(max), "BLOCK", strconv.FormatInt(wait.Milliseconds(), 10), "STREAMS", q.stream, ">")
+	if err != nil {
+		return nil, err
+	}
+	// [[stream, entries]], or nil when BLOCK expired
+	streams, _ := reply.([]any)
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	stream, _ := streams[0].([]any)
+	if len(stream) < 2 {
+		return nil, nil
+	}
+	return redisEntries(stream[1]), nil
+}
+
+func (q *Redis) Ack(ctx context.Context, d Delivery) error {
+	_, err := q.do(ctx, q.cmd, redisTimeout, "XACK", q.stream, group, d.handle)
+	return err
+}
+
+// Nack leaves the entry pending, to be reclaimed after redeliverAfter
+func (q *Redis) Nack(ctx context.Context, d Delivery) error { return nil }
+
+func (q *Redis) Connected() bool { return q.connected.Load() }
+
+func (q *Redis) Close() error {
+	q.closed.Store(true)
+	q.connected.Store(false)
+	q.cmd.close()
+	q.blocking.close()
+	return nil
+}
+
+// do runs a command on c, tracking whether the connection is up
+func (q *Redis) do(ctx context.Context, c *redisConn, timeout time.Duration, args ...string) (any, error) {
+	reply, err := c.do(ctx, timeout, args...)
+	var replyErr redisError
+	switch {
+	case err == nil || errors.As(err, &replyErr):
+		q.connected.Store(true)
+	case !q.closed.Load():
+		q.connected.Store(false)
+	}
+	return reply, err
+}
+
+// redisEntries reads the task IDs of [[id, [field, value, ...]], ...].
+// Trimmed entries come back as nil and are skipped.
+func redisEntries(reply any) []Delivery {
+	entries, _ := reply.([]any)
+	deliveries := make([]Delivery, 0, len(entries))
+	for _, e := range entries {
+		entry, _ := e.([]any)
+		if len(entry) < 2 {
+			continue
+		}
+		id, _ := entry[0].(string)
+		fields, _ := entry[1].([]any)
+		d := Delivery{handle: id}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] == "task" {
+				value, _ := fields[i+1].(string)
+				d.TaskID, _ = strconv.Atoi(value)
+			}
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
+
+// redisConn is a RESP2 connection redialed after network errors
+type redisConn struct {
+	mu   sync.Mutex
+	dial func(context.Context) (*redisConn, error)
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// do sends one command and reads its reply. Error replies are returned as
+// redisError and keep the connection; other errors drop it.
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		fresh, err := c.dial(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.conn, c.r = fresh.conn, fresh.r
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	reply, err := c.roundTrip(deadline, args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		c.conn = nil
+	} else if replyErr != "" && strings.HasPrefix(string(replyErr), "NOGROUP") {
+		// The stream was deleted; redial to create the group again
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (c *redisConn) roundTrip(deadline time.Time, args []string) (any, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read parses one reply. Errors nested in arrays are returned as values so
+// the rest of the array is still consumed.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := c.read()
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				item = replyErr
+			} else if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected redis reply %q", line)
+}
+
+func (c *redisConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package taskqueue
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    any
+		wantErr error
+	}{
+		{name: "simple string", raw: "+OK\r\n", want: "OK"},
+		{name: "empty simple string", raw: "+\r\n", want: ""},
+		{name: "integer", raw: ":42\r\n", want: int64(42)},
+		{name: "bulk string", raw: "$5\r\nhello\r\n", want: "hello"},
+		{name: "bulk string with CRLF", raw: "$7\r\nfoo\r\nba\r\n", want: "foo\r\nba"},
+		{name: "empty bulk string", raw: "$0\r\n\r\n", want: ""},
+		{name: "nil bulk string", raw: "$-1\r\n", want: nil},
+		{name: "nil array", raw: "*-1\r\n", want: nil},
+		{name: "empty array", raw: "*0\r\n", want: []any{}},
+		{name: "error reply", raw: "-NOGROUP No such key\r\n", wantErr: redisError("NOGROUP No such key")},
+		{
+			name: "XREADGROUP reply",
+			raw: "*1\r\n*2\r\n$5\r\ntasks\r\n*2\r\n" +
+				"*2\r\n$3\r\n1-0\r\n*2\r\n$4\r\ntask\r\n$1\r\n7\r\n" +
+				"*2\r\n$3\r\n2-0\r\n*-1\r\n",
+			want: []any{[]any{"tasks", []any{
+				[]any{"1-0", []any{"task", "7"}},
+				[]any{"2-0", nil},
+			}}},
+		},
+		{
+			name: "error nested in an array",
+			raw:  "*3\r\n:1\r\n-ERR wrong type\r\n$-1\r\n",
+			want: []any{int64(1), redisError("ERR wrong type"), nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A trailing reply checks that exactly one reply was consumed
+			c := &redisConn{r: bufio.NewReader(strings.NewReader(tt.raw + "+NEXT\r\n"))}
+			got, err := c.read()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("read() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("read() = %#v, want %#v", got, tt.want)
+			}
+			if next, err := c.read(); err != nil || next != "NEXT" {
+				t.Fatalf("next read() = %#v, %v; the reply wasn't fully consumed", next, err)
+			}
+		})
+	}
+}
+
+func TestRedisReadMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "missing CR", raw: "+OK\n"},
+		{name: "unknown type", raw: "!3\r\n"},
+		{name: "bad integer", raw: ":abc\r\n"},
+		{name: "bad bulk length", raw: "$x\r\n"},
+		{name: "truncated bulk string", raw: "$10\r\nshort\r\n"},
+		{name: "truncated array", raw: "*2\r\n:1\r\n"},
+		{name: "empty input", raw: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &redisConn{r: bufio.NewReader(strings.NewReader(tt.raw))}
+			_, err := c.read()
+			var replyErr redisError
+			if err == nil || errors.As(err, &replyErr) {
+				t.Fatalf("read() error = %v, want a protocol error", err)
+			}
+		})
+	}
+}
+
+func TestRedisEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply any
+		want  []Delivery
+	}{
+		{name: "nil", reply: nil, want: []Delivery{}},
+		{
+			name: "entries",
+			reply: []any{
+				[]any{"1-0", []any{"task", "7"}},
+				[]any{"1-1", []any{"other", "x", "task", "8"}},
+			},
+			want: []Delivery{{TaskID: 7, handle: "1-0"}, {TaskID: 8, handle: "1-1"}},
+		},
+		{
+			name:  "trimmed entry",
+			reply: []any{nil, []any{"2-0", []any{"task", "9"}}},
+			want:  []Delivery{{TaskID: 9, handle: "2-0"}},
+		},
+		{
+			name:  "entry without a task",
+			reply: []any{[]any{"3-0", nil}},
+			want:  []Delivery{{handle: "3-0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redisEntries(tt.reply); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("redisEntries() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisConnDo(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    string
+		want     any
+		wantErr  bool
+		keepConn bool
+	}{
+		{name: "reply", reply: "+OK\r\n", want: "OK", keepConn: true},
+		{name: "error reply", reply: "-ERR unknown command\r\n", wantErr: true, keepConn: true},
+		{name: "missing group", reply: "-NOGROUP No such consumer group\r\n", wantErr: true},
+		{name: "malformed reply", reply: "?\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			c := &redisConn{conn: client, r: bufio.NewReader(client), dial: func(context.Context) (*redisConn, error) {
+				return nil, errors.New("unexpected redial")
+			}}
+
+			request := "*3\r\n$4\r\nXACK\r\n$5\r\ntasks\r\n$3\r\n1-0\r\n"
+			received := make(chan string, 1)
+			go func() {
+				buf := make([]byte, len(request))
+				io.ReadFull(server, buf)
+				received <- string(buf)
+				io.WriteString(server, tt.reply)
+			}()
+
+			got, err := c.do(context.Background(), time.Second, "XACK", "tasks", "1-0")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("do() = %#v, want %#v", got, tt.want)
+			}
+			if sent := <-received; sent != request {
+				t.Fatalf("sent %q, want %q", sent, request)
+			}
+			if kept := c.conn != nil; kept != tt.keepConn {
+				t.Fatalf("connection kept = %v, want %v", kept, tt.keepConn)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"continuumworker/src/compression"
+	"continuumworker/src/model"
+	"continuumworker/src/pgdb"
+	"continuumworker/src/retention"
+	"continuumworker/src/submit"
+)
+
+const (
+	// maxSubmitBodyBytes bounds the size of a POST /tasks request body
+	maxSubmitBodyBytes = 10 << 20
+
+	defaultTaskListLimit = 50
+	maxTaskListLimit     = 500
+
+	// waitPollInterval re-reads a waited task while the waiter can't listen
+	waitPollInterval = 5 * time.Second
+)
+
+// taskColumns is the select list shared by the task detail and listing endpoints
+const taskColumns = `id, name, description, created_at, started, finished, locked_at, last_error, COALESCE(priority, 0),
+	status, COALESCE(payload::TEXT, ''), COALESCE(code::TEXT, ''), output, worker_id, depends_on, tenant_id,
+	COALESCE(python_version, ''), interpreter_version, cpu_seconds, peak_memory_bytes, attempts, max_attempts,
+	first_started_at, policy_version, retry_policy::TEXT, deadline, webhook_url, annotations::TEXT, exit_code, run_at,
+	queue, timeout_seconds, memory_mb, cpu_limit, isolation, network, gpu_required, timezone, locale, ulimits, egress_allowlist,
+	error_code, payload_zstd, output_zstd, stale_after_seconds, task_type, code_version, result::TEXT, bandwidth_kbps, batch_id, preferred_region,
+	receipt::TEXT`
+
+// TaskList is a page of tasks; pass NextCursor as ?cursor= to get the next one
+type TaskList struct {
+	Tasks      []model.Task `json:"tasks"`
+	NextCursor *int         `json:"next_cursor,omitempty"`
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(row rowScanner) (model.Task, error) {
+	var t model.Task
+	var annotations, result, receipt, packedPayload, packedOutput []byte
+	err := row.Scan(&t.ID, &t.Name, &t.Description, &t.CreatedAt, &t.Started, &t.Finished, &t.LockedAt, &t.LastError, &t.Priority,
+		&t.Status, &t.Payload, &t.Code, &t.Output, &t.WorkerID, pgdb.Array(&t.DependsOn), &t.TenantID,
+		&t.PythonVersion, &t.InterpreterVersion, &t.CPUSeconds, &t.PeakMemoryBytes, &t.Attempts, &t.MaxAttempts,
+		&t.FirstStartedAt, &t.PolicyVersion, &t.RetryPolicy, &t.Deadline, &t.WebhookURL, &annotations, &t.ExitCode, &t.RunAt,
+		&t.Queue, &t.TimeoutSeconds, &t.MemoryMB, &t.CPULimit, &t.Isolation, &t.Network, &t.GPURequired,
+		&t.Timezone, &t.Locale, pgdb.Array(&t.Ulimits), pgdb.Array(&t.EgressAllowlist), &t.ErrorCode,
+		&packedPayload, &packedOutput, &t.StaleAfterSeconds, &t.Type, &t.CodeVersion, &result, &t.BandwidthKbps, &t.BatchID, &t.PreferredRegion,
+		&receipt)
+	if err != nil {
+		return t, err
+	}
+	if len(annotations) > 0 {
+		t.Annotations = annotations
+	}
+	if len(result) > 0 {
+		t.Result = result
+	}
+	if len(receipt) > 0 {
+		t.Receipt = receipt
+	}
+	t.Status = model.NormalizeStatus(t.Status)
+
+	// Payloads and outputs over COMPRESS_ABOVE_BYTES are stored compressed
+	if t.Payload, err = compression.Unpack(t.Payload, packedPayload); err != nil {
+		return t, err
+	}
+	if packedOutput != nil {
+		output, err := compression.Unpack("", packedOutput)
+		if err != nil {
+			return t, err
+		}
+		t.Output = &output
+	}
+	return t, nil
+}
+
+// readTask reads a task by ID; a task moved out of TASKS by the retention
+// job is read from TASKS_ARCHIVE
+func (s *APIServer) readTask(ctx context.Context, taskID int) (model.Task, error) {
+	return scanTask(s.db.QueryRowContext(ctx, `
+		SELECT `+taskColumns+` FROM TASKS WHERE id = $1
+		UNION ALL
+		SELECT `+taskColumns+` FROM (SELECT `+retention.Restored+` FROM TASKS_ARCHIVE WHERE id = $1) archived
+		LIMIT 1`, taskID))
+}
+
+// submitTaskHandler creates a task from the request body, see submit.Create
+func (s *APIServer) submitTaskHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmitBodyBytes)
+
+	var req submit.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := submit.Create(r.Context(), s.db, req)
+	switch {
+	case errors.Is(err, submit.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, submit.ErrUnknownCode):
+		http.Error(w, "Unknown code_id", http.StatusNotFound)
+		return
+	case errors.Is(err, submit.ErrUnknownVersion):
+		http.Error(w, "Unknown code_version", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "Failed to create task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/tasks/%d", resp.ID))
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// taskHandler returns a single task, including its output and error, archived
+// or not
+func (s *APIServer) taskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.readTask(r.Context(), taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to query task", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(task)
+}
+
+// taskWaitHandler blocks until the task reaches a final status, then returns
+// it like taskHandler. After ?timeout= (TASK_WAIT_TIMEOUT by default) it
+// returns the task as it is with 202, and the client waits again. The task
+// is re-read when the task_finished notification names it, not on a timer,
+// except while the waiter's listener is down.
+func (s *APIServer) taskWaitHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+	timeout := s.waitTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		timeout, err = time.ParseDuration(v)
+		if err != nil || timeout < 0 || timeout > s.waitMaxTimeout {
+			http.Error(w, fmt.Sprintf("timeout must be a duration of at most %s", s.waitMaxTimeout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Subscribe before the first read so a task finishing in between isn't missed
+	ready, cancel := s.waiter.Wait(taskID)
+	defer cancel()
+	ctx, stop := context.WithTimeout(r.Context(), timeout)
+	defer stop()
+
+	for {
+		task, err := s.readTask(r.Context(), taskID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query task", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if !task.Status.Final() {
+			var poll <-chan time.Time
+			if !s.waiter.Connected() {
+				poll = time.After(waitPollInterval)
+			}
+			select {
+			case <-poll:
+				continue
+			case _, open := <-ready:
+				if open {
+					continue
+				}
+				// The server is shutting down
+			case <-ctx.Done():
+				if r.Context().Err() != nil {
+					return
+				}
+			}
+			status = http.StatusAccepted
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(task)
+		return
+	}
+}
+
+// listTasksHandler lists tasks newest first, filtered by ?status=, ?priority=,
+// ?error_code= and ?annotation=key or key:value (repeatable), paginated with ?limit= and
+// the opaque ?cursor= of the previous page
+func (s *APIServer) listTasksHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var conditions []string
+	var args []any
+
+	if v := q.Get("status"); v != "" {
+		status, err := model.ParseStatus(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if v := q.Get("error_code"); v != "" {
+		code := model.ErrorCode(v)
+		if !code.Valid() {
+			http.Error(w, fmt.Sprintf("Unknown error code %q", v), http.StatusBadRequest)
+			return
+		}
+		args = append(args, code)
+		conditions = append(conditions, fmt.Sprintf("error_code = $%d", len(args)))
+	}
+	if v := q.Get("queue"); v != "" {
+		args = append(args, v)
+		conditions = append(conditions, fmt.Sprintf("queue = $%d", len(args)))
+	}
+	if v := q.Get("priority"); v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid priority", http.StatusBadRequest)
+			return
+		}
+		args = append(args, priority)
+		conditions = append(conditions, fmt.Sprintf("priority = $%d", len(args)))
+	}
+	for _, v := range q["annotation"] {
+		key, value, hasValue := strings.Cut(v, ":")
+		if key == "" {
+			http.Error(w, "Invalid annotation filter", http.StatusBadRequest)
+			return
+		}
+		args = append(args, key)
+		if hasValue {
+			args = append(args, value)
+			conditions = append(conditions, fmt.Sprintf("annotations ->> $%d = $%d", len(args)-1, len(args)))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("annotations ? $%d", len(args)))
+		}
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		args = append(args, cursor)
+		conditions = append(conditions, fmt.Sprintf("id < $%d", len(args)))
+	}
+
+	limit := defaultTaskListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxTaskListLimit)
+	}
+
+	query := "SELECT " + taskColumns + " FROM TASKS"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := s.db.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Failed to query tasks", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := TaskList{Tasks: []model.Task{}}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			http.Error(w, "Failed to read tasks", http.StatusInternalServerError)
+			return
+		}
+		list.Tasks = append(list.Tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to read tasks", http.StatusInternalServerError)
+		return
+	}
+
+	if len(list.Tasks) > limit {
+		list.Tasks = list.Tasks[:limit]
+		next := list.Tasks[limit-1].ID
+		list.NextCursor = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
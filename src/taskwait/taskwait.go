@@ -0,0 +1,184 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package taskwait lets API clients wait for a task to finish. The
+// task_finished trigger notifies the id of every task reaching a final
+// status, and a Waiter fans these notifications out to the requests waiting
+// on that task, so a waiting client costs one query when it arrives and one
+// when its task finishes rather than a query per poll.
+package taskwait
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// notifyChannel is emitted by the TASKS trigger when a task finishes
+const notifyChannel = "task_finished"
+
+// Reconnect backoff of the listening connection
+const (
+	minReconnectDelay = 10 * time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Waiter listens to task_finished on its own pgx connection, outside the
+// pool, and wakes the waiters of each finished task
+type Waiter struct {
+	dsn       string
+	connected atomic.Bool
+	stop      context.CancelFunc
+	done      chan struct{}
+
+	mu      sync.Mutex
+	waiters map[int]map[chan struct{}]struct{}
+	closed  bool
+}
+
+// New starts listening on dsn in the background. A database that can't hold
+// a LISTEN connection (e.g. behind a transaction pooler) is retried with
+// backoff; meanwhile Connected is false and callers poll instead.
+func New(dsn string) *Waiter {
+	ctx, stop := context.WithCancel(context.Background())
+	w := &Waiter{dsn: dsn, stop: stop, done: make(chan struct{}), waiters: map[int]map[chan struct{}]struct{}{}}
+	go w.run(ctx)
+	return w
+}
+
+// Wait returns a channel that receives a value when the task may have
+// finished: it was notified, or the listener reconnected and notifications
+// may have been missed. It is closed once the Waiter is closed. The caller
+// re-reads the task either way, and must call cancel when done.
+func (w *Waiter) Wait(taskID int) (ready <-chan struct{}, cancel func()) {
+	ch := make(chan struct{}, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if w.waiters[taskID] == nil {
+		w.waiters[taskID] = map[chan struct{}]struct{}{}
+	}
+	w.waiters[taskID][ch] = struct{}{}
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.waiters[taskID], ch)
+		if len(w.waiters[taskID]) == 0 {
+			delete(w.waiters, taskID)
+		}
+	}
+}
+
+// Connected reports whether notifications are being received
+func (w *Waiter) Connected() bool { return w.connected.Load() }
+
+// Close stops listening and releases every waiter, e.g. so the API server
+// can shut down without waiting for their timeouts. It is safe to call more
+// than once.
+func (w *Waiter) Close() error {
+	w.stop()
+	<-w.done
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		for _, chans := range w.waiters {
+			for ch := range chans {
+				close(ch)
+			}
+		}
+		w.waiters = nil
+	}
+	return nil
+}
+
+// wake signals the waiters of taskID, or every waiter when taskID is 0
+func (w *Waiter) wake(taskID int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, chans := range w.waiters {
+		if taskID != 0 && id != taskID {
+			continue
+		}
+		for ch := range chans {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func listen(ctx context.Context, dsn string) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+// run waits for notifications until ctx is cancelled, reconnecting with
+// backoff when the connection drops. A reconnect wakes every waiter: tasks
+// may have finished meanwhile.
+func (w *Waiter) run(ctx context.Context) {
+	defer close(w.done)
+
+	var conn *pgx.Conn
+	delay := minReconnectDelay
+	for {
+		if conn == nil {
+			var err error
+			if conn, err = listen(ctx, w.dsn); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				fmt.Printf("Task wait listener error: %v\n", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+				delay = min(delay*2, maxReconnectDelay)
+				continue
+			}
+			delay = minReconnectDelay
+			w.connected.Store(true)
+			w.wake(0)
+		}
+
+		n, err := conn.WaitForNotification(ctx)
+		if err == nil {
+			if taskID, err := strconv.Atoi(n.Payload); err == nil {
+				w.wake(taskID)
+			}
+			continue
+		}
+		w.connected.Store(false)
+		conn.Close(context.Background())
+		conn = nil
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Task wait listener error: %v\n", err)
+	}
+}
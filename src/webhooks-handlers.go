@@ -0,0 +1,118 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// WebhookDelivery is an event queued in WEBHOOK_OUTBOX and how its delivery went
+type WebhookDelivery struct {
+	ID            int64      `json:"id"`
+	TaskID        int        `json:"task_id"`
+	URL           string     `json:"url"`
+	Event         string     `json:"event"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"` // only while pending
+	LastError     *string    `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+}
+
+const webhookDeliveryColumns = `id, task_id, url, COALESCE(event->>'event', ''), status, attempts,
+	CASE WHEN status = 'pending' THEN next_attempt_at END, last_error, created_at, delivered_at`
+
+// taskWebhooksHandler lists the webhook deliveries of a task, oldest first
+func (s *APIServer) taskWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	taskID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid task id", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(r.Context(), "SELECT EXISTS (SELECT 1 FROM TASKS WHERE id = $1)", taskID).Scan(&exists); err != nil {
+		http.Error(w, "Failed to query task", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	deliveries, err := s.webhookDeliveries(r.Context(), `SELECT `+webhookDeliveryColumns+`
+		FROM WEBHOOK_OUTBOX WHERE task_id = $1 ORDER BY id`, taskID)
+	writeDeliveries(w, deliveries, err)
+}
+
+// webhookDeliveriesHandler lists the latest webhook deliveries across tasks,
+// e.g. ?status=dead for the events given up on
+func (s *APIServer) webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", "pending", "delivered", "dead":
+	default:
+		http.Error(w, "Invalid status, must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeliveriesLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxDeliveriesLimit)
+	}
+
+	deliveries, err := s.webhookDeliveries(r.Context(), `SELECT `+webhookDeliveryColumns+`
+		FROM WEBHOOK_OUTBOX WHERE $1 = '' OR status = $1 ORDER BY id DESC LIMIT $2`, status, limit)
+	writeDeliveries(w, deliveries, err)
+}
+
+func (s *APIServer) webhookDeliveries(ctx context.Context, query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.TaskID, &d.URL, &d.Event, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func writeDeliveries(w http.ResponseWriter, deliveries []WebhookDelivery, err error) {
+	if err != nil {
+		http.Error(w, "Failed to query webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(deliveries)
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package webhooks
+
+import (
+	"cmp"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/retry"
+)
+
+// endpoint is the delivery setup of the webhook URLs starting with prefix
+type endpoint struct {
+	prefix  string
+	secret  string
+	timeout time.Duration
+	retry   retry.Policy
+	headers map[string]string
+	client  *http.Client
+	breaker breaker
+}
+
+// endpoints are the configured endpoints, longest prefix first, then the
+// default one matching every URL
+var endpoints []*endpoint
+
+// Configure prepares the delivery setup of each configured endpoint,
+// loading their certificates. RunDispatcher needs it.
+func Configure(cfg config.Webhooks) error {
+	endpoints = nil
+	for _, e := range cfg.Endpoints {
+		ep, err := newEndpoint(cfg, e)
+		if err != nil {
+			return fmt.Errorf("webhook endpoint %s: %w", e.URLPrefix, err)
+		}
+		endpoints = append(endpoints, ep)
+	}
+	slices.SortStableFunc(endpoints, func(a, b *endpoint) int { return len(b.prefix) - len(a.prefix) })
+	fallback, err := newEndpoint(cfg, config.WebhookEndpoint{})
+	if err != nil {
+		return err
+	}
+	endpoints = append(endpoints, fallback)
+	return nil
+}
+
+// newEndpoint applies the settings of e over the default ones of cfg
+func newEndpoint(cfg config.Webhooks, e config.WebhookEndpoint) (*endpoint, error) {
+	ep := &endpoint{
+		prefix:  e.URLPrefix,
+		secret:  cmp.Or(e.Secret, cfg.Secret),
+		timeout: cmp.Or(e.Timeout, cfg.Timeout),
+		retry:   cfg.Retry,
+		headers: e.Headers,
+		breaker: breaker{threshold: e.BreakerThreshold, cooldown: e.BreakerCooldown},
+	}
+	ep.retry.MaxAttempts = cmp.Or(e.Retry.MaxAttempts, ep.retry.MaxAttempts)
+	ep.retry.BaseDelay = cmp.Or(e.Retry.BaseDelay, ep.retry.BaseDelay)
+	ep.retry.MaxDelay = cmp.Or(e.Retry.MaxDelay, ep.retry.MaxDelay)
+	ep.retry.Jitter = cmp.Or(e.Retry.Jitter, ep.retry.Jitter)
+	if err := ep.retry.Validate(); err != nil {
+		return nil, fmt.Errorf("retry policy: %w", err)
+	}
+
+	var tlsConfig *tls.Config
+	if e.ClientCert != "" || e.CACert != "" {
+		tlsConfig = &tls.Config{}
+	}
+	if e.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(e.ClientCert, e.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if e.CACert != "" {
+		pem, err := os.ReadFile(e.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + e.CACert)
+		}
+	}
+	ep.client = newClient(ep.timeout, cfg.AllowPrivate, tlsConfig)
+	return ep, nil
+}
+
+// endpointFor returns the endpoint whose prefix url starts with
+func endpointFor(url string) *endpoint {
+	for _, ep := range endpoints {
+		if strings.HasPrefix(url, ep.prefix) {
+			return ep
+		}
+	}
+	return endpoints[len(endpoints)-1]
+}
+
+// maxTimeout is the longest delivery timeout of the endpoints
+func maxTimeout() time.Duration {
+	var longest time.Duration
+	for _, ep := range endpoints {
+		longest = max(longest, ep.timeout)
+	}
+	return longest
+}
+
+// breaker pauses deliveries to an endpoint after threshold consecutive
+// failures. Once the cooldown is over one delivery is let through: a success
+// closes the circuit again, a failure reopens it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// open reports whether deliveries are paused, and until when
+func (b *breaker) open(now time.Time) (bool, time.Time) {
+	if b.threshold == 0 {
+		return false, time.Time{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return now.Before(b.openUntil), b.openUntil
+}
+
+// record counts the outcome of a delivery and reports whether it opened the
+// circuit
+func (b *breaker) record(delivered bool, now time.Time) bool {
+	if b.threshold == 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if delivered {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package webhooks
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/retry"
+)
+
+func TestEndpointFor(t *testing.T) {
+	cfg := config.Webhooks{
+		Secret:  "default",
+		Timeout: 10 * time.Second,
+		Retry:   retry.Policy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: time.Hour},
+		Endpoints: []config.WebhookEndpoint{
+			{URLPrefix: "https://hooks.example.com/", Timeout: 30 * time.Second},
+			{URLPrefix: "https://hooks.example.com/critical/", Secret: "critical", Retry: retry.Policy{MaxAttempts: 20}},
+		},
+	}
+	if err := Configure(cfg); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+
+	tests := []struct {
+		url         string
+		wantPrefix  string
+		wantSecret  string
+		wantTimeout time.Duration
+		wantRetries int
+	}{
+		{url: "https://other.example.com/hook", wantPrefix: "", wantSecret: "default", wantTimeout: 10 * time.Second, wantRetries: 10},
+		{url: "https://hooks.example.com/a", wantPrefix: "https://hooks.example.com/", wantSecret: "default", wantTimeout: 30 * time.Second, wantRetries: 10},
+		{url: "https://hooks.example.com/critical/b", wantPrefix: "https://hooks.example.com/critical/", wantSecret: "critical", wantTimeout: 10 * time.Second, wantRetries: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			ep := endpointFor(tt.url)
+			if ep.prefix != tt.wantPrefix || ep.secret != tt.wantSecret || ep.timeout != tt.wantTimeout || ep.retry.MaxAttempts != tt.wantRetries {
+				t.Fatalf("endpointFor() = %q (secret %q, timeout %s, %d attempts), want %q (secret %q, timeout %s, %d attempts)",
+					ep.prefix, ep.secret, ep.timeout, ep.retry.MaxAttempts, tt.wantPrefix, tt.wantSecret, tt.wantTimeout, tt.wantRetries)
+			}
+			if ep.retry.MaxDelay != time.Hour {
+				t.Fatalf("max delay = %s, want it inherited", ep.retry.MaxDelay)
+			}
+		})
+	}
+	if got := maxTimeout(); got != 30*time.Second {
+		t.Fatalf("maxTimeout() = %s, want 30s", got)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := &breaker{threshold: 2, cooldown: time.Minute}
+	steps := []struct {
+		name      string
+		at        time.Duration
+		delivered bool
+		wantOpen  bool // before the delivery
+		wantTrip  bool
+	}{
+		{name: "first failure", at: 0, wantTrip: false},
+		{name: "threshold reached", at: time.Second, wantTrip: true},
+		{name: "during cooldown", at: 30 * time.Second, wantOpen: true},
+		{name: "probe fails", at: 2 * time.Minute, wantTrip: true},
+		{name: "probe succeeds", at: 4 * time.Minute, delivered: true},
+		{name: "failure after recovery", at: 5 * time.Minute},
+	}
+	for _, s := range steps {
+		at := now.Add(s.at)
+		if open, _ := b.open(at); open != s.wantOpen {
+			t.Fatalf("%s: open = %v, want %v", s.name, open, s.wantOpen)
+		}
+		if s.wantOpen {
+			continue
+		}
+		if tripped := b.record(s.delivered, at); tripped != s.wantTrip {
+			t.Fatalf("%s: record() = %v, want %v", s.name, tripped, s.wantTrip)
+		}
+	}
+}
+
+func TestSendMTLS(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's certificate doubles as the client certificate
+	dir := t.TempDir()
+	cert := server.TLS.Certificates[0]
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	writePEM(t, certFile, "CERTIFICATE", cert.Certificate[0])
+	writePEM(t, caFile, "CERTIFICATE", cert.Certificate[0])
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, keyFile, "PRIVATE KEY", key)
+
+	tests := []struct {
+		name     string
+		endpoint config.WebhookEndpoint
+		wantErr  bool
+	}{
+		{name: "without a client certificate", endpoint: config.WebhookEndpoint{URLPrefix: server.URL, CACert: caFile}, wantErr: true},
+		{name: "with a client certificate", endpoint: config.WebhookEndpoint{URLPrefix: server.URL, CACert: caFile,
+			ClientCert: certFile, ClientKey: keyFile, Headers: map[string]string{"Authorization": "Bearer abc"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			cfg := config.Webhooks{Secret: "s", Timeout: 5 * time.Second, AllowPrivate: true,
+				Retry: retry.Policy{MaxAttempts: 1}, Endpoints: []config.WebhookEndpoint{tt.endpoint}}
+			if err := Configure(cfg); err != nil {
+				t.Fatalf("Configure() error = %v", err)
+			}
+			err := send(context.Background(), endpointFor(server.URL+"/hook"), delivery{id: 7, url: server.URL + "/hook", event: []byte(`{}`)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Header.Get("Authorization") != "Bearer abc" || got.Header.Get("X-Continuum-Delivery") != "7" || got.Header.Get("X-Continuum-Signature") == "" {
+				t.Fatalf("received headers %v", got.Header)
+			}
+		})
+	}
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+// Package webhooks delivers task events to the webhook_url of their task.
+// Events are written to WEBHOOK_OUTBOX by a trigger in the same transaction
+// as the status change; any worker's dispatcher may then send them, retrying
+// with backoff, so they survive worker restarts. Delivery is at least once:
+// receivers should deduplicate on the X-Continuum-Delivery header.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"continuumworker/src/config"
+	"continuumworker/src/dbwrite"
+	"continuumworker/src/logging"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Delivery outcomes, recorded on worker_webhook_deliveries
+const (
+	resultDelivered = "delivered"
+	resultRetry     = "retry"
+	resultDead      = "dead"
+	resultPaused    = "paused"
+)
+
+const metricDeliveries = "worker_webhook_deliveries"
+
+// ErrPrivateAddress is returned when a webhook resolves to a loopback,
+// private or link-local address and WEBHOOK_ALLOW_PRIVATE is off
+var ErrPrivateAddress = errors.New("webhook target is a private address")
+
+// RegisterMetrics registers the webhook metrics with their descriptions
+func RegisterMetrics() {
+	logging.InitializeFloatCounter(metricDeliveries, "Number of webhook delivery attempts, by result", "Delivery")
+}
+
+type delivery struct {
+	id       int64
+	taskID   int
+	url      string
+	event    []byte
+	attempts int
+}
+
+// Sign returns the X-Continuum-Signature header of a body sent at ts:
+// t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">
+func Sign(secret string, ts time.Time, body []byte) string {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix + "."))
+	mac.Write(body)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newClient returns the HTTP client deliveries are sent with, presenting the
+// client certificate of tlsConfig if any. Unless private targets are allowed,
+// connections to internal addresses are refused after DNS resolution, so a
+// task can't aim the worker at its own network.
+func newClient(timeout time.Duration, allowPrivate bool, tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// RunDispatcher sends due events every PollInterval until ctx is cancelled
+func RunDispatcher(ctx context.Context, db *sql.DB, cfg config.Webhooks) {
+	if endpoints == nil {
+		if err := Configure(cfg); err != nil {
+			logging.Log(ctx, fmt.Sprintf("Webhook dispatcher not started: %v", err), slog.LevelError)
+			return
+		}
+	}
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := dispatch(ctx, db, cfg); err != nil && ctx.Err() == nil {
+			logging.Log(ctx, fmt.Sprintf("Error dispatching webhooks: %v", err), slog.LevelWarn)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch leases a batch of due events and sends them. The lease pushes
+// next_attempt_at past the send timeout, so a worker dying mid-delivery
+// only delays the event.
+func dispatch(ctx context.Context, db *sql.DB, cfg config.Webhooks) error {
+	lease := 2*maxTimeout() + time.Minute
+	rows, err := db.QueryContext(ctx, `
+		UPDATE WEBHOOK_OUTBOX
+		SET attempts = attempts + 1, next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM WEBHOOK_OUTBOX
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, task_id, url, event::TEXT, attempts`, cfg.BatchSize, lease.Seconds())
+	if err != nil {
+		return err
+	}
+
+	var batch []delivery
+	for rows.Next() {
+		var d delivery
+		var event string
+		if err := rows.Scan(&d.id, &d.taskID, &d.url, &event, &d.attempts); err != nil {
+			rows.Close()
+			return err
+		}
+		d.event = []byte(event)
+		batch = append(batch, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, d := range batch {
+		ep := endpointFor(d.url)
+		if open, until := ep.breaker.open(time.Now()); open {
+			pause(ctx, db, d, until)
+			continue
+		}
+		sendErr := send(ctx, ep, d)
+		if ep.breaker.record(sendErr == nil, time.Now()) {
+			logging.Log(ctx, fmt.Sprintf("Webhook endpoint %s failed %d times in a row, pausing its deliveries for %s: %v",
+				ep.prefix, ep.breaker.threshold, ep.breaker.cooldown, sendErr), slog.LevelWarn)
+		}
+		record(ctx, db, ep, d, sendErr)
+	}
+	return nil
+}
+
+// send POSTs the event; any non-2xx answer is a failure
+func send(ctx context.Context, ep *endpoint, d delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.event))
+	if err != nil {
+		return err
+	}
+	for name, value := range ep.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Continuum-Webhooks/1")
+	req.Header.Set("X-Continuum-Delivery", strconv.FormatInt(d.id, 10))
+	if ep.secret != "" {
+		req.Header.Set("X-Continuum-Signature", Sign(ep.secret, time.Now(), d.event))
+	}
+
+	resp, err := ep.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
+
+// pause puts an event of an endpoint whose circuit is open back until the
+// circuit may close, without counting the attempt
+func pause(ctx context.Context, db *sql.DB, d delivery, until time.Time) {
+	_, err := dbwrite.Exec(ctx, db, fmt.Sprintf("webhook delivery %d", d.id),
+		"UPDATE WEBHOOK_OUTBOX SET attempts = attempts - 1, next_attempt_at = $2, last_error = 'Paused: endpoint circuit open' WHERE id = $1",
+		d.id, until)
+	logging.Inc(ctx, metricDeliveries, attribute.String("result", resultPaused))
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error pausing webhook %d: %v", d.id, err), slog.LevelError)
+	}
+}
+
+// record stores the outcome of a delivery attempt: delivered, retried after
+// the endpoint's backoff, or given up on once its attempts are used up
+func record(ctx context.Context, db *sql.DB, ep *endpoint, d delivery, sendErr error) {
+	label := fmt.Sprintf("webhook delivery %d", d.id)
+	var err error
+	result := resultDelivered
+	switch {
+	case sendErr == nil:
+		_, err = dbwrite.Exec(ctx, db, label,
+			"UPDATE WEBHOOK_OUTBOX SET status = 'delivered', delivered_at = NOW(), last_error = NULL WHERE id = $1", d.id)
+	case d.attempts >= ep.retry.MaxAttempts:
+		result = resultDead
+		_, err = dbwrite.Exec(ctx, db, label,
+			"UPDATE WEBHOOK_OUTBOX SET status = 'dead', last_error = $2 WHERE id = $1", d.id, sendErr.Error())
+		logging.Log(ctx, fmt.Sprintf("ALERT: giving up on webhook %d of task %d after %d attempts: %v",
+			d.id, d.taskID, d.attempts, sendErr), slog.LevelError)
+	default:
+		result = resultRetry
+		delay := ep.retry.Delay(d.attempts)
+		_, err = dbwrite.Exec(ctx, db, label,
+			"UPDATE WEBHOOK_OUTBOX SET next_attempt_at = NOW() + $2 * INTERVAL '1 second', last_error = $3 WHERE id = $1",
+			d.id, delay.Seconds(), sendErr.Error())
+		logging.Log(ctx, fmt.Sprintf("Webhook %d of task %d failed (attempt %d/%d), retrying in %s: %v",
+			d.id, d.taskID, d.attempts, ep.retry.MaxAttempts, delay.Truncate(time.Second), sendErr), slog.LevelWarn)
+	}
+	logging.Inc(ctx, metricDeliveries, attribute.String("result", result))
+	if err != nil {
+		logging.Log(ctx, fmt.Sprintf("Error recording webhook %d: %v", d.id, err), slog.LevelError)
+	}
+}
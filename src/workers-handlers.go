@@ -0,0 +1,37 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"continuumworker/src/workers"
+)
+
+// WorkerList is the fleet as seen by GET /workers
+type WorkerList struct {
+	Workers []workers.Info `json:"workers"`
+}
+
+// workersHandler lists every worker registered in WORKERS with its current
+// tasks, filtered by ?status=, giving a cluster-wide view from any worker
+func (s *APIServer) workersHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := workers.List(r.Context(), s.db, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, "Failed to query workers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(WorkerList{Workers: list})
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"continuumworker/src/logging"
+)
+
+// Deadman is a liveness monitor of the main loop: the loop, claims and each
+// step of an execution report progress, and a loop making none for longer
+// than the timeout (e.g. stuck in a hung Docker call) counts as stalled.
+// Waiting for a running script is not a stall, the script's own timeout
+// bounds it.
+type Deadman struct {
+	timeout  time.Duration
+	restart  bool
+	last     atomic.Int64 // UnixNano of the last progress
+	scripts  atomic.Int64 // Scripts being waited for
+	restarts chan struct{}
+}
+
+// NewDeadman creates a deadman switch tripping after timeout without
+// progress. With restart, Restarts asks for a new loop when it trips. A
+// timeout of 0 or less disables it.
+func NewDeadman(timeout time.Duration, restart bool) *Deadman {
+	d := &Deadman{timeout: timeout, restart: restart, restarts: make(chan struct{}, 1)}
+	d.Beat()
+	return d
+}
+
+// Beat records progress of the loop
+func (d *Deadman) Beat() {
+	d.last.Store(time.Now().UnixNano())
+}
+
+// AwaitScript suspends the timeout while a script runs; call done once it
+// has returned
+func (d *Deadman) AwaitScript() (done func()) {
+	d.scripts.Add(1)
+	return func() {
+		d.scripts.Add(-1)
+		d.Beat()
+	}
+}
+
+// Stalled reports whether the loop is stalled and for how long it has made
+// no progress
+func (d *Deadman) Stalled() (time.Duration, bool) {
+	idle := time.Since(time.Unix(0, d.last.Load()))
+	return idle, d.timeout > 0 && d.scripts.Load() == 0 && idle > d.timeout
+}
+
+// Restarts receives when the deadman trips with restart enabled
+func (d *Deadman) Restarts() <-chan struct{} {
+	return d.restarts
+}
+
+// Run checks the loop every quarter of the timeout until ctx is cancelled,
+// raising an alert when it stalls and asking for a restart if enabled
+func (d *Deadman) Run(ctx context.Context) {
+	if d.timeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(d.timeout / 4)
+	defer ticker.Stop()
+
+	alerted := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			idle, stalled := d.Stalled()
+			if !stalled {
+				if alerted {
+					logging.Log(ctx, "Main loop resumed after a stall", slog.LevelInfo)
+				}
+				alerted = false
+				continue
+			}
+			if !alerted {
+				logging.Log(ctx, fmt.Sprintf("ALERT: main loop stalled, no progress for %s (WORKER_STALL_TIMEOUT=%s)", idle.Truncate(time.Second), d.timeout), slog.LevelError)
+				alerted = true
+			}
+			if d.restart {
+				select {
+				case d.restarts <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+type deadmanKey struct{}
+
+// WithDeadman attaches the deadman switch reported to by Progress and
+// AwaitScript
+func WithDeadman(ctx context.Context, d *Deadman) context.Context {
+	return context.WithValue(ctx, deadmanKey{}, d)
+}
+
+// Progress beats the deadman switch of ctx, if any
+func Progress(ctx context.Context) {
+	if d, ok := ctx.Value(deadmanKey{}).(*Deadman); ok {
+		d.Beat()
+	}
+}
+
+// AwaitScript suspends the deadman switch of ctx, if any, while a script
+// runs; call done once it has returned
+func AwaitScript(ctx context.Context) (done func()) {
+	if d, ok := ctx.Value(deadmanKey{}).(*Deadman); ok {
+		return d.AwaitScript()
+	}
+	return func() {}
+}
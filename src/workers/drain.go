@@ -0,0 +1,80 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package workers
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Drain counts consecutive infrastructure failures (Docker errors, container
+// setup failures...) and quarantines the worker once the threshold is hit, so
+// a broken node stops claiming tasks only to fail them
+type Drain struct {
+	threshold   int64
+	consecutive atomic.Int64
+	quarantined atomic.Bool
+
+	mu     sync.Mutex
+	reason string
+}
+
+// NewDrain creates a drain that trips after threshold consecutive failures.
+// A threshold of 0 or less disables self-quarantine.
+func NewDrain(threshold int) *Drain {
+	return &Drain{threshold: int64(threshold)}
+}
+
+// RecordSuccess resets the consecutive failure count
+func (d *Drain) RecordSuccess() {
+	d.consecutive.Store(0)
+}
+
+// RecordFailure counts an infrastructure failure and reports whether this
+// failure is the one that put the worker into quarantine
+func (d *Drain) RecordFailure(err error) bool {
+	n := d.consecutive.Add(1)
+	if d.threshold <= 0 || n < d.threshold {
+		return false
+	}
+	return d.Quarantine(err.Error())
+}
+
+// Quarantine stops the worker from claiming tasks for the given reason and
+// reports whether it was not already quarantined
+func (d *Drain) Quarantine(reason string) bool {
+	if !d.quarantined.CompareAndSwap(false, true) {
+		return false
+	}
+
+	d.mu.Lock()
+	d.reason = reason
+	d.mu.Unlock()
+	return true
+}
+
+// Quarantined reports whether the worker has stopped claiming tasks
+func (d *Drain) Quarantined() bool {
+	return d.quarantined.Load()
+}
+
+// Reason returns why the worker was quarantined
+func (d *Drain) Reason() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reason
+}
+
+// ConsecutiveFailures returns the current run of infrastructure failures
+func (d *Drain) ConsecutiveFailures() int64 {
+	return d.consecutive.Load()
+}
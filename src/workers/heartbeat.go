@@ -0,0 +1,152 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"continuumworker/src/logging"
+)
+
+const (
+	StatusActive    = "active"
+	StatusUnhealthy = "unhealthy"
+	StatusStopped   = "stopped"
+)
+
+var (
+	// ErrDuplicateWorker is returned by Register when another live process
+	// already holds the same worker identity
+	ErrDuplicateWorker = errors.New("another live worker is already registered with this identity")
+	// ErrIdentityConflict is returned by Beat when another process has taken
+	// over this worker's identity since it registered
+	ErrIdentityConflict = errors.New("worker identity was taken over by another process")
+)
+
+// Identity resolves the configured stable worker identity, or returns ""
+// when every process should get a fresh ID. The special value "hostname"
+// uses the host name (e.g. a StatefulSet pod name).
+func Identity(identity string) string {
+	if identity == "hostname" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logging.Log(context.Background(), fmt.Sprintf("Failed to read hostname for WORKER_IDENTITY: %v", err), slog.LevelWarn)
+			return ""
+		}
+		return hostname
+	}
+	return identity
+}
+
+// Register upserts this worker into the WORKERS table as active, in region
+// ("" for none). instanceID is unique to this process, so a second process
+// started with the same stable identity while the first one is still
+// heartbeating is refused.
+func Register(ctx context.Context, db *sql.DB, workerID, instanceID, region string, staleAfter time.Duration) error {
+	hostname, _ := os.Hostname()
+	res, err := db.ExecContext(ctx, `
+		INSERT INTO WORKERS (id, instance_id, hostname, started_at, last_heartbeat, status, region)
+		VALUES ($1, $2, $3, NOW(), NOW(), $4, NULLIF($6, ''))
+		ON CONFLICT (id) DO UPDATE
+		SET instance_id = EXCLUDED.instance_id,
+		    hostname = EXCLUDED.hostname,
+		    region = EXCLUDED.region,
+		    started_at = EXCLUDED.started_at,
+		    last_heartbeat = EXCLUDED.last_heartbeat,
+		    status = EXCLUDED.status,
+		    config_version = NULL,
+		    config_status = NULL,
+		    config_detail = NULL,
+		    config_checked_at = NULL
+		WHERE WORKERS.status = 'stopped'
+		OR WORKERS.last_heartbeat < NOW() - $5 * INTERVAL '1 second'`,
+		workerID, instanceID, hostname, StatusActive, staleAfter.Seconds(), region)
+	if err != nil {
+		return fmt.Errorf("failed to register worker: %w", err)
+	}
+
+	count, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to register worker: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("worker %s: %w", workerID, ErrDuplicateWorker)
+	}
+	return nil
+}
+
+// Beat refreshes the worker's heartbeat timestamp. The status is left
+// untouched so a quarantined worker stays flagged as unhealthy.
+func Beat(ctx context.Context, db *sql.DB, workerID, instanceID string) error {
+	res, err := db.ExecContext(ctx, "UPDATE WORKERS SET last_heartbeat = NOW() WHERE id = $1 AND instance_id = $2", workerID, instanceID)
+	if err != nil {
+		return err
+	}
+	if count, err := res.RowsAffected(); err == nil && count == 0 {
+		return ErrIdentityConflict
+	}
+	return nil
+}
+
+// RunHeartbeat beats every interval until ctx is cancelled. If another process
+// takes over the identity, the worker raises an alert, quarantines itself
+// through drain and stops beating.
+func RunHeartbeat(ctx context.Context, db *sql.DB, workerID, instanceID string, interval time.Duration, drain *Drain) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := Beat(ctx, db, workerID, instanceID)
+			if errors.Is(err, ErrIdentityConflict) {
+				logging.Log(ctx, fmt.Sprintf("ALERT: duplicate worker detected, identity %s is heartbeating from another process. This worker stops claiming tasks.", workerID), slog.LevelError)
+				drain.Quarantine(err.Error())
+				return
+			}
+			if err != nil {
+				logging.Log(ctx, fmt.Sprintf("Failed to send heartbeat: %v", err), slog.LevelError)
+			}
+		}
+	}
+}
+
+// MarkUnhealthy flags the worker as quarantined. It keeps heartbeating, so
+// its tasks are not recovered, but it no longer claims new ones.
+func MarkUnhealthy(ctx context.Context, db *sql.DB, workerID string) error {
+	_, err := db.ExecContext(ctx, "UPDATE WORKERS SET status = $1 WHERE id = $2", StatusUnhealthy, workerID)
+	return err
+}
+
+// MarkStopped flags the worker as stopped on graceful shutdown so other
+// workers stop treating it as alive. It is a no-op if another process has
+// since taken over the identity.
+func MarkStopped(ctx context.Context, db *sql.DB, workerID, instanceID string) error {
+	_, err := db.ExecContext(ctx, "UPDATE WORKERS SET status = $1 WHERE id = $2 AND instance_id = $3", StatusStopped, workerID, instanceID)
+	return err
+}
+
+// MarkRestarted moves the worker's start time to now, as for a restarted
+// process: its running tasks are then recovered by the reconciler, while it
+// keeps its identity and heartbeat
+func MarkRestarted(ctx context.Context, db *sql.DB, workerID, instanceID string) error {
+	_, err := db.ExecContext(ctx, "UPDATE WORKERS SET started_at = NOW() WHERE id = $1 AND instance_id = $2", workerID, instanceID)
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package workers
+
+import (
+	"sync"
+	"time"
+)
+
+// WorkLatch is a shared "new work available" flag. Any number of signals
+// (NOTIFYs, in-process submissions) set it, and the claim loop clears it by
+// receiving from C, so a storm of notifications costs one claim rather than
+// one per insert. Wake-ups are also spaced by at least minInterval: a signal
+// arriving sooner is held and delivered once the interval has passed, so no
+// wake-up is ever lost.
+type WorkLatch struct {
+	c           chan struct{}
+	minInterval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time // When the latch last fired
+	pending bool      // A wake-up is held until minInterval has passed
+}
+
+// NewWorkLatch creates a latch firing at most once per minInterval, 0 for
+// no spacing
+func NewWorkLatch(minInterval time.Duration) *WorkLatch {
+	return &WorkLatch{c: make(chan struct{}, 1), minInterval: minInterval}
+}
+
+// C is set while new work is available
+func (l *WorkLatch) C() <-chan struct{} {
+	return l.c
+}
+
+// Signal records that new work is available. It reports false when the
+// signal was coalesced into a wake-up that is already set or held.
+func (l *WorkLatch) Signal() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending || len(l.c) > 0 {
+		return false
+	}
+
+	if wait := l.minInterval - time.Since(l.last); wait > 0 {
+		l.pending = true
+		time.AfterFunc(wait, func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.pending = false
+			l.fire()
+		})
+		return true
+	}
+	l.fire()
+	return true
+}
+
+// fire sets the latch; the caller holds mu
+func (l *WorkLatch) fire() {
+	l.last = time.Now()
+	select {
+	case l.c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"continuumworker/src/logging"
+)
+
+// Lifecycle coordinates a graceful drain: once draining starts the worker
+// stops claiming tasks, and the in-flight execution gets up to the drain
+// timeout to finish before its context is cancelled
+type Lifecycle struct {
+	draining   chan struct{}
+	once       sync.Once
+	execCtx    context.Context
+	cancelExec context.CancelFunc
+	timeout    time.Duration
+}
+
+// NewLifecycle creates a lifecycle whose execution context lives until the
+// drain timeout expires (or parent is done)
+func NewLifecycle(parent context.Context, timeout time.Duration) *Lifecycle {
+	execCtx, cancel := context.WithCancel(parent)
+	l := &Lifecycle{
+		draining:   make(chan struct{}),
+		execCtx:    execCtx,
+		cancelExec: cancel,
+		timeout:    timeout,
+	}
+	go l.enforceTimeout()
+	return l
+}
+
+// Drain starts draining. It is safe to call more than once.
+func (l *Lifecycle) Drain(reason string) {
+	l.once.Do(func() {
+		logging.Log(context.Background(), fmt.Sprintf("Draining (%s): no new tasks will be claimed, waiting up to %s for in-flight work", reason, l.timeout), slog.LevelInfo)
+		close(l.draining)
+	})
+}
+
+// Draining is closed once draining starts
+func (l *Lifecycle) Draining() <-chan struct{} {
+	return l.draining
+}
+
+// IsDraining reports whether the worker must stop claiming tasks
+func (l *Lifecycle) IsDraining() bool {
+	select {
+	case <-l.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExecContext is the context task executions run under. Unlike the signal
+// context it is only cancelled when the drain timeout expires.
+func (l *Lifecycle) ExecContext() context.Context {
+	return l.execCtx
+}
+
+// Stop cancels the execution context; call it once the worker exits
+func (l *Lifecycle) Stop() {
+	l.cancelExec()
+}
+
+func (l *Lifecycle) enforceTimeout() {
+	select {
+	case <-l.execCtx.Done():
+		return
+	case <-l.draining:
+	}
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case <-l.execCtx.Done():
+	case <-timer.C:
+		logging.Log(context.Background(), fmt.Sprintf("Drain timeout of %s reached, aborting in-flight work", l.timeout), slog.LevelWarn)
+		l.cancelExec()
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package workers
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Info is a worker of the fleet as seen from the WORKERS table, with the
+// tasks it is currently running
+type Info struct {
+	ID                  string        `json:"id"`
+	InstanceID          string        `json:"instance_id"`
+	Hostname            string        `json:"hostname"`
+	Region              string        `json:"region,omitempty"`
+	Status              string        `json:"status"`
+	StartedAt           time.Time     `json:"started_at"`
+	LastHeartbeat       time.Time     `json:"last_heartbeat"`
+	UptimeSeconds       float64       `json:"uptime_seconds"` // 0 once stopped
+	HeartbeatAgeSeconds float64       `json:"heartbeat_age_seconds"`
+	Concurrency         int           `json:"concurrency"` // Number of tasks running on the worker
+	CurrentTasks        []CurrentTask `json:"current_tasks"`
+	// Fleet configuration version the worker reconciled to and its
+	// compliance, empty when it doesn't follow one
+	ConfigVersion string `json:"config_version,omitempty"`
+	ConfigStatus  string `json:"config_status,omitempty"`
+	ConfigDetail  string `json:"config_detail,omitempty"`
+}
+
+// CurrentTask is a task a worker is running
+type CurrentTask struct {
+	ID      int        `json:"id"`
+	Name    string     `json:"name"`
+	Started *time.Time `json:"started"`
+}
+
+// List returns every known worker, optionally only those with the given
+// status, ordered by ID
+func List(ctx context.Context, db *sql.DB, status string) ([]Info, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT w.id, COALESCE(w.instance_id, ''), COALESCE(w.hostname, ''), COALESCE(w.region, ''), w.status, w.started_at, w.last_heartbeat,
+			CASE WHEN w.status = $1 THEN 0 ELSE EXTRACT(EPOCH FROM NOW() - w.started_at) END,
+			EXTRACT(EPOCH FROM NOW() - w.last_heartbeat),
+			COALESCE(w.config_version, ''), COALESCE(w.config_status, ''), COALESCE(w.config_detail, ''),
+			t.id, t.name, t.started
+		FROM WORKERS w
+		LEFT JOIN TASKS t ON t.worker_id = w.id AND t.status = 'running'
+		WHERE $2 = '' OR w.status = $2
+		ORDER BY w.id, t.started`, StatusStopped, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Info{}
+	for rows.Next() {
+		var info Info
+		var taskID sql.NullInt64
+		var taskName sql.NullString
+		var taskStarted *time.Time
+		if err := rows.Scan(&info.ID, &info.InstanceID, &info.Hostname, &info.Region, &info.Status, &info.StartedAt, &info.LastHeartbeat,
+			&info.UptimeSeconds, &info.HeartbeatAgeSeconds, &info.ConfigVersion, &info.ConfigStatus, &info.ConfigDetail, &taskID, &taskName, &taskStarted); err != nil {
+			return nil, err
+		}
+
+		// One row per running task, grouped by worker
+		if n := len(list); n == 0 || list[n-1].ID != info.ID {
+			info.CurrentTasks = []CurrentTask{}
+			list = append(list, info)
+		}
+		if taskID.Valid {
+			last := &list[len(list)-1]
+			last.CurrentTasks = append(last.CurrentTasks, CurrentTask{ID: int(taskID.Int64), Name: taskName.String, Started: taskStarted})
+			last.Concurrency = len(last.CurrentTasks)
+		}
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2026 Khaled Abbas
+//
+// This source code is licensed under the Business Source License 1.1.
+//
+// Change Date: 4 years after the first public release of this version.
+// Change License: MIT
+//
+// On the Change Date, this version of the code automatically converts
+// to the MIT License. Prior to that date, use is subject to the
+// Additional Use Grant. See the LICENSE file for details.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// quantiles reported by the latency summaries
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// summary is a latency distribution over the tasks finished so far
+type summary struct {
+	Quantiles []float64
+	Sum       float64
+	Count     int64
+}
+
+// sample is the state of the run's tasks at one point in time
+type sample struct {
+	Injected, Completed, Failed, Running, Pending int64
+	// Latency runs from insertion to finish, Execution from start to finish
+	Latency, Execution summary
+}
+
+// Exporter serves the live state of a benchmark run at /metrics, in the
+// OpenMetrics or Prometheus text format, so Grafana can follow the run
+// while the terminal table only shows its totals. Only tasks inserted by the
+// run count: those with an id above the highest one before it started.
+type Exporter struct {
+	db      *sql.DB
+	suite   string
+	startID int64
+	started time.Time
+
+	mu      sync.Mutex
+	last    sample
+	perSec  [3]float64 // injected, completed and failed during the last second
+	active  bool
+	sampled time.Time
+}
+
+// NewExporter records where the run's tasks start, before they are injected
+func NewExporter(db *sql.DB, suite string) (*Exporter, error) {
+	e := &Exporter{db: db, suite: suite, started: time.Now(), active: true}
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM TASKS").Scan(&e.startID); err != nil {
+		return nil, fmt.Errorf("failed to read the last task id: %w", err)
+	}
+	return e, nil
+}
+
+// Serve listens on addr and samples the run every second until stop is
+// closed
+func (e *Exporter) Serve(addr string, stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", e.ServeHTTP)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(listener)
+	go func() {
+		<-stop
+		srv.Close()
+	}()
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.collect()
+			}
+		}
+	}()
+	return nil
+}
+
+// Finish marks the run as over after a last sample, so the final counts are
+// what scrapes see from now on
+func (e *Exporter) Finish() {
+	e.collect()
+	e.mu.Lock()
+	e.active = false
+	e.perSec = [3]float64{}
+	e.mu.Unlock()
+}
+
+// collect samples the run's tasks. A failed query keeps the previous sample.
+func (e *Exporter) collect() {
+	var s sample
+	var latencyQ, executionQ pq.Float64Array
+	err := e.db.QueryRow(`SELECT COUNT(*),
+		COUNT(*) FILTER (WHERE status = 'completed'),
+		COUNT(*) FILTER (WHERE status IN ('failed', 'malicious', 'abandoned', 'cancelled')),
+		COUNT(*) FILTER (WHERE status = 'running'),
+		COUNT(*) FILTER (WHERE status = 'pending'),
+		COUNT(finished),
+		COALESCE(SUM(EXTRACT(EPOCH FROM finished - created_at)), 0),
+		percentile_cont($2::FLOAT8[]) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM finished - created_at)),
+		COUNT(finished - started),
+		COALESCE(SUM(EXTRACT(EPOCH FROM finished - started)), 0),
+		percentile_cont($2::FLOAT8[]) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM finished - started))
+		FROM TASKS WHERE id > $1`, e.startID, pq.Float64Array(quantiles)).Scan(
+		&s.Injected, &s.Completed, &s.Failed, &s.Running, &s.Pending,
+		&s.Latency.Count, &s.Latency.Sum, &latencyQ,
+		&s.Execution.Count, &s.Execution.Sum, &executionQ)
+	if err != nil {
+		return
+	}
+	s.Latency.Quantiles, s.Execution.Quantiles = latencyQ, executionQ
+
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.sampled.IsZero() {
+		secs := now.Sub(e.sampled).Seconds()
+		e.perSec = [3]float64{
+			float64(s.Injected-e.last.Injected) / secs,
+			float64(s.Completed-e.last.Completed) / secs,
+			float64(s.Failed-e.last.Failed) / secs,
+		}
+	}
+	e.last, e.sampled = s, now
+}
+
+// ServeHTTP writes the last sample, as OpenMetrics when the scraper accepts
+// it and in the Prometheus text format otherwise
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+
+	e.mu.Lock()
+	s, perSec, active := e.last, e.perSec, e.active
+	e.mu.Unlock()
+
+	m := metricWriter{w: w, openMetrics: openMetrics, labels: fmt.Sprintf(`suite="%s"`, e.suite)}
+	m.counter("continuum_benchmark_tasks_injected", "Tasks inserted by the run", s.Injected)
+	m.counter("continuum_benchmark_tasks_completed", "Tasks of the run that completed", s.Completed)
+	m.counter("continuum_benchmark_tasks_failed", "Tasks of the run that failed, were cancelled or flagged malicious", s.Failed)
+	m.gauge("continuum_benchmark_tasks_injected_per_second", "Tasks inserted during the last second", perSec[0])
+	m.gauge("continuum_benchmark_tasks_completed_per_second", "Tasks completed during the last second", perSec[1])
+	m.gauge("continuum_benchmark_tasks_failed_per_second", "Tasks failed during the last second", perSec[2])
+	m.gauge("continuum_benchmark_tasks_running", "Tasks of the run being executed", float64(s.Running))
+	m.gauge("continuum_benchmark_tasks_pending", "Tasks of the run waiting for a worker", float64(s.Pending))
+	m.summary("continuum_benchmark_task_latency_seconds", "Time from insertion to finish of the run's tasks", s.Latency)
+	m.summary("continuum_benchmark_task_execution_seconds", "Time from start to finish of the run's tasks", s.Execution)
+	m.gauge("continuum_benchmark_elapsed_seconds", "Time since the run started", time.Since(e.started).Seconds())
+	running := 0.0
+	if active {
+		running = 1
+	}
+	m.gauge("continuum_benchmark_active", "Whether the run is still going (1) or over (0)", running)
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// metricWriter writes metric families, which differ between the two formats
+// only in how counters are declared
+type metricWriter struct {
+	w           io.Writer
+	openMetrics bool
+	labels      string
+}
+
+func (m metricWriter) counter(name, help string, value int64) {
+	family := name
+	if !m.openMetrics {
+		// The Prometheus text format declares the sample name itself
+		family = name + "_total"
+	}
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s counter\n%s_total{%s} %d\n", family, help, family, name, m.labels, value)
+}
+
+func (m metricWriter) gauge(name, help string, value float64) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s gauge\n%s{%s} %g\n", name, help, name, name, m.labels, value)
+}
+
+func (m metricWriter) summary(name, help string, s summary) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s summary\n", name, help, name)
+	for i, q := range s.Quantiles {
+		fmt.Fprintf(m.w, "%s{%s,quantile=\"%g\"} %g\n", name, m.labels, quantiles[i], q)
+	}
+	fmt.Fprintf(m.w, "%s_sum{%s} %g\n%s_count{%s} %d\n", name, m.labels, s.Sum, name, m.labels, s.Count)
+}
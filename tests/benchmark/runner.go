@@ -24,7 +24,7 @@ import (
 	_ "github.com/lib/pq"
 )
 
-// GlobalStats matches the structure from server.go
+// GlobalStats matches the structure from src/stats
 type GlobalStats struct {
 	TotalTasks      int     `json:"total_tasks"`
 	PendingTasks    int     `json:"pending_tasks"`
@@ -51,6 +51,8 @@ func main() {
 	dbHost := flag.String("db_host", "localhost", "Database host")
 	apiHost := flag.String("api_host", "localhost", "Worker API host")
 	apiPort := flag.String("api_port", "8080", "Worker API port")
+	metricsAddr := flag.String("metrics_addr", ":9469", "Address serving the run's live /metrics (empty to disable)")
+	metricsLinger := flag.Duration("metrics_linger", 15*time.Second, "How long /metrics stays up after the run, for a last scrape")
 	flag.Parse()
 
 	if *suite == "" {
@@ -108,6 +110,21 @@ func main() {
 		fmt.Printf("%s[WARN]%s Could not get initial stats: %v. Metrics might be absolute.\n", colorYellow, colorReset, err)
 	}
 
+	// Live metrics of the run, counted from the tasks inserted after this point
+	var exporter *Exporter
+	stopMetrics := make(chan struct{})
+	if *metricsAddr != "" {
+		if exporter, err = NewExporter(db, *suite); err == nil {
+			err = exporter.Serve(*metricsAddr, stopMetrics)
+		}
+		if err != nil {
+			fmt.Printf("%s[WARN]%s Live metrics disabled: %v\n", colorYellow, colorReset, err)
+			exporter = nil
+		} else {
+			fmt.Printf("%s[OK]%s Live metrics served on %s at /metrics\n", colorGreen, colorReset, *metricsAddr)
+		}
+	}
+
 	// 3. Execute SQL to Insert Tasks
 	_, err = db.Exec(string(content))
 	if err != nil {
@@ -160,6 +177,12 @@ func main() {
 				fmt.Printf("\n%s------------------------------------------------------------%s\n", colorGray, colorReset)
 				fmt.Printf("\n%s%s Benchmark Completed Successfully! %s%s\n", colorGreen, colorBold, "✓", colorReset)
 				printReport(stats, initialStats, time.Since(startTime))
+				if exporter != nil {
+					exporter.Finish()
+					fmt.Printf("\n%sServing final metrics for %s...%s\n", colorGray, *metricsLinger, colorReset)
+					time.Sleep(*metricsLinger)
+					close(stopMetrics)
+				}
 				break
 			}
 		}